@@ -17,8 +17,12 @@ limitations under the License.
 package store
 
 import (
+	"bufio"
 	"context"
-	"reflect"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
 	"sort"
 	"strings"
 
@@ -36,10 +40,12 @@ import (
 	storagev1 "k8s.io/api/storage/v1"
 	vpaautoscaling "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/apis/autoscaling.k8s.io/v1beta2"
 	vpaclientset "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/client/clientset/versioned"
+	"k8s.io/client-go/dynamic"
 	clientset "k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/klog"
 
+	"k8s.io/kube-state-metrics/pkg/customresource"
 	"k8s.io/kube-state-metrics/pkg/metric"
 	metricsstore "k8s.io/kube-state-metrics/pkg/metrics_store"
 	"k8s.io/kube-state-metrics/pkg/options"
@@ -62,8 +68,37 @@ type Builder struct {
 	enabledResources []string
 	whiteBlackList   whiteBlackLister
 	metrics          *watch.ListWatchMetrics
+	updatesTotal     *prometheus.CounterVec
 	shard            int32
 	totalShards      int
+	formats          []metricsstore.Format
+	sortedOutput     bool
+	omitEmpty        bool
+	compactStorage   bool
+	keepFamilies     bool
+	deletedRetention options.CollectorDurations
+	markDeleted      bool
+	familyLimits     map[string]int64
+	collectorLimits  map[string]int64
+	snapshotDir      string
+	labelsAllowlist  options.KeyAllowlist
+	listSelectors    map[string]options.ListSelector
+	// annotationsAllowlist enables the kube_<resource>_annotations metric
+	// families of the collectors it contains.
+	annotationsAllowlist options.KeyAllowlist
+	dynamicClient        dynamic.Interface
+	customResources      []customResourceFamilies
+	// discoveryAllowlist enables the discovery of custom resources of the
+	// allowed kinds, if not empty.
+	discoveryAllowlist customresource.Allowlist
+	// families contains the unfiltered metric families of the stores built
+	// so far by collector, to determine the stores affected by a change of
+	// the white- or blacklist.
+	families map[string][]metric.FamilyGenerator
+	// reflectorsSynced contains the HasSynced functions of the reflectors
+	// created for each store by the last BuildCollectors.
+	reflectorsSynced map[cache.Store][]cache.InformerSynced
+	syncStatus       SyncStatus
 }
 
 // NewBuilder returns a new builder.
@@ -72,6 +107,16 @@ func NewBuilder() *Builder { return &Builder{} }
 // WithMetrics sets the metrics property of a Builder.
 func (b *Builder) WithMetrics(r *prometheus.Registry) {
 	b.metrics = watch.NewListWatchMetrics(r)
+	b.updatesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kube_state_metrics_store_updates_total",
+			Help: "Number of total added or updated objects in kube-state-metrics, by result (skipped if the resource version is unchanged, unchanged if the regenerated metrics are unchanged, or regenerated).",
+		},
+		[]string{"result", "resource"},
+	)
+	if r != nil {
+		r.MustRegister(b.updatesTotal)
+	}
 }
 
 // WithEnabledResources sets the enabledResources property of a Builder.
@@ -102,6 +147,160 @@ func (b *Builder) WithSharding(shard int32, totalShards int) {
 	b.totalShards = totalShards
 }
 
+// WithFormats sets the exposition formats the stores built by the Builder
+// render metrics in, in addition to the default ones.
+func (b *Builder) WithFormats(f []metricsstore.Format) {
+	b.formats = f
+}
+
+// WithSortedOutput makes the stores built by the Builder write the metrics of
+// their objects ordered by namespace and name.
+func (b *Builder) WithSortedOutput(sorted bool) {
+	b.sortedOutput = sorted
+}
+
+// WithOmitEmptyFamilies makes the stores built by the Builder skip the headers
+// of metric families without any metrics.
+func (b *Builder) WithOmitEmptyFamilies(omit bool) {
+	b.omitEmpty = omit
+}
+
+// WithCompactStorage makes the stores built by the Builder keep their metrics
+// in the compact representation, rendering them on every write.
+func (b *Builder) WithCompactStorage(compact bool) {
+	b.compactStorage = compact
+}
+
+// WithKeptFamilies makes the stores built by the Builder keep the generated
+// metric families of every object, so that they can be walked by exporters,
+// see metricsstore.MetricsStore.KeepFamilies.
+func (b *Builder) WithKeptFamilies(keep bool) {
+	b.keepFamilies = keep
+}
+
+// WithDeletedObjectRetention makes the stores of the given collectors built by
+// the Builder retain the metrics of deleted objects for the given duration,
+// optionally marked with the label deleted="true".
+func (b *Builder) WithDeletedObjectRetention(retention options.CollectorDurations, mark bool) error {
+	for col := range retention {
+		if !collectorExists(col) {
+			return errors.Errorf("collector %s does not exist. Available collectors: %s", col, strings.Join(availableCollectors(), ","))
+		}
+	}
+
+	b.deletedRetention = retention
+	b.markDeleted = mark
+	return nil
+}
+
+// WithSeriesLimits limits the number of series of the metric families with the
+// given names and of all metric families of the stores of the given collectors
+// built by the Builder. Custom resources have to be configured before.
+func (b *Builder) WithSeriesLimits(familyLimits, collectorLimits map[string]int) error {
+	known := b.knownFamilies()
+	b.familyLimits = make(map[string]int64, len(familyLimits))
+	for family, limit := range familyLimits {
+		if !known[family] {
+			return errors.Errorf("metric family %s does not exist", family)
+		}
+		if limit < 0 {
+			return errors.Errorf("series limit of metric family %s must not be negative: %d", family, limit)
+		}
+		b.familyLimits[family] = int64(limit)
+	}
+
+	b.collectorLimits = make(map[string]int64, len(collectorLimits))
+	for col, limit := range collectorLimits {
+		if !collectorExists(col) {
+			return errors.Errorf("collector %s does not exist. Available collectors: %s", col, strings.Join(availableCollectors(), ","))
+		}
+		if limit < 0 {
+			return errors.Errorf("series limit of collector %s must not be negative: %d", col, limit)
+		}
+		b.collectorLimits[col] = int64(limit)
+	}
+	return nil
+}
+
+// WithLabelsAllowlist restricts the Kubernetes labels exposed by the
+// kube_<resource>_labels metric families of the stores of the given
+// collectors built by the Builder to the allowed keys. The labels of other
+// collectors are exposed unrestricted.
+func (b *Builder) WithLabelsAllowlist(l options.KeyAllowlist) error {
+	for col := range l {
+		if !collectorExists(col) {
+			return errors.Errorf("collector %s does not exist. Available collectors: %s", col, strings.Join(availableCollectors(), ","))
+		}
+		if !exposesLabels(col) {
+			return errors.Errorf("collector %s does not expose any labels", col)
+		}
+	}
+
+	b.labelsAllowlist = l
+	return nil
+}
+
+// WithAnnotationsAllowlist makes the stores of the given collectors built by
+// the Builder expose the Kubernetes annotations with the allowed keys by
+// kube_<resource>_annotations metric families. Other collectors expose no
+// annotations.
+func (b *Builder) WithAnnotationsAllowlist(l options.KeyAllowlist) error {
+	for col := range l {
+		if !collectorExists(col) {
+			return errors.Errorf("collector %s does not exist. Available collectors: %s", col, strings.Join(availableCollectors(), ","))
+		}
+	}
+
+	b.annotationsAllowlist = l
+	return nil
+}
+
+// WithListSelectors restricts the objects listed and watched by the stores of
+// the given collectors or custom resources built by the Builder to the ones
+// matching the given selectors. Custom resources have to be configured
+// before.
+func (b *Builder) WithListSelectors(selectors map[string]options.ListSelector) error {
+	if err := b.validateListSelectors(selectors); err != nil {
+		return err
+	}
+
+	b.listSelectors = selectors
+	return nil
+}
+
+// validateListSelectors returns an error if any of the given selectors can not
+// be parsed or is given for an unknown collector.
+func (b *Builder) validateListSelectors(selectors map[string]options.ListSelector) error {
+	for col, s := range selectors {
+		if !collectorExists(col) && !b.hasCustomResource(col) {
+			return errors.Errorf("collector %s does not exist. Available collectors: %s", col, strings.Join(availableCollectors(), ","))
+		}
+		if err := validateListSelector(s); err != nil {
+			return errors.Wrapf(err, "invalid selector of collector %s", col)
+		}
+	}
+	return nil
+}
+
+// hasCustomResource returns whether a custom resource with the given name is
+// configured.
+func (b *Builder) hasCustomResource(name string) bool {
+	for _, r := range b.customResources {
+		if r.resource.Name() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// WithSnapshotDir makes the Builder restore the stores it builds from the
+// snapshots in the given directory, if any, see
+// metricsstore.MetricsStore.RestoreSnapshot. An empty directory disables
+// restoring, e.g. for stores rebuilt at runtime.
+func (b *Builder) WithSnapshotDir(dir string) {
+	b.snapshotDir = dir
+}
+
 // WithContext sets the ctx property of a Builder.
 func (b *Builder) WithContext(ctx context.Context) {
 	b.ctx = ctx
@@ -117,62 +316,302 @@ func (b *Builder) WithVPAClient(c vpaclientset.Interface) {
 	b.vpaClient = c
 }
 
+// WithCustomResources makes the Builder build a store for each of the given
+// custom resources in addition to the enabled collectors, listing and
+// watching them with the given dynamic client.
+func (b *Builder) WithCustomResources(resources []customresource.Resource, c dynamic.Interface) error {
+	config := customresource.Config{Resources: resources}
+	if err := config.Validate(); err != nil {
+		return err
+	}
+
+	builtin := builtinFamilies()
+	b.customResources = nil
+	for _, r := range resources {
+		if collectorExists(r.Name()) {
+			return errors.Errorf("custom resource %s conflicts with the collector of the same name", r.Name())
+		}
+		families, err := customresource.FamilyGenerators(r)
+		if err != nil {
+			return errors.Wrapf(err, "custom resource %s", r.Name())
+		}
+		for _, f := range families {
+			if builtin[f.Name] {
+				return errors.Errorf("custom resource %s: metric %s conflicts with the metric family of the same name of a built-in collector", r.Name(), f.Name)
+			}
+		}
+		b.customResources = append(b.customResources, customResourceFamilies{resource: r, families: families})
+	}
+
+	b.dynamicClient = c
+	return nil
+}
+
 // WithWhiteBlackList configures the white or blacklisted metric to be exposed
 // by the store build by the Builder.
 func (b *Builder) WithWhiteBlackList(l whiteBlackLister) {
 	b.whiteBlackList = l
 }
 
-// Build initializes and registers all enabled stores.
-func (b *Builder) Build() []*metricsstore.MetricsStore {
+// Reconfigure validates and applies the given enabled collectors, namespaces,
+// white- or blacklist and list selectors at runtime. It returns the
+// collectors whose stores have to be (re-)built for the change to take
+// effect, which are the newly enabled collectors, all collectors if the
+// namespaces changed, and the collectors whose exposed metric families or
+// selector changed. If the configuration is invalid, an error is returned and
+// the Builder is left unchanged.
+func (b *Builder) Reconfigure(collectors []string, namespaces options.NamespaceList, l whiteBlackLister, selectors map[string]options.ListSelector) ([]string, error) {
+	if l == nil {
+		return nil, errors.New("whiteBlackList should not be nil")
+	}
+	if err := b.validateListSelectors(selectors); err != nil {
+		return nil, err
+	}
+
+	previous := map[string]bool{}
+	for _, c := range b.Collectors() {
+		previous[c] = true
+	}
+	if err := b.WithEnabledResources(collectors); err != nil {
+		return nil, err
+	}
+
+	namespacesChanged := !equalNamespaces(b.namespaces, namespaces)
+	rebuild := []string{}
+	for _, c := range b.Collectors() {
+		families, built := b.families[c]
+		if !previous[c] || !built || namespacesChanged || b.listSelectors[c] != selectors[c] ||
+			b.whiteBlackList == nil || !sameFamiliesIncluded(b.whiteBlackList, l, families) {
+			rebuild = append(rebuild, c)
+		}
+	}
+
+	b.namespaces = namespaces
+	b.whiteBlackList = l
+	b.listSelectors = selectors
+	return rebuild, nil
+}
+
+// equalNamespaces returns whether the given namespace lists contain the same
+// namespaces, regardless of their order.
+func equalNamespaces(a, b options.NamespaceList) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	sortedA := append([]string{}, a...)
+	sortedB := append([]string{}, b...)
+	sort.Strings(sortedA)
+	sort.Strings(sortedB)
+	for i := range sortedA {
+		if sortedA[i] != sortedB[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// sameFamiliesIncluded returns whether the given white- or blacklists include
+// the same of the given metric families.
+func sameFamiliesIncluded(a, b whiteBlackLister, families []metric.FamilyGenerator) bool {
+	for _, f := range families {
+		if a.IsIncluded(f.Name) != b.IsIncluded(f.Name) {
+			return false
+		}
+	}
+	return true
+}
+
+// Collectors returns the names of the collectors whose stores are built by
+// the Builder, i.e. the enabled collectors, the configured custom resources and the
+// custom resource discovery, if enabled.
+func (b *Builder) Collectors() []string {
+	collectors := []string{}
+	for _, c := range b.enabledResources {
+		if collectorExists(c) {
+			collectors = append(collectors, c)
+		}
+	}
+	for _, r := range b.customResources {
+		collectors = append(collectors, r.resource.Name())
+	}
+	if len(b.discoveryAllowlist) > 0 {
+		collectors = append(collectors, customResourceDiscoveryCollector)
+	}
+	return collectors
+}
+
+// BuildCollectors initializes and registers the stores of the given collectors
+// out of the ones returned by Collectors, ignoring the others. The stores are
+// returned indexed by the name of their collector.
+func (b *Builder) BuildCollectors(collectors []string) map[string]*metricsstore.MetricsStore {
 	if b.whiteBlackList == nil {
 		panic("whiteBlackList should not be nil")
 	}
 
-	stores := []*metricsstore.MetricsStore{}
-	activeStoreNames := []string{}
+	stores := map[string]*metricsstore.MetricsStore{}
+	b.reflectorsSynced = map[cache.Store][]cache.InformerSynced{}
+	b.syncStatus = SyncStatus{}
+	if b.families == nil {
+		b.families = map[string][]metric.FamilyGenerator{}
+	}
+
+	build := map[string]bool{}
+	for _, c := range collectors {
+		build[c] = true
+	}
 
 	for _, c := range b.enabledResources {
 		constructor, ok := availableStores[c]
-		if ok {
-			store := constructor(b)
-			activeStoreNames = append(activeStoreNames, c)
-			stores = append(stores, store)
+		if ok && build[c] {
+			store := constructor(b, c)
+			stores[c] = store
+			b.syncStatus[c] = b.reflectorsSynced[store]
 		}
 	}
 
-	klog.Infof("Active collectors: %s", strings.Join(activeStoreNames, ","))
+	for _, r := range b.customResources {
+		c := r.resource.Name()
+		if !build[c] {
+			continue
+		}
+		store := b.buildCustomResourceStore(r)
+		stores[c] = store
+		b.syncStatus[c] = b.reflectorsSynced[store]
+	}
+
+	if len(b.discoveryAllowlist) > 0 && build[customResourceDiscoveryCollector] {
+		c := customResourceDiscoveryCollector
+		store := b.buildCustomResourceDiscoveryStore()
+		stores[c] = store
+		b.syncStatus[c] = b.reflectorsSynced[store]
+	}
 
 	return stores
 }
 
-var availableStores = map[string]func(f *Builder) *metricsstore.MetricsStore{
-	"certificatesigningrequests":      func(b *Builder) *metricsstore.MetricsStore { return b.buildCsrStore() },
-	"configmaps":                      func(b *Builder) *metricsstore.MetricsStore { return b.buildConfigMapStore() },
-	"cronjobs":                        func(b *Builder) *metricsstore.MetricsStore { return b.buildCronJobStore() },
-	"daemonsets":                      func(b *Builder) *metricsstore.MetricsStore { return b.buildDaemonSetStore() },
-	"deployments":                     func(b *Builder) *metricsstore.MetricsStore { return b.buildDeploymentStore() },
-	"endpoints":                       func(b *Builder) *metricsstore.MetricsStore { return b.buildEndpointsStore() },
-	"horizontalpodautoscalers":        func(b *Builder) *metricsstore.MetricsStore { return b.buildHPAStore() },
-	"ingresses":                       func(b *Builder) *metricsstore.MetricsStore { return b.buildIngressStore() },
-	"jobs":                            func(b *Builder) *metricsstore.MetricsStore { return b.buildJobStore() },
-	"limitranges":                     func(b *Builder) *metricsstore.MetricsStore { return b.buildLimitRangeStore() },
-	"mutatingwebhookconfigurations":   func(b *Builder) *metricsstore.MetricsStore { return b.buildMutatingWebhookConfigurationStore() },
-	"namespaces":                      func(b *Builder) *metricsstore.MetricsStore { return b.buildNamespaceStore() },
-	"nodes":                           func(b *Builder) *metricsstore.MetricsStore { return b.buildNodeStore() },
-	"persistentvolumeclaims":          func(b *Builder) *metricsstore.MetricsStore { return b.buildPersistentVolumeClaimStore() },
-	"persistentvolumes":               func(b *Builder) *metricsstore.MetricsStore { return b.buildPersistentVolumeStore() },
-	"poddisruptionbudgets":            func(b *Builder) *metricsstore.MetricsStore { return b.buildPodDisruptionBudgetStore() },
-	"pods":                            func(b *Builder) *metricsstore.MetricsStore { return b.buildPodStore() },
-	"replicasets":                     func(b *Builder) *metricsstore.MetricsStore { return b.buildReplicaSetStore() },
-	"replicationcontrollers":          func(b *Builder) *metricsstore.MetricsStore { return b.buildReplicationControllerStore() },
-	"resourcequotas":                  func(b *Builder) *metricsstore.MetricsStore { return b.buildResourceQuotaStore() },
-	"secrets":                         func(b *Builder) *metricsstore.MetricsStore { return b.buildSecretStore() },
-	"services":                        func(b *Builder) *metricsstore.MetricsStore { return b.buildServiceStore() },
-	"statefulsets":                    func(b *Builder) *metricsstore.MetricsStore { return b.buildStatefulSetStore() },
-	"storageclasses":                  func(b *Builder) *metricsstore.MetricsStore { return b.buildStorageClassStore() },
-	"validatingwebhookconfigurations": func(b *Builder) *metricsstore.MetricsStore { return b.buildValidatingWebhookConfigurationStore() },
-	"verticalpodautoscalers":          func(b *Builder) *metricsstore.MetricsStore { return b.buildVPAStore() },
+// SyncStatus returns the sync status of the reflectors of the stores created
+// by the last BuildCollectors.
+func (b *Builder) SyncStatus() SyncStatus {
+	return b.syncStatus
+}
+
+var availableStores = map[string]func(b *Builder, collector string) *metricsstore.MetricsStore{
+	"certificatesigningrequests": func(b *Builder, c string) *metricsstore.MetricsStore { return b.buildCsrStore(c) },
+	"configmaps":                 func(b *Builder, c string) *metricsstore.MetricsStore { return b.buildConfigMapStore(c) },
+	"cronjobs":                   func(b *Builder, c string) *metricsstore.MetricsStore { return b.buildCronJobStore(c) },
+	"daemonsets":                 func(b *Builder, c string) *metricsstore.MetricsStore { return b.buildDaemonSetStore(c) },
+	"deployments":                func(b *Builder, c string) *metricsstore.MetricsStore { return b.buildDeploymentStore(c) },
+	"endpoints":                  func(b *Builder, c string) *metricsstore.MetricsStore { return b.buildEndpointsStore(c) },
+	"horizontalpodautoscalers":   func(b *Builder, c string) *metricsstore.MetricsStore { return b.buildHPAStore(c) },
+	"ingresses":                  func(b *Builder, c string) *metricsstore.MetricsStore { return b.buildIngressStore(c) },
+	"jobs":                       func(b *Builder, c string) *metricsstore.MetricsStore { return b.buildJobStore(c) },
+	"limitranges":                func(b *Builder, c string) *metricsstore.MetricsStore { return b.buildLimitRangeStore(c) },
+	"mutatingwebhookconfigurations": func(b *Builder, c string) *metricsstore.MetricsStore {
+		return b.buildMutatingWebhookConfigurationStore(c)
+	},
+	"namespaces":             func(b *Builder, c string) *metricsstore.MetricsStore { return b.buildNamespaceStore(c) },
+	"nodes":                  func(b *Builder, c string) *metricsstore.MetricsStore { return b.buildNodeStore(c) },
+	"persistentvolumeclaims": func(b *Builder, c string) *metricsstore.MetricsStore { return b.buildPersistentVolumeClaimStore(c) },
+	"persistentvolumes":      func(b *Builder, c string) *metricsstore.MetricsStore { return b.buildPersistentVolumeStore(c) },
+	"poddisruptionbudgets":   func(b *Builder, c string) *metricsstore.MetricsStore { return b.buildPodDisruptionBudgetStore(c) },
+	"pods":                   func(b *Builder, c string) *metricsstore.MetricsStore { return b.buildPodStore(c) },
+	"replicasets":            func(b *Builder, c string) *metricsstore.MetricsStore { return b.buildReplicaSetStore(c) },
+	"replicationcontrollers": func(b *Builder, c string) *metricsstore.MetricsStore { return b.buildReplicationControllerStore(c) },
+	"resourcequotas":         func(b *Builder, c string) *metricsstore.MetricsStore { return b.buildResourceQuotaStore(c) },
+	"secrets":                func(b *Builder, c string) *metricsstore.MetricsStore { return b.buildSecretStore(c) },
+	"services":               func(b *Builder, c string) *metricsstore.MetricsStore { return b.buildServiceStore(c) },
+	"statefulsets":           func(b *Builder, c string) *metricsstore.MetricsStore { return b.buildStatefulSetStore(c) },
+	"storageclasses":         func(b *Builder, c string) *metricsstore.MetricsStore { return b.buildStorageClassStore(c) },
+	"validatingwebhookconfigurations": func(b *Builder, c string) *metricsstore.MetricsStore {
+		return b.buildValidatingWebhookConfigurationStore(c)
+	},
+	"verticalpodautoscalers": func(b *Builder, c string) *metricsstore.MetricsStore { return b.buildVPAStore(c) },
+}
+
+// availableFamilies contains the functions returning the metric families of
+// each collector, given the allowed keys of the Kubernetes labels and
+// annotations of its objects.
+var availableFamilies = map[string]func(allowLabels, allowAnnotations []string) []metric.FamilyGenerator{
+	"certificatesigningrequests": csrMetricFamilies,
+	"configmaps": func(_, allowAnnotations []string) []metric.FamilyGenerator {
+		return configMapMetricFamilies(allowAnnotations)
+	},
+	"cronjobs":                 cronJobMetricFamilies,
+	"daemonsets":               daemonSetMetricFamilies,
+	"deployments":              deploymentMetricFamilies,
+	"endpoints":                endpointMetricFamilies,
+	"horizontalpodautoscalers": hpaMetricFamilies,
+	"ingresses":                ingressMetricFamilies,
+	"jobs":                     jobMetricFamilies,
+	"limitranges": func(_, allowAnnotations []string) []metric.FamilyGenerator {
+		return limitRangeMetricFamilies(allowAnnotations)
+	},
+	"mutatingwebhookconfigurations": func(_, allowAnnotations []string) []metric.FamilyGenerator {
+		return mutatingWebhookConfigurationMetricFamilies(allowAnnotations)
+	},
+	"namespaces":             namespaceMetricFamilies,
+	"nodes":                  nodeMetricFamilies,
+	"persistentvolumeclaims": persistentVolumeClaimMetricFamilies,
+	"persistentvolumes":      persistentVolumeMetricFamilies,
+	"poddisruptionbudgets": func(_, allowAnnotations []string) []metric.FamilyGenerator {
+		return podDisruptionBudgetMetricFamilies(allowAnnotations)
+	},
+	"pods":        podMetricFamilies,
+	"replicasets": replicaSetMetricFamilies,
+	"replicationcontrollers": func(_, allowAnnotations []string) []metric.FamilyGenerator {
+		return replicationControllerMetricFamilies(allowAnnotations)
+	},
+	"resourcequotas": func(_, allowAnnotations []string) []metric.FamilyGenerator {
+		return resourceQuotaMetricFamilies(allowAnnotations)
+	},
+	"secrets":        secretMetricFamilies,
+	"services":       serviceMetricFamilies,
+	"statefulsets":   statefulSetMetricFamilies,
+	"storageclasses": storageClassMetricFamilies,
+	"validatingwebhookconfigurations": func(_, allowAnnotations []string) []metric.FamilyGenerator {
+		return validatingWebhookConfigurationMetricFamilies(allowAnnotations)
+	},
+	"verticalpodautoscalers": vpaMetricFamilies,
+}
+
+// exposesLabels returns whether the given built-in collector exposes the
+// Kubernetes labels of its objects, i.e. has a kube_<resource>_labels metric
+// family.
+func exposesLabels(collector string) bool {
+	for _, f := range availableFamilies[collector](nil, nil) {
+		if strings.HasSuffix(f.Name, "_labels") {
+			return true
+		}
+	}
+	return false
+}
+
+// builtinFamilies returns the names of the metric families of all built-in
+// collectors, including the optional ones, and of the custom resource
+// discovery.
+func builtinFamilies() map[string]bool {
+	names := map[string]bool{}
+	for _, families := range availableFamilies {
+		for _, f := range families(nil, []string{}) {
+			names[f.Name] = true
+		}
+	}
+	for _, f := range customResourceMetricFamilies {
+		names[f.Name] = true
+	}
+	return names
+}
+
+// knownFamilies returns the names of the metric families of the built-in
+// collectors and of the configured custom resources.
+func (b *Builder) knownFamilies() map[string]bool {
+	names := builtinFamilies()
+	for _, r := range b.customResources {
+		for _, f := range r.families {
+			names[f.Name] = true
+		}
+	}
+	return names
 }
 
 func collectorExists(name string) bool {
@@ -188,140 +627,257 @@ func availableCollectors() []string {
 	return c
 }
 
-func (b *Builder) buildConfigMapStore() *metricsstore.MetricsStore {
-	return b.buildStore(configMapMetricFamilies, &v1.ConfigMap{}, createConfigMapListWatch)
+func (b *Builder) buildConfigMapStore(collector string) *metricsstore.MetricsStore {
+	return b.buildStore(collector, b.collectorFamilies(collector), &v1.ConfigMap{}, createConfigMapListWatch)
+}
+
+func (b *Builder) buildCronJobStore(collector string) *metricsstore.MetricsStore {
+	return b.buildStore(collector, b.collectorFamilies(collector), &batchv1beta1.CronJob{}, createCronJobListWatch)
 }
 
-func (b *Builder) buildCronJobStore() *metricsstore.MetricsStore {
-	return b.buildStore(cronJobMetricFamilies, &batchv1beta1.CronJob{}, createCronJobListWatch)
+func (b *Builder) buildDaemonSetStore(collector string) *metricsstore.MetricsStore {
+	return b.buildStore(collector, b.collectorFamilies(collector), &appsv1.DaemonSet{}, createDaemonSetListWatch)
 }
 
-func (b *Builder) buildDaemonSetStore() *metricsstore.MetricsStore {
-	return b.buildStore(daemonSetMetricFamilies, &appsv1.DaemonSet{}, createDaemonSetListWatch)
+func (b *Builder) buildDeploymentStore(collector string) *metricsstore.MetricsStore {
+	return b.buildStore(collector, b.collectorFamilies(collector), &appsv1.Deployment{}, createDeploymentListWatch)
 }
 
-func (b *Builder) buildDeploymentStore() *metricsstore.MetricsStore {
-	return b.buildStore(deploymentMetricFamilies, &appsv1.Deployment{}, createDeploymentListWatch)
+func (b *Builder) buildEndpointsStore(collector string) *metricsstore.MetricsStore {
+	return b.buildStore(collector, b.collectorFamilies(collector), &v1.Endpoints{}, createEndpointsListWatch)
 }
 
-func (b *Builder) buildEndpointsStore() *metricsstore.MetricsStore {
-	return b.buildStore(endpointMetricFamilies, &v1.Endpoints{}, createEndpointsListWatch)
+func (b *Builder) buildHPAStore(collector string) *metricsstore.MetricsStore {
+	return b.buildStore(collector, b.collectorFamilies(collector), &autoscaling.HorizontalPodAutoscaler{}, createHPAListWatch)
 }
 
-func (b *Builder) buildHPAStore() *metricsstore.MetricsStore {
-	return b.buildStore(hpaMetricFamilies, &autoscaling.HorizontalPodAutoscaler{}, createHPAListWatch)
+func (b *Builder) buildIngressStore(collector string) *metricsstore.MetricsStore {
+	return b.buildStore(collector, b.collectorFamilies(collector), &extensions.Ingress{}, createIngressListWatch)
 }
 
-func (b *Builder) buildIngressStore() *metricsstore.MetricsStore {
-	return b.buildStore(ingressMetricFamilies, &extensions.Ingress{}, createIngressListWatch)
+func (b *Builder) buildJobStore(collector string) *metricsstore.MetricsStore {
+	return b.buildStore(collector, b.collectorFamilies(collector), &batchv1.Job{}, createJobListWatch)
 }
 
-func (b *Builder) buildJobStore() *metricsstore.MetricsStore {
-	return b.buildStore(jobMetricFamilies, &batchv1.Job{}, createJobListWatch)
+func (b *Builder) buildLimitRangeStore(collector string) *metricsstore.MetricsStore {
+	return b.buildStore(collector, b.collectorFamilies(collector), &v1.LimitRange{}, createLimitRangeListWatch)
 }
 
-func (b *Builder) buildLimitRangeStore() *metricsstore.MetricsStore {
-	return b.buildStore(limitRangeMetricFamilies, &v1.LimitRange{}, createLimitRangeListWatch)
+func (b *Builder) buildMutatingWebhookConfigurationStore(collector string) *metricsstore.MetricsStore {
+	return b.buildStore(collector, b.collectorFamilies(collector), &admissionregistration.MutatingWebhookConfiguration{}, createMutatingWebhookConfigurationListWatch)
 }
 
-func (b *Builder) buildMutatingWebhookConfigurationStore() *metricsstore.MetricsStore {
-	return b.buildStore(mutatingWebhookConfigurationMetricFamilies, &admissionregistration.MutatingWebhookConfiguration{}, createMutatingWebhookConfigurationListWatch)
+func (b *Builder) buildNamespaceStore(collector string) *metricsstore.MetricsStore {
+	return b.buildStore(collector, b.collectorFamilies(collector), &v1.Namespace{}, createNamespaceListWatch)
 }
 
-func (b *Builder) buildNamespaceStore() *metricsstore.MetricsStore {
-	return b.buildStore(namespaceMetricFamilies, &v1.Namespace{}, createNamespaceListWatch)
+func (b *Builder) buildNodeStore(collector string) *metricsstore.MetricsStore {
+	return b.buildStore(collector, b.collectorFamilies(collector), &v1.Node{}, createNodeListWatch)
 }
 
-func (b *Builder) buildNodeStore() *metricsstore.MetricsStore {
-	return b.buildStore(nodeMetricFamilies, &v1.Node{}, createNodeListWatch)
+func (b *Builder) buildPersistentVolumeClaimStore(collector string) *metricsstore.MetricsStore {
+	return b.buildStore(collector, b.collectorFamilies(collector), &v1.PersistentVolumeClaim{}, createPersistentVolumeClaimListWatch)
 }
 
-func (b *Builder) buildPersistentVolumeClaimStore() *metricsstore.MetricsStore {
-	return b.buildStore(persistentVolumeClaimMetricFamilies, &v1.PersistentVolumeClaim{}, createPersistentVolumeClaimListWatch)
+func (b *Builder) buildPersistentVolumeStore(collector string) *metricsstore.MetricsStore {
+	return b.buildStore(collector, b.collectorFamilies(collector), &v1.PersistentVolume{}, createPersistentVolumeListWatch)
 }
 
-func (b *Builder) buildPersistentVolumeStore() *metricsstore.MetricsStore {
-	return b.buildStore(persistentVolumeMetricFamilies, &v1.PersistentVolume{}, createPersistentVolumeListWatch)
+func (b *Builder) buildPodDisruptionBudgetStore(collector string) *metricsstore.MetricsStore {
+	return b.buildStore(collector, b.collectorFamilies(collector), &policy.PodDisruptionBudget{}, createPodDisruptionBudgetListWatch)
 }
 
-func (b *Builder) buildPodDisruptionBudgetStore() *metricsstore.MetricsStore {
-	return b.buildStore(podDisruptionBudgetMetricFamilies, &policy.PodDisruptionBudget{}, createPodDisruptionBudgetListWatch)
+func (b *Builder) buildReplicaSetStore(collector string) *metricsstore.MetricsStore {
+	return b.buildStore(collector, b.collectorFamilies(collector), &appsv1.ReplicaSet{}, createReplicaSetListWatch)
 }
 
-func (b *Builder) buildReplicaSetStore() *metricsstore.MetricsStore {
-	return b.buildStore(replicaSetMetricFamilies, &appsv1.ReplicaSet{}, createReplicaSetListWatch)
+func (b *Builder) buildReplicationControllerStore(collector string) *metricsstore.MetricsStore {
+	return b.buildStore(collector, b.collectorFamilies(collector), &v1.ReplicationController{}, createReplicationControllerListWatch)
 }
 
-func (b *Builder) buildReplicationControllerStore() *metricsstore.MetricsStore {
-	return b.buildStore(replicationControllerMetricFamilies, &v1.ReplicationController{}, createReplicationControllerListWatch)
+func (b *Builder) buildResourceQuotaStore(collector string) *metricsstore.MetricsStore {
+	return b.buildStore(collector, b.collectorFamilies(collector), &v1.ResourceQuota{}, createResourceQuotaListWatch)
 }
 
-func (b *Builder) buildResourceQuotaStore() *metricsstore.MetricsStore {
-	return b.buildStore(resourceQuotaMetricFamilies, &v1.ResourceQuota{}, createResourceQuotaListWatch)
+func (b *Builder) buildSecretStore(collector string) *metricsstore.MetricsStore {
+	return b.buildStore(collector, b.collectorFamilies(collector), &v1.Secret{}, createSecretListWatch)
 }
 
-func (b *Builder) buildSecretStore() *metricsstore.MetricsStore {
-	return b.buildStore(secretMetricFamilies, &v1.Secret{}, createSecretListWatch)
+func (b *Builder) buildServiceStore(collector string) *metricsstore.MetricsStore {
+	return b.buildStore(collector, b.collectorFamilies(collector), &v1.Service{}, createServiceListWatch)
 }
 
-func (b *Builder) buildServiceStore() *metricsstore.MetricsStore {
-	return b.buildStore(serviceMetricFamilies, &v1.Service{}, createServiceListWatch)
+func (b *Builder) buildStatefulSetStore(collector string) *metricsstore.MetricsStore {
+	return b.buildStore(collector, b.collectorFamilies(collector), &appsv1.StatefulSet{}, createStatefulSetListWatch)
 }
 
-func (b *Builder) buildStatefulSetStore() *metricsstore.MetricsStore {
-	return b.buildStore(statefulSetMetricFamilies, &appsv1.StatefulSet{}, createStatefulSetListWatch)
+func (b *Builder) buildStorageClassStore(collector string) *metricsstore.MetricsStore {
+	return b.buildStore(collector, b.collectorFamilies(collector), &storagev1.StorageClass{}, createStorageClassListWatch)
 }
 
-func (b *Builder) buildStorageClassStore() *metricsstore.MetricsStore {
-	return b.buildStore(storageClassMetricFamilies, &storagev1.StorageClass{}, createStorageClassListWatch)
+func (b *Builder) buildPodStore(collector string) *metricsstore.MetricsStore {
+	return b.buildStore(collector, b.collectorFamilies(collector), &v1.Pod{}, createPodListWatch)
 }
 
-func (b *Builder) buildPodStore() *metricsstore.MetricsStore {
-	return b.buildStore(podMetricFamilies, &v1.Pod{}, createPodListWatch)
+func (b *Builder) buildCsrStore(collector string) *metricsstore.MetricsStore {
+	return b.buildStore(collector, b.collectorFamilies(collector), &certv1beta1.CertificateSigningRequest{}, createCSRListWatch)
 }
 
-func (b *Builder) buildCsrStore() *metricsstore.MetricsStore {
-	return b.buildStore(csrMetricFamilies, &certv1beta1.CertificateSigningRequest{}, createCSRListWatch)
+func (b *Builder) buildValidatingWebhookConfigurationStore(collector string) *metricsstore.MetricsStore {
+	return b.buildStore(collector, b.collectorFamilies(collector), &admissionregistration.ValidatingWebhookConfiguration{}, createValidatingWebhookConfigurationListWatch)
 }
 
-func (b *Builder) buildValidatingWebhookConfigurationStore() *metricsstore.MetricsStore {
-	return b.buildStore(validatingWebhookConfigurationMetricFamilies, &admissionregistration.ValidatingWebhookConfiguration{}, createValidatingWebhookConfigurationListWatch)
+func (b *Builder) buildVPAStore(collector string) *metricsstore.MetricsStore {
+	return b.buildStore(collector, b.collectorFamilies(collector), &vpaautoscaling.VerticalPodAutoscaler{}, createVPAListWatchFunc(b.vpaClient))
 }
 
-func (b *Builder) buildVPAStore() *metricsstore.MetricsStore {
-	return b.buildStore(vpaMetricFamilies, &vpaautoscaling.VerticalPodAutoscaler{}, createVPAListWatchFunc(b.vpaClient))
+// collectorFamilies returns the metric families of the given built-in
+// collector, exposing the allowed labels and annotations.
+func (b *Builder) collectorFamilies(collector string) []metric.FamilyGenerator {
+	return availableFamilies[collector](b.labelsAllowlist[collector], b.annotationsAllowlist[collector])
 }
 
 func (b *Builder) buildStore(
+	collector string,
 	metricFamilies []metric.FamilyGenerator,
 	expectedType interface{},
 	listWatchFunc func(kubeClient clientset.Interface, ns string) cache.ListerWatcher,
 ) *metricsstore.MetricsStore {
+	store := b.newStore(collector, metricFamilies, expectedType)
+	if b.snapshotDir != "" {
+		b.restoreSnapshot(collector, store)
+	}
+	b.reflectorPerNamespace(collector, expectedType, store, listWatchFunc)
+
+	return store
+}
+
+// newStore creates the store of the given collector with the given metric
+// families of objects of the given type, configured like all stores built by
+// the Builder.
+func (b *Builder) newStore(collector string, metricFamilies []metric.FamilyGenerator, expectedType interface{}) *metricsstore.MetricsStore {
+	if b.families != nil {
+		b.families[collector] = metricFamilies
+	}
 	filteredMetricFamilies := metric.FilterMetricFamilies(b.whiteBlackList, metricFamilies)
 	composedMetricGenFuncs := metric.ComposeMetricGenFuncs(filteredMetricFamilies)
 
-	familyHeaders := metric.ExtractMetricFamilyHeaders(filteredMetricFamilies)
+	familyHeaders := metric.ExtractMetricFamilyFormatHeaders(filteredMetricFamilies)
 
-	store := metricsstore.NewMetricsStore(
+	store := metricsstore.NewMetricsStoreWithHeaders(
 		familyHeaders,
 		composedMetricGenFuncs,
 	)
-	b.reflectorPerNamespace(expectedType, store, listWatchFunc)
+	for _, f := range b.formats {
+		store.EnableFormat(f)
+	}
+	if b.sortedOutput {
+		store.EnableSortedOutput()
+	}
+	if b.omitEmpty {
+		store.OmitEmptyFamilies()
+	}
+	if b.compactStorage {
+		store.EnableCompactStorage()
+	}
+	if b.keepFamilies {
+		store.KeepFamilies()
+	}
+	if d, ok := b.deletedRetention[collector]; ok {
+		store.RetainDeleted(d, b.markDeleted)
+	}
+	if len(b.familyLimits) > 0 || b.collectorLimits[collector] > 0 {
+		store.LimitSeries(b.familyLimits, b.collectorLimits[collector])
+	}
+	store.ScopeSnapshots(b.snapshotScope(collector))
+	if b.updatesTotal != nil {
+		updatesTotal := b.updatesTotal.MustCurryWith(prometheus.Labels{"resource": typeName(expectedType)})
+		store.ObserveUpdates(func(r metricsstore.UpdateResult) {
+			updatesTotal.WithLabelValues(string(r)).Inc()
+		})
+	}
 
 	return store
 }
 
+// snapshotScope returns the scope of the snapshots of the store of the given
+// collector, consisting of the namespaces and the selector its objects are
+// listed with, the label and annotation keys exposed by its metrics and the
+// hash of the configuration of its custom resource, if any.
+func (b *Builder) snapshotScope(collector string) string {
+	selector := b.listSelectors[collector]
+	scope := fmt.Sprintf("namespaces=%q labelSelector=%q fieldSelector=%q labels=%q annotations=%q",
+		sortedJoin(b.namespaces), selector.LabelSelector, selector.FieldSelector,
+		sortedJoin(b.labelsAllowlist[collector]), sortedJoin(b.annotationsAllowlist[collector]))
+
+	for _, r := range b.customResources {
+		if r.resource.Name() == collector {
+			// The configuration consists of plain values, hence marshaling
+			// it cannot fail.
+			config, _ := json.Marshal(r.resource)
+			scope += fmt.Sprintf(" customResource=%x", sha256.Sum256(config))
+		}
+	}
+	return scope
+}
+
+// sortedJoin joins the given values in sorted order with commas.
+func sortedJoin(values []string) string {
+	sorted := append([]string{}, values...)
+	sort.Strings(sorted)
+	return strings.Join(sorted, ",")
+}
+
+// restoreSnapshot restores the given store of the given collector from its
+// snapshot, if any. Failing to restore it is not fatal, as the store is filled
+// by its reflectors anyway.
+func (b *Builder) restoreSnapshot(collector string, store *metricsstore.MetricsStore) {
+	path := metricsstore.SnapshotFile(b.snapshotDir, collector, b.shard, b.totalShards)
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return
+	}
+	if err != nil {
+		klog.Warningf("Failed to open snapshot of collector %s: %v", collector, err)
+		return
+	}
+	defer f.Close()
+
+	if err := store.RestoreSnapshot(bufio.NewReader(f)); err != nil {
+		klog.Warningf("Failed to restore snapshot of collector %s from %s: %v", collector, path, err)
+		return
+	}
+	klog.Infof("Restored snapshot of collector %s from %s", collector, path)
+}
+
 // reflectorPerNamespace creates a Kubernetes client-go reflector with the given
-// listWatchFunc for each given namespace and registers it with the given store.
+// listWatchFunc for each given namespace and registers it with the given store
+// of the given collector.
 func (b *Builder) reflectorPerNamespace(
+	collector string,
 	expectedType interface{},
-	store cache.Store,
+	store *metricsstore.MetricsStore,
 	listWatchFunc func(kubeClient clientset.Interface, ns string) cache.ListerWatcher,
 ) {
 	for _, ns := range b.namespaces {
-		lw := listWatchFunc(b.kubeClient, ns)
-		instrumentedListWatch := watch.NewInstrumentedListerWatcher(lw, b.metrics, reflect.TypeOf(expectedType).String())
-		reflector := cache.NewReflector(sharding.NewShardedListWatch(b.shard, b.totalShards, instrumentedListWatch), expectedType, store, 0)
+		lw := newSelectingListWatch(b.listSelectors[collector], listWatchFunc(b.kubeClient, ns))
+		instrumentedListWatch := watch.NewInstrumentedListerWatcher(lw, b.metrics, typeName(expectedType))
+		synced := newSyncTrackingStore(&namespaceStore{MetricsStore: store, namespace: ns})
+		reflector := cache.NewReflector(sharding.NewShardedListWatch(b.shard, b.totalShards, instrumentedListWatch), expectedType, synced, 0)
+		b.reflectorsSynced[store] = append(b.reflectorsSynced[store], synced.HasSynced)
 		go reflector.Run(b.ctx.Done())
 	}
 }
+
+// namespaceStore is the cache.Store of the reflector of a single namespace,
+// whose objects share a MetricsStore with the ones of other namespaces.
+// Replace only replaces the objects the reflector lists.
+type namespaceStore struct {
+	*metricsstore.MetricsStore
+	namespace string
+}
+
+// Replace implements the Replace method of the store interface.
+func (s *namespaceStore) Replace(list []interface{}, _ string) error {
+	return s.MetricsStore.ReplaceNamespace(list, s.namespace)
+}
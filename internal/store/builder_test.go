@@ -0,0 +1,157 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package store
+
+import (
+	"testing"
+
+	"k8s.io/kube-state-metrics/pkg/customresource"
+	"k8s.io/kube-state-metrics/pkg/options"
+)
+
+func TestAvailableFamilies(t *testing.T) {
+	for c := range availableStores {
+		if _, ok := availableFamilies[c]; !ok {
+			t.Errorf("expected metric families of collector %s", c)
+		}
+	}
+	if len(availableFamilies) != len(availableStores) {
+		t.Errorf("expected metric families of %d collectors but got %d", len(availableStores), len(availableFamilies))
+	}
+}
+
+func TestWithSeriesLimits(t *testing.T) {
+	tests := []struct {
+		families map[string]int
+		wantErr  bool
+	}{
+		{families: map[string]int{"kube_pod_info": 10, "kube_pod_annotations": 10, "kube_customresource_status_condition": 10}},
+		{families: map[string]int{"kube_pod_inf": 10}, wantErr: true},
+		{families: map[string]int{"kube_pod_info": -1}, wantErr: true},
+	}
+
+	for _, test := range tests {
+		err := NewBuilder().WithSeriesLimits(test.families, nil)
+		if gotErr := err != nil; gotErr != test.wantErr {
+			t.Errorf("%v: expected error %v but got %v", test.families, test.wantErr, err)
+		}
+	}
+}
+
+func TestWithCustomResources(t *testing.T) {
+	resource := func(metric string) customresource.Resource {
+		return customresource.Resource{
+			Group:    "example.com",
+			Version:  "v1",
+			Kind:     "Foo",
+			Resource: "foos",
+			Metrics:  []customresource.Metric{{Name: metric, Type: customresource.MetricInfo}},
+		}
+	}
+
+	tests := []struct {
+		metric  string
+		wantErr bool
+	}{
+		{metric: "kube_foo_info"},
+		{metric: "kube_pod_info", wantErr: true},
+		{metric: "kube_pod_annotations", wantErr: true},
+		{metric: "kube_customresource_created", wantErr: true},
+	}
+
+	for _, test := range tests {
+		err := NewBuilder().WithCustomResources([]customresource.Resource{resource(test.metric)}, nil)
+		if gotErr := err != nil; gotErr != test.wantErr {
+			t.Errorf("%v: expected error %v but got %v", test.metric, test.wantErr, err)
+		}
+	}
+}
+
+func TestWithLabelsAllowlist(t *testing.T) {
+	tests := []struct {
+		collector string
+		wantErr   bool
+	}{
+		{collector: "pods"},
+		{collector: "verticalpodautoscalers"},
+		{collector: "configmaps", wantErr: true},
+		{collector: "limitranges", wantErr: true},
+		{collector: "validatingwebhookconfigurations", wantErr: true},
+		{collector: "unknown", wantErr: true},
+	}
+
+	for _, test := range tests {
+		err := NewBuilder().WithLabelsAllowlist(options.KeyAllowlist{test.collector: {"app"}})
+		if gotErr := err != nil; gotErr != test.wantErr {
+			t.Errorf("%v: expected error %v but got %v", test.collector, test.wantErr, err)
+		}
+	}
+}
+
+func TestSnapshotScope(t *testing.T) {
+	foo := customresource.Resource{
+		Group:    "example.com",
+		Version:  "v1",
+		Kind:     "Foo",
+		Resource: "foos",
+		Metrics:  []customresource.Metric{{Name: "foo_info", Type: customresource.MetricInfo}},
+	}
+	fooWithLabels := foo
+	fooWithLabels.Labels = map[string]string{"team": ".spec.team"}
+
+	newBuilder := func(labels, annotations options.KeyAllowlist, resource customresource.Resource) *Builder {
+		b := NewBuilder()
+		b.WithNamespaces(options.NamespaceList{"b", "a"})
+		if err := b.WithLabelsAllowlist(labels); err != nil {
+			t.Fatal(err)
+		}
+		if err := b.WithAnnotationsAllowlist(annotations); err != nil {
+			t.Fatal(err)
+		}
+		if err := b.WithCustomResources([]customresource.Resource{resource}, nil); err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	// Snapshots of stores exposing other labels, annotations or custom
+	// resource metrics are not restored.
+	scopes := map[string]string{}
+	for name, b := range map[string]*Builder{
+		"default":           newBuilder(nil, nil, foo),
+		"labels":            newBuilder(options.KeyAllowlist{"pods": {"app"}}, nil, foo),
+		"annotations":       newBuilder(nil, options.KeyAllowlist{"pods": {"app"}}, foo),
+		"custom resource":   newBuilder(nil, nil, fooWithLabels),
+		"other annotations": newBuilder(nil, options.KeyAllowlist{"pods": {"team"}}, foo),
+	} {
+		scope := b.snapshotScope("pods") + " " + b.snapshotScope(foo.Name())
+		for other, otherScope := range scopes {
+			if scope == otherScope {
+				t.Errorf("expected scope of %s to differ from the one of %s, got %s", name, other, scope)
+			}
+		}
+		scopes[name] = scope
+	}
+
+	// The order of namespaces and keys does not matter.
+	b := newBuilder(options.KeyAllowlist{"pods": {"app", "team"}}, nil, foo)
+	reordered := newBuilder(options.KeyAllowlist{"pods": {"team", "app"}}, nil, foo)
+	reordered.WithNamespaces(options.NamespaceList{"a", "b"})
+	if got, want := reordered.snapshotScope("pods"), b.snapshotScope("pods"); got != want {
+		t.Errorf("expected scope %s but got %s", want, got)
+	}
+}
@@ -31,14 +31,18 @@ var (
 	descCSRLabelsName          = "kube_certificatesigningrequest_labels"
 	descCSRLabelsHelp          = "Kubernetes labels converted to Prometheus labels."
 	descCSRLabelsDefaultLabels = []string{"certificatesigningrequest"}
+)
+
+func csrMetricFamilies(allowLabels, allowAnnotations []string) []metric.FamilyGenerator {
+	allowedLabels := newKeyAllowlist(allowLabels)
 
-	csrMetricFamilies = []metric.FamilyGenerator{
+	families := []metric.FamilyGenerator{
 		{
 			Name: descCSRLabelsName,
 			Type: metric.Gauge,
 			Help: descCSRLabelsHelp,
 			GenerateFunc: wrapCSRFunc(func(j *certv1beta1.CertificateSigningRequest) *metric.Family {
-				labelKeys, labelValues := kubeLabelsToPrometheusLabels(j.Labels)
+				labelKeys, labelValues := kubeLabelsToPrometheusLabels(j.Labels, allowedLabels)
 				return &metric.Family{
 					Metrics: []*metric.Metric{
 						{
@@ -96,7 +100,21 @@ var (
 			}),
 		},
 	}
-)
+
+	if allowAnnotations != nil {
+		allowedAnnotations := newKeyAllowlist(allowAnnotations)
+		families = append(families, metric.FamilyGenerator{
+			Name: "kube_certificatesigningrequest_annotations",
+			Type: metric.Gauge,
+			Help: "Kubernetes annotations converted to Prometheus labels.",
+			GenerateFunc: wrapCSRFunc(func(j *certv1beta1.CertificateSigningRequest) *metric.Family {
+				return kubeAnnotationsFamily(j.Annotations, allowedAnnotations)
+			}),
+		})
+	}
+
+	return families
+}
 
 func wrapCSRFunc(f func(*certv1beta1.CertificateSigningRequest) *metric.Family) func(interface{}) *metric.Family {
 	return func(obj interface{}) *metric.Family {
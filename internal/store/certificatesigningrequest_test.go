@@ -212,8 +212,8 @@ func TestCsrStore(t *testing.T) {
 		},
 	}
 	for i, c := range cases {
-		c.Func = metric.ComposeMetricGenFuncs(csrMetricFamilies)
-		c.Headers = metric.ExtractMetricFamilyHeaders(csrMetricFamilies)
+		c.Func = metric.ComposeMetricGenFuncs(csrMetricFamilies(nil, nil))
+		c.Headers = metric.ExtractMetricFamilyHeaders(csrMetricFamilies(nil, nil))
 		if err := c.run(); err != nil {
 			t.Errorf("unexpected error when collecting result in %vth run:\n%s", i, err)
 		}
@@ -29,8 +29,10 @@ import (
 
 var (
 	descConfigMapLabelsDefaultLabels = []string{"namespace", "configmap"}
+)
 
-	configMapMetricFamilies = []metric.FamilyGenerator{
+func configMapMetricFamilies(allowAnnotations []string) []metric.FamilyGenerator {
+	families := []metric.FamilyGenerator{
 		{
 			Name: "kube_configmap_info",
 			Type: metric.Gauge,
@@ -82,7 +84,21 @@ var (
 			}),
 		},
 	}
-)
+
+	if allowAnnotations != nil {
+		allowedAnnotations := newKeyAllowlist(allowAnnotations)
+		families = append(families, metric.FamilyGenerator{
+			Name: "kube_configmap_annotations",
+			Type: metric.Gauge,
+			Help: "Kubernetes annotations converted to Prometheus labels.",
+			GenerateFunc: wrapConfigMapFunc(func(c *v1.ConfigMap) *metric.Family {
+				return kubeAnnotationsFamily(c.Annotations, allowedAnnotations)
+			}),
+		})
+	}
+
+	return families
+}
 
 func createConfigMapListWatch(kubeClient clientset.Interface, ns string) cache.ListerWatcher {
 	return &cache.ListWatch{
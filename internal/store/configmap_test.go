@@ -72,8 +72,8 @@ func TestConfigMapStore(t *testing.T) {
 		},
 	}
 	for i, c := range cases {
-		c.Func = metric.ComposeMetricGenFuncs(configMapMetricFamilies)
-		c.Headers = metric.ExtractMetricFamilyHeaders(configMapMetricFamilies)
+		c.Func = metric.ComposeMetricGenFuncs(configMapMetricFamilies(nil))
+		c.Headers = metric.ExtractMetricFamilyHeaders(configMapMetricFamilies(nil))
 		if err := c.run(); err != nil {
 			t.Errorf("unexpected collecting result in %vth run:\n%s", i, err)
 		}
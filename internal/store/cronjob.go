@@ -35,14 +35,18 @@ var (
 	descCronJobLabelsName          = "kube_cronjob_labels"
 	descCronJobLabelsHelp          = "Kubernetes labels converted to Prometheus labels."
 	descCronJobLabelsDefaultLabels = []string{"namespace", "cronjob"}
+)
+
+func cronJobMetricFamilies(allowLabels, allowAnnotations []string) []metric.FamilyGenerator {
+	allowedLabels := newKeyAllowlist(allowLabels)
 
-	cronJobMetricFamilies = []metric.FamilyGenerator{
+	families := []metric.FamilyGenerator{
 		{
 			Name: descCronJobLabelsName,
 			Type: metric.Gauge,
 			Help: descCronJobLabelsHelp,
 			GenerateFunc: wrapCronJobFunc(func(j *batchv1beta1.CronJob) *metric.Family {
-				labelKeys, labelValues := kubeLabelsToPrometheusLabels(j.Labels)
+				labelKeys, labelValues := kubeLabelsToPrometheusLabels(j.Labels, allowedLabels)
 				return &metric.Family{
 					Metrics: []*metric.Metric{
 						{
@@ -148,6 +152,7 @@ var (
 		{
 			Name: "kube_cronjob_spec_starting_deadline_seconds",
 			Type: metric.Gauge,
+			Unit: "seconds",
 			Help: "Deadline in seconds for starting the job if it misses scheduled time for any reason.",
 			GenerateFunc: wrapCronJobFunc(func(j *batchv1beta1.CronJob) *metric.Family {
 				ms := []*metric.Metric{}
@@ -191,7 +196,21 @@ var (
 			}),
 		},
 	}
-)
+
+	if allowAnnotations != nil {
+		allowedAnnotations := newKeyAllowlist(allowAnnotations)
+		families = append(families, metric.FamilyGenerator{
+			Name: "kube_cronjob_annotations",
+			Type: metric.Gauge,
+			Help: "Kubernetes annotations converted to Prometheus labels.",
+			GenerateFunc: wrapCronJobFunc(func(j *batchv1beta1.CronJob) *metric.Family {
+				return kubeAnnotationsFamily(j.Annotations, allowedAnnotations)
+			}),
+		})
+	}
+
+	return families
+}
 
 func wrapCronJobFunc(f func(*batchv1beta1.CronJob) *metric.Family) func(interface{}) *metric.Family {
 	return func(obj interface{}) *metric.Family {
@@ -243,8 +243,8 @@ func TestCronJobStore(t *testing.T) {
 		},
 	}
 	for i, c := range cases {
-		c.Func = metric.ComposeMetricGenFuncs(cronJobMetricFamilies)
-		c.Headers = metric.ExtractMetricFamilyHeaders(cronJobMetricFamilies)
+		c.Func = metric.ComposeMetricGenFuncs(cronJobMetricFamilies(nil, nil))
+		c.Headers = metric.ExtractMetricFamilyHeaders(cronJobMetricFamilies(nil, nil))
 		if err := c.run(); err != nil {
 			t.Errorf("unexpected collecting result in %vth run:\n%s", i, err)
 		}
@@ -0,0 +1,76 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package store
+
+import (
+	"reflect"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+
+	"k8s.io/kube-state-metrics/pkg/customresource"
+	"k8s.io/kube-state-metrics/pkg/metric"
+	metricsstore "k8s.io/kube-state-metrics/pkg/metrics_store"
+)
+
+// customResourceFamilies contains a configured custom resource and the
+// generators of its metric families.
+type customResourceFamilies struct {
+	resource customresource.Resource
+	families []metric.FamilyGenerator
+}
+
+func (b *Builder) buildCustomResourceStore(r customResourceFamilies) *metricsstore.MetricsStore {
+	expectedType := &unstructured.Unstructured{}
+	expectedType.SetGroupVersionKind(r.resource.GroupVersionKind())
+
+	return b.buildStore(r.resource.Name(), r.families, expectedType, createCustomResourceListWatchFunc(b.dynamicClient, r.resource))
+}
+
+func createCustomResourceListWatchFunc(dynamicClient dynamic.Interface, r customresource.Resource) func(kubeClient clientset.Interface, ns string) cache.ListerWatcher {
+	return func(kubeClient clientset.Interface, ns string) cache.ListerWatcher {
+		client := dynamicClient.Resource(r.GroupVersionResource())
+		var resource dynamic.ResourceInterface = client
+		if !r.ClusterScoped {
+			resource = client.Namespace(ns)
+		}
+
+		return &cache.ListWatch{
+			ListFunc: func(opts metav1.ListOptions) (runtime.Object, error) {
+				return resource.List(opts)
+			},
+			WatchFunc: func(opts metav1.ListOptions) (watch.Interface, error) {
+				return resource.Watch(opts)
+			},
+		}
+	}
+}
+
+// typeName returns the name of the given type of objects, e.g. *v1.Pod, or
+// the group, version and kind of custom resources of a single kind, which are
+// all of the same type.
+func typeName(expectedType interface{}) string {
+	if u, ok := expectedType.(*unstructured.Unstructured); ok && u.GetKind() != "" {
+		return u.GroupVersionKind().String()
+	}
+	return reflect.TypeOf(expectedType).String()
+}
@@ -0,0 +1,484 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package store
+
+import (
+	"context"
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog"
+
+	"k8s.io/kube-state-metrics/pkg/customresource"
+	"k8s.io/kube-state-metrics/pkg/metric"
+	metricsstore "k8s.io/kube-state-metrics/pkg/metrics_store"
+	"k8s.io/kube-state-metrics/pkg/options"
+	"k8s.io/kube-state-metrics/pkg/sharding"
+	kswatch "k8s.io/kube-state-metrics/pkg/watch"
+)
+
+// customResourceDiscoveryCollector is the name of the collector of the
+// conditions of discovered custom resources.
+const customResourceDiscoveryCollector = "customresources"
+
+var (
+	descCustomResourceLabelsDefaultLabels = []string{"group", "kind", "namespace", "name"}
+
+	// crdResources are the versions of the CustomResourceDefinitions in order
+	// of preference, the first one served by the API server is watched.
+	crdResources = []schema.GroupVersionResource{
+		{Group: "apiextensions.k8s.io", Version: "v1", Resource: "customresourcedefinitions"},
+		{Group: "apiextensions.k8s.io", Version: "v1beta1", Resource: "customresourcedefinitions"},
+	}
+
+	customResourceMetricFamilies = []metric.FamilyGenerator{
+		{
+			Name: "kube_customresource_created",
+			Type: metric.Gauge,
+			Help: "Unix creation timestamp of a discovered custom resource.",
+			GenerateFunc: wrapCustomResourceFunc(func(u *unstructured.Unstructured) *metric.Family {
+				ms := []*metric.Metric{}
+
+				if created := u.GetCreationTimestamp(); !created.IsZero() {
+					ms = append(ms, &metric.Metric{
+						Value: float64(created.Unix()),
+					})
+				}
+
+				return &metric.Family{
+					Metrics: ms,
+				}
+			}),
+		},
+		{
+			Name: "kube_customresource_status_condition",
+			Type: metric.Gauge,
+			Help: "The current status conditions of a discovered custom resource.",
+			GenerateFunc: wrapCustomResourceFunc(func(u *unstructured.Unstructured) *metric.Family {
+				conditions, _, _ := unstructured.NestedSlice(u.Object, "status", "conditions")
+				ms := make([]*metric.Metric, 0, len(conditions)*len(conditionStatuses))
+
+				for _, c := range conditions {
+					condition, ok := c.(map[string]interface{})
+					if !ok {
+						continue
+					}
+					conditionType, _, _ := unstructured.NestedString(condition, "type")
+					status, _, _ := unstructured.NestedString(condition, "status")
+					if conditionType == "" {
+						continue
+					}
+
+					for _, m := range addConditionMetrics(v1.ConditionStatus(status)) {
+						metric := m
+
+						metric.LabelKeys = []string{"type", "status"}
+						metric.LabelValues = append([]string{conditionType}, metric.LabelValues...)
+						ms = append(ms, metric)
+					}
+				}
+
+				return &metric.Family{
+					Metrics: ms,
+				}
+			}),
+		},
+	}
+)
+
+func wrapCustomResourceFunc(f func(*unstructured.Unstructured) *metric.Family) func(interface{}) *metric.Family {
+	return func(obj interface{}) *metric.Family {
+		u := obj.(*unstructured.Unstructured)
+
+		metricFamily := f(u)
+		gvk := u.GroupVersionKind()
+
+		for _, m := range metricFamily.Metrics {
+			m.LabelKeys = append(descCustomResourceLabelsDefaultLabels, m.LabelKeys...)
+			m.LabelValues = append([]string{gvk.Group, gvk.Kind, u.GetNamespace(), u.GetName()}, m.LabelValues...)
+		}
+
+		return metricFamily
+	}
+}
+
+// WithCustomResourceDiscovery makes the Builder build a store of the
+// conditions of all custom resources of the kinds allowed by the given
+// allowlist, which are discovered by watching the CustomResourceDefinitions
+// with the given dynamic client.
+func (b *Builder) WithCustomResourceDiscovery(allowlist customresource.Allowlist, c dynamic.Interface) {
+	b.discoveryAllowlist = allowlist
+	b.dynamicClient = c
+}
+
+func (b *Builder) buildCustomResourceDiscoveryStore() *metricsstore.MetricsStore {
+	store := b.newStore(customResourceDiscoveryCollector, customResourceMetricFamilies, &unstructured.Unstructured{})
+
+	d := &customResourceDiscovery{
+		client:      b.dynamicClient,
+		allowlist:   b.discoveryAllowlist,
+		namespaces:  b.namespaces,
+		shard:       b.shard,
+		totalShards: b.totalShards,
+		metrics:     b.metrics,
+		ctx:         b.ctx,
+		store:       store,
+		kinds:       map[schema.GroupVersionResource]*discoveredKind{},
+	}
+
+	_, controller := cache.NewInformer(
+		&crdListWatch{client: d.client},
+		&unstructured.Unstructured{}, 0,
+		cache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) {
+				d.update(obj.(*unstructured.Unstructured))
+			},
+			UpdateFunc: func(_, obj interface{}) {
+				d.update(obj.(*unstructured.Unstructured))
+			},
+			DeleteFunc: func(obj interface{}) {
+				if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+					obj = tombstone.Obj
+				}
+				if crd, ok := obj.(*unstructured.Unstructured); ok {
+					d.remove(crd.GetName())
+				}
+			},
+		},
+	)
+	d.crdSynced = controller.HasSynced
+	b.reflectorsSynced[store] = append(b.reflectorsSynced[store], d.hasSynced)
+	go controller.Run(b.ctx.Done())
+
+	return store
+}
+
+// crdListWatch lists and watches the CustomResourceDefinitions in the first
+// of crdResources served by the API server.
+type crdListWatch struct {
+	client dynamic.Interface
+
+	mutex sync.Mutex
+	// resource is the version of the last successful list, which is watched.
+	resource schema.GroupVersionResource
+}
+
+// List implements the List method of the cache.ListerWatcher interface.
+func (lw *crdListWatch) List(opts metav1.ListOptions) (runtime.Object, error) {
+	var err error
+	for _, r := range crdResources {
+		var list *unstructured.UnstructuredList
+		list, err = lw.client.Resource(r).List(opts)
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		lw.mutex.Lock()
+		lw.resource = r
+		lw.mutex.Unlock()
+		return list, nil
+	}
+	return nil, err
+}
+
+// Watch implements the Watch method of the cache.ListerWatcher interface.
+func (lw *crdListWatch) Watch(opts metav1.ListOptions) (watch.Interface, error) {
+	lw.mutex.Lock()
+	r := lw.resource
+	lw.mutex.Unlock()
+
+	return lw.client.Resource(r).Watch(opts)
+}
+
+// customResourceDiscovery starts and stops the reflectors of the custom
+// resources of the allowed kinds whenever their CustomResourceDefinitions
+// change. The objects of all kinds share a single store.
+type customResourceDiscovery struct {
+	client      dynamic.Interface
+	allowlist   customresource.Allowlist
+	namespaces  options.NamespaceList
+	shard       int32
+	totalShards int
+	metrics     *kswatch.ListWatchMetrics
+	ctx         context.Context
+	store       *metricsstore.MetricsStore
+	// crdSynced returns whether the CustomResourceDefinition informer
+	// completed its initial list.
+	crdSynced cache.InformerSynced
+
+	// mutex protects kinds, which is changed by the handlers of the
+	// CustomResourceDefinition informer and read by hasSynced.
+	mutex sync.Mutex
+	// kinds contains the reflected kinds by their resource.
+	kinds map[schema.GroupVersionResource]*discoveredKind
+}
+
+// hasSynced returns whether the CustomResourceDefinitions and the custom
+// resources of all kinds discovered so far completed their initial list.
+func (d *customResourceDiscovery) hasSynced() bool {
+	if !d.crdSynced() {
+		return false
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	for _, k := range d.kinds {
+		for _, synced := range k.synced {
+			if !synced() {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// discoveredKind is a kind of custom resources whose objects are reflected
+// into the store.
+type discoveredKind struct {
+	// crd is the name of the CustomResourceDefinition of the kind.
+	crd    string
+	cancel func()
+	stores []*kindStore
+	// synced contains the HasSynced functions of the reflectors of the kind.
+	synced []cache.InformerSynced
+}
+
+// update starts reflecting the custom resources of the given
+// CustomResourceDefinition if its kind is allowed, and stops reflecting the
+// ones of its previously served version.
+func (d *customResourceDiscovery) update(crd *unstructured.Unstructured) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	resource, namespaced, ok := servedResource(crd)
+	if ok {
+		kind, _, _ := unstructured.NestedString(crd.Object, "spec", "names", "kind")
+		ok = d.allowlist.Allows(resource.Group, kind)
+	}
+
+	for r, k := range d.kinds {
+		if k.crd == crd.GetName() && (!ok || r != resource) {
+			d.stop(r)
+		}
+	}
+	if !ok {
+		return
+	}
+	if _, exists := d.kinds[resource]; exists {
+		return
+	}
+
+	klog.Infof("Discovered custom resource %s", resource)
+	ctx, cancel := context.WithCancel(d.ctx)
+	k := &discoveredKind{crd: crd.GetName(), cancel: cancel}
+
+	expectedType := &unstructured.Unstructured{}
+	namespaces := d.namespaces
+	if !namespaced {
+		namespaces = options.NamespaceList{metav1.NamespaceAll}
+	}
+	for _, ns := range namespaces {
+		var client dynamic.ResourceInterface = d.client.Resource(resource)
+		if namespaced {
+			client = d.client.Resource(resource).Namespace(ns)
+		}
+		lw := &cache.ListWatch{
+			ListFunc: func(opts metav1.ListOptions) (runtime.Object, error) {
+				return client.List(opts)
+			},
+			WatchFunc: func(opts metav1.ListOptions) (watch.Interface, error) {
+				return client.Watch(opts)
+			},
+		}
+		instrumentedListWatch := kswatch.NewInstrumentedListerWatcher(lw, d.metrics, resource.String())
+		s := newKindStore(d.store)
+		synced := newSyncTrackingStore(s)
+		k.stores = append(k.stores, s)
+		k.synced = append(k.synced, synced.HasSynced)
+		reflector := cache.NewReflector(sharding.NewShardedListWatch(d.shard, d.totalShards, instrumentedListWatch), expectedType, synced, 0)
+		go reflector.Run(ctx.Done())
+	}
+	d.kinds[resource] = k
+}
+
+// remove stops reflecting the custom resources of the deleted
+// CustomResourceDefinition with the given name.
+func (d *customResourceDiscovery) remove(crd string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	for r, k := range d.kinds {
+		if k.crd == crd {
+			d.stop(r)
+		}
+	}
+}
+
+// stop stops reflecting the custom resources of the given resource and
+// removes their metrics. The caller has to hold the lock of the discovery.
+func (d *customResourceDiscovery) stop(resource schema.GroupVersionResource) {
+	klog.Infof("Stopped discovering custom resource %s", resource)
+	k := d.kinds[resource]
+	k.cancel()
+	for _, s := range k.stores {
+		s.stop()
+	}
+	delete(d.kinds, resource)
+}
+
+// servedResource returns the resource of the given CustomResourceDefinition
+// in its served storage version, or the first served version, and whether it
+// is namespaced.
+func servedResource(crd *unstructured.Unstructured) (resource schema.GroupVersionResource, namespaced bool, ok bool) {
+	group, _, _ := unstructured.NestedString(crd.Object, "spec", "group")
+	plural, _, _ := unstructured.NestedString(crd.Object, "spec", "names", "plural")
+	scope, _, _ := unstructured.NestedString(crd.Object, "spec", "scope")
+	if group == "" || plural == "" {
+		return resource, false, false
+	}
+
+	version, _, _ := unstructured.NestedString(crd.Object, "spec", "version")
+	versions, _, _ := unstructured.NestedSlice(crd.Object, "spec", "versions")
+	served := ""
+	for _, v := range versions {
+		v, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _, _ := unstructured.NestedString(v, "name")
+		isServed, _, _ := unstructured.NestedBool(v, "served")
+		isStorage, _, _ := unstructured.NestedBool(v, "storage")
+		if !isServed {
+			continue
+		}
+		if served == "" || isStorage {
+			served = name
+		}
+	}
+	if len(versions) > 0 {
+		version = served
+	}
+	if version == "" {
+		return resource, false, false
+	}
+
+	return schema.GroupVersionResource{Group: group, Version: version, Resource: plural}, scope != "Cluster", true
+}
+
+// kindStore is the cache.Store of a reflector of a single kind of custom
+// resources, whose objects share a store with other kinds. Replace only
+// replaces the objects of the reflector.
+type kindStore struct {
+	cache.Store
+
+	mutex   sync.Mutex
+	objects map[types.UID]*metav1.ObjectMeta
+	stopped bool
+}
+
+func newKindStore(s cache.Store) *kindStore {
+	return &kindStore{Store: s, objects: map[types.UID]*metav1.ObjectMeta{}}
+}
+
+// Add implements the Add method of the store interface.
+func (s *kindStore) Add(obj interface{}) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.add(obj)
+}
+
+func (s *kindStore) add(obj interface{}) error {
+	if s.stopped {
+		return nil
+	}
+
+	u := obj.(*unstructured.Unstructured)
+	s.objects[u.GetUID()] = &metav1.ObjectMeta{UID: u.GetUID(), Namespace: u.GetNamespace(), Name: u.GetName()}
+	return s.Store.Add(obj)
+}
+
+// Update implements the Update method of the store interface.
+func (s *kindStore) Update(obj interface{}) error {
+	return s.Add(obj)
+}
+
+// Delete implements the Delete method of the store interface.
+func (s *kindStore) Delete(obj interface{}) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.stopped {
+		return nil
+	}
+
+	u := obj.(*unstructured.Unstructured)
+	delete(s.objects, u.GetUID())
+	return s.Store.Delete(obj)
+}
+
+// Replace implements the Replace method of the store interface. It adds the
+// given objects and deletes the other objects of the reflector.
+func (s *kindStore) Replace(list []interface{}, _ string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	previous := s.objects
+	s.objects = map[types.UID]*metav1.ObjectMeta{}
+	for _, obj := range list {
+		if err := s.add(obj); err != nil {
+			return err
+		}
+	}
+
+	for uid, o := range previous {
+		if _, ok := s.objects[uid]; ok {
+			continue
+		}
+		if err := s.Store.Delete(o); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stop deletes all objects of the reflector and ignores further changes.
+func (s *kindStore) stop() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.stopped = true
+	for _, o := range s.objects {
+		if err := s.Store.Delete(o); err != nil {
+			klog.Errorf("failed to delete metrics of custom resource %s/%s: %v", o.Namespace, o.Name, err)
+		}
+	}
+	s.objects = nil
+}
@@ -0,0 +1,302 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package store
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+
+	"k8s.io/kube-state-metrics/pkg/customresource"
+	"k8s.io/kube-state-metrics/pkg/metric"
+	metricsstore "k8s.io/kube-state-metrics/pkg/metrics_store"
+	"k8s.io/kube-state-metrics/pkg/options"
+	"k8s.io/kube-state-metrics/pkg/whiteblacklist"
+)
+
+// fakeDynamicClient serves the objects of the given resources, other
+// resources are not found. listed is called on every list.
+type fakeDynamicClient struct {
+	objects map[schema.GroupVersionResource][]unstructured.Unstructured
+	listed  func(schema.GroupVersionResource)
+}
+
+func (c *fakeDynamicClient) Resource(r schema.GroupVersionResource) dynamic.NamespaceableResourceInterface {
+	return &fakeResource{client: c, resource: r}
+}
+
+type fakeResource struct {
+	dynamic.NamespaceableResourceInterface
+	client   *fakeDynamicClient
+	resource schema.GroupVersionResource
+}
+
+func (r *fakeResource) Namespace(string) dynamic.ResourceInterface {
+	return r
+}
+
+func (r *fakeResource) List(metav1.ListOptions) (*unstructured.UnstructuredList, error) {
+	r.client.listed(r.resource)
+	items, ok := r.client.objects[r.resource]
+	if !ok {
+		return nil, apierrors.NewNotFound(r.resource.GroupResource(), "")
+	}
+	return &unstructured.UnstructuredList{Items: items}, nil
+}
+
+func (r *fakeResource) Watch(metav1.ListOptions) (watch.Interface, error) {
+	return watch.NewFake(), nil
+}
+
+func newTestCustomResource(name, uid string, conditions ...interface{}) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "cert-manager.io/v1",
+		"kind":       "Certificate",
+		"status": map[string]interface{}{
+			"conditions": conditions,
+		},
+	}}
+	u.SetNamespace("default")
+	u.SetName(name)
+	u.SetUID(types.UID(uid))
+	u.SetCreationTimestamp(metav1.Unix(1500000000, 0))
+	return u
+}
+
+func TestCustomResourceDiscoveryStore(t *testing.T) {
+	const metadata = `
+		# HELP kube_customresource_created Unix creation timestamp of a discovered custom resource.
+		# TYPE kube_customresource_created gauge
+		# HELP kube_customresource_status_condition The current status conditions of a discovered custom resource.
+		# TYPE kube_customresource_status_condition gauge
+	`
+	cases := []generateMetricsTestCase{
+		{
+			Obj: newTestCustomResource("web", "1",
+				map[string]interface{}{"type": "Ready", "status": "True"},
+				map[string]interface{}{"type": "Issuing", "status": "Unknown"},
+				map[string]interface{}{"status": "True"},
+			),
+			Want: metadata + `
+				kube_customresource_created{group="cert-manager.io",kind="Certificate",namespace="default",name="web"} 1.5e+09
+				kube_customresource_status_condition{group="cert-manager.io",kind="Certificate",namespace="default",name="web",type="Ready",status="true"} 1
+				kube_customresource_status_condition{group="cert-manager.io",kind="Certificate",namespace="default",name="web",type="Ready",status="false"} 0
+				kube_customresource_status_condition{group="cert-manager.io",kind="Certificate",namespace="default",name="web",type="Ready",status="unknown"} 0
+				kube_customresource_status_condition{group="cert-manager.io",kind="Certificate",namespace="default",name="web",type="Issuing",status="true"} 0
+				kube_customresource_status_condition{group="cert-manager.io",kind="Certificate",namespace="default",name="web",type="Issuing",status="false"} 0
+				kube_customresource_status_condition{group="cert-manager.io",kind="Certificate",namespace="default",name="web",type="Issuing",status="unknown"} 1
+			`,
+		},
+		{
+			Obj: newTestCustomResource("new", "2"),
+			Want: metadata + `
+				kube_customresource_created{group="cert-manager.io",kind="Certificate",namespace="default",name="new"} 1.5e+09
+			`,
+		},
+	}
+	for i, c := range cases {
+		c.Func = metric.ComposeMetricGenFuncs(customResourceMetricFamilies)
+		c.Headers = metric.ExtractMetricFamilyHeaders(customResourceMetricFamilies)
+		if err := c.run(); err != nil {
+			t.Errorf("unexpected collecting result in %vth run:\n%s", i, err)
+		}
+	}
+}
+
+func TestCustomResourceDiscoverySynced(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Only the deprecated version of the CustomResourceDefinitions is served.
+	crd := unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apiextensions.k8s.io/v1beta1",
+		"kind":       "CustomResourceDefinition",
+		"metadata":   map[string]interface{}{"name": "certificates.cert-manager.io", "uid": "crd"},
+		"spec": map[string]interface{}{
+			"group":   "cert-manager.io",
+			"version": "v1",
+			"scope":   "Namespaced",
+			"names":   map[string]interface{}{"plural": "certificates", "kind": "Certificate"},
+		},
+	}}
+	certificates := schema.GroupVersionResource{Group: "cert-manager.io", Version: "v1", Resource: "certificates"}
+
+	// The list of the certificates blocks until released.
+	listing := make(chan struct{})
+	release := make(chan struct{})
+	var once sync.Once
+	client := &fakeDynamicClient{
+		objects: map[schema.GroupVersionResource][]unstructured.Unstructured{
+			crdResources[1]: {crd},
+			certificates:    {*newTestCustomResource("web", "1")},
+		},
+		listed: func(r schema.GroupVersionResource) {
+			if r == certificates {
+				once.Do(func() { close(listing) })
+				<-release
+			}
+		},
+	}
+
+	l, err := whiteblacklist.New(map[string]struct{}{}, map[string]struct{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := NewBuilder()
+	b.WithMetrics(nil)
+	b.WithNamespaces(options.DefaultNamespaces)
+	b.WithWhiteBlackList(l)
+	b.WithSharding(0, 1)
+	b.WithContext(ctx)
+	b.WithCustomResourceDiscovery(customresource.Allowlist{"*"}, client)
+	store := b.BuildCollectors([]string{customResourceDiscoveryCollector})[customResourceDiscoveryCollector]
+	status := b.SyncStatus()
+
+	select {
+	case <-listing:
+	case <-time.After(10 * time.Second):
+		t.Fatal("expected discovered custom resources to be listed")
+	}
+	if status.Synced()[customResourceDiscoveryCollector] {
+		t.Error("expected collector not to be synced before the discovered custom resources were listed")
+	}
+
+	close(release)
+	for start := time.Now(); !status.Synced()[customResourceDiscoveryCollector]; time.Sleep(time.Millisecond) {
+		if time.Since(start) > 10*time.Second {
+			t.Fatal("expected collector to be synced once the discovered custom resources were listed")
+		}
+	}
+	if got, want := strings.Join(store.ListKeys(), ","), "default/web"; got != want {
+		t.Errorf("expected keys %v but got %v", want, got)
+	}
+}
+
+func TestServedResource(t *testing.T) {
+	tests := []struct {
+		desc       string
+		spec       map[string]interface{}
+		want       schema.GroupVersionResource
+		namespaced bool
+		ok         bool
+	}{
+		{
+			desc: "storage version",
+			spec: map[string]interface{}{
+				"group": "example.com",
+				"names": map[string]interface{}{"kind": "Foo", "plural": "foos"},
+				"scope": "Namespaced",
+				"versions": []interface{}{
+					map[string]interface{}{"name": "v1alpha1", "served": true, "storage": false},
+					map[string]interface{}{"name": "v1", "served": true, "storage": true},
+				},
+			},
+			want:       schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: "foos"},
+			namespaced: true,
+			ok:         true,
+		},
+		{
+			desc: "served version",
+			spec: map[string]interface{}{
+				"group": "example.com",
+				"names": map[string]interface{}{"kind": "Foo", "plural": "foos"},
+				"scope": "Cluster",
+				"versions": []interface{}{
+					map[string]interface{}{"name": "v1alpha1", "served": true, "storage": false},
+					map[string]interface{}{"name": "v1", "served": false, "storage": true},
+				},
+			},
+			want: schema.GroupVersionResource{Group: "example.com", Version: "v1alpha1", Resource: "foos"},
+			ok:   true,
+		},
+		{
+			desc: "single version",
+			spec: map[string]interface{}{
+				"group":   "example.com",
+				"names":   map[string]interface{}{"kind": "Foo", "plural": "foos"},
+				"scope":   "Namespaced",
+				"version": "v1beta1",
+			},
+			want:       schema.GroupVersionResource{Group: "example.com", Version: "v1beta1", Resource: "foos"},
+			namespaced: true,
+			ok:         true,
+		},
+		{
+			desc: "no served version",
+			spec: map[string]interface{}{
+				"group": "example.com",
+				"names": map[string]interface{}{"kind": "Foo", "plural": "foos"},
+				"versions": []interface{}{
+					map[string]interface{}{"name": "v1", "served": false, "storage": true},
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		crd := &unstructured.Unstructured{Object: map[string]interface{}{"spec": test.spec}}
+		got, namespaced, ok := servedResource(crd)
+		if ok != test.ok || (ok && (got != test.want || namespaced != test.namespaced)) {
+			t.Errorf("%s: expected %v, %v, %v but got %v, %v, %v", test.desc, test.want, test.namespaced, test.ok, got, namespaced, ok)
+		}
+	}
+}
+
+func TestKindStore(t *testing.T) {
+	store := metricsstore.NewMetricsStoreWithHeaders(
+		metric.ExtractMetricFamilyFormatHeaders(customResourceMetricFamilies),
+		metric.ComposeMetricGenFuncs(customResourceMetricFamilies),
+	)
+	certificates := newKindStore(store)
+	issuers := newKindStore(store)
+
+	if err := issuers.Add(newTestCustomResource("issuer", "issuer")); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"web", "db"} {
+		if err := certificates.Add(newTestCustomResource(name, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Replace only replaces the objects of the same kind.
+	if err := certificates.Replace([]interface{}{newTestCustomResource("web", "web")}, ""); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(store.ListKeys(), ","), "default/issuer,default/web"; got != want {
+		t.Errorf("expected keys %v but got %v", want, got)
+	}
+
+	// Stopped kinds are removed and further changes ignored.
+	certificates.stop()
+	if err := certificates.Add(newTestCustomResource("db", "db")); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(store.ListKeys(), ","), "default/issuer"; got != want {
+		t.Errorf("expected keys %v but got %v", want, got)
+	}
+}
@@ -31,8 +31,12 @@ var (
 	descDaemonSetLabelsName          = "kube_daemonset_labels"
 	descDaemonSetLabelsHelp          = "Kubernetes labels converted to Prometheus labels."
 	descDaemonSetLabelsDefaultLabels = []string{"namespace", "daemonset"}
+)
+
+func daemonSetMetricFamilies(allowLabels, allowAnnotations []string) []metric.FamilyGenerator {
+	allowedLabels := newKeyAllowlist(allowLabels)
 
-	daemonSetMetricFamilies = []metric.FamilyGenerator{
+	families := []metric.FamilyGenerator{
 		{
 			Name: "kube_daemonset_created",
 			Type: metric.Gauge,
@@ -184,7 +188,7 @@ var (
 			Type: metric.Gauge,
 			Help: descDaemonSetLabelsHelp,
 			GenerateFunc: wrapDaemonSetFunc(func(d *v1.DaemonSet) *metric.Family {
-				labelKeys, labelValues := kubeLabelsToPrometheusLabels(d.ObjectMeta.Labels)
+				labelKeys, labelValues := kubeLabelsToPrometheusLabels(d.ObjectMeta.Labels, allowedLabels)
 				return &metric.Family{
 					Metrics: []*metric.Metric{
 						{
@@ -197,7 +201,21 @@ var (
 			}),
 		},
 	}
-)
+
+	if allowAnnotations != nil {
+		allowedAnnotations := newKeyAllowlist(allowAnnotations)
+		families = append(families, metric.FamilyGenerator{
+			Name: "kube_daemonset_annotations",
+			Type: metric.Gauge,
+			Help: "Kubernetes annotations converted to Prometheus labels.",
+			GenerateFunc: wrapDaemonSetFunc(func(d *v1.DaemonSet) *metric.Family {
+				return kubeAnnotationsFamily(d.Annotations, allowedAnnotations)
+			}),
+		})
+	}
+
+	return families
+}
 
 func wrapDaemonSetFunc(f func(*v1.DaemonSet) *metric.Family) func(interface{}) *metric.Family {
 	return func(obj interface{}) *metric.Family {
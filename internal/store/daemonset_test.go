@@ -217,8 +217,8 @@ func TestDaemonSetStore(t *testing.T) {
 		},
 	}
 	for i, c := range cases {
-		c.Func = metric.ComposeMetricGenFuncs(daemonSetMetricFamilies)
-		c.Headers = metric.ExtractMetricFamilyHeaders(daemonSetMetricFamilies)
+		c.Func = metric.ComposeMetricGenFuncs(daemonSetMetricFamilies(nil, nil))
+		c.Headers = metric.ExtractMetricFamilyHeaders(daemonSetMetricFamilies(nil, nil))
 		if err := c.run(); err != nil {
 			t.Errorf("unexpected collecting result in %vth run:\n%s", i, err)
 		}
@@ -32,8 +32,12 @@ var (
 	descDeploymentLabelsName          = "kube_deployment_labels"
 	descDeploymentLabelsHelp          = "Kubernetes labels converted to Prometheus labels."
 	descDeploymentLabelsDefaultLabels = []string{"namespace", "deployment"}
+)
+
+func deploymentMetricFamilies(allowLabels, allowAnnotations []string) []metric.FamilyGenerator {
+	allowedLabels := newKeyAllowlist(allowLabels)
 
-	deploymentMetricFamilies = []metric.FamilyGenerator{
+	families := []metric.FamilyGenerator{
 		{
 			Name: "kube_deployment_created",
 			Type: metric.Gauge,
@@ -239,7 +243,7 @@ var (
 			Type: metric.Gauge,
 			Help: descDeploymentLabelsHelp,
 			GenerateFunc: wrapDeploymentFunc(func(d *v1.Deployment) *metric.Family {
-				labelKeys, labelValues := kubeLabelsToPrometheusLabels(d.Labels)
+				labelKeys, labelValues := kubeLabelsToPrometheusLabels(d.Labels, allowedLabels)
 				return &metric.Family{
 					Metrics: []*metric.Metric{
 						{
@@ -252,7 +256,21 @@ var (
 			}),
 		},
 	}
-)
+
+	if allowAnnotations != nil {
+		allowedAnnotations := newKeyAllowlist(allowAnnotations)
+		families = append(families, metric.FamilyGenerator{
+			Name: "kube_deployment_annotations",
+			Type: metric.Gauge,
+			Help: "Kubernetes annotations converted to Prometheus labels.",
+			GenerateFunc: wrapDeploymentFunc(func(d *v1.Deployment) *metric.Family {
+				return kubeAnnotationsFamily(d.Annotations, allowedAnnotations)
+			}),
+		})
+	}
+
+	return families
+}
 
 func wrapDeploymentFunc(f func(*v1.Deployment) *metric.Family) func(interface{}) *metric.Family {
 	return func(obj interface{}) *metric.Family {
@@ -183,8 +183,8 @@ func TestDeploymentStore(t *testing.T) {
 	}
 
 	for i, c := range cases {
-		c.Func = metric.ComposeMetricGenFuncs(deploymentMetricFamilies)
-		c.Headers = metric.ExtractMetricFamilyHeaders(deploymentMetricFamilies)
+		c.Func = metric.ComposeMetricGenFuncs(deploymentMetricFamilies(nil, nil))
+		c.Headers = metric.ExtractMetricFamilyHeaders(deploymentMetricFamilies(nil, nil))
 		if err := c.run(); err != nil {
 			t.Errorf("unexpected collecting result in %vth run:\n%s", i, err)
 		}
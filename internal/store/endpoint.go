@@ -31,8 +31,12 @@ var (
 	descEndpointLabelsName          = "kube_endpoint_labels"
 	descEndpointLabelsHelp          = "Kubernetes labels converted to Prometheus labels."
 	descEndpointLabelsDefaultLabels = []string{"namespace", "endpoint"}
+)
+
+func endpointMetricFamilies(allowLabels, allowAnnotations []string) []metric.FamilyGenerator {
+	allowedLabels := newKeyAllowlist(allowLabels)
 
-	endpointMetricFamilies = []metric.FamilyGenerator{
+	families := []metric.FamilyGenerator{
 		{
 			Name: "kube_endpoint_info",
 			Type: metric.Gauge,
@@ -71,7 +75,7 @@ var (
 			Type: metric.Gauge,
 			Help: descEndpointLabelsHelp,
 			GenerateFunc: wrapEndpointFunc(func(e *v1.Endpoints) *metric.Family {
-				labelKeys, labelValues := kubeLabelsToPrometheusLabels(e.Labels)
+				labelKeys, labelValues := kubeLabelsToPrometheusLabels(e.Labels, allowedLabels)
 				return &metric.Family{
 					Metrics: []*metric.Metric{
 						{
@@ -121,7 +125,21 @@ var (
 			}),
 		},
 	}
-)
+
+	if allowAnnotations != nil {
+		allowedAnnotations := newKeyAllowlist(allowAnnotations)
+		families = append(families, metric.FamilyGenerator{
+			Name: "kube_endpoint_annotations",
+			Type: metric.Gauge,
+			Help: "Kubernetes annotations converted to Prometheus labels.",
+			GenerateFunc: wrapEndpointFunc(func(e *v1.Endpoints) *metric.Family {
+				return kubeAnnotationsFamily(e.Annotations, allowedAnnotations)
+			}),
+		})
+	}
+
+	return families
+}
 
 func wrapEndpointFunc(f func(*v1.Endpoints) *metric.Family) func(interface{}) *metric.Family {
 	return func(obj interface{}) *metric.Family {
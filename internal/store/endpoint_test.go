@@ -93,8 +93,8 @@ func TestEndpointStore(t *testing.T) {
 		},
 	}
 	for i, c := range cases {
-		c.Func = metric.ComposeMetricGenFuncs(endpointMetricFamilies)
-		c.Headers = metric.ExtractMetricFamilyHeaders(endpointMetricFamilies)
+		c.Func = metric.ComposeMetricGenFuncs(endpointMetricFamilies(nil, nil))
+		c.Headers = metric.ExtractMetricFamilyHeaders(endpointMetricFamilies(nil, nil))
 		if err := c.run(); err != nil {
 			t.Errorf("unexpected collecting result in %vth run:\n%s", i, err)
 		}
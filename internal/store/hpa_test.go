@@ -104,8 +104,8 @@ func TestHPAStore(t *testing.T) {
 		},
 	}
 	for i, c := range cases {
-		c.Func = metric.ComposeMetricGenFuncs(hpaMetricFamilies)
-		c.Headers = metric.ExtractMetricFamilyHeaders(hpaMetricFamilies)
+		c.Func = metric.ComposeMetricGenFuncs(hpaMetricFamilies(nil, nil))
+		c.Headers = metric.ExtractMetricFamilyHeaders(hpaMetricFamilies(nil, nil))
 		if err := c.run(); err != nil {
 			t.Errorf("unexpected collecting result in %vth run:\n%s", i, err)
 		}
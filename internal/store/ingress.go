@@ -32,8 +32,12 @@ var (
 	descIngressLabelsName          = "kube_ingress_labels"
 	descIngressLabelsHelp          = "Kubernetes labels converted to Prometheus labels."
 	descIngressLabelsDefaultLabels = []string{"namespace", "ingress"}
+)
+
+func ingressMetricFamilies(allowLabels, allowAnnotations []string) []metric.FamilyGenerator {
+	allowedLabels := newKeyAllowlist(allowLabels)
 
-	ingressMetricFamilies = []metric.FamilyGenerator{
+	families := []metric.FamilyGenerator{
 		{
 			Name: "kube_ingress_info",
 			Type: metric.Gauge,
@@ -52,7 +56,7 @@ var (
 			Type: metric.Gauge,
 			Help: descIngressLabelsHelp,
 			GenerateFunc: wrapIngressFunc(func(i *v1beta1.Ingress) *metric.Family {
-				labelKeys, labelValues := kubeLabelsToPrometheusLabels(i.Labels)
+				labelKeys, labelValues := kubeLabelsToPrometheusLabels(i.Labels, allowedLabels)
 				return &metric.Family{
 					Metrics: []*metric.Metric{
 						{
@@ -140,7 +144,21 @@ var (
 			}),
 		},
 	}
-)
+
+	if allowAnnotations != nil {
+		allowedAnnotations := newKeyAllowlist(allowAnnotations)
+		families = append(families, metric.FamilyGenerator{
+			Name: "kube_ingress_annotations",
+			Type: metric.Gauge,
+			Help: "Kubernetes annotations converted to Prometheus labels.",
+			GenerateFunc: wrapIngressFunc(func(s *v1beta1.Ingress) *metric.Family {
+				return kubeAnnotationsFamily(s.Annotations, allowedAnnotations)
+			}),
+		})
+	}
+
+	return families
+}
 
 func wrapIngressFunc(f func(*v1beta1.Ingress) *metric.Family) func(interface{}) *metric.Family {
 	return func(obj interface{}) *metric.Family {
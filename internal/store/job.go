@@ -33,14 +33,18 @@ var (
 	descJobLabelsName          = "kube_job_labels"
 	descJobLabelsHelp          = "Kubernetes labels converted to Prometheus labels."
 	descJobLabelsDefaultLabels = []string{"namespace", "job_name"}
+)
+
+func jobMetricFamilies(allowLabels, allowAnnotations []string) []metric.FamilyGenerator {
+	allowedLabels := newKeyAllowlist(allowLabels)
 
-	jobMetricFamilies = []metric.FamilyGenerator{
+	families := []metric.FamilyGenerator{
 		{
 			Name: descJobLabelsName,
 			Type: metric.Gauge,
 			Help: descJobLabelsHelp,
 			GenerateFunc: wrapJobFunc(func(j *v1batch.Job) *metric.Family {
-				labelKeys, labelValues := kubeLabelsToPrometheusLabels(j.Labels)
+				labelKeys, labelValues := kubeLabelsToPrometheusLabels(j.Labels, allowedLabels)
 				return &metric.Family{
 					Metrics: []*metric.Metric{
 						{
@@ -123,6 +127,7 @@ var (
 		{
 			Name: "kube_job_spec_active_deadline_seconds",
 			Type: metric.Gauge,
+			Unit: "seconds",
 			Help: "The duration in seconds relative to the startTime that the job may be active before the system tries to terminate it.",
 			GenerateFunc: wrapJobFunc(func(j *v1batch.Job) *metric.Family {
 				ms := []*metric.Metric{}
@@ -307,7 +312,21 @@ var (
 			}),
 		},
 	}
-)
+
+	if allowAnnotations != nil {
+		allowedAnnotations := newKeyAllowlist(allowAnnotations)
+		families = append(families, metric.FamilyGenerator{
+			Name: "kube_job_annotations",
+			Type: metric.Gauge,
+			Help: "Kubernetes annotations converted to Prometheus labels.",
+			GenerateFunc: wrapJobFunc(func(j *v1batch.Job) *metric.Family {
+				return kubeAnnotationsFamily(j.Annotations, allowedAnnotations)
+			}),
+		})
+	}
+
+	return families
+}
 
 func wrapJobFunc(f func(*v1batch.Job) *metric.Family) func(interface{}) *metric.Family {
 	return func(obj interface{}) *metric.Family {
@@ -254,8 +254,8 @@ func TestJobStore(t *testing.T) {
 		},
 	}
 	for i, c := range cases {
-		c.Func = metric.ComposeMetricGenFuncs(jobMetricFamilies)
-		c.Headers = metric.ExtractMetricFamilyHeaders(jobMetricFamilies)
+		c.Func = metric.ComposeMetricGenFuncs(jobMetricFamilies(nil, nil))
+		c.Headers = metric.ExtractMetricFamilyHeaders(jobMetricFamilies(nil, nil))
 		if err := c.run(); err != nil {
 			t.Errorf("unexpected collecting result in %vth run:\n%s", i, err)
 		}
@@ -29,8 +29,10 @@ import (
 
 var (
 	descLimitRangeLabelsDefaultLabels = []string{"namespace", "limitrange"}
+)
 
-	limitRangeMetricFamilies = []metric.FamilyGenerator{
+func limitRangeMetricFamilies(allowAnnotations []string) []metric.FamilyGenerator {
+	families := []metric.FamilyGenerator{
 		{
 			Name: "kube_limitrange",
 			Type: metric.Gauge,
@@ -105,7 +107,21 @@ var (
 			}),
 		},
 	}
-)
+
+	if allowAnnotations != nil {
+		allowedAnnotations := newKeyAllowlist(allowAnnotations)
+		families = append(families, metric.FamilyGenerator{
+			Name: "kube_limitrange_annotations",
+			Type: metric.Gauge,
+			Help: "Kubernetes annotations converted to Prometheus labels.",
+			GenerateFunc: wrapLimitRangeFunc(func(r *v1.LimitRange) *metric.Family {
+				return kubeAnnotationsFamily(r.Annotations, allowedAnnotations)
+			}),
+		})
+	}
+
+	return families
+}
 
 func wrapLimitRangeFunc(f func(*v1.LimitRange) *metric.Family) func(interface{}) *metric.Family {
 	return func(obj interface{}) *metric.Family {
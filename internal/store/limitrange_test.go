@@ -81,8 +81,40 @@ func TestLimitRangeStore(t *testing.T) {
 		},
 	}
 	for i, c := range cases {
-		c.Func = metric.ComposeMetricGenFuncs(limitRangeMetricFamilies)
-		c.Headers = metric.ExtractMetricFamilyHeaders(limitRangeMetricFamilies)
+		c.Func = metric.ComposeMetricGenFuncs(limitRangeMetricFamilies(nil))
+		c.Headers = metric.ExtractMetricFamilyHeaders(limitRangeMetricFamilies(nil))
+		if err := c.run(); err != nil {
+			t.Errorf("unexpected collecting result in %vth run:\n%s", i, err)
+		}
+	}
+}
+
+func TestLimitRangeStoreAnnotations(t *testing.T) {
+	cases := []generateMetricsTestCase{
+		{
+			Obj: &v1.LimitRange{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "quotaTest",
+					Namespace: "testNS",
+					Annotations: map[string]string{
+						"example.com/owner": "platform",
+						"example.com.owner": "collision",
+						"example.org/owner": "other",
+					},
+				},
+			},
+			Want: `
+				# HELP kube_limitrange_annotations Kubernetes annotations converted to Prometheus labels.
+				# TYPE kube_limitrange_annotations gauge
+				kube_limitrange_annotations{annotation_example_com_owner="collision",limitrange="quotaTest",namespace="testNS"} 1
+`,
+			MetricNames: []string{"kube_limitrange_annotations"},
+		},
+	}
+	families := limitRangeMetricFamilies([]string{"example.com*"})
+	for i, c := range cases {
+		c.Func = metric.ComposeMetricGenFuncs(families)
+		c.Headers = metric.ExtractMetricFamilyHeaders(families)
 		if err := c.run(); err != nil {
 			t.Errorf("unexpected collecting result in %vth run:\n%s", i, err)
 		}
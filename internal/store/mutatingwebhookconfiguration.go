@@ -30,8 +30,10 @@ import (
 var (
 	descMutatingWebhookConfigurationHelp          = "Kubernetes labels converted to Prometheus labels."
 	descMutatingWebhookConfigurationDefaultLabels = []string{"namespace", "mutatingwebhookconfiguration"}
+)
 
-	mutatingWebhookConfigurationMetricFamilies = []metric.FamilyGenerator{
+func mutatingWebhookConfigurationMetricFamilies(allowAnnotations []string) []metric.FamilyGenerator {
+	families := []metric.FamilyGenerator{
 		{
 			Name: "kube_mutatingwebhookconfiguration_info",
 			Type: metric.Gauge,
@@ -80,7 +82,21 @@ var (
 			}),
 		},
 	}
-)
+
+	if allowAnnotations != nil {
+		allowedAnnotations := newKeyAllowlist(allowAnnotations)
+		families = append(families, metric.FamilyGenerator{
+			Name: "kube_mutatingwebhookconfiguration_annotations",
+			Type: metric.Gauge,
+			Help: "Kubernetes annotations converted to Prometheus labels.",
+			GenerateFunc: wrapMutatingWebhookConfigurationFunc(func(mwc *admissionregistration.MutatingWebhookConfiguration) *metric.Family {
+				return kubeAnnotationsFamily(mwc.Annotations, allowedAnnotations)
+			}),
+		})
+	}
+
+	return families
+}
 
 func createMutatingWebhookConfigurationListWatch(kubeClient clientset.Interface, ns string) cache.ListerWatcher {
 	return &cache.ListWatch{
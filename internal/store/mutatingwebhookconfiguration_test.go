@@ -72,8 +72,39 @@ func TestMutatingWebhookConfigurationStore(t *testing.T) {
 		},
 	}
 	for i, c := range cases {
-		c.Func = metric.ComposeMetricGenFuncs(mutatingWebhookConfigurationMetricFamilies)
-		c.Headers = metric.ExtractMetricFamilyHeaders(mutatingWebhookConfigurationMetricFamilies)
+		c.Func = metric.ComposeMetricGenFuncs(mutatingWebhookConfigurationMetricFamilies(nil))
+		c.Headers = metric.ExtractMetricFamilyHeaders(mutatingWebhookConfigurationMetricFamilies(nil))
+		if err := c.run(); err != nil {
+			t.Errorf("unexpected collecting result in %vth run:\n%s", i, err)
+		}
+	}
+}
+
+func TestMutatingWebhookConfigurationStoreAnnotations(t *testing.T) {
+	cases := []generateMetricsTestCase{
+		{
+			Obj: &admissionregistration.MutatingWebhookConfiguration{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "mutatingwebhookconfiguration1",
+					Namespace: "ns1",
+					Annotations: map[string]string{
+						"example.com/owner": "platform",
+						"example.org/owner": "other",
+					},
+				},
+			},
+			Want: `
+				# HELP kube_mutatingwebhookconfiguration_annotations Kubernetes annotations converted to Prometheus labels.
+				# TYPE kube_mutatingwebhookconfiguration_annotations gauge
+				kube_mutatingwebhookconfiguration_annotations{annotation_example_com_owner="platform",mutatingwebhookconfiguration="mutatingwebhookconfiguration1",namespace="ns1"} 1
+`,
+			MetricNames: []string{"kube_mutatingwebhookconfiguration_annotations"},
+		},
+	}
+	families := mutatingWebhookConfigurationMetricFamilies([]string{"example.com/owner"})
+	for i, c := range cases {
+		c.Func = metric.ComposeMetricGenFuncs(families)
+		c.Headers = metric.ExtractMetricFamilyHeaders(families)
 		if err := c.run(); err != nil {
 			t.Errorf("unexpected collecting result in %vth run:\n%s", i, err)
 		}
@@ -124,8 +124,8 @@ func TestNamespaceStore(t *testing.T) {
 	}
 
 	for i, c := range cases {
-		c.Func = metric.ComposeMetricGenFuncs(namespaceMetricFamilies)
-		c.Headers = metric.ExtractMetricFamilyHeaders(namespaceMetricFamilies)
+		c.Func = metric.ComposeMetricGenFuncs(namespaceMetricFamilies(nil, nil))
+		c.Headers = metric.ExtractMetricFamilyHeaders(namespaceMetricFamilies(nil, nil))
 		if err := c.run(); err != nil {
 			t.Errorf("unexpected collecting result in %vth run:\n%s", i, err)
 		}
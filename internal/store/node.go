@@ -34,8 +34,12 @@ var (
 	descNodeLabelsName          = "kube_node_labels"
 	descNodeLabelsHelp          = "Kubernetes labels converted to Prometheus labels."
 	descNodeLabelsDefaultLabels = []string{"node"}
+)
+
+func nodeMetricFamilies(allowLabels, allowAnnotations []string) []metric.FamilyGenerator {
+	allowedLabels := newKeyAllowlist(allowLabels)
 
-	nodeMetricFamilies = []metric.FamilyGenerator{
+	families := []metric.FamilyGenerator{
 		{
 			Name: "kube_node_info",
 			Type: metric.Gauge,
@@ -90,7 +94,7 @@ var (
 			Type: metric.Gauge,
 			Help: descNodeLabelsHelp,
 			GenerateFunc: wrapNodeFunc(func(n *v1.Node) *metric.Family {
-				labelKeys, labelValues := kubeLabelsToPrometheusLabels(n.Labels)
+				labelKeys, labelValues := kubeLabelsToPrometheusLabels(n.Labels, allowedLabels)
 				return &metric.Family{
 					Metrics: []*metric.Metric{
 						{
@@ -329,6 +333,7 @@ var (
 		{
 			Name: "kube_node_status_capacity_cpu_cores",
 			Type: metric.Gauge,
+			Unit: "cores",
 			Help: "The total CPU resources of the node.",
 			GenerateFunc: wrapNodeFunc(func(n *v1.Node) *metric.Family {
 				ms := []*metric.Metric{}
@@ -348,6 +353,7 @@ var (
 		{
 			Name: "kube_node_status_capacity_memory_bytes",
 			Type: metric.Gauge,
+			Unit: "bytes",
 			Help: "The total memory resources of the node.",
 			GenerateFunc: wrapNodeFunc(func(n *v1.Node) *metric.Family {
 				ms := []*metric.Metric{}
@@ -465,6 +471,7 @@ var (
 		{
 			Name: "kube_node_status_allocatable_cpu_cores",
 			Type: metric.Gauge,
+			Unit: "cores",
 			Help: "The CPU resources of a node that are available for scheduling.",
 			GenerateFunc: wrapNodeFunc(func(n *v1.Node) *metric.Family {
 				ms := []*metric.Metric{}
@@ -484,6 +491,7 @@ var (
 		{
 			Name: "kube_node_status_allocatable_memory_bytes",
 			Type: metric.Gauge,
+			Unit: "bytes",
 			Help: "The memory resources of a node that are available for scheduling.",
 			GenerateFunc: wrapNodeFunc(func(n *v1.Node) *metric.Family {
 				ms := []*metric.Metric{}
@@ -502,7 +510,21 @@ var (
 			}),
 		},
 	}
-)
+
+	if allowAnnotations != nil {
+		allowedAnnotations := newKeyAllowlist(allowAnnotations)
+		families = append(families, metric.FamilyGenerator{
+			Name: "kube_node_annotations",
+			Type: metric.Gauge,
+			Help: "Kubernetes annotations converted to Prometheus labels.",
+			GenerateFunc: wrapNodeFunc(func(n *v1.Node) *metric.Family {
+				return kubeAnnotationsFamily(n.Annotations, allowedAnnotations)
+			}),
+		})
+	}
+
+	return families
+}
 
 func wrapNodeFunc(f func(*v1.Node) *metric.Family) func(interface{}) *metric.Family {
 	return func(obj interface{}) *metric.Family {
@@ -333,8 +333,61 @@ func TestNodeStore(t *testing.T) {
 		},
 	}
 	for i, c := range cases {
-		c.Func = metric.ComposeMetricGenFuncs(nodeMetricFamilies)
-		c.Headers = metric.ExtractMetricFamilyHeaders(nodeMetricFamilies)
+		c.Func = metric.ComposeMetricGenFuncs(nodeMetricFamilies(nil, nil))
+		c.Headers = metric.ExtractMetricFamilyHeaders(nodeMetricFamilies(nil, nil))
+		if err := c.run(); err != nil {
+			t.Errorf("unexpected collecting result in %vth run:\n%s", i, err)
+		}
+	}
+}
+
+func TestNodeStoreAllowlists(t *testing.T) {
+	cases := []generateMetricsTestCase{
+		{
+			Obj: &v1.Node{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "127.0.0.1",
+					Labels: map[string]string{
+						"kubernetes.io/hostname":           "node-1",
+						"node.kubernetes.io/instance-type": "m5.large",
+					},
+					Annotations: map[string]string{
+						"example.com/owner":            "platform",
+						"node.alpha.kubernetes.io/ttl": "0",
+					},
+				},
+			},
+			Want: `
+				# HELP kube_node_annotations Kubernetes annotations converted to Prometheus labels.
+				# HELP kube_node_labels Kubernetes labels converted to Prometheus labels.
+				# TYPE kube_node_annotations gauge
+				# TYPE kube_node_labels gauge
+				kube_node_annotations{annotation_example_com_owner="platform",node="127.0.0.1"} 1
+				kube_node_labels{label_node_kubernetes_io_instance_type="m5.large",node="127.0.0.1"} 1
+`,
+			MetricNames: []string{"kube_node_annotations", "kube_node_labels"},
+		},
+		{
+			Obj: &v1.Node{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "127.0.0.2",
+				},
+			},
+			Want: `
+				# HELP kube_node_annotations Kubernetes annotations converted to Prometheus labels.
+				# HELP kube_node_labels Kubernetes labels converted to Prometheus labels.
+				# TYPE kube_node_annotations gauge
+				# TYPE kube_node_labels gauge
+				kube_node_annotations{node="127.0.0.2"} 1
+				kube_node_labels{node="127.0.0.2"} 1
+`,
+			MetricNames: []string{"kube_node_annotations", "kube_node_labels"},
+		},
+	}
+	families := nodeMetricFamilies([]string{"node.kubernetes.io/*"}, []string{"example.com/owner"})
+	for i, c := range cases {
+		c.Func = metric.ComposeMetricGenFuncs(families)
+		c.Headers = metric.ExtractMetricFamilyHeaders(families)
 		if err := c.run(); err != nil {
 			t.Errorf("unexpected collecting result in %vth run:\n%s", i, err)
 		}
@@ -231,8 +231,8 @@ func TestPersistentVolumeStore(t *testing.T) {
 		},
 	}
 	for i, c := range cases {
-		c.Func = metric.ComposeMetricGenFuncs(persistentVolumeMetricFamilies)
-		c.Headers = metric.ExtractMetricFamilyHeaders(persistentVolumeMetricFamilies)
+		c.Func = metric.ComposeMetricGenFuncs(persistentVolumeMetricFamilies(nil, nil))
+		c.Headers = metric.ExtractMetricFamilyHeaders(persistentVolumeMetricFamilies(nil, nil))
 		if err := c.run(); err != nil {
 			t.Errorf("unexpected collecting result in %vth run:\n%s", i, err)
 		}
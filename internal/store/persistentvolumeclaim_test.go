@@ -149,8 +149,8 @@ func TestPersistentVolumeClaimStore(t *testing.T) {
 		},
 	}
 	for i, c := range cases {
-		c.Func = metric.ComposeMetricGenFuncs(persistentVolumeClaimMetricFamilies)
-		c.Headers = metric.ExtractMetricFamilyHeaders(persistentVolumeClaimMetricFamilies)
+		c.Func = metric.ComposeMetricGenFuncs(persistentVolumeClaimMetricFamilies(nil, nil))
+		c.Headers = metric.ExtractMetricFamilyHeaders(persistentVolumeClaimMetricFamilies(nil, nil))
 		if err := c.run(); err != nil {
 			t.Errorf("unexpected collecting result in %vth run:\n%s", i, err)
 		}
@@ -36,8 +36,12 @@ var (
 	descPodLabelsDefaultLabels = []string{"namespace", "pod"}
 	containerWaitingReasons    = []string{"ContainerCreating", "CrashLoopBackOff", "CreateContainerConfigError", "ErrImagePull", "ImagePullBackOff", "CreateContainerError", "InvalidImageName"}
 	containerTerminatedReasons = []string{"OOMKilled", "Completed", "Error", "ContainerCannotRun", "DeadlineExceeded"}
+)
+
+func podMetricFamilies(allowLabels, allowAnnotations []string) []metric.FamilyGenerator {
+	allowedLabels := newKeyAllowlist(allowLabels)
 
-	podMetricFamilies = []metric.FamilyGenerator{
+	families := []metric.FamilyGenerator{
 		{
 			Name: "kube_pod_info",
 			Type: metric.Gauge,
@@ -165,7 +169,7 @@ var (
 			Type: metric.Gauge,
 			Help: "Kubernetes labels converted to Prometheus labels.",
 			GenerateFunc: wrapPodFunc(func(p *v1.Pod) *metric.Family {
-				labelKeys, labelValues := kubeLabelsToPrometheusLabels(p.Labels)
+				labelKeys, labelValues := kubeLabelsToPrometheusLabels(p.Labels, allowedLabels)
 				m := metric.Metric{
 					LabelKeys:   labelKeys,
 					LabelValues: labelValues,
@@ -699,6 +703,7 @@ var (
 						LabelKeys:   []string{"container"},
 						LabelValues: []string{cs.Name},
 						Value:       float64(cs.RestartCount),
+						Created:     podCreated(p),
 					}
 				}
 
@@ -719,6 +724,7 @@ var (
 						LabelKeys:   []string{"container"},
 						LabelValues: []string{cs.Name},
 						Value:       float64(cs.RestartCount),
+						Created:     podCreated(p),
 					}
 				}
 
@@ -904,6 +910,7 @@ var (
 		{
 			Name: "kube_pod_container_resource_requests_cpu_cores",
 			Type: metric.Gauge,
+			Unit: "cores",
 			Help: "The number of requested cpu cores by a container.",
 			GenerateFunc: wrapPodFunc(func(p *v1.Pod) *metric.Family {
 				ms := []*metric.Metric{}
@@ -927,6 +934,7 @@ var (
 		{
 			Name: "kube_pod_container_resource_requests_memory_bytes",
 			Type: metric.Gauge,
+			Unit: "bytes",
 			Help: "The number of requested memory bytes by a container.",
 			GenerateFunc: wrapPodFunc(func(p *v1.Pod) *metric.Family {
 				ms := []*metric.Metric{}
@@ -950,6 +958,7 @@ var (
 		{
 			Name: "kube_pod_container_resource_limits_cpu_cores",
 			Type: metric.Gauge,
+			Unit: "cores",
 			Help: "The limit on cpu cores to be used by a container.",
 			GenerateFunc: wrapPodFunc(func(p *v1.Pod) *metric.Family {
 				ms := []*metric.Metric{}
@@ -973,6 +982,7 @@ var (
 		{
 			Name: "kube_pod_container_resource_limits_memory_bytes",
 			Type: metric.Gauge,
+			Unit: "bytes",
 			Help: "The limit on memory to be used by a container in bytes.",
 			GenerateFunc: wrapPodFunc(func(p *v1.Pod) *metric.Family {
 				ms := []*metric.Metric{}
@@ -1039,7 +1049,21 @@ var (
 			}),
 		},
 	}
-)
+
+	if allowAnnotations != nil {
+		allowedAnnotations := newKeyAllowlist(allowAnnotations)
+		families = append(families, metric.FamilyGenerator{
+			Name: "kube_pod_annotations",
+			Type: metric.Gauge,
+			Help: "Kubernetes annotations converted to Prometheus labels.",
+			GenerateFunc: wrapPodFunc(func(p *v1.Pod) *metric.Family {
+				return kubeAnnotationsFamily(p.Annotations, allowedAnnotations)
+			}),
+		})
+	}
+
+	return families
+}
 
 func wrapPodFunc(f func(*v1.Pod) *metric.Family) func(interface{}) *metric.Family {
 	return func(obj interface{}) *metric.Family {
@@ -1087,3 +1111,14 @@ func lastTerminationReason(cs v1.ContainerStatus, reason string) bool {
 	}
 	return cs.LastTerminationState.Terminated.Reason == reason
 }
+
+// podCreated returns the creation timestamp of the given pod, which the
+// restart counters of its containers are exposed with in the OpenMetrics
+// format. It returns zero if the pod has no creation timestamp.
+func podCreated(p *v1.Pod) float64 {
+	if p.CreationTimestamp.IsZero() {
+		return 0
+	}
+
+	return float64(p.CreationTimestamp.Unix())
+}
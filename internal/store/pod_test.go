@@ -1494,8 +1494,8 @@ kube_pod_container_status_last_terminated_reason{container="container7",namespac
 	}
 
 	for i, c := range cases {
-		c.Func = metric.ComposeMetricGenFuncs(podMetricFamilies)
-		c.Headers = metric.ExtractMetricFamilyHeaders(podMetricFamilies)
+		c.Func = metric.ComposeMetricGenFuncs(podMetricFamilies(nil, nil))
+		c.Headers = metric.ExtractMetricFamilyHeaders(podMetricFamilies(nil, nil))
 		if err := c.run(); err != nil {
 			t.Errorf("unexpected collecting result in %vth run:\n%s", i, err)
 		}
@@ -1505,7 +1505,7 @@ kube_pod_container_status_last_terminated_reason{container="container7",namespac
 func BenchmarkPodStore(b *testing.B) {
 	b.ReportAllocs()
 
-	f := metric.ComposeMetricGenFuncs(podMetricFamilies)
+	f := metric.ComposeMetricGenFuncs(podMetricFamilies(nil, nil))
 
 	pod := &v1.Pod{
 		ObjectMeta: metav1.ObjectMeta{
@@ -29,8 +29,10 @@ import (
 
 var (
 	descPodDisruptionBudgetLabelsDefaultLabels = []string{"namespace", "poddisruptionbudget"}
+)
 
-	podDisruptionBudgetMetricFamilies = []metric.FamilyGenerator{
+func podDisruptionBudgetMetricFamilies(allowAnnotations []string) []metric.FamilyGenerator {
+	families := []metric.FamilyGenerator{
 		{
 			Name: "kube_poddisruptionbudget_created",
 			Type: metric.Gauge,
@@ -120,7 +122,21 @@ var (
 			}),
 		},
 	}
-)
+
+	if allowAnnotations != nil {
+		allowedAnnotations := newKeyAllowlist(allowAnnotations)
+		families = append(families, metric.FamilyGenerator{
+			Name: "kube_poddisruptionbudget_annotations",
+			Type: metric.Gauge,
+			Help: "Kubernetes annotations converted to Prometheus labels.",
+			GenerateFunc: wrapPodDisruptionBudgetFunc(func(p *v1beta1.PodDisruptionBudget) *metric.Family {
+				return kubeAnnotationsFamily(p.Annotations, allowedAnnotations)
+			}),
+		})
+	}
+
+	return families
+}
 
 func wrapPodDisruptionBudgetFunc(f func(*v1beta1.PodDisruptionBudget) *metric.Family) func(interface{}) *metric.Family {
 	return func(obj interface{}) *metric.Family {
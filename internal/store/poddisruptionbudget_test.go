@@ -94,8 +94,8 @@ func TestPodDisruptionBudgetStore(t *testing.T) {
 		},
 	}
 	for i, c := range cases {
-		c.Func = metric.ComposeMetricGenFuncs(podDisruptionBudgetMetricFamilies)
-		c.Headers = metric.ExtractMetricFamilyHeaders(podDisruptionBudgetMetricFamilies)
+		c.Func = metric.ComposeMetricGenFuncs(podDisruptionBudgetMetricFamilies(nil))
+		c.Headers = metric.ExtractMetricFamilyHeaders(podDisruptionBudgetMetricFamilies(nil))
 		if err := c.run(); err != nil {
 			t.Errorf("unexpected collecting result in %vth run:\n%s", i, err)
 		}
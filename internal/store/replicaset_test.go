@@ -130,8 +130,8 @@ func TestReplicaSetStore(t *testing.T) {
 		},
 	}
 	for i, c := range cases {
-		c.Func = metric.ComposeMetricGenFuncs(replicaSetMetricFamilies)
-		c.Headers = metric.ExtractMetricFamilyHeaders(replicaSetMetricFamilies)
+		c.Func = metric.ComposeMetricGenFuncs(replicaSetMetricFamilies(nil, nil))
+		c.Headers = metric.ExtractMetricFamilyHeaders(replicaSetMetricFamilies(nil, nil))
 		if err := c.run(); err != nil {
 			t.Errorf("unexpected collecting result in %vth run:\n%s", i, err)
 		}
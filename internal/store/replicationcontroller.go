@@ -29,8 +29,10 @@ import (
 
 var (
 	descReplicationControllerLabelsDefaultLabels = []string{"namespace", "replicationcontroller"}
+)
 
-	replicationControllerMetricFamilies = []metric.FamilyGenerator{
+func replicationControllerMetricFamilies(allowAnnotations []string) []metric.FamilyGenerator {
+	families := []metric.FamilyGenerator{
 		{
 			Name: "kube_replicationcontroller_created",
 			Type: metric.Gauge,
@@ -152,7 +154,21 @@ var (
 			}),
 		},
 	}
-)
+
+	if allowAnnotations != nil {
+		allowedAnnotations := newKeyAllowlist(allowAnnotations)
+		families = append(families, metric.FamilyGenerator{
+			Name: "kube_replicationcontroller_annotations",
+			Type: metric.Gauge,
+			Help: "Kubernetes annotations converted to Prometheus labels.",
+			GenerateFunc: wrapReplicationControllerFunc(func(r *v1.ReplicationController) *metric.Family {
+				return kubeAnnotationsFamily(r.Annotations, allowedAnnotations)
+			}),
+		})
+	}
+
+	return families
+}
 
 func wrapReplicationControllerFunc(f func(*v1.ReplicationController) *metric.Family) func(interface{}) *metric.Family {
 	return func(obj interface{}) *metric.Family {
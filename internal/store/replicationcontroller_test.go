@@ -113,8 +113,8 @@ func TestReplicationControllerStore(t *testing.T) {
 		},
 	}
 	for i, c := range cases {
-		c.Func = metric.ComposeMetricGenFuncs(replicationControllerMetricFamilies)
-		c.Headers = metric.ExtractMetricFamilyHeaders(replicationControllerMetricFamilies)
+		c.Func = metric.ComposeMetricGenFuncs(replicationControllerMetricFamilies(nil))
+		c.Headers = metric.ExtractMetricFamilyHeaders(replicationControllerMetricFamilies(nil))
 		if err := c.run(); err != nil {
 			t.Errorf("unexpected collecting result in %vth run:\n%s", i, err)
 		}
@@ -29,8 +29,10 @@ import (
 
 var (
 	descResourceQuotaLabelsDefaultLabels = []string{"namespace", "resourcequota"}
+)
 
-	resourceQuotaMetricFamilies = []metric.FamilyGenerator{
+func resourceQuotaMetricFamilies(allowAnnotations []string) []metric.FamilyGenerator {
+	families := []metric.FamilyGenerator{
 		{
 			Name: "kube_resourcequota_created",
 			Type: metric.Gauge,
@@ -80,7 +82,21 @@ var (
 			}),
 		},
 	}
-)
+
+	if allowAnnotations != nil {
+		allowedAnnotations := newKeyAllowlist(allowAnnotations)
+		families = append(families, metric.FamilyGenerator{
+			Name: "kube_resourcequota_annotations",
+			Type: metric.Gauge,
+			Help: "Kubernetes annotations converted to Prometheus labels.",
+			GenerateFunc: wrapResourceQuotaFunc(func(r *v1.ResourceQuota) *metric.Family {
+				return kubeAnnotationsFamily(r.Annotations, allowedAnnotations)
+			}),
+		})
+	}
+
+	return families
+}
 
 func wrapResourceQuotaFunc(f func(*v1.ResourceQuota) *metric.Family) func(interface{}) *metric.Family {
 	return func(obj interface{}) *metric.Family {
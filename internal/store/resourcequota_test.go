@@ -134,8 +134,8 @@ func TestResourceQuotaStore(t *testing.T) {
 		},
 	}
 	for i, c := range cases {
-		c.Func = metric.ComposeMetricGenFuncs(resourceQuotaMetricFamilies)
-		c.Headers = metric.ExtractMetricFamilyHeaders(resourceQuotaMetricFamilies)
+		c.Func = metric.ComposeMetricGenFuncs(resourceQuotaMetricFamilies(nil))
+		c.Headers = metric.ExtractMetricFamilyHeaders(resourceQuotaMetricFamilies(nil))
 		if err := c.run(); err != nil {
 			t.Errorf("unexpected collecting result in %vth run:\n%s", i, err)
 		}
@@ -117,11 +117,77 @@ func TestSecretStore(t *testing.T) {
 		},
 	}
 	for i, c := range cases {
-		c.Func = metric.ComposeMetricGenFuncs(secretMetricFamilies)
-		c.Headers = metric.ExtractMetricFamilyHeaders(secretMetricFamilies)
+		c.Func = metric.ComposeMetricGenFuncs(secretMetricFamilies(nil, nil))
+		c.Headers = metric.ExtractMetricFamilyHeaders(secretMetricFamilies(nil, nil))
 		if err := c.run(); err != nil {
 			t.Errorf("unexpected collecting result in %vth run:\n%s", i, err)
 		}
 
 	}
 }
+
+func TestSecretStoreAllowlists(t *testing.T) {
+	cases := []generateMetricsTestCase{
+		{
+			Obj: &v1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "secret1",
+					Namespace: "ns1",
+					Labels: map[string]string{
+						"app":               "web",
+						"pod-template-hash": "5d4f8b7c9",
+					},
+					Annotations: map[string]string{
+						"example.com/owner":                                "platform",
+						"example.com/cost-center":                          "42",
+						"kubectl.kubernetes.io/last-applied-configuration": "{}",
+					},
+				},
+			},
+			Want: `
+				# HELP kube_secret_annotations Kubernetes annotations converted to Prometheus labels.
+				# HELP kube_secret_labels Kubernetes labels converted to Prometheus labels.
+				# TYPE kube_secret_annotations gauge
+				# TYPE kube_secret_labels gauge
+				kube_secret_annotations{annotation_example_com_cost_center="42",annotation_example_com_owner="platform",namespace="ns1",secret="secret1"} 1
+				kube_secret_labels{label_app="web",namespace="ns1",secret="secret1"} 1
+`,
+			MetricNames: []string{"kube_secret_annotations", "kube_secret_labels"},
+		},
+	}
+	families := secretMetricFamilies([]string{"app"}, []string{"example.com/*"})
+	for i, c := range cases {
+		c.Func = metric.ComposeMetricGenFuncs(families)
+		c.Headers = metric.ExtractMetricFamilyHeaders(families)
+		if err := c.run(); err != nil {
+			t.Errorf("unexpected collecting result in %vth run:\n%s", i, err)
+		}
+	}
+
+	// The last applied configuration contains the data of the secret, hence
+	// it is not exposed even if all annotations are allowed.
+	families = secretMetricFamilies(nil, []string{"*"})
+	c := generateMetricsTestCase{
+		Obj: &v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "secret1",
+				Namespace: "ns1",
+				Annotations: map[string]string{
+					"example.com/owner": "platform",
+					"kubectl.kubernetes.io/last-applied-configuration": `{"data":{"password":"c2VjcmV0"}}`,
+				},
+			},
+		},
+		Want: `
+			# HELP kube_secret_annotations Kubernetes annotations converted to Prometheus labels.
+			# TYPE kube_secret_annotations gauge
+			kube_secret_annotations{annotation_example_com_owner="platform",namespace="ns1",secret="secret1"} 1
+`,
+		MetricNames: []string{"kube_secret_annotations"},
+		Func:        metric.ComposeMetricGenFuncs(families),
+		Headers:     metric.ExtractMetricFamilyHeaders(families),
+	}
+	if err := c.run(); err != nil {
+		t.Errorf("unexpected collecting result with all annotations allowed:\n%s", err)
+	}
+}
@@ -0,0 +1,70 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package store
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+
+	"k8s.io/kube-state-metrics/pkg/options"
+)
+
+// selectingListWatch lists and watches only the objects matching a label and
+// a field selector, which are filtered by the API server.
+type selectingListWatch struct {
+	selector options.ListSelector
+	lw       cache.ListerWatcher
+}
+
+// newSelectingListWatch returns a ListerWatcher restricting the given one to
+// the objects matching the given selector.
+func newSelectingListWatch(s options.ListSelector, lw cache.ListerWatcher) cache.ListerWatcher {
+	if s.LabelSelector == "" && s.FieldSelector == "" {
+		return lw
+	}
+
+	return &selectingListWatch{selector: s, lw: lw}
+}
+
+func (s *selectingListWatch) List(opts metav1.ListOptions) (runtime.Object, error) {
+	return s.lw.List(s.options(opts))
+}
+
+func (s *selectingListWatch) Watch(opts metav1.ListOptions) (watch.Interface, error) {
+	return s.lw.Watch(s.options(opts))
+}
+
+// options returns the given list options with the selectors set.
+func (s *selectingListWatch) options(opts metav1.ListOptions) metav1.ListOptions {
+	opts.LabelSelector = s.selector.LabelSelector
+	opts.FieldSelector = s.selector.FieldSelector
+	return opts
+}
+
+// validateListSelector returns an error if the label or field selector of the
+// given ListSelector can not be parsed.
+func validateListSelector(s options.ListSelector) error {
+	if _, err := labels.Parse(s.LabelSelector); err != nil {
+		return err
+	}
+	_, err := fields.ParseSelector(s.FieldSelector)
+	return err
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package store
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+
+	"k8s.io/kube-state-metrics/pkg/options"
+)
+
+func TestSelectingListWatch(t *testing.T) {
+	var listOpts, watchOpts metav1.ListOptions
+	lw := &cache.ListWatch{
+		ListFunc: func(opts metav1.ListOptions) (runtime.Object, error) {
+			listOpts = opts
+			return &metav1.List{}, nil
+		},
+		WatchFunc: func(opts metav1.ListOptions) (watch.Interface, error) {
+			watchOpts = opts
+			return watch.NewFake(), nil
+		},
+	}
+
+	if got := newSelectingListWatch(options.ListSelector{}, lw); got != lw {
+		t.Error("expected ListerWatcher without selectors to be returned unchanged")
+	}
+
+	s := newSelectingListWatch(options.ListSelector{
+		LabelSelector: "team=platform",
+		FieldSelector: "status.phase!=Succeeded",
+	}, lw)
+	if _, err := s.List(metav1.ListOptions{ResourceVersion: "0"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Watch(metav1.ListOptions{ResourceVersion: "42"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, opts := range []metav1.ListOptions{listOpts, watchOpts} {
+		if opts.LabelSelector != "team=platform" || opts.FieldSelector != "status.phase!=Succeeded" {
+			t.Errorf("expected selectors to be set, got label selector %q and field selector %q", opts.LabelSelector, opts.FieldSelector)
+		}
+	}
+	if listOpts.ResourceVersion != "0" || watchOpts.ResourceVersion != "42" {
+		t.Errorf("expected other options to be kept, got resource versions %q and %q", listOpts.ResourceVersion, watchOpts.ResourceVersion)
+	}
+}
+
+func TestValidateListSelector(t *testing.T) {
+	tests := []struct {
+		selector options.ListSelector
+		wantErr  bool
+	}{
+		{selector: options.ListSelector{}},
+		{selector: options.ListSelector{LabelSelector: "team in (platform,infra),!canary", FieldSelector: "spec.nodeName=node-1"}},
+		{selector: options.ListSelector{LabelSelector: "team in (platform"}, wantErr: true},
+		{selector: options.ListSelector{FieldSelector: "status.phase"}, wantErr: true},
+	}
+
+	for _, test := range tests {
+		err := validateListSelector(test.selector)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%+v: expected error %v but got %v", test.selector, test.wantErr, err)
+		}
+	}
+}
@@ -31,8 +31,12 @@ var (
 	descServiceLabelsName          = "kube_service_labels"
 	descServiceLabelsHelp          = "Kubernetes labels converted to Prometheus labels."
 	descServiceLabelsDefaultLabels = []string{"namespace", "service"}
+)
+
+func serviceMetricFamilies(allowLabels, allowAnnotations []string) []metric.FamilyGenerator {
+	allowedLabels := newKeyAllowlist(allowLabels)
 
-	serviceMetricFamilies = []metric.FamilyGenerator{
+	families := []metric.FamilyGenerator{
 		{
 			Name: "kube_service_info",
 			Type: metric.Gauge,
@@ -81,7 +85,7 @@ var (
 			Type: metric.Gauge,
 			Help: descServiceLabelsHelp,
 			GenerateFunc: wrapSvcFunc(func(s *v1.Service) *metric.Family {
-				labelKeys, labelValues := kubeLabelsToPrometheusLabels(s.Labels)
+				labelKeys, labelValues := kubeLabelsToPrometheusLabels(s.Labels, allowedLabels)
 				m := metric.Metric{
 
 					LabelKeys:   labelKeys,
@@ -144,7 +148,21 @@ var (
 			}),
 		},
 	}
-)
+
+	if allowAnnotations != nil {
+		allowedAnnotations := newKeyAllowlist(allowAnnotations)
+		families = append(families, metric.FamilyGenerator{
+			Name: "kube_service_annotations",
+			Type: metric.Gauge,
+			Help: "Kubernetes annotations converted to Prometheus labels.",
+			GenerateFunc: wrapSvcFunc(func(s *v1.Service) *metric.Family {
+				return kubeAnnotationsFamily(s.Annotations, allowedAnnotations)
+			}),
+		})
+	}
+
+	return families
+}
 
 func wrapSvcFunc(f func(*v1.Service) *metric.Family) func(interface{}) *metric.Family {
 	return func(obj interface{}) *metric.Family {
@@ -209,8 +209,8 @@ func TestServiceStore(t *testing.T) {
 		},
 	}
 	for i, c := range cases {
-		c.Func = metric.ComposeMetricGenFuncs(serviceMetricFamilies)
-		c.Headers = metric.ExtractMetricFamilyHeaders(serviceMetricFamilies)
+		c.Func = metric.ComposeMetricGenFuncs(serviceMetricFamilies(nil, nil))
+		c.Headers = metric.ExtractMetricFamilyHeaders(serviceMetricFamilies(nil, nil))
 		if err := c.run(); err != nil {
 			t.Errorf("unexpected collecting result in %vth run:\n%s", i, err)
 		}
@@ -241,8 +241,8 @@ func TestStatefulSetStore(t *testing.T) {
 		},
 	}
 	for i, c := range cases {
-		c.Func = metric.ComposeMetricGenFuncs(statefulSetMetricFamilies)
-		c.Headers = metric.ExtractMetricFamilyHeaders(statefulSetMetricFamilies)
+		c.Func = metric.ComposeMetricGenFuncs(statefulSetMetricFamilies(nil, nil))
+		c.Headers = metric.ExtractMetricFamilyHeaders(statefulSetMetricFamilies(nil, nil))
 		if err := c.run(); err != nil {
 			t.Errorf("unexpected collecting result in %vth run:\n%s", i, err)
 		}
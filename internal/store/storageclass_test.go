@@ -108,8 +108,8 @@ func TestStorageClassStore(t *testing.T) {
 		},
 	}
 	for i, c := range cases {
-		c.Func = metric.ComposeMetricGenFuncs(storageClassMetricFamilies)
-		c.Headers = metric.ExtractMetricFamilyHeaders(storageClassMetricFamilies)
+		c.Func = metric.ComposeMetricGenFuncs(storageClassMetricFamilies(nil, nil))
+		c.Headers = metric.ExtractMetricFamilyHeaders(storageClassMetricFamilies(nil, nil))
 		if err := c.run(); err != nil {
 			t.Errorf("unexpected collecting result in %vth run:\n%s", i, err)
 		}
@@ -0,0 +1,72 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package store
+
+import (
+	"sync/atomic"
+
+	"k8s.io/client-go/tools/cache"
+)
+
+// SyncStatus contains the HasSynced functions of the reflectors of each
+// collector, indexed by the name of the collector.
+type SyncStatus map[string][]cache.InformerSynced
+
+// Synced returns for each collector whether all of its reflectors completed
+// their initial list.
+func (s SyncStatus) Synced() map[string]bool {
+	synced := make(map[string]bool, len(s))
+
+	for collector, hasSynced := range s {
+		synced[collector] = true
+		for _, f := range hasSynced {
+			if !f() {
+				synced[collector] = false
+				break
+			}
+		}
+	}
+
+	return synced
+}
+
+// syncTrackingStore wraps the cache.Store of a single reflector and tracks
+// whether the reflector completed its initial list, which a reflector
+// delivers to its store via Replace.
+type syncTrackingStore struct {
+	cache.Store
+	synced int32
+}
+
+func newSyncTrackingStore(s cache.Store) *syncTrackingStore {
+	return &syncTrackingStore{Store: s}
+}
+
+// Replace implements the Replace method of the store interface.
+func (s *syncTrackingStore) Replace(list []interface{}, resourceVersion string) error {
+	if err := s.Store.Replace(list, resourceVersion); err != nil {
+		return err
+	}
+
+	atomic.StoreInt32(&s.synced, 1)
+	return nil
+}
+
+// HasSynced returns whether the initial list was replaced into the store.
+func (s *syncTrackingStore) HasSynced() bool {
+	return atomic.LoadInt32(&s.synced) == 1
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package store
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestSyncStatus(t *testing.T) {
+	pods := newSyncTrackingStore(cache.NewStore(cache.MetaNamespaceKeyFunc))
+	nodesDefault := newSyncTrackingStore(cache.NewStore(cache.MetaNamespaceKeyFunc))
+	nodesKubeSystem := newSyncTrackingStore(cache.NewStore(cache.MetaNamespaceKeyFunc))
+
+	status := SyncStatus{
+		"pods":  {pods.HasSynced},
+		"nodes": {nodesDefault.HasSynced, nodesKubeSystem.HasSynced},
+	}
+
+	steps := []struct {
+		replace *syncTrackingStore
+		want    map[string]bool
+	}{
+		{
+			want: map[string]bool{"pods": false, "nodes": false},
+		},
+		{
+			replace: pods,
+			want:    map[string]bool{"pods": true, "nodes": false},
+		},
+		{
+			replace: nodesDefault,
+			want:    map[string]bool{"pods": true, "nodes": false},
+		},
+		{
+			replace: nodesKubeSystem,
+			want:    map[string]bool{"pods": true, "nodes": true},
+		},
+	}
+
+	for i, step := range steps {
+		if step.replace != nil {
+			if err := step.replace.Replace(nil, "1"); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if got := status.Synced(); !reflect.DeepEqual(got, step.want) {
+			t.Errorf("step %d: expected %v but got %v", i, step.want, got)
+		}
+	}
+}
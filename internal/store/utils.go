@@ -57,21 +57,118 @@ func addConditionMetrics(cs v1.ConditionStatus) []*metric.Metric {
 	return ms
 }
 
-func kubeLabelsToPrometheusLabels(labels map[string]string) ([]string, []string) {
-	labelKeys := make([]string, 0, len(labels))
-	for k := range labels {
-		labelKeys = append(labelKeys, k)
+// keyAllowlist allows Kubernetes label or annotation keys by their exact key or
+// by patterns in which * matches any sequence of characters, e.g.
+// app.kubernetes.io/*. A nil keyAllowlist allows all keys.
+type keyAllowlist struct {
+	keys     map[string]struct{}
+	patterns []*regexp.Regexp
+}
+
+// newKeyAllowlist returns a keyAllowlist allowing the given keys and patterns,
+// or nil, allowing all keys, if keys is nil.
+func newKeyAllowlist(keys []string) *keyAllowlist {
+	if keys == nil {
+		return nil
+	}
+
+	l := &keyAllowlist{keys: map[string]struct{}{}}
+	for _, k := range keys {
+		if !strings.Contains(k, "*") {
+			l.keys[k] = struct{}{}
+			continue
+		}
+		pattern := strings.Replace(regexp.QuoteMeta(k), `\*`, ".*", -1)
+		l.patterns = append(l.patterns, regexp.MustCompile("^"+pattern+"$"))
+	}
+	return l
+}
+
+// allows returns whether the given key is allowed.
+func (l *keyAllowlist) allows(key string) bool {
+	if l == nil {
+		return true
+	}
+	if _, ok := l.keys[key]; ok {
+		return true
+	}
+	for _, p := range l.patterns {
+		if p.MatchString(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// kubeLabelsToPrometheusLabels converts the given Kubernetes labels allowed by
+// the given allowlist to Prometheus label keys, prefixed with label_, and
+// values, ordered by key.
+func kubeLabelsToPrometheusLabels(labels map[string]string, allowed *keyAllowlist) ([]string, []string) {
+	return mapToPrometheusLabels(labels, "label_", allowed)
+}
+
+// kubeAnnotationsToPrometheusLabels converts the given Kubernetes annotations
+// allowed by the given allowlist to Prometheus label keys, prefixed with
+// annotation_, and values, ordered by key. The last applied configuration of
+// kubectl is never converted, even if allowed by a pattern, as it contains the
+// entire object, e.g. the data of a secret.
+func kubeAnnotationsToPrometheusLabels(annotations map[string]string, allowed *keyAllowlist) ([]string, []string) {
+	return mapToPrometheusLabels(annotations, "annotation_", allowed, v1.LastAppliedConfigAnnotation)
+}
+
+// kubeAnnotationsFamily returns the family of the kube_<resource>_annotations
+// metric with the given Kubernetes annotations allowed by the given allowlist.
+func kubeAnnotationsFamily(annotations map[string]string, allowed *keyAllowlist) *metric.Family {
+	annotationKeys, annotationValues := kubeAnnotationsToPrometheusLabels(annotations, allowed)
+	return &metric.Family{
+		Metrics: []*metric.Metric{
+			{
+				LabelKeys:   annotationKeys,
+				LabelValues: annotationValues,
+				Value:       1,
+			},
+		},
 	}
-	sort.Strings(labelKeys)
+}
 
-	labelValues := make([]string, 0, len(labels))
-	for i, k := range labelKeys {
-		labelKeys[i] = "label_" + sanitizeLabelName(k)
-		labelValues = append(labelValues, labels[k])
+// mapToPrometheusLabels converts the keys of the given map allowed by the given
+// allowlist, except the excluded ones, to sanitized Prometheus label keys with
+// the given prefix. Keys colliding after sanitization, e.g. a.b and a_b, would
+// result in duplicate labels, hence only the first of them in order is kept.
+func mapToPrometheusLabels(m map[string]string, prefix string, allowed *keyAllowlist, excluded ...string) ([]string, []string) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		if allowed.allows(k) && !containsString(excluded, k) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	labelKeys := make([]string, 0, len(keys))
+	labelValues := make([]string, 0, len(keys))
+	seen := make(map[string]struct{}, len(keys))
+	for _, k := range keys {
+		labelKey := prefix + sanitizeLabelName(k)
+		if _, ok := seen[labelKey]; ok {
+			continue
+		}
+		seen[labelKey] = struct{}{}
+		labelKeys = append(labelKeys, labelKey)
+		labelValues = append(labelValues, m[k])
 	}
 	return labelKeys, labelValues
 }
 
+// containsString returns whether the given values contain the given value.
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
 func sanitizeLabelName(s string) string {
 	return invalidLabelCharRE.ReplaceAllString(s, "_")
 }
@@ -129,6 +129,7 @@ func TestIsExtendedResourceName(t *testing.T) {
 func TestKubeLabelsToPrometheusLabels(t *testing.T) {
 	testCases := []struct {
 		kubeLabels   map[string]string
+		allowLabels  []string
 		expectKeys   []string
 		expectValues []string
 	}{
@@ -176,11 +177,58 @@ func TestKubeLabelsToPrometheusLabels(t *testing.T) {
 			expectKeys:   []string{"label_an", "label_order", "label_test"},
 			expectValues: []string{"", "", ""},
 		},
+		{
+			kubeLabels: map[string]string{
+				"app":               "web",
+				"team":              "platform",
+				"pod-template-hash": "5d4f8b7c9",
+			},
+			allowLabels:  []string{"app", "team", "tier"},
+			expectKeys:   []string{"label_app", "label_team"},
+			expectValues: []string{"web", "platform"},
+		},
+		{
+			kubeLabels: map[string]string{
+				"app.kubernetes.io/name":    "web",
+				"app.kubernetes.io/part-of": "shop",
+				"appname":                   "web",
+			},
+			allowLabels:  []string{"app.kubernetes.io/*"},
+			expectKeys:   []string{"label_app_kubernetes_io_name", "label_app_kubernetes_io_part_of"},
+			expectValues: []string{"web", "shop"},
+		},
+		{
+			kubeLabels: map[string]string{
+				"app":  "web",
+				"team": "platform",
+			},
+			allowLabels:  []string{"*"},
+			expectKeys:   []string{"label_app", "label_team"},
+			expectValues: []string{"web", "platform"},
+		},
+		{
+			kubeLabels: map[string]string{
+				"app": "web",
+			},
+			allowLabels:  []string{},
+			expectKeys:   []string{},
+			expectValues: []string{},
+		},
+		{
+			kubeLabels: map[string]string{
+				"app.name": "dot",
+				"app_name": "underscore",
+				"app-name": "dash",
+				"team":     "platform",
+			},
+			expectKeys:   []string{"label_app_name", "label_team"},
+			expectValues: []string{"dash", "platform"},
+		},
 	}
 
 	for _, tc := range testCases {
-		t.Run(fmt.Sprintf("kubelabels input=%v , expected prometheus keys=%v, expected prometheus values=%v", tc.kubeLabels, tc.expectKeys, tc.expectValues), func(t *testing.T) {
-			labelKeys, labelValues := kubeLabelsToPrometheusLabels(tc.kubeLabels)
+		t.Run(fmt.Sprintf("kubelabels input=%v , allowed=%v, expected prometheus keys=%v, expected prometheus values=%v", tc.kubeLabels, tc.allowLabels, tc.expectKeys, tc.expectValues), func(t *testing.T) {
+			labelKeys, labelValues := kubeLabelsToPrometheusLabels(tc.kubeLabels, newKeyAllowlist(tc.allowLabels))
 			if len(labelKeys) != len(tc.expectKeys) {
 				t.Errorf("Got Prometheus label keys with len %d but expected %d", len(labelKeys), len(tc.expectKeys))
 			}
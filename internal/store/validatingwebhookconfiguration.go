@@ -30,8 +30,10 @@ import (
 var (
 	descValidatingWebhookConfigurationHelp          = "Kubernetes labels converted to Prometheus labels."
 	descValidatingWebhookConfigurationDefaultLabels = []string{"namespace", "validatingwebhookconfiguration"}
+)
 
-	validatingWebhookConfigurationMetricFamilies = []metric.FamilyGenerator{
+func validatingWebhookConfigurationMetricFamilies(allowAnnotations []string) []metric.FamilyGenerator {
+	families := []metric.FamilyGenerator{
 		{
 			Name: "kube_validatingwebhookconfiguration_info",
 			Type: metric.Gauge,
@@ -80,7 +82,21 @@ var (
 			}),
 		},
 	}
-)
+
+	if allowAnnotations != nil {
+		allowedAnnotations := newKeyAllowlist(allowAnnotations)
+		families = append(families, metric.FamilyGenerator{
+			Name: "kube_validatingwebhookconfiguration_annotations",
+			Type: metric.Gauge,
+			Help: "Kubernetes annotations converted to Prometheus labels.",
+			GenerateFunc: wrapValidatingWebhookConfigurationFunc(func(vwc *admissionregistration.ValidatingWebhookConfiguration) *metric.Family {
+				return kubeAnnotationsFamily(vwc.Annotations, allowedAnnotations)
+			}),
+		})
+	}
+
+	return families
+}
 
 func createValidatingWebhookConfigurationListWatch(kubeClient clientset.Interface, ns string) cache.ListerWatcher {
 	return &cache.ListWatch{
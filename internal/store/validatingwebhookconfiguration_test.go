@@ -72,8 +72,39 @@ func TestValidatingWebhookConfigurationStore(t *testing.T) {
 		},
 	}
 	for i, c := range cases {
-		c.Func = metric.ComposeMetricGenFuncs(validatingWebhookConfigurationMetricFamilies)
-		c.Headers = metric.ExtractMetricFamilyHeaders(validatingWebhookConfigurationMetricFamilies)
+		c.Func = metric.ComposeMetricGenFuncs(validatingWebhookConfigurationMetricFamilies(nil))
+		c.Headers = metric.ExtractMetricFamilyHeaders(validatingWebhookConfigurationMetricFamilies(nil))
+		if err := c.run(); err != nil {
+			t.Errorf("unexpected collecting result in %vth run:\n%s", i, err)
+		}
+	}
+}
+
+func TestValidatingWebhookConfigurationStoreAnnotations(t *testing.T) {
+	cases := []generateMetricsTestCase{
+		{
+			Obj: &admissionregistration.ValidatingWebhookConfiguration{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "validatingwebhookconfiguration1",
+					Namespace: "ns1",
+					Annotations: map[string]string{
+						"example.com/owner": "platform",
+						"example.org/owner": "other",
+					},
+				},
+			},
+			Want: `
+				# HELP kube_validatingwebhookconfiguration_annotations Kubernetes annotations converted to Prometheus labels.
+				# TYPE kube_validatingwebhookconfiguration_annotations gauge
+				kube_validatingwebhookconfiguration_annotations{annotation_example_com_owner="platform",annotation_example_org_owner="other",namespace="ns1",validatingwebhookconfiguration="validatingwebhookconfiguration1"} 1
+`,
+			MetricNames: []string{"kube_validatingwebhookconfiguration_annotations"},
+		},
+	}
+	families := validatingWebhookConfigurationMetricFamilies([]string{"*"})
+	for i, c := range cases {
+		c.Func = metric.ComposeMetricGenFuncs(families)
+		c.Headers = metric.ExtractMetricFamilyHeaders(families)
 		if err := c.run(); err != nil {
 			t.Errorf("unexpected collecting result in %vth run:\n%s", i, err)
 		}
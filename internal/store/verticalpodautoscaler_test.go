@@ -133,8 +133,8 @@ func TestVPAStore(t *testing.T) {
 		},
 	}
 	for i, c := range cases {
-		c.Func = metric.ComposeMetricGenFuncs(vpaMetricFamilies)
-		c.Headers = metric.ExtractMetricFamilyHeaders(vpaMetricFamilies)
+		c.Func = metric.ComposeMetricGenFuncs(vpaMetricFamilies(nil, nil))
+		c.Headers = metric.ExtractMetricFamilyHeaders(vpaMetricFamilies(nil, nil))
 		if err := c.run(); err != nil {
 			t.Errorf("unexpected collecting result in %vth run:\n%s", i, err)
 		}
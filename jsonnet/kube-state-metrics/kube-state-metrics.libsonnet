@@ -12,6 +12,15 @@ local k = import 'ksonnet/ksonnet.beta.4/k.libsonnet';
     'app.kubernetes.io/version': 'v' + ksm.version,
   },
 
+  // customResources are the custom resources kube-state-metrics is allowed to
+  // list and watch, e.g. { group: 'cert-manager.io', resources: ['certificates'] }
+  // for the resources declared by --custom-resource-config.
+  customResources:: [],
+  // customResourceDiscovery allows listing and watching the
+  // CustomResourceDefinitions for --custom-resource-discovery. The discovered
+  // custom resources have to be added to customResources.
+  customResourceDiscovery:: false,
+
   podLabels:: {
     [labelName]: ksm.commonLabels[labelName]
     for labelName in std.objectFields(ksm.commonLabels)
@@ -121,7 +130,22 @@ local k = import 'ksonnet/ksonnet.beta.4/k.libsonnet';
         'storageclasses',
       ]) +
       rulesType.withVerbs(['list', 'watch']),
-    ];
+    ] + [
+      rulesType.new() +
+      rulesType.withApiGroups([r.group]) +
+      rulesType.withResources(r.resources) +
+      rulesType.withVerbs(['list', 'watch'])
+      for r in ksm.customResources
+    ] + (
+      if ksm.customResourceDiscovery then [
+        rulesType.new() +
+        rulesType.withApiGroups(['apiextensions.k8s.io']) +
+        rulesType.withResources([
+          'customresourcedefinitions',
+        ]) +
+        rulesType.withVerbs(['list', 'watch']),
+      ] else []
+    );
 
     clusterRole.new() +
     clusterRole.mixin.metadata.withName(ksm.name) +
@@ -145,8 +169,8 @@ local k = import 'ksonnet/ksonnet.beta.4/k.libsonnet';
       container.mixin.livenessProbe.httpGet.withPort(8080) +
       container.mixin.livenessProbe.withInitialDelaySeconds(5) +
       container.mixin.livenessProbe.withTimeoutSeconds(5) +
-      container.mixin.readinessProbe.httpGet.withPath("/") +
-      container.mixin.readinessProbe.httpGet.withPort(8081) +
+      container.mixin.readinessProbe.httpGet.withPath("/readyz") +
+      container.mixin.readinessProbe.httpGet.withPort(8080) +
       container.mixin.readinessProbe.withInitialDelaySeconds(5) +
       container.mixin.readinessProbe.withTimeoutSeconds(5);
 
@@ -18,6 +18,7 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"log"
 	"net"
@@ -30,22 +31,34 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	vpaclientset "k8s.io/autoscaler/vertical-pod-autoscaler/pkg/client/clientset/versioned"
+	"k8s.io/client-go/dynamic"
 	clientset "k8s.io/client-go/kubernetes"
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/klog"
 
 	"k8s.io/kube-state-metrics/internal/store"
+	"k8s.io/kube-state-metrics/pkg/auth"
+	"k8s.io/kube-state-metrics/pkg/customresource"
+	metricsstore "k8s.io/kube-state-metrics/pkg/metrics_store"
 	"k8s.io/kube-state-metrics/pkg/metricshandler"
 	"k8s.io/kube-state-metrics/pkg/options"
+	"k8s.io/kube-state-metrics/pkg/otlp"
+	"k8s.io/kube-state-metrics/pkg/remotewrite"
+	"k8s.io/kube-state-metrics/pkg/runtimeconfig"
+	"k8s.io/kube-state-metrics/pkg/tlsconfig"
 	"k8s.io/kube-state-metrics/pkg/util/proc"
 	"k8s.io/kube-state-metrics/pkg/version"
 	"k8s.io/kube-state-metrics/pkg/whiteblacklist"
 )
 
 const (
-	metricsPath = "/metrics"
-	healthzPath = "/healthz"
+	metricsPath    = "/metrics"
+	namespacesPath = metricsPath + "/namespaces/"
+	healthzPath    = "/healthz"
+	readyzPath     = "/readyz"
+	objectsPath    = "/api/v1/objects"
+	watchPath      = "/api/v1/watch"
 )
 
 // promLogger implements promhttp.Logger
@@ -81,6 +94,119 @@ func main() {
 	ksmMetricsRegistry := prometheus.NewRegistry()
 	storeBuilder.WithMetrics(ksmMetricsRegistry)
 
+	storeOpts := opts
+	var selectors map[string]options.ListSelector
+	var configWatcher *runtimeconfig.Watcher
+	if opts.Config != "" {
+		configWatcher = runtimeconfig.NewWatcher(opts.Config, ksmMetricsRegistry)
+		config, err := configWatcher.Load()
+		if err != nil {
+			klog.Fatalf("Failed to load config: %v", err)
+		}
+		storeOpts = config.Apply(opts)
+		selectors = config.Selectors
+	}
+
+	collectors, namespaces, whiteBlackList, err := storeConfig(storeOpts)
+	if err != nil {
+		klog.Fatal(err)
+	}
+
+	if err := storeBuilder.WithEnabledResources(collectors); err != nil {
+		klog.Fatalf("Failed to set up collectors: %v", err)
+	}
+	storeBuilder.WithNamespaces(namespaces)
+	storeBuilder.WithWhiteBlackList(whiteBlackList)
+
+	proc.StartReaper()
+
+	kubeClient, vpaClient, dynamicClient, err := createKubeClient(opts.Apiserver, opts.Kubeconfig)
+	if err != nil {
+		klog.Fatalf("Failed to create client: %v", err)
+	}
+	storeBuilder.WithKubeClient(kubeClient)
+	storeBuilder.WithVPAClient(vpaClient)
+	if opts.CustomResourceConfig != "" {
+		config, err := customresource.Load(opts.CustomResourceConfig)
+		if err != nil {
+			klog.Fatalf("Failed to load custom resource config: %v", err)
+		}
+		if err := storeBuilder.WithCustomResources(config.Resources, dynamicClient); err != nil {
+			klog.Fatalf("Failed to set up custom resource metrics: %v", err)
+		}
+	}
+	if err := storeBuilder.WithListSelectors(selectors); err != nil {
+		klog.Fatalf("Failed to set up selectors: %v", err)
+	}
+	if len(opts.CustomResourceDiscovery) > 0 {
+		allowlist, err := customresource.ParseAllowlist(opts.CustomResourceDiscovery)
+		if err != nil {
+			klog.Fatalf("Failed to set up custom resource discovery: %v", err)
+		}
+		storeBuilder.WithCustomResourceDiscovery(allowlist, dynamicClient)
+	}
+	storeBuilder.WithSharding(opts.Shard, opts.TotalShards)
+	if opts.EnableProtobufEncoding {
+		storeBuilder.WithFormats([]metricsstore.Format{metricsstore.FormatProtobuf})
+	}
+	storeBuilder.WithSortedOutput(opts.EnableSortedOutput)
+	storeBuilder.WithOmitEmptyFamilies(opts.OmitEmptyFamilies)
+	storeBuilder.WithCompactStorage(opts.EnableCompactStorage)
+	storeBuilder.WithKeptFamilies(opts.RemoteWriteURL != "" || opts.OTLPEndpoint != "")
+	if err := storeBuilder.WithDeletedObjectRetention(opts.DeletedObjectRetention, opts.MarkDeletedObjects); err != nil {
+		klog.Fatalf("Failed to set up deleted object retention: %v", err)
+	}
+	if err := storeBuilder.WithSeriesLimits(opts.FamilySeriesLimits, opts.CollectorSeriesLimits); err != nil {
+		klog.Fatalf("Failed to set up series limits: %v", err)
+	}
+	storeBuilder.WithSnapshotDir(opts.SnapshotDir)
+	if err := storeBuilder.WithLabelsAllowlist(opts.LabelsAllowlist); err != nil {
+		klog.Fatalf("Failed to set up labels allowlist: %v", err)
+	}
+	if err := storeBuilder.WithAnnotationsAllowlist(opts.AnnotationsAllowlist); err != nil {
+		klog.Fatalf("Failed to set up annotations allowlist: %v", err)
+	}
+
+	tlsConfig, err := serverTLSConfig(opts)
+	if err != nil {
+		klog.Fatalf("Failed to set up TLS: %v", err)
+	}
+
+	authenticator := auth.New(auth.Config{
+		ClientCert: opts.TLSClientCAFile != "",
+		Kubernetes: opts.EnableKubernetesAuth,
+	}, kubeClient)
+
+	ksmMetricsRegistry.MustRegister(
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		prometheus.NewGoCollector(),
+	)
+	go telemetryServer(ksmMetricsRegistry, opts.TelemetryHost, opts.TelemetryPort, tlsConfig, authenticator)
+
+	serveMetrics(ctx, kubeClient, storeBuilder, ksmMetricsRegistry, opts, configWatcher, opts.Host, opts.Port, opts.EnableGZIPEncoding, tlsConfig, authenticator)
+}
+
+// serverTLSConfig returns the TLS configuration of the servers configured by
+// the given options, or nil if they are served over plain HTTP. Clients
+// authenticated via Kubernetes send their bearer tokens, hence serving them
+// over plain HTTP is rejected.
+func serverTLSConfig(opts *options.Options) (*tls.Config, error) {
+	if opts.TLSCertFile == "" && opts.TLSPrivateKeyFile == "" {
+		if opts.TLSClientCAFile != "" {
+			return nil, errors.New("--tls-client-ca-file requires --tls-cert-file and --tls-private-key-file")
+		}
+		if opts.EnableKubernetesAuth {
+			return nil, errors.New("--enable-kubernetes-auth requires --tls-cert-file and --tls-private-key-file")
+		}
+		return nil, nil
+	}
+
+	return tlsconfig.New(opts.TLSCertFile, opts.TLSPrivateKeyFile, opts.TLSClientCAFile)
+}
+
+// storeConfig returns the enabled collectors, the namespaces and the metric
+// white- or blacklist configured by the given options.
+func storeConfig(opts *options.Options) ([]string, options.NamespaceList, *whiteblacklist.WhiteBlackList, error) {
 	var collectors []string
 	if len(opts.Collectors) == 0 {
 		klog.Info("Using default collectors")
@@ -90,25 +216,21 @@ func main() {
 		collectors = opts.Collectors.AsSlice()
 	}
 
-	if err := storeBuilder.WithEnabledResources(collectors); err != nil {
-		klog.Fatalf("Failed to set up collectors: %v", err)
-	}
-
-	if len(opts.Namespaces) == 0 {
+	namespaces := opts.Namespaces
+	if len(namespaces) == 0 {
 		klog.Info("Using all namespace")
-		storeBuilder.WithNamespaces(options.DefaultNamespaces)
+		namespaces = options.DefaultNamespaces
 	} else {
-		if opts.Namespaces.IsAllNamespaces() {
+		if namespaces.IsAllNamespaces() {
 			klog.Info("Using all namespace")
 		} else {
-			klog.Infof("Using %s namespaces", opts.Namespaces)
+			klog.Infof("Using %s namespaces", namespaces)
 		}
-		storeBuilder.WithNamespaces(opts.Namespaces)
 	}
 
 	whiteBlackList, err := whiteblacklist.New(opts.MetricWhitelist, opts.MetricBlacklist)
 	if err != nil {
-		klog.Fatal(err)
+		return nil, nil, nil, err
 	}
 
 	if opts.DisablePodNonGenericResourceMetrics {
@@ -133,36 +255,18 @@ func main() {
 
 	err = whiteBlackList.Parse()
 	if err != nil {
-		klog.Fatalf("error initializing the whiteblack list : %v", err)
+		return nil, nil, nil, errors.Wrap(err, "error initializing the whiteblack list")
 	}
 
 	klog.Infof("metric white-blacklisting: %v", whiteBlackList.Status())
 
-	storeBuilder.WithWhiteBlackList(whiteBlackList)
-
-	proc.StartReaper()
-
-	kubeClient, vpaClient, err := createKubeClient(opts.Apiserver, opts.Kubeconfig)
-	if err != nil {
-		klog.Fatalf("Failed to create client: %v", err)
-	}
-	storeBuilder.WithKubeClient(kubeClient)
-	storeBuilder.WithVPAClient(vpaClient)
-	storeBuilder.WithSharding(opts.Shard, opts.TotalShards)
-
-	ksmMetricsRegistry.MustRegister(
-		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
-		prometheus.NewGoCollector(),
-	)
-	go telemetryServer(ksmMetricsRegistry, opts.TelemetryHost, opts.TelemetryPort)
-
-	serveMetrics(ctx, kubeClient, storeBuilder, opts, opts.Host, opts.Port, opts.EnableGZIPEncoding)
+	return collectors, namespaces, whiteBlackList, nil
 }
 
-func createKubeClient(apiserver string, kubeconfig string) (clientset.Interface, vpaclientset.Interface, error) {
+func createKubeClient(apiserver string, kubeconfig string) (clientset.Interface, vpaclientset.Interface, dynamic.Interface, error) {
 	config, err := clientcmd.BuildConfigFromFlags(apiserver, kubeconfig)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 
 	config.UserAgent = version.GetVersion().String()
@@ -171,12 +275,17 @@ func createKubeClient(apiserver string, kubeconfig string) (clientset.Interface,
 
 	kubeClient, err := clientset.NewForConfig(config)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 
 	vpaClient, err := vpaclientset.NewForConfig(config)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
+	}
+
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, nil, nil, err
 	}
 	// Informers don't seem to do a good job logging error messages when it
 	// can't reach the server, making debugging hard. This makes it easier to
@@ -184,16 +293,16 @@ func createKubeClient(apiserver string, kubeconfig string) (clientset.Interface,
 	klog.Infof("Testing communication with server")
 	v, err := kubeClient.Discovery().ServerVersion()
 	if err != nil {
-		return nil, nil, errors.Wrap(err, "error while trying to communicate with apiserver")
+		return nil, nil, nil, errors.Wrap(err, "error while trying to communicate with apiserver")
 	}
 	klog.Infof("Running with Kubernetes cluster version: v%s.%s. git version: %s. git tree state: %s. commit: %s. platform: %s",
 		v.Major, v.Minor, v.GitVersion, v.GitTreeState, v.GitCommit, v.Platform)
 	klog.Infof("Communication with server successful")
 
-	return kubeClient, vpaClient, nil
+	return kubeClient, vpaClient, dynamicClient, nil
 }
 
-func telemetryServer(registry prometheus.Gatherer, host string, port int) {
+func telemetryServer(registry prometheus.Gatherer, host string, port int, tlsConfig *tls.Config, authenticator *auth.Authenticator) {
 	// Address to listen on for web interface and telemetry
 	listenAddress := net.JoinHostPort(host, strconv.Itoa(port))
 
@@ -215,10 +324,10 @@ func telemetryServer(registry prometheus.Gatherer, host string, port int) {
              </body>
              </html>`))
 	})
-	log.Fatal(http.ListenAndServe(listenAddress, mux))
+	log.Fatal(listenAndServe(listenAddress, authenticator.Handler(mux), tlsConfig))
 }
 
-func serveMetrics(ctx context.Context, kubeClient clientset.Interface, storeBuilder *store.Builder, opts *options.Options, host string, port int, enableGZIPEncoding bool) {
+func serveMetrics(ctx context.Context, kubeClient clientset.Interface, storeBuilder *store.Builder, registry *prometheus.Registry, opts *options.Options, configWatcher *runtimeconfig.Watcher, host string, port int, enableGZIPEncoding bool, tlsConfig *tls.Config, authenticator *auth.Authenticator) {
 	// Address to listen on for web interface and telemetry
 	listenAddress := net.JoinHostPort(host, strconv.Itoa(port))
 
@@ -239,14 +348,67 @@ func serveMetrics(ctx context.Context, kubeClient clientset.Interface, storeBuil
 		storeBuilder,
 		enableGZIPEncoding,
 	)
+	m.WithMetrics(registry)
 	go m.Run(ctx)
+
+	if configWatcher != nil {
+		go func() {
+			err := configWatcher.Run(ctx, func(config *runtimeconfig.Config) error {
+				collectors, namespaces, whiteBlackList, err := storeConfig(config.Apply(opts))
+				if err != nil {
+					return err
+				}
+				return m.Reconfigure(collectors, namespaces, whiteBlackList, config.Selectors)
+			})
+			if err != nil && err != context.Canceled {
+				klog.Errorf("Failed to watch config: %v", err)
+			}
+		}()
+	}
+
+	if opts.RemoteWriteURL != "" {
+		w, err := remotewrite.New(remotewrite.Config{
+			URL:               opts.RemoteWriteURL,
+			Interval:          opts.RemoteWriteInterval,
+			Timeout:           opts.RemoteWriteTimeout,
+			Shards:            opts.RemoteWriteShards,
+			MaxSamplesPerSend: opts.RemoteWriteMaxSamplesPerSend,
+			MaxRetries:        opts.RemoteWriteMaxRetries,
+			ExternalLabels:    opts.RemoteWriteExternalLabels,
+		}, m.WalkFamilies, registry)
+		if err != nil {
+			klog.Fatalf("Failed to set up remote write: %v", err)
+		}
+		klog.Infof("Pushing metrics via remote write to %s every %v", opts.RemoteWriteURL, opts.RemoteWriteInterval)
+		go w.Run(ctx)
+	}
+	if opts.OTLPEndpoint != "" {
+		e, err := otlp.New(otlp.Config{
+			Endpoint: opts.OTLPEndpoint,
+			Protocol: opts.OTLPProtocol,
+			Interval: opts.OTLPInterval,
+			Timeout:  opts.OTLPTimeout,
+		}, m.WalkFamilies, registry)
+		if err != nil {
+			klog.Fatalf("Failed to set up OTLP export: %v", err)
+		}
+		klog.Infof("Exporting metrics via OTLP (%s) to %s every %v", opts.OTLPProtocol, opts.OTLPEndpoint, opts.OTLPInterval)
+		go e.Run(ctx)
+	}
 	mux.Handle(metricsPath, m)
+	mux.Handle(namespacesPath, http.StripPrefix(namespacesPath, m.NamespaceHandler()))
 
 	// Add healthzPath
 	mux.HandleFunc(healthzPath, func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte(http.StatusText(http.StatusOK)))
 	})
+	// Add readyzPath
+	mux.HandleFunc(readyzPath, m.ServeReadyz)
+	// Add objectsPath
+	mux.HandleFunc(objectsPath, m.ServeObjects)
+	// Add watchPath
+	mux.HandleFunc(watchPath, m.ServeWatch)
 	// Add index
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte(`<html>
@@ -256,9 +418,28 @@ func serveMetrics(ctx context.Context, kubeClient clientset.Interface, storeBuil
 			 <ul>
              <li><a href='` + metricsPath + `'>metrics</a></li>
              <li><a href='` + healthzPath + `'>healthz</a></li>
+             <li><a href='` + readyzPath + `'>readyz</a></li>
 			 </ul>
              </body>
              </html>`))
 	})
-	log.Fatal(http.ListenAndServe(listenAddress, mux))
+	// Probes can not authenticate, hence healthzPath and readyzPath are not
+	// protected.
+	log.Fatal(listenAndServe(listenAddress, authenticator.Handler(mux, healthzPath, readyzPath), tlsConfig))
+}
+
+// listenAndServe serves the given handler on the given address, over TLS if
+// tlsConfig is not nil.
+func listenAndServe(listenAddress string, handler http.Handler, tlsConfig *tls.Config) error {
+	server := &http.Server{
+		Addr:      listenAddress,
+		Handler:   handler,
+		TLSConfig: tlsConfig,
+	}
+
+	if tlsConfig != nil {
+		// The certificate is provided by tlsConfig.
+		return server.ListenAndServeTLS("", "")
+	}
+	return server.ListenAndServe()
 }
@@ -19,8 +19,11 @@ package main
 import (
 	"bytes"
 	"context"
+	"io"
 	"io/ioutil"
+	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"sort"
 	"strconv"
 	"strings"
@@ -28,11 +31,14 @@ import (
 	"time"
 
 	"k8s.io/kube-state-metrics/internal/store"
+	metricsstore "k8s.io/kube-state-metrics/pkg/metrics_store"
 	"k8s.io/kube-state-metrics/pkg/metricshandler"
 	"k8s.io/kube-state-metrics/pkg/options"
 	"k8s.io/kube-state-metrics/pkg/whiteblacklist"
 
 	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -335,6 +341,169 @@ kube_pod_container_resource_limits_memory_bytes{namespace="default",pod="pod0",c
 	}
 }
 
+// TestProtobufScrapeCycle covers the entire cycle from cache filling to
+// scraping in the protobuf format, comparing it with the text format.
+func TestProtobufScrapeCycle(t *testing.T) {
+	t.Parallel()
+
+	kubeClient := fake.NewSimpleClientset()
+
+	for i := 0; i < 2; i++ {
+		err := pod(kubeClient, i)
+		if err != nil {
+			t.Fatalf("failed to insert sample pod %v", err.Error())
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	reg := prometheus.NewRegistry()
+	builder := store.NewBuilder()
+	builder.WithMetrics(reg)
+	builder.WithEnabledResources([]string{"pods"})
+	builder.WithKubeClient(kubeClient)
+	builder.WithNamespaces(options.DefaultNamespaces)
+	builder.WithFormats([]metricsstore.Format{metricsstore.FormatProtobuf})
+
+	l, err := whiteblacklist.New(map[string]struct{}{}, map[string]struct{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	builder.WithWhiteBlackList(l)
+
+	handler := metricshandler.New(&options.Options{EnableProtobufEncoding: true}, kubeClient, builder, false)
+	handler.ConfigureSharding(ctx, 0, 1)
+
+	// Wait for caches to fill
+	time.Sleep(time.Second)
+
+	scrape := func(accept string) *http.Response {
+		req := httptest.NewRequest("GET", "http://localhost:8080/metrics", nil)
+		req.Header.Set("Accept", accept)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		resp := w.Result()
+		if resp.StatusCode != 200 {
+			t.Fatalf("expected 200 status code but got %v", resp.StatusCode)
+		}
+		return resp
+	}
+
+	textResp := scrape("text/plain")
+	var parser expfmt.TextParser
+	textFamilies, err := parser.TextToMetricFamilies(textResp.Body)
+	if err != nil {
+		t.Fatalf("failed to parse text format: %v", err)
+	}
+
+	protoResp := scrape("application/vnd.google.protobuf;proto=io.prometheus.client.MetricFamily;encoding=delimited")
+	if got, want := protoResp.Header.Get("Content-Type"), metricsstore.FormatProtobuf.ContentType(); got != want {
+		t.Fatalf("expected content type %q but got %q", want, got)
+	}
+
+	protoFamilies := map[string]*dto.MetricFamily{}
+	decoder := expfmt.NewDecoder(protoResp.Body, expfmt.FmtProtoDelim)
+	for {
+		mf := &dto.MetricFamily{}
+		if err := decoder.Decode(mf); err != nil {
+			if err == io.EOF {
+				break
+			}
+			t.Fatalf("failed to decode protobuf format: %v", err)
+		}
+		protoFamilies[mf.GetName()] = mf
+	}
+
+	for name, textFamily := range textFamilies {
+		if len(textFamily.GetMetric()) == 0 {
+			continue
+		}
+
+		protoFamily, ok := protoFamilies[name]
+		if !ok {
+			t.Fatalf("expected protobuf format to contain metric family %v", name)
+		}
+
+		var textOut, protoOut bytes.Buffer
+		expfmt.MetricFamilyToText(&textOut, textFamily)
+		expfmt.MetricFamilyToText(&protoOut, protoFamily)
+		textLines := strings.Split(textOut.String(), "\n")
+		protoLines := strings.Split(protoOut.String(), "\n")
+		sort.Strings(textLines)
+		sort.Strings(protoLines)
+
+		if !reflect.DeepEqual(textLines, protoLines) {
+			t.Fatalf("expected protobuf metric family:\n%v\nto equal text metric family:\n%v", protoOut.String(), textOut.String())
+		}
+	}
+
+	if len(protoFamilies) == 0 {
+		t.Fatal("expected protobuf format to contain metric families")
+	}
+}
+
+// TestReadyzScrapeCycle tests that the readiness endpoint reports the
+// collectors as ready once their reflectors completed the initial list.
+func TestReadyzScrapeCycle(t *testing.T) {
+	t.Parallel()
+
+	kubeClient := fake.NewSimpleClientset()
+
+	err := pod(kubeClient, 0)
+	if err != nil {
+		t.Fatalf("failed to insert sample pod %v", err.Error())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	reg := prometheus.NewRegistry()
+	builder := store.NewBuilder()
+	builder.WithMetrics(reg)
+	builder.WithEnabledResources([]string{"nodes", "pods"})
+	builder.WithKubeClient(kubeClient)
+	builder.WithNamespaces(options.DefaultNamespaces)
+
+	l, err := whiteblacklist.New(map[string]struct{}{}, map[string]struct{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	builder.WithWhiteBlackList(l)
+
+	handler := metricshandler.New(&options.Options{}, kubeClient, builder, false)
+
+	readyz := func() (int, string) {
+		req := httptest.NewRequest("GET", "http://localhost:8080/readyz", nil)
+		w := httptest.NewRecorder()
+		handler.ServeReadyz(w, req)
+		return w.Code, w.Body.String()
+	}
+
+	if status, _ := readyz(); status != http.StatusServiceUnavailable {
+		t.Fatalf("expected status %v before configuring collectors but got %v", http.StatusServiceUnavailable, status)
+	}
+
+	handler.ConfigureSharding(ctx, 0, 1)
+
+	var (
+		status int
+		body   string
+	)
+	for i := 0; i < 50; i++ {
+		if status, body = readyz(); status == http.StatusOK {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	if status != http.StatusOK {
+		t.Fatalf("expected status %v after initial list but got %v:\n%v", http.StatusOK, status, body)
+	}
+	if expected := "[+]nodes ok\n[+]pods ok\nok\n"; body != expected {
+		t.Fatalf("expected body:\n%v\nbut got:\n%v", expected, body)
+	}
+}
+
 // TestShardingEquivalenceScrapeCycle is a simple smoke test covering the entire cycle from
 // cache filling to scraping comparing a sharded with an unsharded setup.
 func TestShardingEquivalenceScrapeCycle(t *testing.T) {
@@ -492,6 +661,28 @@ func TestShardingEquivalenceScrapeCycle(t *testing.T) {
 	}
 }
 
+func TestServerTLSConfig(t *testing.T) {
+	tests := []struct {
+		opts    options.Options
+		wantErr bool
+	}{
+		{opts: options.Options{}},
+		{opts: options.Options{EnableKubernetesAuth: true}, wantErr: true},
+		{opts: options.Options{TLSClientCAFile: "ca.crt"}, wantErr: true},
+		{opts: options.Options{TLSCertFile: "tls.crt"}, wantErr: true},
+	}
+
+	for _, test := range tests {
+		config, err := serverTLSConfig(&test.opts)
+		if gotErr := err != nil; gotErr != test.wantErr {
+			t.Errorf("%+v: expected error %v but got %v", test.opts, test.wantErr, err)
+		}
+		if config != nil {
+			t.Errorf("%+v: expected no TLS config but got %v", test.opts, config)
+		}
+	}
+}
+
 func injectFixtures(client *fake.Clientset, multiplier int) error {
 	creators := []func(*fake.Clientset, int) error{
 		configMap,
@@ -0,0 +1,260 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog"
+)
+
+// Config configures how requests are authenticated and authorized.
+type Config struct {
+	// ClientCert authenticates requests by their verified TLS client
+	// certificate, using its common name as user and its organizations as
+	// groups.
+	ClientCert bool
+	// Kubernetes authenticates requests by their bearer token via a
+	// TokenReview and authorizes all authenticated requests via a
+	// SubjectAccessReview of a non-resource request to their path.
+	Kubernetes bool
+}
+
+const (
+	// The durations for which the results of reviews are cached. Denials
+	// are cached briefly, so that granted permissions take effect soon.
+	authenticatedTTL   = 2 * time.Minute
+	unauthenticatedTTL = 10 * time.Second
+	allowedTTL         = 5 * time.Minute
+	deniedTTL          = 30 * time.Second
+)
+
+// tokenRE matches the syntax of bearer tokens, see RFC 6750 section 2.1.
+var tokenRE = regexp.MustCompile(`^[A-Za-z0-9\-._~+/]+=*$`)
+
+// Enabled returns whether any authentication is configured.
+func (c Config) Enabled() bool {
+	return c.ClientCert || c.Kubernetes
+}
+
+// Authenticator authenticates and authorizes HTTP requests.
+type Authenticator struct {
+	config     Config
+	kubeClient kubernetes.Interface
+
+	// tokenReviews caches the users of bearer tokens, or nil for tokens
+	// which are not authenticated, by the hash of the token.
+	tokenReviews *reviewCache
+	// accessReviews caches whether users are allowed to perform requests by
+	// accessReviewKey.
+	accessReviews *reviewCache
+}
+
+// New returns a new Authenticator. The given kubeClient is only used if
+// Kubernetes authentication is configured. The results of TokenReviews and
+// SubjectAccessReviews are cached briefly.
+func New(config Config, kubeClient kubernetes.Interface) *Authenticator {
+	return &Authenticator{
+		config:        config,
+		kubeClient:    kubeClient,
+		tokenReviews:  newReviewCache(),
+		accessReviews: newReviewCache(),
+	}
+}
+
+// Handler returns a http.Handler passing authorized requests on to next.
+// Unauthenticated requests are rejected with 401, unauthorized ones with 403.
+// Requests to the given paths are passed on without any check. If the
+// Authenticator is nil or no authentication is configured, next is returned.
+func (a *Authenticator) Handler(next http.Handler, ignorePaths ...string) http.Handler {
+	if a == nil || !a.config.Enabled() {
+		return next
+	}
+
+	ignored := map[string]struct{}{}
+	for _, p := range ignorePaths {
+		ignored[p] = struct{}{}
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := ignored[r.URL.Path]; ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		user, err := a.authenticate(r)
+		if err != nil {
+			klog.Errorf("failed to authenticate request to %s: %v", r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		if user == nil {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		allowed, err := a.authorize(user, r)
+		if err != nil {
+			klog.Errorf("failed to authorize request of user %s to %s: %v", user.Username, r.URL.Path, err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		if !allowed {
+			klog.V(4).Infof("user %s is not allowed to %s %s", user.Username, r.Method, r.URL.Path)
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authenticate returns the user of the given request, or nil if the request
+// can not be authenticated. A verified client certificate takes precedence
+// over a bearer token.
+func (a *Authenticator) authenticate(r *http.Request) (*authenticationv1.UserInfo, error) {
+	if a.config.ClientCert && r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+		cert := r.TLS.VerifiedChains[0][0]
+		return &authenticationv1.UserInfo{
+			Username: cert.Subject.CommonName,
+			Groups:   cert.Subject.Organization,
+		}, nil
+	}
+
+	if !a.config.Kubernetes {
+		return nil, nil
+	}
+
+	token := bearerToken(r)
+	if !tokenRE.MatchString(token) {
+		return nil, nil
+	}
+
+	hash := sha256.Sum256([]byte(token))
+	key := hex.EncodeToString(hash[:])
+	if user, ok := a.tokenReviews.get(key); ok {
+		return user.(*authenticationv1.UserInfo), nil
+	}
+
+	review, err := a.kubeClient.AuthenticationV1().TokenReviews().Create(&authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{
+			Token: token,
+		},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "create TokenReview")
+	}
+
+	if !review.Status.Authenticated {
+		if review.Status.Error != "" {
+			klog.V(4).Infof("token of request to %s not authenticated: %s", r.URL.Path, review.Status.Error)
+		}
+		a.tokenReviews.add(key, (*authenticationv1.UserInfo)(nil), unauthenticatedTTL)
+		return nil, nil
+	}
+
+	a.tokenReviews.add(key, &review.Status.User, authenticatedTTL)
+	return &review.Status.User, nil
+}
+
+// authorize returns whether the given user is allowed to perform the given
+// request. Without Kubernetes authorization, every authenticated user is.
+func (a *Authenticator) authorize(user *authenticationv1.UserInfo, r *http.Request) (bool, error) {
+	if !a.config.Kubernetes {
+		return true, nil
+	}
+
+	key := accessReviewKey(user, r)
+	if allowed, ok := a.accessReviews.get(key); ok {
+		return allowed.(bool), nil
+	}
+
+	extra := make(map[string]authorizationv1.ExtraValue, len(user.Extra))
+	for k, v := range user.Extra {
+		extra[k] = authorizationv1.ExtraValue(v)
+	}
+
+	review, err := a.kubeClient.AuthorizationV1().SubjectAccessReviews().Create(&authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			User:   user.Username,
+			UID:    user.UID,
+			Groups: user.Groups,
+			Extra:  extra,
+			NonResourceAttributes: &authorizationv1.NonResourceAttributes{
+				Path: r.URL.Path,
+				Verb: verb(r.Method),
+			},
+		},
+	})
+	if err != nil {
+		return false, errors.Wrap(err, "create SubjectAccessReview")
+	}
+
+	ttl := deniedTTL
+	if review.Status.Allowed {
+		ttl = allowedTTL
+	}
+	a.accessReviews.add(key, review.Status.Allowed, ttl)
+	return review.Status.Allowed, nil
+}
+
+// accessReviewKey returns the key of the SubjectAccessReview of the given
+// request of the given user in the cache. The extra values are formatted
+// ordered by key.
+func accessReviewKey(user *authenticationv1.UserInfo, r *http.Request) string {
+	return fmt.Sprintf("%q %q %q %q %q %q", user.Username, user.UID, user.Groups, user.Extra, verb(r.Method), r.URL.Path)
+}
+
+// bearerToken returns the bearer token of the Authorization header of the
+// given request, if any.
+func bearerToken(r *http.Request) string {
+	parts := strings.SplitN(r.Header.Get("Authorization"), " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "bearer") {
+		return ""
+	}
+
+	return strings.TrimSpace(parts[1])
+}
+
+// verb returns the Kubernetes API verb of the given HTTP method for
+// non-resource requests.
+func verb(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead:
+		return "get"
+	case http.MethodPost:
+		return "create"
+	case http.MethodPut:
+		return "update"
+	case http.MethodPatch:
+		return "patch"
+	case http.MethodDelete:
+		return "delete"
+	default:
+		return strings.ToLower(method)
+	}
+}
@@ -0,0 +1,350 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestHandler(t *testing.T) {
+	kubeClient := fake.NewSimpleClientset()
+
+	// The token "valid" authenticates as user "prometheus", which is only
+	// allowed to get /metrics.
+	kubeClient.PrependReactor("create", "tokenreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authenticationv1.TokenReview)
+		if review.Spec.Token == "valid" {
+			review.Status.Authenticated = true
+			review.Status.User = authenticationv1.UserInfo{
+				Username: "prometheus",
+				Groups:   []string{"system:serviceaccounts"},
+			}
+		}
+		return true, review, nil
+	})
+	kubeClient.PrependReactor("create", "subjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SubjectAccessReview)
+		attributes := review.Spec.NonResourceAttributes
+		review.Status.Allowed = (review.Spec.User == "prometheus" || review.Spec.User == "scraper") &&
+			attributes != nil && attributes.Path == "/metrics" && attributes.Verb == "get"
+		return true, review, nil
+	})
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+
+	clientCert := &tls.ConnectionState{
+		VerifiedChains: [][]*x509.Certificate{{
+			{Subject: pkix.Name{CommonName: "scraper", Organization: []string{"monitoring"}}},
+		}},
+	}
+
+	tests := []struct {
+		name   string
+		config Config
+		path   string
+		token  string
+		tls    *tls.ConnectionState
+		status int
+	}{
+		{
+			name:   "no authentication configured",
+			path:   "/metrics",
+			status: http.StatusOK,
+		},
+		{
+			name:   "valid token",
+			config: Config{Kubernetes: true},
+			path:   "/metrics",
+			token:  "valid",
+			status: http.StatusOK,
+		},
+		{
+			name:   "invalid token",
+			config: Config{Kubernetes: true},
+			path:   "/metrics",
+			token:  "invalid",
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "missing token",
+			config: Config{Kubernetes: true},
+			path:   "/metrics",
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "unauthorized path",
+			config: Config{Kubernetes: true},
+			path:   "/debug/pprof/",
+			token:  "valid",
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "ignored path",
+			config: Config{Kubernetes: true},
+			path:   "/healthz",
+			status: http.StatusOK,
+		},
+		{
+			name:   "client certificate",
+			config: Config{ClientCert: true},
+			path:   "/debug/pprof/",
+			tls:    clientCert,
+			status: http.StatusOK,
+		},
+		{
+			name:   "missing client certificate",
+			config: Config{ClientCert: true},
+			path:   "/metrics",
+			tls:    &tls.ConnectionState{},
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "client certificate authorized via Kubernetes",
+			config: Config{ClientCert: true, Kubernetes: true},
+			path:   "/metrics",
+			tls:    clientCert,
+			status: http.StatusOK,
+		},
+		{
+			name:   "client certificate unauthorized via Kubernetes",
+			config: Config{ClientCert: true, Kubernetes: true},
+			path:   "/debug/pprof/",
+			tls:    clientCert,
+			status: http.StatusForbidden,
+		},
+	}
+
+	for _, test := range tests {
+		h := New(test.config, kubeClient).Handler(next, "/healthz")
+
+		req := httptest.NewRequest("GET", "https://localhost:8443"+test.path, nil)
+		if test.token != "" {
+			req.Header.Set("Authorization", "Bearer "+test.token)
+		}
+		req.TLS = test.tls
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		if w.Code != test.status {
+			t.Errorf("%v: expected status %v but got %v", test.name, test.status, w.Code)
+		}
+	}
+}
+
+func TestNilAuthenticator(t *testing.T) {
+	var a *Authenticator
+	next := http.NotFoundHandler()
+
+	req := httptest.NewRequest("GET", "http://localhost:8080/metrics", nil)
+	w := httptest.NewRecorder()
+	a.Handler(next).ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected request to be passed on, got status %v", w.Code)
+	}
+}
+
+func TestHandlerCachesReviews(t *testing.T) {
+	kubeClient := fake.NewSimpleClientset()
+
+	// The token "valid" authenticates as user "prometheus", which is only
+	// allowed to get /metrics. The token "failing" fails to be reviewed.
+	var tokenReviews, accessReviews int
+	kubeClient.PrependReactor("create", "tokenreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		tokenReviews++
+		review := action.(k8stesting.CreateAction).GetObject().(*authenticationv1.TokenReview)
+		switch review.Spec.Token {
+		case "failing":
+			return true, review, errors.NewServiceUnavailable("unavailable")
+		case "valid":
+			review.Status.Authenticated = true
+			review.Status.User = authenticationv1.UserInfo{Username: "prometheus"}
+		}
+		return true, review, nil
+	})
+	kubeClient.PrependReactor("create", "subjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		accessReviews++
+		review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SubjectAccessReview)
+		review.Status.Allowed = review.Spec.NonResourceAttributes.Path == "/metrics"
+		return true, review, nil
+	})
+
+	now := time.Unix(0, 0)
+	a := New(Config{Kubernetes: true}, kubeClient)
+	a.tokenReviews.now = func() time.Time { return now }
+	a.accessReviews.now = func() time.Time { return now }
+	h := a.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		name          string
+		path          string
+		header        string
+		after         time.Duration
+		status        int
+		tokenReviews  int
+		accessReviews int
+	}{
+		{
+			name:          "first request",
+			path:          "/metrics",
+			header:        "Bearer valid",
+			status:        http.StatusOK,
+			tokenReviews:  1,
+			accessReviews: 1,
+		},
+		{
+			name:          "cached authentication and authorization",
+			path:          "/metrics",
+			header:        "Bearer valid",
+			after:         time.Minute,
+			status:        http.StatusOK,
+			tokenReviews:  1,
+			accessReviews: 1,
+		},
+		{
+			name:          "denied path",
+			path:          "/debug/pprof/",
+			header:        "Bearer valid",
+			status:        http.StatusForbidden,
+			tokenReviews:  1,
+			accessReviews: 2,
+		},
+		{
+			name:          "cached denial",
+			path:          "/debug/pprof/",
+			header:        "Bearer valid",
+			after:         20 * time.Second,
+			status:        http.StatusForbidden,
+			tokenReviews:  1,
+			accessReviews: 2,
+		},
+		{
+			name:          "expired authentication",
+			path:          "/metrics",
+			header:        "Bearer valid",
+			after:         time.Minute,
+			status:        http.StatusOK,
+			tokenReviews:  2,
+			accessReviews: 2,
+		},
+		{
+			name:          "invalid token",
+			path:          "/metrics",
+			header:        "Bearer invalid",
+			status:        http.StatusUnauthorized,
+			tokenReviews:  3,
+			accessReviews: 2,
+		},
+		{
+			name:          "cached invalid token",
+			path:          "/metrics",
+			header:        "Bearer invalid",
+			status:        http.StatusUnauthorized,
+			tokenReviews:  3,
+			accessReviews: 2,
+		},
+		{
+			name:          "empty token",
+			path:          "/metrics",
+			header:        "Bearer ",
+			status:        http.StatusUnauthorized,
+			tokenReviews:  3,
+			accessReviews: 2,
+		},
+		{
+			name:          "malformed token",
+			path:          "/metrics",
+			header:        "Bearer in valid",
+			status:        http.StatusUnauthorized,
+			tokenReviews:  3,
+			accessReviews: 2,
+		},
+		{
+			name:          "failing review",
+			path:          "/metrics",
+			header:        "Bearer failing",
+			status:        http.StatusInternalServerError,
+			tokenReviews:  4,
+			accessReviews: 2,
+		},
+		{
+			name:          "failed review not cached",
+			path:          "/metrics",
+			header:        "Bearer failing",
+			status:        http.StatusInternalServerError,
+			tokenReviews:  5,
+			accessReviews: 2,
+		},
+	}
+
+	for _, test := range tests {
+		now = now.Add(test.after)
+
+		req := httptest.NewRequest("GET", "https://localhost:8443"+test.path, nil)
+		req.Header.Set("Authorization", test.header)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		if w.Code != test.status {
+			t.Errorf("%v: expected status %v but got %v", test.name, test.status, w.Code)
+		}
+		if tokenReviews != test.tokenReviews || accessReviews != test.accessReviews {
+			t.Errorf("%v: expected %v TokenReviews and %v SubjectAccessReviews but got %v and %v",
+				test.name, test.tokenReviews, test.accessReviews, tokenReviews, accessReviews)
+		}
+	}
+}
+
+func TestReviewCacheSize(t *testing.T) {
+	now := time.Unix(0, 0)
+	c := newReviewCache()
+	c.now = func() time.Time { return now }
+
+	for i := 0; i < maxReviewCacheEntries; i++ {
+		c.add(strconv.Itoa(i), true, time.Minute)
+	}
+	c.add("full", true, time.Minute)
+	if _, ok := c.get("full"); ok {
+		t.Error("expected result not to be cached in full cache")
+	}
+
+	// Expired results make room for new ones.
+	now = now.Add(time.Minute)
+	c.add("expired", true, time.Minute)
+	if _, ok := c.get("expired"); !ok {
+		t.Error("expected result to be cached after expiry of the others")
+	}
+	if got := len(c.entries); got != 1 {
+		t.Errorf("expected 1 cached result but got %v", got)
+	}
+}
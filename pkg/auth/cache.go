@@ -0,0 +1,85 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package auth
+
+import (
+	"sync"
+	"time"
+)
+
+// maxReviewCacheEntries bounds the number of results cached per kind of
+// review, so that requests with arbitrary tokens can not exhaust the memory.
+const maxReviewCacheEntries = 4096
+
+// reviewCache caches the results of TokenReviews or SubjectAccessReviews for a
+// limited time, so that not every request has to be reviewed by the API
+// server. Failed reviews are not cached.
+type reviewCache struct {
+	mutex   sync.Mutex
+	entries map[string]reviewCacheEntry
+	now     func() time.Time
+}
+
+type reviewCacheEntry struct {
+	result  interface{}
+	expires time.Time
+}
+
+func newReviewCache() *reviewCache {
+	return &reviewCache{
+		entries: map[string]reviewCacheEntry{},
+		now:     time.Now,
+	}
+}
+
+// get returns the cached result of the review with the given key, if it did
+// not expire yet.
+func (c *reviewCache) get(key string) (interface{}, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if !c.now().Before(e.expires) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return e.result, true
+}
+
+// add caches the given result of the review with the given key for the given
+// duration. If the cache is full even after dropping expired results, the
+// result is not cached.
+func (c *reviewCache) add(key string, result interface{}, ttl time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := c.now()
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= maxReviewCacheEntries {
+		for k, e := range c.entries {
+			if !now.Before(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= maxReviewCacheEntries {
+			return
+		}
+	}
+	c.entries[key] = reviewCacheEntry{result: result, expires: now.Add(ttl)}
+}
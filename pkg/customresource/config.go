@@ -0,0 +1,161 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package customresource generates metrics of custom resources as declared by
+// a configuration file, mapping fields of the objects to metrics.
+package customresource
+
+import (
+	"io/ioutil"
+	"regexp"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/yaml"
+)
+
+var (
+	metricNameRE = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+	labelNameRE  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+// MetricType is the type of a configured metric.
+type MetricType string
+
+const (
+	// MetricGauge is a gauge whose value is taken from a field of an object.
+	// Numbers, booleans, numeric strings and RFC 3339 timestamps are
+	// supported.
+	MetricGauge MetricType = "gauge"
+	// MetricInfo is a gauge with the value 1 whose labels are taken from
+	// fields of an object.
+	MetricInfo MetricType = "info"
+	// MetricStateSet is a gauge per state with the value 1 for the state
+	// equal to a field of an object and 0 for the others.
+	MetricStateSet MetricType = "stateset"
+)
+
+// Config declares the custom resources to generate metrics of.
+type Config struct {
+	Resources []Resource `json:"resources"`
+}
+
+// Resource declares the metrics of a custom resource.
+type Resource struct {
+	Group   string `json:"group"`
+	Version string `json:"version"`
+	Kind    string `json:"kind"`
+	// Resource is the plural name of the resource in the API, e.g.
+	// certificates.
+	Resource string `json:"resource"`
+	// ClusterScoped is true for resources which are not namespaced.
+	ClusterScoped bool `json:"clusterScoped,omitempty"`
+	// Labels are added to all metrics of the resource, in addition to the
+	// namespace and name of the object. They map label names to paths.
+	Labels  map[string]string `json:"labels,omitempty"`
+	Metrics []Metric          `json:"metrics"`
+}
+
+// Metric declares a metric family of a custom resource. Paths are JSONPath
+// expressions as supported by kubectl, e.g. .status.replicas or
+// {.status.conditions[?(@.type=="Ready")].status}. Objects for which the path
+// of a gauge or state set selects nothing have no metric, for multiple
+// selected values the first one is used.
+type Metric struct {
+	Name string     `json:"name"`
+	Help string     `json:"help,omitempty"`
+	Type MetricType `json:"type"`
+	// Path selects the value of a gauge or the state of a state set.
+	Path string `json:"path,omitempty"`
+	// Labels map label names to paths.
+	Labels map[string]string `json:"labels,omitempty"`
+	// StateLabel is the name of the label containing the state of a state
+	// set, "state" by default.
+	StateLabel string   `json:"stateLabel,omitempty"`
+	States     []string `json:"states,omitempty"`
+}
+
+// Load reads the configuration from the YAML file at the given path and
+// validates it.
+func Load(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "read custom resource config")
+	}
+
+	return Parse(data)
+}
+
+// Parse parses the given YAML configuration and validates it.
+func Parse(data []byte) (*Config, error) {
+	c := &Config{}
+	if err := yaml.UnmarshalStrict(data, c); err != nil {
+		return nil, errors.Wrap(err, "parse custom resource config")
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Validate returns an error if the configuration is invalid, e.g. if a
+// resource or metric is declared twice or a path can not be parsed.
+func (c *Config) Validate() error {
+	names := map[string]bool{}
+	// metrics contains the resource declaring each metric.
+	metrics := map[string]string{}
+	for _, r := range c.Resources {
+		if r.Version == "" || r.Kind == "" || r.Resource == "" {
+			return errors.Errorf("custom resource %s: version, kind and resource must be set", r.Name())
+		}
+		if names[r.Name()] {
+			return errors.Errorf("custom resource %s is declared twice", r.Name())
+		}
+		names[r.Name()] = true
+
+		for _, m := range r.Metrics {
+			if declaring, ok := metrics[m.Name]; ok {
+				return errors.Errorf("custom resource %s: metric %s is already declared by custom resource %s", r.Name(), m.Name, declaring)
+			}
+			metrics[m.Name] = r.Name()
+		}
+
+		if _, err := FamilyGenerators(r); err != nil {
+			return errors.Wrapf(err, "custom resource %s", r.Name())
+		}
+	}
+	return nil
+}
+
+// Name returns the name of the collector of the resource, which is the plural
+// name qualified by the group, e.g. certificates.cert-manager.io.
+func (r Resource) Name() string {
+	if r.Group == "" {
+		return r.Resource
+	}
+	return r.Resource + "." + r.Group
+}
+
+// GroupVersionResource returns the group, version and plural name of the
+// resource.
+func (r Resource) GroupVersionResource() schema.GroupVersionResource {
+	return schema.GroupVersionResource{Group: r.Group, Version: r.Version, Resource: r.Resource}
+}
+
+// GroupVersionKind returns the group, version and kind of the resource.
+func (r Resource) GroupVersionKind() schema.GroupVersionKind {
+	return schema.GroupVersionKind{Group: r.Group, Version: r.Version, Kind: r.Kind}
+}
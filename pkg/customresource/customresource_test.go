@@ -0,0 +1,189 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package customresource
+
+import (
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const testConfig = `
+resources:
+  - group: cert-manager.io
+    version: v1
+    kind: Certificate
+    resource: certificates
+    labels:
+      issuer: .spec.issuerRef.name
+    metrics:
+      - name: kube_certificate_expiration_timestamp_seconds
+        help: Expiration time of the certificate.
+        type: gauge
+        path: .status.notAfter
+      - name: kube_certificate_renewals
+        type: gauge
+        path: '{.status.renewals}'
+      - name: kube_certificate_info
+        type: info
+        labels:
+          secret: .spec.secretName
+          missing: .spec.missing
+      - name: kube_certificate_status_ready
+        type: stateset
+        path: '{.status.conditions[?(@.type=="Ready")].status}'
+        stateLabel: status
+        states: ["True", "False", "Unknown"]
+`
+
+func TestFamilyGenerators(t *testing.T) {
+	config, err := Parse([]byte(testConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Resources) != 1 {
+		t.Fatalf("expected a single resource but got %v", len(config.Resources))
+	}
+	r := config.Resources[0]
+	if r.Name() != "certificates.cert-manager.io" {
+		t.Errorf("expected name certificates.cert-manager.io but got %v", r.Name())
+	}
+
+	generators, err := FamilyGenerators(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "cert-manager.io/v1",
+		"kind":       "Certificate",
+		"metadata": map[string]interface{}{
+			"namespace": "default",
+			"name":      "web",
+		},
+		"spec": map[string]interface{}{
+			"issuerRef":  map[string]interface{}{"name": "letsencrypt"},
+			"secretName": "web-tls",
+		},
+		"status": map[string]interface{}{
+			"notAfter": "2020-01-01T00:00:00Z",
+			"renewals": int64(3),
+			"conditions": []interface{}{
+				map[string]interface{}{"type": "Issuing", "status": "False"},
+				map[string]interface{}{"type": "Ready", "status": "True"},
+			},
+		},
+	}}
+
+	want := `kube_certificate_expiration_timestamp_seconds{namespace="default",name="web",issuer="letsencrypt"} 1.5778368e+09
+kube_certificate_renewals{namespace="default",name="web",issuer="letsencrypt"} 3
+kube_certificate_info{namespace="default",name="web",issuer="letsencrypt",missing="",secret="web-tls"} 1
+kube_certificate_status_ready{namespace="default",name="web",issuer="letsencrypt",status="True"} 1
+kube_certificate_status_ready{namespace="default",name="web",issuer="letsencrypt",status="False"} 0
+kube_certificate_status_ready{namespace="default",name="web",issuer="letsencrypt",status="Unknown"} 0
+`
+	got := strings.Builder{}
+	for _, g := range generators {
+		got.Write(g.Generate(obj).ByteSlice())
+	}
+	if got.String() != want {
+		t.Errorf("expected:\n%v\nbut got:\n%v", want, got.String())
+	}
+
+	// Objects missing the selected fields have no gauges and state sets.
+	empty := &unstructured.Unstructured{Object: map[string]interface{}{
+		"metadata": map[string]interface{}{"namespace": "default", "name": "new"},
+	}}
+	want = `kube_certificate_info{namespace="default",name="new",issuer="",missing="",secret=""} 1
+`
+	got.Reset()
+	for _, g := range generators {
+		got.Write(g.Generate(empty).ByteSlice())
+	}
+	if got.String() != want {
+		t.Errorf("expected:\n%v\nbut got:\n%v", want, got.String())
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	resource := `
+resources:
+  - group: example.com
+    version: v1
+    kind: Foo
+    resource: foos
+    metrics:
+`
+	tests := []struct {
+		desc   string
+		config string
+	}{
+		{"unknown field", resource + "      - name: foo\n        type: info\n        unknown: true\n"},
+		{"missing resource", "resources:\n  - group: example.com\n    version: v1\n    kind: Foo\n"},
+		{"duplicate resource", resource + strings.Replace(resource, "resources:\n", "", 1)},
+		{"invalid metric name", resource + "      - name: foo-bar\n        type: info\n"},
+		{"invalid label name", resource + "      - name: foo\n        type: info\n        labels:\n          foo-bar: .spec.bar\n"},
+		{"unknown type", resource + "      - name: foo\n        type: histogram\n"},
+		{"missing path", resource + "      - name: foo\n        type: gauge\n"},
+		{"invalid path", resource + "      - name: foo\n        type: gauge\n        path: '{.spec[}'\n"},
+		{"missing states", resource + "      - name: foo\n        type: stateset\n        path: .status.phase\n"},
+		{"duplicate metric", resource + "      - name: foo\n        type: info\n      - name: foo\n        type: info\n"},
+		{"metric of other resource", resource + "      - name: foo\n        type: info\n" + strings.Replace(strings.Replace(resource, "resources:\n", "", 1), "foos", "bars", 1) + "      - name: foo\n        type: info\n"},
+		{"implicit label", resource + "      - name: foo\n        type: info\n        labels:\n          name: .spec.name\n"},
+		{"resource and metric label", strings.Replace(resource, "    metrics:\n", "    labels:\n      bar: .spec.bar\n    metrics:\n", 1) + "      - name: foo\n        type: info\n        labels:\n          bar: .spec.bar\n"},
+		{"implicit state label", resource + "      - name: foo\n        type: stateset\n        path: .status.phase\n        stateLabel: namespace\n        states: [Ready]\n"},
+	}
+
+	for _, test := range tests {
+		if _, err := Parse([]byte(test.config)); err == nil {
+			t.Errorf("%s: expected error", test.desc)
+		}
+	}
+}
+
+func TestAllowlist(t *testing.T) {
+	a, err := ParseAllowlist([]string{"cert-manager.io/*", "argoproj.io/Workflow", "*/Backup"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		group, kind string
+		want        bool
+	}{
+		{"cert-manager.io", "Certificate", true},
+		{"argoproj.io", "Workflow", true},
+		{"argoproj.io", "Rollout", false},
+		{"velero.io", "Backup", true},
+		{"example.com", "Foo", false},
+	}
+	for _, test := range tests {
+		if got := a.Allows(test.group, test.kind); got != test.want {
+			t.Errorf("%s/%s: expected %v but got %v", test.group, test.kind, test.want, got)
+		}
+	}
+
+	if !(Allowlist{"*"}).Allows("example.com", "Foo") {
+		t.Error("expected * to allow all kinds")
+	}
+	for _, entry := range []string{"cert-manager.io", "/Foo", "a/b/c"} {
+		if _, err := ParseAllowlist([]string{entry}); err == nil {
+			t.Errorf("%s: expected error", entry)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package customresource
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Allowlist selects the kinds of custom resources whose conditions are
+// exposed by discovery. Its entries are either group/kind, where both group
+// and kind can be *, or * for all kinds.
+type Allowlist []string
+
+// ParseAllowlist validates the given entries of an allowlist.
+func ParseAllowlist(entries []string) (Allowlist, error) {
+	for _, entry := range entries {
+		if entry == "*" {
+			continue
+		}
+		parts := strings.Split(entry, "/")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, errors.Errorf("invalid custom resource discovery allowlist entry %q, must be group/kind or *", entry)
+		}
+	}
+	return Allowlist(entries), nil
+}
+
+// Allows returns whether the kind of the given group is allowed.
+func (a Allowlist) Allows(group, kind string) bool {
+	for _, entry := range a {
+		if entry == "*" {
+			return true
+		}
+		parts := strings.SplitN(entry, "/", 2)
+		if (parts[0] == "*" || parts[0] == group) && (parts[1] == "*" || parts[1] == kind) {
+			return true
+		}
+	}
+	return false
+}
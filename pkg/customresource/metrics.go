@@ -0,0 +1,290 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package customresource
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/util/jsonpath"
+
+	"k8s.io/kube-state-metrics/pkg/metric"
+)
+
+var descLabels = []string{"namespace", "name"}
+
+// path is a parsed JSONPath expression. A JSONPath keeps state while
+// evaluated, hence it is locked, as metrics of objects are generated
+// concurrently.
+type path struct {
+	mutex sync.Mutex
+	j     *jsonpath.JSONPath
+}
+
+func parsePath(name, text string) (*path, error) {
+	if !strings.HasPrefix(text, "{") {
+		text = "{" + text + "}"
+	}
+
+	j := jsonpath.New(name).AllowMissingKeys(true)
+	if err := j.Parse(text); err != nil {
+		return nil, errors.Wrapf(err, "parse path %s", text)
+	}
+	return &path{j: j}, nil
+}
+
+// find returns the first value selected in the given object, if any.
+func (p *path) find(content map[string]interface{}) (interface{}, bool) {
+	p.mutex.Lock()
+	results, err := p.j.FindResults(content)
+	p.mutex.Unlock()
+	if err != nil {
+		return nil, false
+	}
+
+	for _, values := range results {
+		for _, v := range values {
+			if v.IsValid() && v.CanInterface() {
+				return v.Interface(), true
+			}
+		}
+	}
+	return nil, false
+}
+
+// labelPaths are the paths of labels, ordered by label name.
+type labelPaths struct {
+	keys  []string
+	paths []*path
+}
+
+func parseLabelPaths(labels map[string]string) (labelPaths, error) {
+	l := labelPaths{}
+	for key := range labels {
+		if !labelNameRE.MatchString(key) {
+			return l, errors.Errorf("invalid label name %s", key)
+		}
+		l.keys = append(l.keys, key)
+	}
+	sort.Strings(l.keys)
+
+	for _, key := range l.keys {
+		p, err := parsePath(key, labels[key])
+		if err != nil {
+			return l, errors.Wrapf(err, "label %s", key)
+		}
+		l.paths = append(l.paths, p)
+	}
+	return l, nil
+}
+
+// values returns the values of the labels in the given object, the empty
+// string for labels whose path selects nothing.
+func (l labelPaths) values(content map[string]interface{}) []string {
+	values := make([]string, len(l.paths))
+	for i, p := range l.paths {
+		if v, ok := p.find(content); ok {
+			values[i] = stringValue(v)
+		}
+	}
+	return values
+}
+
+// FamilyGenerators returns the generators of the metric families declared for
+// the given resource. Their metrics are labeled with the namespace and name of
+// the object, followed by the labels of the resource and of the metric.
+func FamilyGenerators(r Resource) ([]metric.FamilyGenerator, error) {
+	resourceLabels, err := parseLabelPaths(r.Labels)
+	if err != nil {
+		return nil, err
+	}
+
+	generators := make([]metric.FamilyGenerator, 0, len(r.Metrics))
+	for _, m := range r.Metrics {
+		g, err := familyGenerator(m, resourceLabels)
+		if err != nil {
+			return nil, errors.Wrapf(err, "metric %s", m.Name)
+		}
+		generators = append(generators, g)
+	}
+	return generators, nil
+}
+
+func familyGenerator(m Metric, resourceLabels labelPaths) (metric.FamilyGenerator, error) {
+	if !metricNameRE.MatchString(m.Name) {
+		return metric.FamilyGenerator{}, errors.New("invalid metric name")
+	}
+
+	metricLabels, err := parseLabelPaths(m.Labels)
+	if err != nil {
+		return metric.FamilyGenerator{}, err
+	}
+	labelKeys := append(append(append([]string{}, descLabels...), resourceLabels.keys...), metricLabels.keys...)
+	if err := uniqueLabels(labelKeys); err != nil {
+		return metric.FamilyGenerator{}, err
+	}
+
+	var valuePath *path
+	if m.Type != MetricInfo {
+		if m.Path == "" {
+			return metric.FamilyGenerator{}, errors.Errorf("path of %s must be set", m.Type)
+		}
+		if valuePath, err = parsePath(m.Name, m.Path); err != nil {
+			return metric.FamilyGenerator{}, err
+		}
+	}
+
+	var generate func(content map[string]interface{}, labelValues []string) []*metric.Metric
+	switch m.Type {
+	case MetricGauge:
+		generate = func(content map[string]interface{}, labelValues []string) []*metric.Metric {
+			v, ok := valuePath.find(content)
+			if !ok {
+				return nil
+			}
+			value, ok := floatValue(v)
+			if !ok {
+				return nil
+			}
+			return []*metric.Metric{{LabelKeys: labelKeys, LabelValues: labelValues, Value: value}}
+		}
+	case MetricInfo:
+		generate = func(content map[string]interface{}, labelValues []string) []*metric.Metric {
+			return []*metric.Metric{{LabelKeys: labelKeys, LabelValues: labelValues, Value: 1}}
+		}
+	case MetricStateSet:
+		if len(m.States) == 0 {
+			return metric.FamilyGenerator{}, errors.New("states of stateset must be set")
+		}
+		stateLabel := m.StateLabel
+		if stateLabel == "" {
+			stateLabel = "state"
+		}
+		if !labelNameRE.MatchString(stateLabel) {
+			return metric.FamilyGenerator{}, errors.Errorf("invalid state label name %s", stateLabel)
+		}
+		stateKeys := append(append([]string{}, labelKeys...), stateLabel)
+		if err := uniqueLabels(stateKeys); err != nil {
+			return metric.FamilyGenerator{}, err
+		}
+		states := m.States
+
+		generate = func(content map[string]interface{}, labelValues []string) []*metric.Metric {
+			v, ok := valuePath.find(content)
+			if !ok {
+				return nil
+			}
+			current := stringValue(v)
+
+			ms := make([]*metric.Metric, len(states))
+			for i, state := range states {
+				ms[i] = &metric.Metric{
+					LabelKeys:   stateKeys,
+					LabelValues: append(append([]string{}, labelValues...), state),
+					Value:       boolFloat64(current == state),
+				}
+			}
+			return ms
+		}
+	default:
+		return metric.FamilyGenerator{}, errors.Errorf("unknown type %q, must be one of %s, %s or %s", m.Type, MetricGauge, MetricInfo, MetricStateSet)
+	}
+
+	return metric.FamilyGenerator{
+		Name: m.Name,
+		Type: metric.Gauge,
+		Help: m.Help,
+		GenerateFunc: func(obj interface{}) *metric.Family {
+			u := obj.(*unstructured.Unstructured)
+			content := u.UnstructuredContent()
+
+			labelValues := append([]string{u.GetNamespace(), u.GetName()}, resourceLabels.values(content)...)
+			labelValues = append(labelValues, metricLabels.values(content)...)
+
+			return &metric.Family{Metrics: generate(content, labelValues)}
+		},
+	}, nil
+}
+
+// uniqueLabels returns an error if any of the given label names is not
+// unique, e.g. if a configured label is named like the namespace and name
+// labels of all metrics.
+func uniqueLabels(keys []string) error {
+	seen := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		if seen[key] {
+			return errors.Errorf("label %s is declared twice", key)
+		}
+		seen[key] = true
+	}
+	return nil
+}
+
+// stringValue returns the given value of an object as label value.
+func stringValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// floatValue returns the given value of an object as metric value, if it is
+// a number, a boolean, a numeric string or an RFC 3339 timestamp.
+func floatValue(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case bool:
+		return boolFloat64(v), true
+	case string:
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f, true
+		}
+		if t, err := time.Parse(time.RFC3339, v); err == nil {
+			return float64(t.Unix()), true
+		}
+	default:
+		if rv := reflect.ValueOf(v); rv.IsValid() && rv.Kind() >= reflect.Int && rv.Kind() <= reflect.Float64 {
+			return rv.Convert(reflect.TypeOf(float64(0))).Float(), true
+		}
+	}
+	return 0, false
+}
+
+func boolFloat64(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
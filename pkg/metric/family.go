@@ -17,15 +17,38 @@ limitations under the License.
 package metric
 
 import (
+	"fmt"
 	"strings"
+
+	"github.com/golang/protobuf/proto"
+	dto "github.com/prometheus/client_model/go"
+
+	metricsstore "k8s.io/kube-state-metrics/pkg/metrics_store"
 )
 
 // Family represents a set of metrics with the same name and help text.
 type Family struct {
-	Name    string
+	Name string
+	Help string
+	Type Type
+	// Unit is the optional unit of the family, see FamilyGenerator.Unit.
+	Unit    string
 	Metrics []*Metric
 }
 
+// Families returns the metric families generated by FamilyGenerators among the
+// given ones, e.g. as walked by metricsstore.MetricsStore.WalkFamilies. Other
+// families, e.g. ones dropped by a series limit, are skipped.
+func Families(families []metricsstore.FamilyByteSlicer) []*Family {
+	result := make([]*Family, 0, len(families))
+	for _, f := range families {
+		if family, ok := f.(*Family); ok {
+			result = append(result, family)
+		}
+	}
+	return result
+}
+
 // ByteSlice returns the given Family in its string representation.
 func (f Family) ByteSlice() []byte {
 	b := strings.Builder{}
@@ -36,3 +59,114 @@ func (f Family) ByteSlice() []byte {
 
 	return []byte(b.String())
 }
+
+// ListMetrics implements the metricsstore.MetricLister interface, allowing
+// stores to keep the family in their compact representation.
+func (f Family) ListMetrics(fn func(labelKeys, labelValues []string, value float64)) {
+	for _, m := range f.Metrics {
+		fn(m.LabelKeys, m.LabelValues, m.Value)
+	}
+}
+
+// LimitMetrics implements the metricsstore.MetricLimiter interface, returning
+// the family restricted to its first n metrics.
+func (f Family) LimitMetrics(n int) metricsstore.FamilyByteSlicer {
+	f.Metrics = f.Metrics[:n]
+	return &f
+}
+
+// FormatByteSlice returns the given Family in its representation in the given
+// exposition format. It returns false if that representation does not differ
+// from the one returned by ByteSlice.
+func (f Family) FormatByteSlice(format metricsstore.Format) ([]byte, bool) {
+	if format == metricsstore.FormatProtobuf {
+		return f.protobufByteSlice(), true
+	}
+
+	if format != metricsstore.FormatOpenMetrics || !f.differsInOpenMetrics() {
+		return nil, false
+	}
+
+	familyName := openMetricsFamilyName(f.Name, f.Type)
+	sampleName := familyName + "_total"
+	createdName := familyName + "_created"
+
+	b := strings.Builder{}
+	for _, m := range f.Metrics {
+		b.WriteString(sampleName)
+		m.Write(&b)
+		if m.Created != 0 {
+			b.WriteString(createdName)
+			m.writeCreated(&b)
+		}
+	}
+
+	return []byte(b.String()), true
+}
+
+// differsInOpenMetrics returns whether the OpenMetrics representation of the
+// family differs from its Prometheus text representation. This is only the
+// case for counters, as their samples need to be suffixed with "_total" and
+// can be accompanied by a "_created" sample.
+func (f Family) differsInOpenMetrics() bool {
+	if f.Type != Counter {
+		return false
+	}
+
+	if !strings.HasSuffix(f.Name, "_total") {
+		return true
+	}
+
+	for _, m := range f.Metrics {
+		if m.Created != 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// openMetricsFamilyName returns the name of a metric family in the OpenMetrics
+// format, where counter families are named without their "_total" suffix.
+func openMetricsFamilyName(name string, t Type) string {
+	if t == Counter {
+		return strings.TrimSuffix(name, "_total")
+	}
+
+	return name
+}
+
+// Proto returns the given Family as io.prometheus.client.MetricFamily protobuf
+// message.
+func (f Family) Proto() *dto.MetricFamily {
+	mf := &dto.MetricFamily{
+		Name:   proto.String(f.Name),
+		Help:   proto.String(f.Help),
+		Type:   f.Type.proto().Enum(),
+		Metric: make([]*dto.Metric, len(f.Metrics)),
+	}
+
+	for i, m := range f.Metrics {
+		mf.Metric[i] = m.Proto(f.Type)
+	}
+
+	return mf
+}
+
+// protobufByteSlice returns the metrics of the given Family encoded as the
+// repeated metric field of an io.prometheus.client.MetricFamily message. Its
+// result can be appended to an encoded MetricFamily message without metrics.
+func (f Family) protobufByteSlice() []byte {
+	b := proto.NewBuffer(nil)
+
+	for _, m := range f.Metrics {
+		if err := b.EncodeVarint(metricsstore.MetricFieldTag); err != nil {
+			panic(fmt.Sprintf("failed to encode metric field tag: %v", err))
+		}
+		if err := b.EncodeMessage(m.Proto(f.Type)); err != nil {
+			panic(fmt.Sprintf("failed to encode metric of family %s: %v", f.Name, err))
+		}
+	}
+
+	return b.Bytes()
+}
@@ -17,27 +17,38 @@ limitations under the License.
 package metric
 
 import (
+	"fmt"
 	"strings"
 
+	"github.com/golang/protobuf/proto"
+	dto "github.com/prometheus/client_model/go"
+
 	metricsstore "k8s.io/kube-state-metrics/pkg/metrics_store"
 )
 
 // FamilyGenerator provides everything needed to generate a metric family with a
 // Kubernetes object.
 type FamilyGenerator struct {
-	Name         string
-	Help         string
-	Type         Type
+	Name string
+	Help string
+	Type Type
+	// Unit is the optional unit of the metric family, e.g. "bytes". It is only
+	// exposed in the OpenMetrics format, which requires the family name to be
+	// suffixed with it.
+	Unit         string
 	GenerateFunc func(obj interface{}) *Family
 }
 
 // Generate calls the FamilyGenerator.GenerateFunc and gives the family its
-// name. The reasoning behind injecting the name at such a late point in time is
-// deduplication in the code, preventing typos made by developers as
-// well as saving memory.
+// name, help text, type and unit. The reasoning behind injecting the name at such a
+// late point in time is deduplication in the code, preventing typos made by
+// developers as well as saving memory.
 func (g *FamilyGenerator) Generate(obj interface{}) *Family {
 	family := g.GenerateFunc(obj)
 	family.Name = g.Name
+	family.Help = g.Help
+	family.Type = g.Type
+	family.Unit = g.Unit
 	return family
 }
 
@@ -46,7 +57,7 @@ func (g *FamilyGenerator) generateHeader() string {
 	header.WriteString("# HELP ")
 	header.WriteString(g.Name)
 	header.WriteByte(' ')
-	header.WriteString(g.Help)
+	escapeHelp(&header, g.Help)
 	header.WriteByte('\n')
 	header.WriteString("# TYPE ")
 	header.WriteString(g.Name)
@@ -56,8 +67,51 @@ func (g *FamilyGenerator) generateHeader() string {
 	return header.String()
 }
 
+// generateOpenMetricsHeader generates the header of the family in the
+// OpenMetrics format. In contrast to the Prometheus text format, the name of a
+// counter family does not contain the "_total" suffix of its samples.
+func (g *FamilyGenerator) generateOpenMetricsHeader() string {
+	name := openMetricsFamilyName(g.Name, g.Type)
+
+	header := strings.Builder{}
+	header.WriteString("# HELP ")
+	header.WriteString(name)
+	header.WriteByte(' ')
+	escapeOpenMetricsHelp(&header, g.Help)
+	header.WriteByte('\n')
+	header.WriteString("# TYPE ")
+	header.WriteString(name)
+	header.WriteByte(' ')
+	header.WriteString(string(g.Type))
+	if g.Unit != "" {
+		header.WriteByte('\n')
+		header.WriteString("# UNIT ")
+		header.WriteString(name)
+		header.WriteByte(' ')
+		header.WriteString(g.Unit)
+	}
+
+	return header.String()
+}
+
+// generateProtobufHeader generates the header of the family in the protobuf
+// format, an encoded io.prometheus.client.MetricFamily message without any
+// metrics.
+func (g *FamilyGenerator) generateProtobufHeader() string {
+	header, err := proto.Marshal(&dto.MetricFamily{
+		Name: proto.String(g.Name),
+		Help: proto.String(g.Help),
+		Type: g.Type.proto().Enum(),
+	})
+	if err != nil {
+		panic(fmt.Sprintf("failed to encode header of metric family %s: %v", g.Name, err))
+	}
+
+	return string(header)
+}
+
 // ExtractMetricFamilyHeaders takes in a slice of FamilyGenerator metrics and
-// returns the extracted headers.
+// returns the extracted headers in the Prometheus text format.
 func ExtractMetricFamilyHeaders(families []FamilyGenerator) []string {
 	headers := make([]string, len(families))
 
@@ -68,6 +122,50 @@ func ExtractMetricFamilyHeaders(families []FamilyGenerator) []string {
 	return headers
 }
 
+// familyHeader contains the header of a metric family pre-rendered in each
+// exposition format.
+type familyHeader struct {
+	name        string
+	text        string
+	openMetrics string
+	protobuf    string
+}
+
+// Name implements the metricsstore.FamilyHeader interface.
+func (h familyHeader) Name() string {
+	return h.name
+}
+
+// Header implements the metricsstore.FamilyHeader interface.
+func (h familyHeader) Header(f metricsstore.Format) string {
+	switch f {
+	case metricsstore.FormatOpenMetrics:
+		return h.openMetrics
+	case metricsstore.FormatProtobuf:
+		return h.protobuf
+	default:
+		return h.text
+	}
+}
+
+// ExtractMetricFamilyFormatHeaders takes in a slice of FamilyGenerator metrics
+// and returns the extracted headers, which can be rendered in every exposition
+// format supported by the metricsstore.
+func ExtractMetricFamilyFormatHeaders(families []FamilyGenerator) []metricsstore.FamilyHeader {
+	headers := make([]metricsstore.FamilyHeader, len(families))
+
+	for i, f := range families {
+		headers[i] = familyHeader{
+			name:        f.Name,
+			text:        f.generateHeader(),
+			openMetrics: f.generateOpenMetricsHeader(),
+			protobuf:    f.generateProtobufHeader(),
+		}
+	}
+
+	return headers
+}
+
 // ComposeMetricGenFuncs takes a slice of metric families and returns a function
 // that composes their metric generation functions into a single one.
 func ComposeMetricGenFuncs(familyGens []FamilyGenerator) func(obj interface{}) []metricsstore.FamilyByteSlicer {
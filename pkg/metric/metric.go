@@ -18,25 +18,18 @@ package metric
 
 import (
 	"fmt"
-	"math"
-	"strconv"
 	"strings"
-	"sync"
-)
 
-const (
-	initialNumBufSize = 24
-)
+	"github.com/golang/protobuf/proto"
+	dto "github.com/prometheus/client_model/go"
 
-var (
-	numBufPool = sync.Pool{
-		New: func() interface{} {
-			b := make([]byte, 0, initialNumBufSize)
-			return &b
-		},
-	}
+	metricsstore "k8s.io/kube-state-metrics/pkg/metrics_store"
 )
 
+// numBufSize is the size of the buffer floats are rendered into, which is
+// sufficient for all values.
+const numBufSize = 24
+
 // Type represents the type of a metric e.g. a counter. See
 // https://prometheus.io/docs/concepts/metric_types/.
 type Type string
@@ -47,15 +40,98 @@ var Gauge Type = "gauge"
 // Counter defines a Prometheus counter.
 var Counter Type = "counter"
 
+// proto returns the io.prometheus.client.MetricType of the given Type.
+func (t Type) proto() dto.MetricType {
+	switch t {
+	case Counter:
+		return dto.MetricType_COUNTER
+	case Gauge:
+		return dto.MetricType_GAUGE
+	default:
+		return dto.MetricType_UNTYPED
+	}
+}
+
 // Metric represents a single time series.
 type Metric struct {
 	// The name of a metric is injected by its family to reduce duplication.
 	LabelKeys   []string
 	LabelValues []string
 	Value       float64
+	// Created is the unix timestamp at which a counter started counting. It
+	// is exposed as a "_created" sample in the OpenMetrics format only. Zero
+	// means that the creation time is unknown.
+	Created float64
 }
 
 func (m *Metric) Write(s *strings.Builder) {
+	m.writeSample(s, m.Value)
+}
+
+// Proto returns the given Metric as io.prometheus.client.Metric protobuf
+// message of the given Type.
+func (m *Metric) Proto(t Type) *dto.Metric {
+	if len(m.LabelKeys) != len(m.LabelValues) {
+		panic(fmt.Sprintf(
+			"expected labelKeys %q to be of same length as labelValues %q",
+			m.LabelKeys, m.LabelValues,
+		))
+	}
+
+	pm := &dto.Metric{
+		Label: make([]*dto.LabelPair, len(m.LabelKeys)),
+	}
+	for i := range m.LabelKeys {
+		pm.Label[i] = &dto.LabelPair{
+			Name:  proto.String(m.LabelKeys[i]),
+			Value: proto.String(m.LabelValues[i]),
+		}
+	}
+
+	switch t {
+	case Counter:
+		pm.Counter = &dto.Counter{Value: proto.Float64(m.Value)}
+	case Gauge:
+		pm.Gauge = &dto.Gauge{Value: proto.Float64(m.Value)}
+	default:
+		pm.Untyped = &dto.Untyped{Value: proto.Float64(m.Value)}
+	}
+
+	return pm
+}
+
+// MetricFromProto returns the Metric represented by the given
+// io.prometheus.client.Metric protobuf message of any Type, the inverse of
+// Metric.Proto.
+func MetricFromProto(pm *dto.Metric) *Metric {
+	m := &Metric{
+		LabelKeys:   make([]string, len(pm.Label)),
+		LabelValues: make([]string, len(pm.Label)),
+	}
+	for i, l := range pm.Label {
+		m.LabelKeys[i] = l.GetName()
+		m.LabelValues[i] = l.GetValue()
+	}
+
+	switch {
+	case pm.Counter != nil:
+		m.Value = pm.Counter.GetValue()
+	case pm.Gauge != nil:
+		m.Value = pm.Gauge.GetValue()
+	case pm.Untyped != nil:
+		m.Value = pm.Untyped.GetValue()
+	}
+
+	return m
+}
+
+// writeCreated writes the labels of the metric followed by its creation
+// timestamp.
+func (m *Metric) writeCreated(s *strings.Builder) {
+	m.writeSample(s, m.Created)
+}
+
+func (m *Metric) writeSample(s *strings.Builder, value float64) {
 	if len(m.LabelKeys) != len(m.LabelValues) {
 		panic(fmt.Sprintf(
 			"expected labelKeys %q to be of same length as labelValues %q",
@@ -65,7 +141,7 @@ func (m *Metric) Write(s *strings.Builder) {
 
 	labelsToString(s, m.LabelKeys, m.LabelValues)
 	s.WriteByte(' ')
-	writeFloat(s, m.Value)
+	writeFloat(s, value)
 	s.WriteByte('\n')
 }
 
@@ -86,39 +162,30 @@ func labelsToString(m *strings.Builder, keys, values []string) {
 	}
 }
 
-var (
-	escapeWithDoubleQuote = strings.NewReplacer("\\", `\\`, "\n", `\n`, "\"", `\"`)
-)
+var escapeHelpText = strings.NewReplacer("\\", `\\`, "\n", `\n`)
 
 // escapeString replaces '\' by '\\', new line character by '\n', and '"' by
-// '\"'.
-// Taken from github.com/prometheus/common/expfmt/text_create.go.
+// '\"', see metricsstore.EscapeLabelValue.
 func escapeString(m *strings.Builder, v string) {
-	escapeWithDoubleQuote.WriteString(m, v)
+	m.WriteString(metricsstore.EscapeLabelValue(v))
+}
+
+// escapeHelp replaces '\' by '\\' and new line character by '\n' in help
+// texts of the Prometheus text format.
+func escapeHelp(m *strings.Builder, v string) {
+	escapeHelpText.WriteString(m, v)
 }
 
-// writeFloat is equivalent to fmt.Fprint with a float64 argument but hardcodes
-// a few common cases for increased efficiency. For non-hardcoded cases, it uses
-// strconv.AppendFloat to avoid allocations, similar to writeInt.
-// Taken from github.com/prometheus/common/expfmt/text_create.go.
+// escapeOpenMetricsHelp escapes help texts of the OpenMetrics format, which
+// additionally requires '"' to be replaced by '\"'.
+func escapeOpenMetricsHelp(m *strings.Builder, v string) {
+	escapeString(m, v)
+}
+
+// writeFloat writes the given value like fmt.Fprint, see
+// metricsstore.AppendFloat. It renders into a buffer on the stack to avoid
+// allocations.
 func writeFloat(w *strings.Builder, f float64) {
-	switch {
-	case f == 1:
-		w.WriteByte('1')
-	case f == 0:
-		w.WriteByte('0')
-	case f == -1:
-		w.WriteString("-1")
-	case math.IsNaN(f):
-		w.WriteString("NaN")
-	case math.IsInf(f, +1):
-		w.WriteString("+Inf")
-	case math.IsInf(f, -1):
-		w.WriteString("-Inf")
-	default:
-		bp := numBufPool.Get().(*[]byte)
-		*bp = strconv.AppendFloat((*bp)[:0], f, 'g', -1, 64)
-		w.Write(*bp)
-		numBufPool.Put(bp)
-	}
+	var buf [numBufSize]byte
+	w.Write(metricsstore.AppendFloat(buf[:0], f))
 }
@@ -17,8 +17,14 @@ limitations under the License.
 package metric
 
 import (
+	"reflect"
 	"strings"
 	"testing"
+
+	"github.com/golang/protobuf/proto"
+	dto "github.com/prometheus/client_model/go"
+
+	metricsstore "k8s.io/kube-state-metrics/pkg/metrics_store"
 )
 
 func TestFamilyString(t *testing.T) {
@@ -41,6 +47,176 @@ func TestFamilyString(t *testing.T) {
 	}
 }
 
+func TestFamilyFormatByteSlice(t *testing.T) {
+	tests := []struct {
+		family      Family
+		want        string
+		wantDiffers bool
+	}{
+		{
+			family: Family{
+				Name: "kube_pod_info",
+				Type: Gauge,
+				Metrics: []*Metric{
+					{LabelKeys: []string{"namespace"}, LabelValues: []string{"default"}, Value: 1},
+				},
+			},
+			wantDiffers: false,
+		},
+		{
+			family: Family{
+				Name: "kube_pod_container_status_restarts_total",
+				Type: Counter,
+				Metrics: []*Metric{
+					{LabelKeys: []string{"container"}, LabelValues: []string{"a"}, Value: 3},
+				},
+			},
+			wantDiffers: false,
+		},
+		{
+			family: Family{
+				Name: "kube_pod_container_status_restarts_total",
+				Type: Counter,
+				Metrics: []*Metric{
+					{LabelKeys: []string{"container"}, LabelValues: []string{"a"}, Value: 3, Created: 1500000000},
+					{LabelKeys: []string{"container"}, LabelValues: []string{"b"}, Value: 0},
+				},
+			},
+			want: `kube_pod_container_status_restarts_total{container="a"} 3
+kube_pod_container_status_restarts_created{container="a"} 1.5e+09
+kube_pod_container_status_restarts_total{container="b"} 0
+`,
+			wantDiffers: true,
+		},
+		{
+			family: Family{
+				Name: "kube_pod_restarts",
+				Type: Counter,
+				Metrics: []*Metric{
+					{LabelKeys: []string{"container"}, LabelValues: []string{"a"}, Value: 3},
+				},
+			},
+			want: `kube_pod_restarts_total{container="a"} 3
+`,
+			wantDiffers: true,
+		},
+	}
+
+	for _, test := range tests {
+		got, differs := test.family.FormatByteSlice(metricsstore.FormatOpenMetrics)
+		if differs != test.wantDiffers {
+			t.Fatalf("%v: expected differs to be %v but got %v", test.family.Name, test.wantDiffers, differs)
+		}
+		if string(got) != test.want {
+			t.Fatalf("%v: expected:\n%v\nbut got:\n%v", test.family.Name, test.want, string(got))
+		}
+	}
+}
+
+func TestExtractMetricFamilyFormatHeaders(t *testing.T) {
+	families := []FamilyGenerator{
+		{
+			Name: "kube_node_status_capacity_memory_bytes",
+			Help: "The total memory resources of the node.",
+			Type: Gauge,
+			Unit: "bytes",
+		},
+		{
+			Name: "kube_pod_container_status_restarts_total",
+			Help: "The number of \"container\" restarts.",
+			Type: Counter,
+		},
+	}
+
+	tests := []struct {
+		format metricsstore.Format
+		want   []string
+	}{
+		{
+			format: metricsstore.FormatText,
+			want: []string{
+				"# HELP kube_node_status_capacity_memory_bytes The total memory resources of the node.\n# TYPE kube_node_status_capacity_memory_bytes gauge",
+				"# HELP kube_pod_container_status_restarts_total The number of \"container\" restarts.\n# TYPE kube_pod_container_status_restarts_total counter",
+			},
+		},
+		{
+			format: metricsstore.FormatOpenMetrics,
+			want: []string{
+				"# HELP kube_node_status_capacity_memory_bytes The total memory resources of the node.\n# TYPE kube_node_status_capacity_memory_bytes gauge\n# UNIT kube_node_status_capacity_memory_bytes bytes",
+				"# HELP kube_pod_container_status_restarts The number of \\\"container\\\" restarts.\n# TYPE kube_pod_container_status_restarts counter",
+			},
+		},
+	}
+
+	headers := ExtractMetricFamilyFormatHeaders(families)
+	for i, h := range headers {
+		if got := h.Name(); got != families[i].Name {
+			t.Errorf("expected header name %v but got %v", families[i].Name, got)
+		}
+	}
+	for _, test := range tests {
+		for i, h := range headers {
+			if got := h.Header(test.format); got != test.want[i] {
+				t.Errorf("format %v: expected header:\n%v\nbut got:\n%v", test.format, test.want[i], got)
+			}
+		}
+	}
+}
+
+func TestFamilyProtobufByteSlice(t *testing.T) {
+	gen := FamilyGenerator{
+		Name: "kube_pod_container_status_restarts_total",
+		Help: "The number of container restarts per container.",
+		Type: Counter,
+		GenerateFunc: func(obj interface{}) *Family {
+			return &Family{
+				Metrics: []*Metric{
+					{LabelKeys: []string{"namespace", "container"}, LabelValues: []string{"default", "a"}, Value: 3},
+					{LabelKeys: []string{"namespace", "container"}, LabelValues: []string{"default", "b"}, Value: 0},
+				},
+			}
+		},
+	}
+
+	header := ExtractMetricFamilyFormatHeaders([]FamilyGenerator{gen})[0].Header(metricsstore.FormatProtobuf)
+	body, ok := gen.Generate(nil).FormatByteSlice(metricsstore.FormatProtobuf)
+	if !ok {
+		t.Fatal("expected family to be rendered in the protobuf format")
+	}
+
+	got := &dto.MetricFamily{}
+	if err := proto.Unmarshal(append([]byte(header), body...), got); err != nil {
+		t.Fatalf("failed to unmarshal metric family: %v", err)
+	}
+
+	want := gen.Generate(nil).Proto()
+	if !proto.Equal(got, want) {
+		t.Fatalf("expected metric family %v but got %v", want, got)
+	}
+
+	if got.GetType() != dto.MetricType_COUNTER || got.GetMetric()[0].GetCounter().GetValue() != 3 {
+		t.Fatalf("expected counter with value 3 but got %v", got)
+	}
+}
+
+func TestFamilyLimitMetrics(t *testing.T) {
+	f := Family{
+		Name: "kube_pod_labels",
+		Metrics: []*Metric{
+			{LabelKeys: []string{"pod"}, LabelValues: []string{"a"}, Value: 1},
+			{LabelKeys: []string{"pod"}, LabelValues: []string{"b"}, Value: 1},
+		},
+	}
+
+	want := "kube_pod_labels{pod=\"a\"} 1\n"
+	if got := string(f.LimitMetrics(1).ByteSlice()); got != want {
+		t.Errorf("expected:\n%v\nbut got:\n%v", want, got)
+	}
+	if len(f.Metrics) != 2 {
+		t.Errorf("expected the limited family not to be modified, got %v metrics", len(f.Metrics))
+	}
+}
+
 func BenchmarkMetricWrite(b *testing.B) {
 	tests := []struct {
 		testName       string
@@ -86,3 +262,17 @@ func BenchmarkMetricWrite(b *testing.B) {
 		})
 	}
 }
+
+func TestMetricFromProto(t *testing.T) {
+	m := &Metric{
+		LabelKeys:   []string{"namespace", "pod"},
+		LabelValues: []string{"default", "a"},
+		Value:       3,
+	}
+
+	for _, typ := range []Type{Counter, Gauge, Type("unknown")} {
+		if got := MetricFromProto(m.Proto(typ)); !reflect.DeepEqual(got, m) {
+			t.Errorf("type %v: expected metric %v but got %v", typ, m, got)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metricsstore
+
+import (
+	"fmt"
+	"math"
+)
+
+// MetricLister represents a metric family whose metrics can be listed one by
+// one, which allows the store to keep it in its compact representation.
+type MetricLister interface {
+	ListMetrics(f func(labelKeys, labelValues []string, value float64))
+}
+
+// EnableCompactStorage makes the MetricsStore keep the metric families
+// implementing MetricLister in a packed form instead of rendered. Label names
+// and values are interned, hence shared by all metrics of a shard, and
+// families are only rendered while being written. This trades CPU time of
+// every write for memory. Families in the protobuf format and OpenMetrics
+// families differing from their text representation are still rendered
+// eagerly. It has to be called before any object is added to the store.
+func (s *MetricsStore) EnableCompactStorage() {
+	s.lockAll()
+	defer s.unlockAll()
+
+	for _, sh := range s.shards {
+		sh.symbols = newSymbolTable()
+	}
+}
+
+// packedFamily is the compact representation of the metrics of a metric
+// family of an object. Each metric is represented by the number of its labels,
+// followed by the symbols of the name and value of each label and by the
+// upper and lower half of the bits of its value. The name of the family is
+// not part of it, as it is the name of the header of the family.
+type packedFamily []uint32
+
+// equal returns whether the given packed families are equal, which requires
+// them to be packed with the same symbol table.
+func (p packedFamily) equal(o packedFamily) bool {
+	if len(p) != len(o) {
+		return false
+	}
+	for i := range p {
+		if p[i] != o[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// len returns the number of metrics of the packed family.
+func (p packedFamily) len() int {
+	n := 0
+	for i := 0; i < len(p); i += 2*int(p[i]) + 3 {
+		n++
+	}
+	return n
+}
+
+// symbolTable interns strings as reference counted symbols. Symbols of
+// released strings are reused.
+type symbolTable struct {
+	ids     map[string]uint32
+	symbols []string
+	refs    []uint32
+	free    []uint32
+	// scratch is reused to pack metric families.
+	scratch []uint32
+}
+
+func newSymbolTable() *symbolTable {
+	return &symbolTable{ids: map[string]uint32{}}
+}
+
+// intern returns the symbol of the given string and increases its reference
+// count.
+func (t *symbolTable) intern(s string) uint32 {
+	if id, ok := t.ids[s]; ok {
+		t.refs[id]++
+		return id
+	}
+
+	// The string is copied, as it might be part of a larger string which
+	// would be kept alive otherwise.
+	s = string([]byte(s))
+
+	var id uint32
+	if n := len(t.free); n > 0 {
+		id = t.free[n-1]
+		t.free = t.free[:n-1]
+		t.symbols[id] = s
+		t.refs[id] = 1
+	} else {
+		id = uint32(len(t.symbols))
+		t.symbols = append(t.symbols, s)
+		t.refs = append(t.refs, 1)
+	}
+	t.ids[s] = id
+	return id
+}
+
+// release decreases the reference count of the given symbol, freeing it if it
+// is not referenced anymore.
+func (t *symbolTable) release(id uint32) {
+	t.refs[id]--
+	if t.refs[id] > 0 {
+		return
+	}
+
+	delete(t.ids, t.symbols[id])
+	t.symbols[id] = ""
+	t.free = append(t.free, id)
+}
+
+// len returns the number of strings currently interned.
+func (t *symbolTable) len() int {
+	return len(t.ids)
+}
+
+// pack returns the packed representation of the metrics of the given family,
+// which is nil if the family does not have any metrics. Label values are
+// interned escaped.
+func (t *symbolTable) pack(l MetricLister) packedFamily {
+	packed := t.scratch[:0]
+	l.ListMetrics(func(labelKeys, labelValues []string, value float64) {
+		if len(labelKeys) != len(labelValues) {
+			panic(fmt.Sprintf(
+				"expected labelKeys %q to be of same length as labelValues %q",
+				labelKeys, labelValues,
+			))
+		}
+
+		packed = append(packed, uint32(len(labelKeys)))
+		for i := range labelKeys {
+			packed = append(packed, t.intern(labelKeys[i]), t.intern(EscapeLabelValue(labelValues[i])))
+		}
+		bits := math.Float64bits(value)
+		packed = append(packed, uint32(bits>>32), uint32(bits))
+	})
+	t.scratch = packed
+
+	if len(packed) == 0 {
+		return nil
+	}
+	return append(packedFamily(nil), packed...)
+}
+
+// unpack releases the symbols of the given packed family.
+func (t *symbolTable) unpack(p packedFamily) {
+	for i := 0; i < len(p); {
+		n := int(p[i])
+		for _, id := range p[i+1 : i+1+2*n] {
+			t.release(id)
+		}
+		i += 2*n + 3
+	}
+}
+
+// render appends the metrics of the given packed family with the given name
+// in the Prometheus text format to buf and returns the result.
+func (t *symbolTable) render(buf []byte, name string, p packedFamily) []byte {
+	for i := 0; i < len(p); {
+		n := int(p[i])
+		i++
+
+		buf = append(buf, name...)
+		if n > 0 {
+			separator := byte('{')
+			for j := 0; j < n; j++ {
+				buf = append(buf, separator)
+				buf = append(buf, t.symbols[p[i]]...)
+				buf = append(buf, '=', '"')
+				buf = append(buf, t.symbols[p[i+1]]...)
+				buf = append(buf, '"')
+				separator = ','
+				i += 2
+			}
+			buf = append(buf, '}')
+		}
+
+		buf = append(buf, ' ')
+		buf = AppendFloat(buf, math.Float64frombits(uint64(p[i])<<32|uint64(p[i+1])))
+		buf = append(buf, '\n')
+		i += 2
+	}
+	return buf
+}
+
+// text returns the metric families of the given entry of the given shard in
+// the Prometheus text format, rendering the packed ones. The caller has to
+// hold the read lock of the shard.
+func (s *MetricsStore) text(sh *storeShard, e *entry) [][]byte {
+	if e.packed == nil {
+		return e.families[FormatText]
+	}
+
+	text := make([][]byte, len(e.packed))
+	copy(text, e.families[FormatText])
+	for i, p := range e.packed {
+		if p != nil {
+			text[i] = sh.symbols.render(nil, s.headers[i].Name(), p)
+		}
+	}
+	return text
+}
+
+// release releases the symbols of the packed metric families of the given
+// entry. The caller has to hold the lock of the shard.
+func (sh *storeShard) release(e *entry) {
+	for _, p := range e.packed {
+		sh.symbols.unpack(p)
+	}
+}
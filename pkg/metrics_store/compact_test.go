@@ -0,0 +1,328 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metricsstore
+
+import (
+	"fmt"
+	"math"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Mock metricFamily whose metrics can be listed. Its text representation has
+// to be given explicitly, as rendering it is what is tested.
+type listedFamily struct {
+	metricFamily
+	metrics []listedMetric
+}
+
+type listedMetric struct {
+	labelKeys   []string
+	labelValues []string
+	value       float64
+}
+
+// Implement MetricLister interface.
+func (f *listedFamily) ListMetrics(fn func(labelKeys, labelValues []string, value float64)) {
+	for _, m := range f.metrics {
+		fn(m.labelKeys, m.labelValues, m.value)
+	}
+}
+
+var compactTestHeaders = []FamilyHeader{
+	familyHeader{name: "kube_service_info", text: "# TYPE kube_service_info gauge", openMetrics: "# TYPE kube_service_info gauge"},
+	familyHeader{name: "kube_service_spec_ports", text: "# TYPE kube_service_spec_ports gauge", openMetrics: "# TYPE kube_service_spec_ports gauge"},
+	familyHeader{name: "kube_service_created", text: "# TYPE kube_service_created gauge", openMetrics: "# TYPE kube_service_created gauge"},
+	familyHeader{name: "kube_service_restarts_total", text: "# TYPE kube_service_restarts_total counter", openMetrics: "# TYPE kube_service_restarts counter"},
+}
+
+// compactTestFamilies generates metric families of the headers above, the
+// number of ports is taken from the label "ports" of the object.
+func compactTestFamilies(t testing.TB) func(obj interface{}) []FamilyByteSlicer {
+	return func(obj interface{}) []FamilyByteSlicer {
+		o, err := meta.Accessor(obj)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ports, _ := strconv.Atoi(o.GetLabels()["ports"])
+
+		keys := []string{"namespace", "service"}
+		values := []string{o.GetNamespace(), o.GetName()}
+		info := &listedFamily{
+			metricFamily: metricFamily{[]byte(fmt.Sprintf(
+				"kube_service_info{namespace=\"%s\",service=\"%s\",note=\"say \\\"hi\\\"\\n\\\\\"} 1\n",
+				o.GetNamespace(), o.GetName(),
+			))},
+			metrics: []listedMetric{{
+				labelKeys:   append(keys, "note"),
+				labelValues: append(values, "say \"hi\"\n\\"),
+				value:       1,
+			}},
+		}
+
+		portsFamily := &listedFamily{}
+		for i := 0; i < ports; i++ {
+			portsFamily.value = append(portsFamily.value, fmt.Sprintf(
+				"kube_service_spec_ports{namespace=\"%s\",service=\"%s\",port=\"%d\"} 35.7\n",
+				o.GetNamespace(), o.GetName(), i,
+			)...)
+			portsFamily.metrics = append(portsFamily.metrics, listedMetric{
+				labelKeys:   append(keys, "port"),
+				labelValues: append(values, strconv.Itoa(i)),
+				value:       35.7,
+			})
+		}
+
+		// Families without labels, with special values and differing in
+		// OpenMetrics.
+		created := &listedFamily{
+			metricFamily: metricFamily{[]byte("kube_service_created NaN\nkube_service_created -Inf\nkube_service_created 0\n")},
+			metrics: []listedMetric{
+				{value: math.NaN()},
+				{value: math.Inf(-1)},
+				{value: math.Copysign(0, -1)},
+			},
+		}
+		restarts := &openMetricsFamily{
+			metricFamily:     metricFamily{[]byte("kube_service_restarts_total 1e+21\n")},
+			openMetricsValue: []byte("kube_service_restarts_total 1e+21\nkube_service_restarts_created 1\n"),
+		}
+
+		return []FamilyByteSlicer{info, portsFamily, created, restarts}
+	}
+}
+
+func newCompactTestService(namespace, name, version string, ports int) *v1.Service {
+	return &v1.Service{ObjectMeta: metav1.ObjectMeta{
+		Namespace:       namespace,
+		Name:            name,
+		UID:             types.UID(namespace + "/" + name),
+		ResourceVersion: version,
+		Labels:          map[string]string{"ports": strconv.Itoa(ports)},
+	}}
+}
+
+func TestCompactStorage(t *testing.T) {
+	stores := map[string]*MetricsStore{
+		"default": NewMetricsStoreWithHeaders(compactTestHeaders, compactTestFamilies(t)),
+		"compact": NewMetricsStoreWithHeaders(compactTestHeaders, compactTestFamilies(t)),
+	}
+	stores["compact"].EnableCompactStorage()
+
+	for _, ms := range stores {
+		ms.EnableSortedOutput()
+		for _, s := range []*v1.Service{
+			newCompactTestService("default", "web", "1", 2),
+			newCompactTestService("default", "db", "1", 1),
+			newCompactTestService("kube-system", "dns", "1", 0),
+		} {
+			if err := ms.Add(s); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := ms.Update(newCompactTestService("default", "web", "2", 3)); err != nil {
+			t.Fatal(err)
+		}
+		if err := ms.Delete(newCompactTestService("default", "db", "1", 1)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write := func(ms *MetricsStore, f Format) string {
+		w := strings.Builder{}
+		ms.WriteAllFormat(&w, f)
+		return w.String()
+	}
+
+	want := `# TYPE kube_service_info gauge
+kube_service_info{namespace="default",service="web",note="say \"hi\"\n\\"} 1
+kube_service_info{namespace="kube-system",service="dns",note="say \"hi\"\n\\"} 1
+# TYPE kube_service_spec_ports gauge
+kube_service_spec_ports{namespace="default",service="web",port="0"} 35.7
+kube_service_spec_ports{namespace="default",service="web",port="1"} 35.7
+kube_service_spec_ports{namespace="default",service="web",port="2"} 35.7
+# TYPE kube_service_created gauge
+kube_service_created NaN
+kube_service_created -Inf
+kube_service_created 0
+kube_service_created NaN
+kube_service_created -Inf
+kube_service_created 0
+# TYPE kube_service_restarts_total counter
+kube_service_restarts_total 1e+21
+kube_service_restarts_total 1e+21
+`
+	if got := write(stores["compact"], FormatText); got != want {
+		t.Errorf("expected:\n%v\nbut got:\n%v", want, got)
+	}
+
+	for _, f := range []Format{FormatText, FormatOpenMetrics} {
+		if want, got := write(stores["default"], f), write(stores["compact"], f); got != want {
+			t.Errorf("expected %v output of compact store:\n%v\nbut got:\n%v", f, want, got)
+		}
+	}
+
+	// The parsed NaN values are never equal, hence the listed objects are
+	// compared as strings.
+	list := func(ms *MetricsStore) string {
+		items := []string{}
+		for _, item := range ms.List() {
+			o := item.(*ObjectMetrics)
+			items = append(items, fmt.Sprintf("%v: %v", o.Object, o.Families))
+		}
+		return strings.Join(items, "\n")
+	}
+	if want, got := list(stores["default"]), list(stores["compact"]); got != want {
+		t.Errorf("expected listed objects of compact store:\n%v\nbut got:\n%v", want, got)
+	}
+}
+
+func TestCompactStorageReleasesSymbols(t *testing.T) {
+	ms := NewMetricsStoreWithHeaders(compactTestHeaders, compactTestFamilies(t))
+	ms.EnableCompactStorage()
+
+	// Symbols are interned per shard.
+	expectSymbols := func(want int) {
+		t.Helper()
+		got := 0
+		for _, sh := range ms.shards {
+			got += sh.symbols.len()
+		}
+		if got != want {
+			t.Errorf("expected %v symbols but got %v", want, got)
+		}
+	}
+
+	web := newCompactTestService("default", "web", "1", 2)
+	dns := newCompactTestService("kube-system", "dns", "1", 0)
+	if ms.shardIndex(web.UID) == ms.shardIndex(dns.UID) {
+		t.Fatal("expected services in different shards")
+	}
+	for _, s := range []*v1.Service{web, dns} {
+		if err := ms.Add(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// namespace, service, note, port, the escaped note, default, web, 0 and 1
+	// in the shard of web, namespace, service, note, the escaped note,
+	// kube-system and dns in the shard of dns.
+	expectSymbols(15)
+
+	// Neither unchanged nor regenerated metrics keep symbols referenced.
+	if err := ms.Update(newCompactTestService("default", "web", "2", 2)); err != nil {
+		t.Fatal(err)
+	}
+	expectSymbols(15)
+	if err := ms.Update(newCompactTestService("default", "web", "3", 1)); err != nil {
+		t.Fatal(err)
+	}
+	expectSymbols(14)
+
+	if err := ms.Replace([]interface{}{dns}, ""); err != nil {
+		t.Fatal(err)
+	}
+	expectSymbols(6)
+
+	if err := ms.Delete(dns); err != nil {
+		t.Fatal(err)
+	}
+	expectSymbols(0)
+	for _, sh := range ms.shards {
+		if got := len(sh.symbols.free); got != len(sh.symbols.symbols) {
+			t.Errorf("expected all %v symbols to be free but got %v", len(sh.symbols.symbols), got)
+		}
+	}
+}
+
+func BenchmarkCompactStorage(b *testing.B) {
+	const objects = 1000
+
+	tests := []struct {
+		testName string
+		compact  bool
+	}{
+		{
+			testName: "default",
+		},
+		{
+			testName: "compact",
+			compact:  true,
+		},
+	}
+
+	services := make([]*v1.Service, objects)
+	for i := range services {
+		services[i] = newCompactTestService(fmt.Sprintf("namespace-%d", i%10), fmt.Sprintf("service-%d", i), "1", 5)
+	}
+
+	newStore := func(b *testing.B, compact bool) *MetricsStore {
+		ms := NewMetricsStoreWithHeaders(compactTestHeaders, compactTestFamilies(b))
+		if compact {
+			ms.EnableCompactStorage()
+		}
+		for _, s := range services {
+			if err := ms.Add(s); err != nil {
+				b.Fatal(err)
+			}
+		}
+		return ms
+	}
+
+	for _, test := range tests {
+		b.Run(test.testName+"/add", func(b *testing.B) {
+			b.ReportAllocs()
+
+			var before, after runtime.MemStats
+			for i := 0; i < b.N; i++ {
+				runtime.GC()
+				runtime.ReadMemStats(&before)
+
+				ms := newStore(b, test.compact)
+
+				runtime.GC()
+				runtime.ReadMemStats(&after)
+				b.ReportMetric(float64(after.HeapAlloc-before.HeapAlloc)/objects, "heap-B/object")
+				runtime.KeepAlive(ms)
+			}
+		})
+
+		b.Run(test.testName+"/write-all", func(b *testing.B) {
+			ms := newStore(b, test.compact)
+			w := strings.Builder{}
+			ms.WriteAll(&w)
+			expectedLength := w.Len()
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				w := strings.Builder{}
+				ms.WriteAll(&w)
+
+				if got := w.Len(); got != expectedLength {
+					b.Fatalf("expected output of length %v but got %v", expectedLength, got)
+				}
+			}
+		})
+	}
+}
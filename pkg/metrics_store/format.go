@@ -0,0 +1,202 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metricsstore
+
+import (
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Format represents an exposition format metrics can be written in.
+type Format int
+
+const (
+	// FormatText is the Prometheus text exposition format in version 0.0.4.
+	FormatText Format = iota
+	// FormatOpenMetrics is the OpenMetrics text exposition format in version
+	// 1.0.0.
+	FormatOpenMetrics
+	// FormatProtobuf is the Prometheus protobuf exposition format, a stream of
+	// varint length-delimited io.prometheus.client.MetricFamily messages.
+	FormatProtobuf
+
+	// formatCount is the number of supported formats. It has to stay the last
+	// constant of this block.
+	formatCount
+)
+
+const openMetricsEOF = "# EOF\n"
+
+// MetricFieldTag is the tag of the length-delimited metric field (number 4) of
+// the io.prometheus.client.MetricFamily protobuf message, which precedes every
+// metric of a family in the protobuf format.
+const MetricFieldTag = 4<<3 | 2
+
+// ContentType returns the value of the HTTP Content-Type header for the
+// format.
+func (f Format) ContentType() string {
+	switch f {
+	case FormatOpenMetrics:
+		return "application/openmetrics-text; version=1.0.0; charset=utf-8"
+	case FormatProtobuf:
+		return "application/vnd.google.protobuf; proto=io.prometheus.client.MetricFamily; encoding=delimited"
+	default:
+		return "text/plain; version=0.0.4"
+	}
+}
+
+// String returns a human readable name of the format.
+func (f Format) String() string {
+	switch f {
+	case FormatOpenMetrics:
+		return "openmetrics"
+	case FormatProtobuf:
+		return "protobuf"
+	default:
+		return "text"
+	}
+}
+
+// textBased returns whether the format is a text format, in which case metric
+// families that can not be rendered in the format specifically fall back to
+// their Prometheus text representation.
+func (f Format) textBased() bool {
+	return f != FormatProtobuf
+}
+
+// WriteTrailer writes what has to follow the metrics of all stores in the
+// given format, e.g. the "# EOF" marker of OpenMetrics.
+func (f Format) WriteTrailer(w io.Writer) {
+	if f == FormatOpenMetrics {
+		w.Write([]byte(openMetricsEOF))
+	}
+}
+
+// FamilyHeader represents the header (HELP, TYPE and, in OpenMetrics, UNIT)
+// of a metric family, which can be rendered in each exposition format. In the
+// protobuf format the header is an io.prometheus.client.MetricFamily message
+// without any metrics. Name returns the name of the family in the Prometheus
+// text format.
+type FamilyHeader interface {
+	Name() string
+	Header(Format) string
+}
+
+// textFamilyHeader is a FamilyHeader given in the Prometheus text format only,
+// see NewMetricsStore. It is written as is in every text based format and
+// omitted in binary formats.
+type textFamilyHeader string
+
+// Name returns the metric name of the first HELP or TYPE line of the header,
+// if any.
+func (h textFamilyHeader) Name() string {
+	fields := strings.Fields(string(h))
+	if len(fields) < 3 || fields[0] != "#" || (fields[1] != "HELP" && fields[1] != "TYPE") {
+		return ""
+	}
+	return fields[2]
+}
+
+// Header implements the FamilyHeader interface.
+func (h textFamilyHeader) Header(f Format) string {
+	if !f.textBased() {
+		return ""
+	}
+	return string(h)
+}
+
+// FormatByteSlicer represents a metric family that can be converted to
+// exposition formats other than the Prometheus text format. The returned bool
+// is false if the representation in the given format does not differ from the
+// one returned by FamilyByteSlicer.ByteSlice. In the protobuf format a family
+// is represented by the encoded metric field of its
+// io.prometheus.client.MetricFamily message.
+type FormatByteSlicer interface {
+	FormatByteSlice(Format) ([]byte, bool)
+}
+
+// renderFamilies renders the given families in the given format. Families
+// whose representation does not differ from their text representation share
+// the text byte slices, if no family differs the text slice itself is returned.
+// Families which can not be rendered in a binary format are left empty.
+func renderFamilies(families []FamilyByteSlicer, text [][]byte, f Format) [][]byte {
+	rendered := text
+	copied := !f.textBased()
+	if copied {
+		rendered = make([][]byte, len(text))
+	}
+
+	for i, family := range families {
+		fs, ok := family.(FormatByteSlicer)
+		if !ok {
+			continue
+		}
+
+		b, ok := fs.FormatByteSlice(f)
+		if !ok {
+			continue
+		}
+
+		if !copied {
+			rendered = make([][]byte, len(text))
+			copy(rendered, text)
+			copied = true
+		}
+		rendered[i] = b
+	}
+
+	return rendered
+}
+
+var labelValueEscaper = strings.NewReplacer("\\", `\\`, "\n", `\n`, "\"", `\"`)
+
+// EscapeLabelValue replaces '\' by '\\', new line character by '\n', and '"'
+// by '\"' in the given label value, as required by the text based exposition
+// formats.
+// Taken from github.com/prometheus/common/expfmt/text_create.go.
+func EscapeLabelValue(v string) string {
+	if !strings.ContainsAny(v, "\\\n\"") {
+		return v
+	}
+	return labelValueEscaper.Replace(v)
+}
+
+// AppendFloat appends the given value as represented in the text based
+// exposition formats to buf and returns the result. It is equivalent to
+// fmt.Fprint with a float64 argument but hardcodes a few common cases for
+// increased efficiency.
+// Taken from github.com/prometheus/common/expfmt/text_create.go.
+func AppendFloat(buf []byte, f float64) []byte {
+	switch {
+	case f == 1:
+		return append(buf, '1')
+	case f == 0:
+		return append(buf, '0')
+	case f == -1:
+		return append(buf, "-1"...)
+	case math.IsNaN(f):
+		return append(buf, "NaN"...)
+	case math.IsInf(f, +1):
+		return append(buf, "+Inf"...)
+	case math.IsInf(f, -1):
+		return append(buf, "-Inf"...)
+	default:
+		return strconv.AppendFloat(buf, f, 'g', -1, 64)
+	}
+}
@@ -0,0 +1,212 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metricsstore
+
+import (
+	"bytes"
+	"math"
+	"sync/atomic"
+)
+
+// MetricLimiter represents a metric family which can be restricted to its
+// first n metrics, which allows the store to drop the series of the family
+// exceeding a series limit individually.
+type MetricLimiter interface {
+	LimitMetrics(n int) FamilyByteSlicer
+}
+
+// FamilyStats contains the cardinality of a metric family of a store.
+type FamilyStats struct {
+	Name string
+	// Series is the number of series of the family.
+	Series int64
+	// Bytes is the size of the metrics of the family kept in memory, in all
+	// exposition formats.
+	Bytes int64
+	// Dropped is the number of series of the family dropped because a series
+	// limit was exceeded.
+	Dropped int64
+}
+
+// familyCounts contains the counters of a metric family, see FamilyStats.
+// They are accessed atomically.
+type familyCounts struct {
+	series  int64
+	bytes   int64
+	dropped int64
+}
+
+// emptyFamily replaces a metric family whose series were all dropped.
+type emptyFamily struct{}
+
+func (emptyFamily) ByteSlice() []byte {
+	return nil
+}
+
+// LimitSeries limits the number of series of the metric families with the
+// given names and of all metric families of the MetricsStore, zero means
+// unlimited. Series exceeding a limit are dropped when an object is added, in
+// the order of the families and their metrics, hence the series of objects
+// added before are kept. Families not implementing MetricLimiter are dropped
+// entirely for an object exceeding a limit. As objects of different shards
+// are added concurrently, a limit can be exceeded by the series of a single
+// object per shard. It has to be called before any object is added to the
+// store.
+func (s *MetricsStore) LimitSeries(familyLimits map[string]int64, seriesLimit int64) {
+	s.lockAll()
+	defer s.unlockAll()
+
+	s.familyLimits = make([]int64, len(s.headers))
+	for i, header := range s.headers {
+		s.familyLimits[i] = familyLimits[header.Name()]
+		s.limited = s.limited || s.familyLimits[i] > 0
+	}
+	s.seriesLimit = seriesLimit
+	s.limited = s.limited || seriesLimit > 0
+}
+
+// FamilyStats returns the cardinality of each metric family of the store, in
+// the order of its headers.
+func (s *MetricsStore) FamilyStats() []FamilyStats {
+	stats := make([]FamilyStats, len(s.headers))
+	for i, header := range s.headers {
+		stats[i] = FamilyStats{
+			Name:    header.Name(),
+			Series:  atomic.LoadInt64(&s.counts[i].series),
+			Bytes:   atomic.LoadInt64(&s.counts[i].bytes),
+			Dropped: atomic.LoadInt64(&s.counts[i].dropped),
+		}
+	}
+	return stats
+}
+
+// limit drops the series of the given new metrics of an object exceeding the
+// series limits, taking into account that they replace the given already
+// accounted metrics of the object, if any. The given families are replaced by
+// the limited ones. The caller has to hold the lock of the shard.
+func (s *MetricsStore) limit(sh *storeShard, e *entry, families []FamilyByteSlicer, counted *entry) {
+	remaining := int64(math.MaxInt64)
+	if s.seriesLimit > 0 {
+		remaining = s.seriesLimit - atomic.LoadInt64(&s.totalSeries)
+		if counted != nil {
+			for i := range s.counts {
+				remaining += int64(counted.series(i))
+			}
+		}
+	}
+
+	for i, f := range families {
+		if i >= len(s.counts) {
+			break
+		}
+		n := int64(e.series(i))
+		if n == 0 {
+			continue
+		}
+
+		allowed := n
+		if remaining < allowed {
+			allowed = remaining
+		}
+		if limit := s.familyLimits[i]; limit > 0 {
+			familyRemaining := limit - atomic.LoadInt64(&s.counts[i].series)
+			if counted != nil {
+				familyRemaining += int64(counted.series(i))
+			}
+			if familyRemaining < allowed {
+				allowed = familyRemaining
+			}
+		}
+
+		if allowed < n {
+			l, ok := f.(MetricLimiter)
+			if ok && allowed > 0 {
+				families[i] = l.LimitMetrics(int(allowed))
+			} else {
+				families[i] = emptyFamily{}
+				allowed = 0
+			}
+			if e.packed != nil && e.packed[i] != nil {
+				sh.symbols.unpack(e.packed[i])
+				e.packed[i] = nil
+			}
+			sh.renderFamily(e, i, families[i])
+			atomic.AddInt64(&s.counts[i].dropped, n-allowed)
+		}
+		remaining -= allowed
+	}
+}
+
+// account adds the series and size of the given metrics of an object,
+// multiplied by sign, to the counters of the store.
+func (s *MetricsStore) account(e *entry, sign int64) {
+	total := int64(0)
+	for i := range s.counts {
+		series := int64(e.series(i))
+		atomic.AddInt64(&s.counts[i].series, sign*series)
+		atomic.AddInt64(&s.counts[i].bytes, sign*int64(e.size(i)))
+		total += series
+	}
+	atomic.AddInt64(&s.totalSeries, sign*total)
+}
+
+// resetCounts resets the series and size counters of the store, e.g. when its
+// content is replaced.
+func (s *MetricsStore) resetCounts() {
+	for i := range s.counts {
+		atomic.StoreInt64(&s.counts[i].series, 0)
+		atomic.StoreInt64(&s.counts[i].bytes, 0)
+	}
+	atomic.StoreInt64(&s.totalSeries, 0)
+}
+
+// series returns the number of series of the metric family with the given
+// index.
+func (e *entry) series(i int) int {
+	if i >= len(e.families[FormatText]) {
+		return 0
+	}
+	if e.packed != nil && e.packed[i] != nil {
+		return e.packed[i].len()
+	}
+	return bytes.Count(e.families[FormatText][i], []byte{'\n'})
+}
+
+// size returns the size of the metric family with the given index in all
+// formats. Formats sharing the rendered family are only counted once.
+func (e *entry) size(i int) int {
+	text := e.families[FormatText]
+	if i >= len(text) {
+		return 0
+	}
+
+	size := len(text[i])
+	if e.packed != nil {
+		size += 4 * len(e.packed[i])
+	}
+	for f := FormatText + 1; f < formatCount; f++ {
+		if families := e.families[f]; families != nil && !sameBytes(families[i], text[i]) {
+			size += len(families[i])
+		}
+	}
+	return size
+}
+
+// sameBytes returns whether the given byte slices share the same memory.
+func sameBytes(a, b []byte) bool {
+	return len(a) == len(b) && (len(a) == 0 || &a[0] == &b[0])
+}
@@ -0,0 +1,187 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metricsstore
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+)
+
+// Mock metricFamily of lines, which can be limited.
+type lineFamily []string
+
+// Implement FamilyByteSlicer interface.
+func (f lineFamily) ByteSlice() []byte {
+	return []byte(strings.Join(f, ""))
+}
+
+// Implement MetricLimiter interface.
+func (f lineFamily) LimitMetrics(n int) FamilyByteSlicer {
+	return f[:n]
+}
+
+// newLimitTestStore returns a store generating a series per label of an
+// object in the first family, which can be limited, and a series per label in
+// the second family, which can not.
+func newLimitTestStore(t *testing.T) *MetricsStore {
+	genFunc := func(obj interface{}) []FamilyByteSlicer {
+		o, err := meta.Accessor(obj)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		count, _ := strconv.Atoi(o.GetLabels()["count"])
+		var labels lineFamily
+		var annotations []byte
+		for i := 0; i < count; i++ {
+			labels = append(labels, fmt.Sprintf("kube_service_labels{service=%q,label=\"%d\"} 1\n", o.GetName(), i))
+			annotations = append(annotations, fmt.Sprintf("kube_service_annotations{service=%q,annotation=\"%d\"} 1\n", o.GetName(), i)...)
+		}
+		return []FamilyByteSlicer{labels, &metricFamily{annotations}}
+	}
+
+	headers := []FamilyHeader{
+		familyHeader{name: "kube_service_labels", text: "# TYPE kube_service_labels gauge"},
+		familyHeader{name: "kube_service_annotations", text: "# TYPE kube_service_annotations gauge"},
+	}
+	return NewMetricsStoreWithHeaders(headers, genFunc)
+}
+
+func newLimitTestService(name, version string, count int) *v1.Service {
+	s := newOrderTestService("default", name, name)
+	s.ResourceVersion = version
+	s.Labels = map[string]string{"count": strconv.Itoa(count)}
+	return s
+}
+
+func TestFamilyStats(t *testing.T) {
+	ms := newLimitTestStore(t)
+	ms.EnableFormat(FormatProtobuf)
+
+	for _, s := range []*v1.Service{newLimitTestService("a", "1", 2), newLimitTestService("b", "1", 1)} {
+		if err := ms.Add(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// No family can be rendered in the protobuf format and the OpenMetrics
+	// format shares the text.
+	labelsSize := 2*len("kube_service_labels{service=\"a\",label=\"0\"} 1\n") + len("kube_service_labels{service=\"b\",label=\"0\"} 1\n")
+	annotationsSize := 2*len("kube_service_annotations{service=\"a\",annotation=\"0\"} 1\n") + len("kube_service_annotations{service=\"b\",annotation=\"0\"} 1\n")
+	want := []FamilyStats{
+		{Name: "kube_service_labels", Series: 3, Bytes: int64(labelsSize)},
+		{Name: "kube_service_annotations", Series: 3, Bytes: int64(annotationsSize)},
+	}
+	if got := ms.FamilyStats(); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected stats:\n%+v\nbut got:\n%+v", want, got)
+	}
+
+	if err := ms.Delete(newLimitTestService("a", "1", 2)); err != nil {
+		t.Fatal(err)
+	}
+	if err := ms.Replace([]interface{}{newLimitTestService("b", "1", 1), newLimitTestService("c", "1", 0)}, ""); err != nil {
+		t.Fatal(err)
+	}
+	want = []FamilyStats{
+		{Name: "kube_service_labels", Series: 1, Bytes: int64(labelsSize / 3)},
+		{Name: "kube_service_annotations", Series: 1, Bytes: int64(annotationsSize / 3)},
+	}
+	if got := ms.FamilyStats(); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected stats:\n%+v\nbut got:\n%+v", want, got)
+	}
+}
+
+func TestLimitSeries(t *testing.T) {
+	tests := []struct {
+		desc         string
+		familyLimits map[string]int64
+		seriesLimit  int64
+		want         string
+		wantStats    []FamilyStats
+	}{
+		{
+			desc:         "family limit",
+			familyLimits: map[string]int64{"kube_service_labels": 3},
+			want: `# TYPE kube_service_labels gauge
+kube_service_labels{service="a",label="0"} 1
+kube_service_labels{service="a",label="1"} 1
+kube_service_labels{service="b",label="0"} 1
+# TYPE kube_service_annotations gauge
+kube_service_annotations{service="a",annotation="0"} 1
+kube_service_annotations{service="a",annotation="1"} 1
+kube_service_annotations{service="b",annotation="0"} 1
+kube_service_annotations{service="b",annotation="1"} 1
+`,
+			wantStats: []FamilyStats{
+				{Name: "kube_service_labels", Series: 3, Dropped: 1},
+				{Name: "kube_service_annotations", Series: 4},
+			},
+		},
+		{
+			desc:        "series limit",
+			seriesLimit: 5,
+			want: `# TYPE kube_service_labels gauge
+kube_service_labels{service="a",label="0"} 1
+kube_service_labels{service="a",label="1"} 1
+kube_service_labels{service="b",label="0"} 1
+# TYPE kube_service_annotations gauge
+kube_service_annotations{service="a",annotation="0"} 1
+kube_service_annotations{service="a",annotation="1"} 1
+`,
+			wantStats: []FamilyStats{
+				{Name: "kube_service_labels", Series: 3, Dropped: 1},
+				{Name: "kube_service_annotations", Series: 2, Dropped: 2},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		ms := newLimitTestStore(t)
+		ms.EnableSortedOutput()
+		ms.LimitSeries(test.familyLimits, test.seriesLimit)
+
+		for _, s := range []*v1.Service{newLimitTestService("a", "1", 2), newLimitTestService("b", "1", 2)} {
+			if err := ms.Add(s); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// Updating an object keeps its own series.
+		if err := ms.Add(newLimitTestService("a", "2", 2)); err != nil {
+			t.Fatal(err)
+		}
+
+		w := strings.Builder{}
+		ms.WriteAll(&w)
+		if got := w.String(); got != test.want {
+			t.Errorf("%s: expected:\n%s\nbut got:\n%s", test.desc, test.want, got)
+		}
+
+		stats := ms.FamilyStats()
+		for i := range stats {
+			stats[i].Bytes = 0
+		}
+		if !reflect.DeepEqual(stats, test.wantStats) {
+			t.Errorf("%s: expected stats:\n%+v\nbut got:\n%+v", test.desc, test.wantStats, stats)
+		}
+	}
+}
@@ -17,10 +17,20 @@ limitations under the License.
 package metricsstore
 
 import (
+	"bytes"
 	"io"
+	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
 
 	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 )
 
@@ -30,34 +40,240 @@ type FamilyByteSlicer interface {
 	ByteSlice() []byte
 }
 
+// Object identifies the Kubernetes object metrics were generated for.
+type Object struct {
+	UID       types.UID
+	Namespace string
+	Name      string
+}
+
+// Key returns the key of the object in the namespace/name format of
+// cache.MetaNamespaceKeyFunc, which is just the name for cluster-scoped
+// objects.
+func (o Object) Key() string {
+	if o.Namespace == "" {
+		return o.Name
+	}
+	return o.Namespace + "/" + o.Name
+}
+
+// ObjectMetrics contains the metric families the store holds for a single
+// object. It is the item type of the List and Get methods.
+type ObjectMetrics struct {
+	Object
+	// Families are the metric families with at least one metric of the
+	// object, in the order of the headers of the store.
+	Families []*dto.MetricFamily
+}
+
+// UpdateResult is the result of adding or updating an object.
+type UpdateResult string
+
+const (
+	// UpdateSkipped means the resource version of the object did not change,
+	// hence its metrics were not regenerated.
+	UpdateSkipped UpdateResult = "skipped"
+	// UpdateUnchanged means the metrics of the object were regenerated but
+	// did not change.
+	UpdateUnchanged UpdateResult = "unchanged"
+	// UpdateRegenerated means the metrics of a new or changed object were
+	// regenerated.
+	UpdateRegenerated UpdateResult = "regenerated"
+)
+
+// entry contains the metrics of an object.
+type entry struct {
+	object Object
+	// families contains a slice of rendered metric families per exposition
+	// format. Formats in which a family is rendered identically share the
+	// same byte slice.
+	families [][][]byte
+	// packed contains the metric families kept in the compact representation,
+	// whose rendered slices are nil. It is nil unless compact storage is
+	// enabled.
+	packed []packedFamily
+	// tombstone is true for the retained metrics of a deleted object.
+	tombstone bool
+	// generated contains the metric families returned by the generate
+	// function of the store. It is nil unless the store keeps them, see
+	// KeepFamilies, and for metrics restored from a snapshot.
+	generated []FamilyByteSlicer
+}
+
+// storeContent is the content of a shard replaced by Replace.
+type storeContent struct {
+	metrics  map[types.UID]*entry
+	versions map[types.UID]string
+}
+
 // MetricsStore implements the k8s.io/client-go/tools/cache.Store
 // interface. Instead of storing entire Kubernetes objects, it stores metrics
 // generated based on those objects.
 type MetricsStore struct {
-	// Protects metrics
-	mutex sync.RWMutex
-	// metrics is a map indexed by Kubernetes object id, containing a slice of
-	// metric families, containing a slice of metrics. We need to keep metrics
-	// grouped by metric families in order to zip families with their help text in
-	// MetricsStore.WriteAll().
-	metrics map[types.UID][][]byte
+	// generation is increased on every change of metrics, allowing users of
+	// the store to detect whether its content changed. It is accessed
+	// atomically, hence the first field to be 64-bit aligned.
+	generation uint64
+	// totalSeries is the number of series of all metric families, accessed
+	// atomically.
+	totalSeries int64
+	// counts contains the counters of each metric family, see FamilyStats.
+	counts []familyCounts
+	// familyLimits contains the series limit of each metric family and
+	// seriesLimit the one of all families, zero means unlimited. limited is
+	// true if any limit is set.
+	familyLimits []int64
+	seriesLimit  int64
+	limited      bool
+	// restored is 1 while the store contains metrics restored from a
+	// snapshot, accessed atomically.
+	restored uint32
+	// snapshotScope describes the objects of the store in its snapshots, see
+	// ScopeSnapshots.
+	snapshotScope string
+	// shards contain the metrics of the objects partitioned by the hash of
+	// their UID, so that adding objects and writing metrics only contend on
+	// the lock of a single shard at a time.
+	shards []*storeShard
+	// keysMutex protects keys, retained and displaced. It is acquired while
+	// holding the lock of a shard, but never the other way around.
+	keysMutex sync.RWMutex
+	// keys indexes the objects by their key, see Object.Key.
+	keys map[string]types.UID
+	// retained indexes the retained metrics of deleted objects by their key.
+	// displaced contains the retained metrics which collide with the ones of
+	// another object with the same key, to be removed once the lock of their
+	// shard is free, see dropDisplaced.
+	retained  map[string]*entry
+	displaced []*entry
 	// headers contains the header (TYPE and HELP) of each metric family. It is
 	// later on zipped with with their corresponding metric families in
 	// MetricStore.WriteAll().
-	headers []string
+	headers []FamilyHeader
+	// formats contains the exposition formats metrics are rendered in besides
+	// the Prometheus text format.
+	formats []Format
+	// watchMutex protects watchers.
+	watchMutex sync.RWMutex
+	// watchers are notified of every change of metrics.
+	watchers map[Watcher]struct{}
+	// sorted enables writing objects sorted by namespace and name, using the
+	// order of each shard.
+	sorted bool
+	// omitEmpty enables skipping the headers of empty metric families.
+	omitEmpty bool
+	// keepFamilies enables keeping the generated metric families of every
+	// object, see KeepFamilies.
+	keepFamilies bool
+	// observeUpdate is called with the result of every added object.
+	observeUpdate func(UpdateResult)
+	// retention is the duration the metrics of deleted objects are retained
+	// for, markDeleted enables adding the label deleted="true" to them.
+	retention   time.Duration
+	markDeleted bool
+	// afterFunc calls f after the given duration in its own goroutine.
+	afterFunc func(d time.Duration, f func())
 
 	// generateMetricsFunc generates metrics based on a given Kubernetes object
 	// and returns them grouped by metric family.
 	generateMetricsFunc func(interface{}) []FamilyByteSlicer
 }
 
-// NewMetricsStore returns a new MetricsStore
+// NewMetricsStore returns a new MetricsStore with the given headers of its
+// metric families in the Prometheus text format, which are written as is in
+// every text based format. Use NewMetricsStoreWithHeaders to write metric
+// families in binary formats or with format specific headers.
 func NewMetricsStore(headers []string, generateFunc func(interface{}) []FamilyByteSlicer) *MetricsStore {
-	return &MetricsStore{
+	familyHeaders := make([]FamilyHeader, len(headers))
+	for i, h := range headers {
+		familyHeaders[i] = textFamilyHeader(h)
+	}
+	return NewMetricsStoreWithHeaders(familyHeaders, generateFunc)
+}
+
+// NewMetricsStoreWithHeaders returns a new MetricsStore with the given headers
+// of its metric families, which can be rendered in every exposition format.
+func NewMetricsStoreWithHeaders(headers []FamilyHeader, generateFunc func(interface{}) []FamilyByteSlicer) *MetricsStore {
+	return newMetricsStore(headers, generateFunc, defaultShardCount)
+}
+
+// newMetricsStore returns a new MetricsStore with the given number of shards.
+func newMetricsStore(headers []FamilyHeader, generateFunc func(interface{}) []FamilyByteSlicer, shards int) *MetricsStore {
+	s := &MetricsStore{
 		generateMetricsFunc: generateFunc,
 		headers:             headers,
-		metrics:             map[types.UID][][]byte{},
+		formats:             []Format{FormatOpenMetrics},
+		shards:              make([]*storeShard, shards),
+		counts:              make([]familyCounts, len(headers)),
+		keys:                map[string]types.UID{},
+		retained:            map[string]*entry{},
+		watchers:            map[Watcher]struct{}{},
+		observeUpdate:       func(UpdateResult) {},
+		afterFunc: func(d time.Duration, f func()) {
+			time.AfterFunc(d, f)
+		},
+	}
+	for i := range s.shards {
+		s.shards[i] = newStoreShard()
+	}
+	return s
+}
+
+// EnableFormat makes the MetricsStore render metrics in the given exposition
+// format in addition to the default ones. It has to be called before any
+// object is added to the store.
+func (s *MetricsStore) EnableFormat(f Format) {
+	s.lockAll()
+	defer s.unlockAll()
+
+	for _, enabled := range s.formats {
+		if enabled == f {
+			return
+		}
 	}
+	s.formats = append(s.formats, f)
+}
+
+// Generation returns the generation of the store, which is increased by every
+// Add, Update, Delete and Replace changing its metrics. As long as the
+// generation does not change, the output of the Write methods does not change
+// either, apart from the order of objects.
+func (s *MetricsStore) Generation() uint64 {
+	return atomic.LoadUint64(&s.generation)
+}
+
+// ScopeSnapshots makes the MetricsStore write the given scope, describing
+// which objects it contains, e.g. their namespaces and selectors, into its
+// snapshots and only restore snapshots of the same scope. It has to be called
+// before any snapshot is written or restored.
+func (s *MetricsStore) ScopeSnapshots(scope string) {
+	s.lockAll()
+	defer s.unlockAll()
+
+	s.snapshotScope = scope
+}
+
+// KeepFamilies makes the MetricsStore keep the metric families returned by its
+// generate function for every object in addition to their rendered form, so
+// that WalkFamilies can pass them on, e.g. to exporters. This increases the
+// memory usage of the store, regardless of compact storage. It has to be
+// called before any object is added to the store.
+func (s *MetricsStore) KeepFamilies() {
+	s.lockAll()
+	defer s.unlockAll()
+
+	s.keepFamilies = true
+}
+
+// ObserveUpdates makes the MetricsStore call f with the result of every added
+// or updated object, e.g. to count skipped regenerations. f is called
+// concurrently for objects of different shards. It has to be called before any
+// object is added to the store.
+func (s *MetricsStore) ObserveUpdates(f func(UpdateResult)) {
+	s.lockAll()
+	defer s.unlockAll()
+
+	s.observeUpdate = f
 }
 
 // Implementing k8s.io/client-go/tools/cache.Store interface
@@ -65,101 +281,782 @@ func NewMetricsStore(headers []string, generateFunc func(interface{}) []FamilyBy
 // Add inserts adds to the MetricsStore by calling the metrics generator functions and
 // adding the generated metrics to the metrics map that underlies the MetricStore.
 func (s *MetricsStore) Add(obj interface{}) error {
+	defer s.dropDisplaced()
+	return s.add(obj, nil)
+}
+
+// add adds the metrics of the given object. Metrics are only regenerated if
+// the resource version of the object changed, and only replaced if they
+// changed. previous is the content of each shard before Replace if called by
+// Replace, in which case the watchers are not notified and the order of the
+// objects is not maintained.
+func (s *MetricsStore) add(obj interface{}, previous []storeContent) error {
 	o, err := meta.Accessor(obj)
 	if err != nil {
 		return err
 	}
 
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
+	object := Object{
+		UID:       o.GetUID(),
+		Namespace: o.GetNamespace(),
+		Name:      o.GetName(),
+	}
+	version := o.GetResourceVersion()
+
+	i := s.shardIndex(object.UID)
+	sh := s.shards[i]
+	sh.mutex.Lock()
+	defer sh.mutex.Unlock()
+
+	current := storeContent{metrics: sh.metrics, versions: sh.versions}
+	if previous != nil {
+		current = previous[i]
+	}
+	old, exists := current.metrics[object.UID]
+	// The retained metrics of a deleted object have to be replaced, even if
+	// the object is added again unchanged, so that they do not expire.
+	live := exists && !old.tombstone
+
+	// Objects are re-delivered unchanged on every relist and resync. The
+	// metric families of restored objects are generated, if they are kept.
+	if live && version != "" && current.versions[object.UID] == version && (old.generated != nil || !s.keepFamilies) {
+		s.observeUpdate(UpdateSkipped)
+		if previous != nil {
+			s.insert(sh, version, old)
+		}
+		return nil
+	}
 
 	families := s.generateMetricsFunc(obj)
-	familyStrings := make([][]byte, len(families))
+	e := sh.newEntry(object, families)
+	if s.keepFamilies {
+		// Families limited below are replaced in the same slice.
+		e.generated = families
+	}
+	if s.limited {
+		var counted *entry
+		if previous == nil && exists {
+			counted = old
+		}
+		s.limit(sh, e, families, counted)
+	}
 
-	for i, f := range families {
-		familyStrings[i] = f.ByteSlice()
+	// Changes of an object often do not affect its metrics, e.g. updates of
+	// its status by controllers.
+	if live && equalEntries(old, e) {
+		s.observeUpdate(UpdateUnchanged)
+		sh.release(e)
+		if s.keepFamilies {
+			old.generated = e.generated
+		}
+		if previous != nil {
+			s.insert(sh, version, old)
+		} else {
+			sh.versions[object.UID] = version
+		}
+		return nil
 	}
+	s.observeUpdate(UpdateRegenerated)
 
-	s.metrics[o.GetUID()] = familyStrings
+	for _, f := range s.formats {
+		e.families[f] = renderFamilies(families, e.families[FormatText], f)
+	}
+
+	if previous == nil {
+		if s.sorted && !exists {
+			sh.insertOrdered(object)
+		}
+		if s.watched() {
+			var oldFamilies [][]byte
+			if exists {
+				oldFamilies = s.text(sh, old)
+			}
+			s.notify(object, oldFamilies, s.text(sh, e))
+		}
+		// The previous content of Replace is released at its end.
+		if exists {
+			sh.release(old)
+		}
+	}
+
+	s.insert(sh, version, e)
+	atomic.AddUint64(&s.generation, 1)
 
 	return nil
 }
 
-// Update updates the existing entry in the MetricsStore.
+// newEntry renders the given metric families of an object in the Prometheus
+// text format, or packs them if compact storage is enabled. The caller has to
+// hold the lock of the shard.
+func (sh *storeShard) newEntry(object Object, families []FamilyByteSlicer) *entry {
+	e := &entry{object: object, families: make([][][]byte, formatCount)}
+	text := make([][]byte, len(families))
+	if sh.symbols != nil {
+		e.packed = make([]packedFamily, len(families))
+	}
+
+	e.families[FormatText] = text
+	for i, f := range families {
+		sh.renderFamily(e, i, f)
+	}
+
+	return e
+}
+
+// renderFamily renders the given metric family with the given index of the
+// given entry in the Prometheus text format, or packs it if compact storage is
+// enabled. The caller has to hold the lock of the shard.
+func (sh *storeShard) renderFamily(e *entry, i int, f FamilyByteSlicer) {
+	if l, ok := f.(MetricLister); ok && sh.symbols != nil {
+		e.packed[i] = sh.symbols.pack(l)
+		e.families[FormatText][i] = nil
+		return
+	}
+	e.families[FormatText][i] = f.ByteSlice()
+}
+
+// insert stores the given metrics of an object in the given shard and indexes
+// them. The caller has to hold the lock of the shard.
+func (s *MetricsStore) insert(sh *storeShard, version string, e *entry) {
+	s.index(sh, e)
+	sh.versions[e.object.UID] = version
+
+	key := e.object.Key()
+	s.keysMutex.Lock()
+	s.keys[key] = e.object.UID
+	// The retained metrics of a deleted object with the same key collide with
+	// the ones of the recreated object unless they are marked.
+	if t, ok := s.retained[key]; ok && (t.object.UID == e.object.UID || !s.markDeleted) {
+		if t.object.UID != e.object.UID {
+			s.displaced = append(s.displaced, t)
+		}
+		delete(s.retained, key)
+	}
+	s.keysMutex.Unlock()
+}
+
+// index stores the given metrics of an object in the given shard, indexed by
+// its UID and namespace, and accounts for them. The caller has to hold the
+// lock of the shard.
+func (s *MetricsStore) index(sh *storeShard, e *entry) {
+	object := e.object
+	if previous, ok := sh.metrics[object.UID]; ok {
+		s.account(previous, -1)
+	}
+	s.account(e, 1)
+	sh.metrics[object.UID] = e
+
+	namespaced, ok := sh.namespaces[object.Namespace]
+	if !ok {
+		namespaced = map[types.UID]*entry{}
+		sh.namespaces[object.Namespace] = namespaced
+	}
+	namespaced[object.UID] = e
+}
+
+// equalEntries returns whether the given metrics of an object are equal.
+func equalEntries(a, b *entry) bool {
+	if !equalFamilies(a.families[FormatText], b.families[FormatText]) {
+		return false
+	}
+	if len(a.packed) != len(b.packed) {
+		return false
+	}
+	for i := range a.packed {
+		if !a.packed[i].equal(b.packed[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// equalFamilies returns whether the given rendered metric families are equal.
+func equalFamilies(a, b [][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !bytes.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Update updates the existing entry in the MetricsStore. Like Add, it only
+// regenerates the metrics if the resource version of the object changed.
 func (s *MetricsStore) Update(obj interface{}) error {
-	// TODO: For now, just call Add, in the future one could check if the resource version changed?
 	return s.Add(obj)
 }
 
-// Delete deletes an existing entry in the MetricsStore.
+// Delete deletes an existing entry in the MetricsStore. If deleted objects are
+// retained, its metrics are only removed once the retention expired.
 func (s *MetricsStore) Delete(obj interface{}) error {
+	defer s.dropDisplaced()
 
 	o, err := meta.Accessor(obj)
 	if err != nil {
 		return err
 	}
 
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
+	object := Object{UID: o.GetUID(), Namespace: o.GetNamespace(), Name: o.GetName()}
+	sh := s.shards[s.shardIndex(object.UID)]
+	sh.mutex.Lock()
+	defer sh.mutex.Unlock()
+
+	e, ok := sh.metrics[object.UID]
+	if ok && e.tombstone {
+		return nil
+	}
+
+	if ok && s.retention > 0 {
+		var before [][]byte
+		if s.watched() {
+			before = s.text(sh, e)
+		}
+		t := s.tombstone(sh, e)
+		if before != nil {
+			s.notify(object, before, s.text(sh, t))
+		}
+		return nil
+	}
 
-	delete(s.metrics, o.GetUID())
+	if ok && s.watched() {
+		s.notify(e.object, s.text(sh, e), nil)
+	}
+	s.remove(sh, object)
 
 	return nil
 }
 
-// List implements the List method of the store interface.
+// remove removes the metrics of the given object from the given shard. The
+// caller has to hold the lock of the shard.
+func (s *MetricsStore) remove(sh *storeShard, o Object) {
+	if e, ok := sh.metrics[o.UID]; ok {
+		if s.sorted {
+			sh.removeOrdered(e.object)
+		}
+		s.account(e, -1)
+		sh.release(e)
+	}
+	delete(sh.metrics, o.UID)
+	delete(sh.versions, o.UID)
+	// A recreated object with the same key might have been added before the
+	// previous one is deleted.
+	key := o.Key()
+	s.keysMutex.Lock()
+	if s.keys[key] == o.UID {
+		delete(s.keys, key)
+	}
+	if t, ok := s.retained[key]; ok && t.object.UID == o.UID {
+		delete(s.retained, key)
+	}
+	s.keysMutex.Unlock()
+
+	if namespaced, ok := sh.namespaces[o.Namespace]; ok {
+		delete(namespaced, o.UID)
+		if len(namespaced) == 0 {
+			delete(sh.namespaces, o.Namespace)
+		}
+	}
+	atomic.AddUint64(&s.generation, 1)
+}
+
+// List implements the List method of the store interface. It returns an
+// *ObjectMetrics per object, sorted by namespace and name.
 func (s *MetricsStore) List() []interface{} {
-	return nil
+	objects := s.list(func(sh *storeShard) map[types.UID]*entry {
+		return sh.metrics
+	})
+
+	items := make([]interface{}, len(objects))
+	for i, o := range objects {
+		items[i] = o
+	}
+	return items
+}
+
+// ListNamespace returns the metrics of the objects in the given namespace,
+// sorted by name. Cluster-scoped objects are listed for the empty namespace.
+func (s *MetricsStore) ListNamespace(namespace string) []*ObjectMetrics {
+	return s.list(func(sh *storeShard) map[types.UID]*entry {
+		return sh.namespaces[namespace]
+	})
 }
 
 // ListKeys implements the ListKeys method of the store interface.
 func (s *MetricsStore) ListKeys() []string {
-	return nil
+	s.keysMutex.RLock()
+	defer s.keysMutex.RUnlock()
+
+	keys := make([]string, 0, len(s.keys))
+	for key := range s.keys {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
 }
 
-// Get implements the Get method of the store interface.
+// Get implements the Get method of the store interface. The item is the
+// *ObjectMetrics of the object with the UID of the given object.
 func (s *MetricsStore) Get(obj interface{}) (item interface{}, exists bool, err error) {
-	return nil, false, nil
+	o, err := meta.Accessor(obj)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return s.get(o.GetUID())
 }
 
-// GetByKey implements the GetByKey method of the store interface.
+// GetByKey implements the GetByKey method of the store interface. The item is
+// the *ObjectMetrics of the object with the given namespace/name key.
 func (s *MetricsStore) GetByKey(key string) (item interface{}, exists bool, err error) {
-	return nil, false, nil
+	s.keysMutex.RLock()
+	uid, ok := s.keys[key]
+	s.keysMutex.RUnlock()
+	if !ok {
+		return nil, false, nil
+	}
+	return s.get(uid)
+}
+
+// get returns the *ObjectMetrics of the object with the given UID.
+func (s *MetricsStore) get(uid types.UID) (interface{}, bool, error) {
+	sh := s.shards[s.shardIndex(uid)]
+	sh.mutex.RLock()
+	e, ok := sh.metrics[uid]
+	var text [][]byte
+	if ok {
+		text = s.text(sh, e)
+	}
+	sh.mutex.RUnlock()
+	if !ok {
+		return nil, false, nil
+	}
+
+	o, err := s.objectMetrics(e.object, text)
+	if err != nil {
+		return nil, false, err
+	}
+	return o, true, nil
+}
+
+// list returns the metrics of the objects of the metrics map selected from
+// each shard, sorted by namespace and name. Objects whose metrics can not be
+// parsed are skipped, which can only happen if a generator renders invalid
+// metrics.
+func (s *MetricsStore) list(selectMetrics func(sh *storeShard) map[types.UID]*entry) []*ObjectMetrics {
+	type objectFamilies struct {
+		object   Object
+		families [][]byte
+	}
+
+	// The metrics are parsed after releasing the locks.
+	var snapshot []objectFamilies
+	for _, sh := range s.shards {
+		sh.mutex.RLock()
+		for _, e := range selectMetrics(sh) {
+			snapshot = append(snapshot, objectFamilies{object: e.object, families: s.text(sh, e)})
+		}
+		sh.mutex.RUnlock()
+	}
+
+	objects := make([]*ObjectMetrics, 0, len(snapshot))
+	for _, o := range snapshot {
+		parsed, err := s.objectMetrics(o.object, o.families)
+		if err != nil {
+			continue
+		}
+		objects = append(objects, parsed)
+	}
+
+	sort.Slice(objects, func(i, j int) bool {
+		if objects[i].Namespace != objects[j].Namespace {
+			return objects[i].Namespace < objects[j].Namespace
+		}
+		return objects[i].Name < objects[j].Name
+	})
+	return objects
+}
+
+// objectMetrics parses the given rendered metric families of the given object.
+func (s *MetricsStore) objectMetrics(o Object, families [][]byte) (*ObjectMetrics, error) {
+	var parser expfmt.TextParser
+	parsed, err := parser.TextToMetricFamilies(bytes.NewReader(s.objectText(nil, families)))
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse metrics of object %s", o.Key())
+	}
+
+	result := &ObjectMetrics{Object: o}
+	for _, header := range s.headers {
+		if family, ok := parsed[header.Name()]; ok {
+			result.Families = append(result.Families, family)
+		}
+	}
+	return result, nil
 }
 
 // Replace will delete the contents of the store, using instead the
-// given list.
+// given list. Watchers are not notified of the individual changes but
+// resynced afterwards.
 func (s *MetricsStore) Replace(list []interface{}, _ string) error {
-	s.mutex.Lock()
-	s.metrics = map[types.UID][][]byte{}
-	s.mutex.Unlock()
+	return s.ReplaceNamespace(list, metav1.NamespaceAll)
+}
+
+// ReplaceNamespace replaces the objects of the given namespace and the
+// cluster-scoped objects by the given list like Replace, keeping the objects
+// of other namespaces. This allows a reflector per namespace to share a store.
+// All objects are replaced for metav1.NamespaceAll.
+func (s *MetricsStore) ReplaceNamespace(list []interface{}, namespace string) error {
+	defer s.dropDisplaced()
+
+	s.lockAll()
+	// The metrics of objects which did not change are taken over.
+	previous := make([]storeContent, len(s.shards))
+	if namespace == metav1.NamespaceAll {
+		for i, sh := range s.shards {
+			previous[i] = storeContent{metrics: sh.metrics, versions: sh.versions}
+			sh.metrics = map[types.UID]*entry{}
+			sh.versions = map[types.UID]string{}
+			sh.namespaces = map[string]map[types.UID]*entry{}
+			if s.sorted {
+				sh.order = []Object{}
+			}
+		}
+		s.keysMutex.Lock()
+		s.keys = map[string]types.UID{}
+		s.retained = map[string]*entry{}
+		s.keysMutex.Unlock()
+		s.resetCounts()
+	} else {
+		for i, sh := range s.shards {
+			previous[i] = s.takeNamespace(sh, namespace)
+		}
+	}
+	atomic.AddUint64(&s.generation, 1)
+	s.unlockAll()
 
 	for _, o := range list {
-		err := s.Add(o)
+		err := s.add(o, previous)
 		if err != nil {
 			return err
 		}
 	}
 
+	s.lockAll()
+	defer s.unlockAll()
+	for i, sh := range s.shards {
+		for uid, e := range previous[i].metrics {
+			if sh.metrics[uid] == e {
+				continue
+			}
+
+			// Objects which vanished, e.g. because they were deleted while
+			// not being watched, are retained like deleted objects, as are
+			// the objects retained already.
+			_, exists := sh.metrics[uid]
+			switch {
+			case exists || (!e.tombstone && s.retention == 0):
+				sh.release(e)
+			case e.tombstone:
+				s.indexTombstone(sh, e)
+			default:
+				s.tombstone(sh, e)
+			}
+		}
+		if s.sorted {
+			sh.rebuildOrder()
+		}
+	}
+	// Objects taken over do not increase the generation when they are added
+	// again, hence metrics written while the store was being refilled would
+	// otherwise be considered current.
+	atomic.AddUint64(&s.generation, 1)
+	// The restored metrics of other namespaces are only replaced by the
+	// reflectors of these namespaces, see ClearRestored.
+	if namespace == metav1.NamespaceAll {
+		atomic.StoreUint32(&s.restored, 0)
+	}
+
+	s.watchMutex.RLock()
+	defer s.watchMutex.RUnlock()
+	for w := range s.watchers {
+		w.Resynced()
+	}
+
 	return nil
 }
 
+// takeNamespace removes the metrics of the objects of the given namespace and
+// of the cluster-scoped objects from the given shard and returns them. The
+// caller has to hold the lock of the shard.
+func (s *MetricsStore) takeNamespace(sh *storeShard, namespace string) storeContent {
+	taken := storeContent{metrics: map[types.UID]*entry{}, versions: map[types.UID]string{}}
+	for _, ns := range []string{namespace, metav1.NamespaceNone} {
+		for uid, e := range sh.namespaces[ns] {
+			taken.metrics[uid] = e
+			if version, ok := sh.versions[uid]; ok {
+				taken.versions[uid] = version
+			}
+
+			s.account(e, -1)
+			delete(sh.metrics, uid)
+			delete(sh.versions, uid)
+			s.keysMutex.Lock()
+			if s.keys[e.object.Key()] == uid {
+				delete(s.keys, e.object.Key())
+			}
+			if s.retained[e.object.Key()] == e {
+				delete(s.retained, e.object.Key())
+			}
+			s.keysMutex.Unlock()
+		}
+		delete(sh.namespaces, ns)
+	}
+	if s.sorted {
+		sh.rebuildOrder()
+	}
+	return taken
+}
+
 // Resync implements the Resync method of the store interface.
 func (s *MetricsStore) Resync() error {
 	return nil
 }
 
 // WriteAll writes all metrics of the store into the given writer, zipped with the
-// help text of each metric family.
+// help text of each metric family, in the Prometheus text format.
 func (s *MetricsStore) WriteAll(w io.Writer) {
-	s.mutex.RLock()
-	defer s.mutex.RUnlock()
+	s.WriteAllFormat(w, FormatText)
+}
+
+// WriteAllFormat writes all metrics of the store into the given writer, zipped
+// with the help text of each metric family, in the given exposition format.
+// Text based formats the store does not render metrics in fall back to the
+// Prometheus text format, for other formats nothing is written.
+func (s *MetricsStore) WriteAllFormat(w io.Writer, f Format) {
+	s.WriteFamilies(w, f, nil)
+}
+
+// WriteFamilies writes the metrics of the store into the given writer like
+// WriteAllFormat, restricted to the metric families whose name is accepted by
+// include. If include is nil, all metric families are written.
+func (s *MetricsStore) WriteFamilies(w io.Writer, f Format, include func(name string) bool) {
+	s.write(w, f, include, allNamespaces)
+}
+
+// WriteNamespaceFamilies writes the metrics of the objects in the given
+// namespace into the given writer like WriteFamilies. In contrast to
+// WriteFamilies, nothing, not even the headers, is written if the store does
+// not contain any object in the namespace.
+func (s *MetricsStore) WriteNamespaceFamilies(w io.Writer, f Format, namespace string, include func(name string) bool) {
+	if !s.hasNamespace(namespace) {
+		return
+	}
+
+	s.write(w, f, include, inNamespace(namespace))
+}
+
+// hasNamespace returns whether the store contains any object in the given
+// namespace.
+func (s *MetricsStore) hasNamespace(namespace string) bool {
+	for _, sh := range s.shards {
+		sh.mutex.RLock()
+		_, ok := sh.namespaces[namespace]
+		sh.mutex.RUnlock()
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// write writes the metrics of the objects of the store selected by the given
+// selector in the given format, restricted to the metric families accepted by
+// include. Unless the output is sorted, in which case all shards are locked
+// at once to merge their order, the shards are only locked while writing a
+// single metric family.
+func (s *MetricsStore) write(w io.Writer, f Format, include func(name string) bool, sel objectSelector) {
+	if s.sorted {
+		s.rLockAll()
+		defer s.rUnlockAll()
+
+		objects := s.sortedObjects(sel)
+		for i, header := range s.headers {
+			if include != nil && !include(header.Name()) {
+				continue
+			}
+			s.writeFamily(w, f, i, header, objects)
+		}
+		return
+	}
+
+	for i, header := range s.headers {
+		if include != nil && !include(header.Name()) {
+			continue
+		}
+
+		// The length of a family in the protobuf format has to be known
+		// before writing it.
+		if f == FormatProtobuf {
+			s.rLockAll()
+			writeDelimitedFamily(w, header.Header(f), i, s.shardedObjects(sel))
+			s.rUnlockAll()
+			continue
+		}
+
+		fw := familyWriter{w: w, header: header.Header(f)}
+		if !s.omitEmpty {
+			fw.writeHeader()
+		}
+		for _, sh := range s.shards {
+			sh.mutex.RLock()
+			sh.objects(sel)(func(sh *storeShard, e *entry) bool {
+				fw.write(sh.familyInFormat(e, f, i, header.Name(), &fw.buf))
+				return true
+			})
+			sh.mutex.RUnlock()
+		}
+	}
+}
+
+// writeFamily writes the metric family with the given index of the given
+// objects in the given format. The caller has to hold the read lock of all
+// shards of the objects.
+func (s *MetricsStore) writeFamily(w io.Writer, f Format, i int, header FamilyHeader, objects objectIterator) {
+	if f == FormatProtobuf {
+		writeDelimitedFamily(w, header.Header(f), i, objects)
+		return
+	}
+
+	fw := familyWriter{w: w, header: header.Header(f)}
+	if !s.omitEmpty {
+		fw.writeHeader()
+	}
+	objects(func(sh *storeShard, e *entry) bool {
+		fw.write(sh.familyInFormat(e, f, i, header.Name(), &fw.buf))
+		return true
+	})
+}
+
+// familyWriter writes a metric family in a text based format. Its header is
+// written before its first metrics, hence not at all for families without any
+// metrics, unless written explicitly.
+type familyWriter struct {
+	w             io.Writer
+	header        string
+	headerWritten bool
+	// buf is reused to render packed metric families.
+	buf []byte
+}
+
+func (fw *familyWriter) writeHeader() {
+	if fw.headerWritten {
+		return
+	}
+	fw.w.Write([]byte(fw.header))
+	fw.w.Write([]byte{'\n'})
+	fw.headerWritten = true
+}
+
+func (fw *familyWriter) write(family []byte) {
+	if len(family) == 0 {
+		return
+	}
+	fw.writeHeader()
+	fw.w.Write(family)
+}
+
+// familyInFormat returns the metric family with the given index and name of
+// the given entry in the given text based format, rendering it into buf if it
+// is packed. The caller has to hold the read lock of the shard.
+func (sh *storeShard) familyInFormat(e *entry, f Format, i int, name string, buf *[]byte) []byte {
+	family := familiesInFormat(e.families, f)[i]
+	if family == nil && e.packed != nil && e.packed[i] != nil {
+		*buf = sh.symbols.render((*buf)[:0], name, e.packed[i])
+		family = *buf
+	}
+	return family
+}
+
+// WalkFamilies calls f for each object in the store with its metric families
+// as returned by the generate function of the store, in the order of its
+// headers, see KeepFamilies. The retained metrics of deleted objects and
+// metrics restored from a snapshot are skipped. The store is not locked while
+// f is called, the families must not be modified.
+func (s *MetricsStore) WalkFamilies(f func(o Object, families []FamilyByteSlicer)) {
+	type objectFamilies struct {
+		object   Object
+		families []FamilyByteSlicer
+	}
+
+	for _, sh := range s.shards {
+		sh.mutex.RLock()
+		snapshot := make([]objectFamilies, 0, len(sh.metrics))
+		for _, e := range sh.metrics {
+			if e.tombstone || e.generated == nil {
+				continue
+			}
+			snapshot = append(snapshot, objectFamilies{object: e.object, families: e.generated})
+		}
+		sh.mutex.RUnlock()
 
-	for i, help := range s.headers {
-		w.Write([]byte(help))
-		w.Write([]byte{'\n'})
-		for _, metricFamilies := range s.metrics {
-			w.Write(metricFamilies[i])
+		for _, o := range snapshot {
+			f(o.object, o.families)
 		}
 	}
 }
+
+// objectText appends the given metric families of an object in the Prometheus
+// text format, each preceded by its header, to buf and returns the result.
+// Metric families without any metrics are skipped.
+func (s *MetricsStore) objectText(buf []byte, families [][]byte) []byte {
+	for i, family := range families {
+		if len(family) == 0 {
+			continue
+		}
+		buf = append(buf, s.headers[i].Header(FormatText)...)
+		buf = append(buf, '\n')
+		buf = append(buf, family...)
+	}
+	return buf
+}
+
+// writeDelimitedFamily writes the metric family with the given index as a
+// length-delimited io.prometheus.client.MetricFamily message, i.e. the varint
+// encoded length of the message, followed by the header of the family and the
+// encoded metrics of the given objects. Families without any metrics are
+// skipped.
+func writeDelimitedFamily(w io.Writer, header string, i int, objects objectIterator) {
+	length := 0
+	objects(func(_ *storeShard, e *entry) bool {
+		if families := e.families[FormatProtobuf]; families != nil {
+			length += len(families[i])
+		}
+		return true
+	})
+	if length == 0 {
+		return
+	}
+	length += len(header)
+
+	w.Write(proto.EncodeVarint(uint64(length)))
+	w.Write([]byte(header))
+	objects(func(_ *storeShard, e *entry) bool {
+		if families := e.families[FormatProtobuf]; families != nil {
+			w.Write(families[i])
+		}
+		return true
+	})
+}
+
+// familiesInFormat returns the rendered metric families of an object in the
+// given text based format, falling back to the Prometheus text format if the
+// store does not render metrics in that format.
+func familiesInFormat(formatFamilies [][][]byte, f Format) [][]byte {
+	if families := formatFamilies[f]; families != nil {
+		return families
+	}
+
+	return formatFamilies[FormatText]
+}
@@ -17,9 +17,12 @@ limitations under the License.
 package metricsstore
 
 import (
+	"bytes"
 	"fmt"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/meta"
@@ -38,6 +41,40 @@ func (f *metricFamily) ByteSlice() []byte {
 	return f.value
 }
 
+// Mock metricFamily whose OpenMetrics representation differs from its text
+// representation.
+type openMetricsFamily struct {
+	metricFamily
+	openMetricsValue []byte
+}
+
+// Implement FormatByteSlicer interface.
+func (f *openMetricsFamily) FormatByteSlice(format Format) ([]byte, bool) {
+	if format != FormatOpenMetrics {
+		return nil, false
+	}
+	return f.openMetricsValue, true
+}
+
+// Mock header rendering the same string in every format but OpenMetrics.
+type familyHeader struct {
+	name        string
+	text        string
+	openMetrics string
+}
+
+// Implement FamilyHeader interface.
+func (h familyHeader) Name() string {
+	return h.name
+}
+
+func (h familyHeader) Header(f Format) string {
+	if f == FormatOpenMetrics {
+		return h.openMetrics
+	}
+	return h.text
+}
+
 func TestObjectsSameNameDifferentNamespaces(t *testing.T) {
 	serviceIDS := []string{"a", "b"}
 
@@ -81,3 +118,516 @@ func TestObjectsSameNameDifferentNamespaces(t *testing.T) {
 		}
 	}
 }
+
+func TestWriteAllFormat(t *testing.T) {
+	genFunc := func(obj interface{}) []FamilyByteSlicer {
+		return []FamilyByteSlicer{
+			&metricFamily{[]byte("kube_service_info 1\n")},
+			&openMetricsFamily{
+				metricFamily:     metricFamily{[]byte("kube_service_restarts_total 1\n")},
+				openMetricsValue: []byte("kube_service_restarts_total 1\nkube_service_restarts_created 1.5e+09\n"),
+			},
+		}
+	}
+
+	headers := []FamilyHeader{
+		familyHeader{
+			name:        "kube_service_info",
+			text:        "# TYPE kube_service_info gauge",
+			openMetrics: "# TYPE kube_service_info gauge",
+		},
+		familyHeader{
+			name:        "kube_service_restarts_total",
+			text:        "# TYPE kube_service_restarts_total counter",
+			openMetrics: "# TYPE kube_service_restarts counter",
+		},
+	}
+	ms := NewMetricsStoreWithHeaders(headers, genFunc)
+
+	s := v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "service",
+			Namespace: "default",
+			UID:       types.UID("a"),
+		},
+	}
+	if err := ms.Add(&s); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		format Format
+		want   string
+	}{
+		{
+			format: FormatText,
+			want: `# TYPE kube_service_info gauge
+kube_service_info 1
+# TYPE kube_service_restarts_total counter
+kube_service_restarts_total 1
+`,
+		},
+		{
+			format: FormatOpenMetrics,
+			want: `# TYPE kube_service_info gauge
+kube_service_info 1
+# TYPE kube_service_restarts counter
+kube_service_restarts_total 1
+kube_service_restarts_created 1.5e+09
+`,
+		},
+	}
+
+	for _, test := range tests {
+		w := strings.Builder{}
+		ms.WriteAllFormat(&w, test.format)
+
+		if got := w.String(); got != test.want {
+			t.Errorf("format %v: expected:\n%v\nbut got:\n%v", test.format, test.want, got)
+		}
+	}
+}
+
+func TestWriteFamilies(t *testing.T) {
+	genFunc := func(obj interface{}) []FamilyByteSlicer {
+		return []FamilyByteSlicer{
+			&metricFamily{[]byte("kube_service_info 1\n")},
+			&metricFamily{[]byte("kube_service_created 1.5e+09\n")},
+		}
+	}
+
+	headers := []FamilyHeader{
+		familyHeader{name: "kube_service_info", text: "# TYPE kube_service_info gauge"},
+		familyHeader{name: "kube_service_created", text: "# TYPE kube_service_created gauge"},
+	}
+	ms := NewMetricsStoreWithHeaders(headers, genFunc)
+
+	s := v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "service",
+			Namespace: "default",
+			UID:       types.UID("a"),
+		},
+	}
+	if err := ms.Add(&s); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		include func(string) bool
+		want    string
+	}{
+		{
+			include: nil,
+			want: `# TYPE kube_service_info gauge
+kube_service_info 1
+# TYPE kube_service_created gauge
+kube_service_created 1.5e+09
+`,
+		},
+		{
+			include: func(name string) bool { return name == "kube_service_created" },
+			want: `# TYPE kube_service_created gauge
+kube_service_created 1.5e+09
+`,
+		},
+		{
+			include: func(string) bool { return false },
+			want:    "",
+		},
+	}
+
+	for i, test := range tests {
+		w := strings.Builder{}
+		ms.WriteFamilies(&w, FormatText, test.include)
+
+		if got := w.String(); got != test.want {
+			t.Errorf("test %d: expected:\n%v\nbut got:\n%v", i, test.want, got)
+		}
+	}
+}
+
+func TestWriteNamespaceFamilies(t *testing.T) {
+	genFunc := func(obj interface{}) []FamilyByteSlicer {
+		o, err := meta.Accessor(obj)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return []FamilyByteSlicer{
+			&metricFamily{[]byte(fmt.Sprintf("kube_service_info{namespace=\"%v\",uid=\"%v\"} 1\n", o.GetNamespace(), o.GetUID()))},
+		}
+	}
+
+	headers := []FamilyHeader{
+		familyHeader{name: "kube_service_info", text: "# TYPE kube_service_info gauge"},
+	}
+	ms := NewMetricsStoreWithHeaders(headers, genFunc)
+
+	services := []*v1.Service{
+		{ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: "default", UID: types.UID("a")}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "b", Namespace: "kube-system", UID: types.UID("b")}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "c", Namespace: "monitoring", UID: types.UID("c")}},
+	}
+	for _, s := range services {
+		if err := ms.Add(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ms.Delete(services[2]); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		namespace string
+		want      string
+	}{
+		{
+			namespace: "default",
+			want: `# TYPE kube_service_info gauge
+kube_service_info{namespace="default",uid="a"} 1
+`,
+		},
+		{
+			namespace: "kube-system",
+			want: `# TYPE kube_service_info gauge
+kube_service_info{namespace="kube-system",uid="b"} 1
+`,
+		},
+		{
+			namespace: "monitoring",
+			want:      "",
+		},
+		{
+			namespace: "",
+			want:      "",
+		},
+	}
+
+	for _, test := range tests {
+		w := strings.Builder{}
+		ms.WriteNamespaceFamilies(&w, FormatText, test.namespace, nil)
+
+		if got := w.String(); got != test.want {
+			t.Errorf("namespace %q: expected:\n%v\nbut got:\n%v", test.namespace, test.want, got)
+		}
+	}
+
+	if err := ms.Replace([]interface{}{services[2]}, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	w := strings.Builder{}
+	ms.WriteNamespaceFamilies(&w, FormatText, "default", nil)
+	if got := w.String(); got != "" {
+		t.Errorf("expected no metrics in namespace default after replace, got:\n%v", got)
+	}
+}
+
+func TestGeneration(t *testing.T) {
+	genFunc := func(obj interface{}) []FamilyByteSlicer {
+		value := obj.(*v1.Service).Labels["value"]
+		return []FamilyByteSlicer{&metricFamily{[]byte("kube_service_info " + value + "\n")}}
+	}
+	ms := NewMetricsStoreWithHeaders([]FamilyHeader{familyHeader{name: "kube_service_info"}}, genFunc)
+	s := &v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: "default", UID: types.UID("a"), Labels: map[string]string{"value": "1"}}}
+	updated := s.DeepCopy()
+	updated.Labels["value"] = "2"
+
+	steps := []struct {
+		name   string
+		change func() error
+	}{
+		{"add", func() error { return ms.Add(s) }},
+		{"update", func() error { return ms.Update(updated) }},
+		{"delete", func() error { return ms.Delete(updated) }},
+		{"replace", func() error { return ms.Replace([]interface{}{s}, "") }},
+	}
+
+	generation := ms.Generation()
+	for _, step := range steps {
+		if err := step.change(); err != nil {
+			t.Fatal(err)
+		}
+
+		g := ms.Generation()
+		if g <= generation {
+			t.Errorf("%v: expected generation to increase from %v, got %v", step.name, generation, g)
+		}
+		generation = g
+
+		if ms.Generation() != generation {
+			t.Errorf("%v: expected generation not to change without a change of the store", step.name)
+		}
+	}
+
+	// Updates not changing the metrics do not change the store.
+	if err := ms.Update(s.DeepCopy()); err != nil {
+		t.Fatal(err)
+	}
+	if ms.Generation() != generation {
+		t.Errorf("expected generation not to change by an update without changes")
+	}
+}
+
+func TestUpdateSkipping(t *testing.T) {
+	generated := 0
+	genFunc := func(obj interface{}) []FamilyByteSlicer {
+		generated++
+		value := obj.(*v1.Service).Labels["value"]
+		return []FamilyByteSlicer{&metricFamily{[]byte("kube_service_info " + value + "\n")}}
+	}
+	ms := NewMetricsStoreWithHeaders([]FamilyHeader{familyHeader{name: "kube_service_info"}}, genFunc)
+
+	results := map[UpdateResult]int{}
+	ms.ObserveUpdates(func(r UpdateResult) { results[r]++ })
+
+	service := func(version, value string) *v1.Service {
+		return &v1.Service{ObjectMeta: metav1.ObjectMeta{
+			Name:            "a",
+			Namespace:       "default",
+			UID:             types.UID("a"),
+			ResourceVersion: version,
+			Labels:          map[string]string{"value": value},
+		}}
+	}
+
+	steps := []struct {
+		name      string
+		change    func() error
+		result    UpdateResult
+		generated int
+		want      string
+	}{
+		{"add", func() error { return ms.Add(service("1", "1")) }, UpdateRegenerated, 1, "1"},
+		{"same version", func() error { return ms.Update(service("1", "1")) }, UpdateSkipped, 1, "1"},
+		{"same metrics", func() error { return ms.Update(service("2", "1")) }, UpdateUnchanged, 2, "1"},
+		{"relist", func() error { return ms.Replace([]interface{}{service("2", "1")}, "") }, UpdateSkipped, 2, "1"},
+		{"changed", func() error { return ms.Update(service("3", "2")) }, UpdateRegenerated, 3, "2"},
+		{"relist changed", func() error { return ms.Replace([]interface{}{service("4", "3")}, "") }, UpdateRegenerated, 4, "3"},
+		{"no version", func() error { return ms.Update(service("", "3")) }, UpdateUnchanged, 5, "3"},
+	}
+
+	for _, step := range steps {
+		before := results[step.result]
+		if err := step.change(); err != nil {
+			t.Fatal(err)
+		}
+
+		if results[step.result] != before+1 {
+			t.Errorf("%v: expected result %v, got %v", step.name, step.result, results)
+		}
+		if generated != step.generated {
+			t.Errorf("%v: expected metrics to be generated %d times, got %d", step.name, step.generated, generated)
+		}
+
+		w := strings.Builder{}
+		ms.WriteAll(&w)
+		if want := "\nkube_service_info " + step.want + "\n"; w.String() != want {
+			t.Errorf("%v: expected %q, got %q", step.name, want, w.String())
+		}
+	}
+}
+
+func TestWalkFamilies(t *testing.T) {
+	genFunc := func(obj interface{}) []FamilyByteSlicer {
+		o, err := meta.Accessor(obj)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return []FamilyByteSlicer{
+			&metricFamily{[]byte(fmt.Sprintf("kube_service_info{service=\"%v\"} 1\n", o.GetName()))},
+		}
+	}
+	headers := []FamilyHeader{
+		familyHeader{name: "kube_service_info", text: "# TYPE kube_service_info gauge"},
+	}
+	newService := func(name string) *v1.Service {
+		return &v1.Service{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", UID: types.UID(name), ResourceVersion: "1"}}
+	}
+	walk := func(ms *MetricsStore) map[Object]string {
+		got := map[Object]string{}
+		ms.WalkFamilies(func(o Object, families []FamilyByteSlicer) {
+			for _, f := range families {
+				got[o] += string(f.ByteSlice())
+			}
+		})
+		return got
+	}
+
+	ms := NewMetricsStoreWithHeaders(headers, genFunc)
+	if err := ms.Add(newService("a")); err != nil {
+		t.Fatal(err)
+	}
+	if got := walk(ms); len(got) != 0 {
+		t.Errorf("expected no families unless they are kept, got %v", got)
+	}
+
+	ms = NewMetricsStoreWithHeaders(headers, genFunc)
+	ms.KeepFamilies()
+	ms.RetainDeleted(time.Hour, false)
+	for _, name := range []string{"a", "b"} {
+		if err := ms.Add(newService(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ms.Delete(newService("b")); err != nil {
+		t.Fatal(err)
+	}
+	want := map[Object]string{
+		{UID: "a", Namespace: "default", Name: "a"}: "kube_service_info{service=\"a\"} 1\n",
+	}
+	if got := walk(ms); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected:\n%v\nbut got:\n%v", want, got)
+	}
+
+	// Restored objects are skipped until their families are generated, even
+	// if they did not change.
+	snapshot := &bytes.Buffer{}
+	if err := ms.WriteSnapshot(snapshot); err != nil {
+		t.Fatal(err)
+	}
+	restored := NewMetricsStoreWithHeaders(headers, genFunc)
+	restored.KeepFamilies()
+	if err := restored.RestoreSnapshot(snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if got := walk(restored); len(got) != 0 {
+		t.Errorf("expected no families of restored objects, got %v", got)
+	}
+	if err := restored.Replace([]interface{}{newService("a")}, ""); err != nil {
+		t.Fatal(err)
+	}
+	if got := walk(restored); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected replaced families:\n%v\nbut got:\n%v", want, got)
+	}
+}
+
+func TestListAndGet(t *testing.T) {
+	genFunc := func(obj interface{}) []FamilyByteSlicer {
+		o, err := meta.Accessor(obj)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return []FamilyByteSlicer{
+			&metricFamily{[]byte(fmt.Sprintf("kube_service_info{service=\"%v\"} 1\n", o.GetName()))},
+			&metricFamily{},
+		}
+	}
+
+	headers := []FamilyHeader{
+		familyHeader{name: "kube_service_info", text: "# HELP kube_service_info Information about service.\n# TYPE kube_service_info gauge"},
+		familyHeader{name: "kube_service_created", text: "# TYPE kube_service_created gauge"},
+	}
+	ms := NewMetricsStoreWithHeaders(headers, genFunc)
+
+	services := []*v1.Service{
+		{ObjectMeta: metav1.ObjectMeta{Name: "b", Namespace: "default", UID: types.UID("b")}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: "kube-system", UID: types.UID("a1")}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: "default", UID: types.UID("a")}},
+	}
+	for _, s := range services {
+		if err := ms.Add(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var got []Object
+	for _, item := range ms.List() {
+		got = append(got, item.(*ObjectMetrics).Object)
+	}
+	want := []Object{
+		{UID: "a", Namespace: "default", Name: "a"},
+		{UID: "b", Namespace: "default", Name: "b"},
+		{UID: "a1", Namespace: "kube-system", Name: "a"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected listed objects:\n%v\nbut got:\n%v", want, got)
+	}
+
+	if got := ms.ListNamespace("kube-system"); len(got) != 1 || got[0].Object != want[2] {
+		t.Errorf("expected only %v in namespace kube-system, got %v", want[2], got)
+	}
+
+	wantKeys := []string{"default/a", "default/b", "kube-system/a"}
+	if got := ms.ListKeys(); !reflect.DeepEqual(got, wantKeys) {
+		t.Errorf("expected keys %v, got %v", wantKeys, got)
+	}
+
+	item, exists, err := ms.GetByKey("kube-system/a")
+	if err != nil || !exists {
+		t.Fatalf("expected kube-system/a to exist, got %v, %v", exists, err)
+	}
+	o := item.(*ObjectMetrics)
+	if o.Object != want[2] || len(o.Families) != 1 {
+		t.Fatalf("expected a single family of %v, got %v", want[2], o)
+	}
+	family := o.Families[0]
+	if family.GetName() != "kube_service_info" || family.GetHelp() != "Information about service." ||
+		len(family.Metric) != 1 || family.Metric[0].GetGauge().GetValue() != 1 ||
+		family.Metric[0].Label[0].GetValue() != "a" {
+		t.Errorf("unexpected family %v", family)
+	}
+
+	if _, exists, _ := ms.Get(services[0]); !exists {
+		t.Errorf("expected %s to exist", services[0].Name)
+	}
+
+	// A recreated object must stay accessible by its key when the previous
+	// object is deleted afterwards.
+	recreated := &v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "b", Namespace: "default", UID: types.UID("b2")}}
+	if err := ms.Add(recreated); err != nil {
+		t.Fatal(err)
+	}
+	if err := ms.Delete(services[0]); err != nil {
+		t.Fatal(err)
+	}
+	item, exists, _ = ms.GetByKey("default/b")
+	if !exists || item.(*ObjectMetrics).UID != "b2" {
+		t.Errorf("expected default/b to be the recreated object, got %v", item)
+	}
+	if _, exists, _ := ms.Get(services[0]); exists {
+		t.Errorf("expected deleted object not to exist")
+	}
+}
+
+func TestNewMetricsStoreTextHeaders(t *testing.T) {
+	genFunc := func(obj interface{}) []FamilyByteSlicer {
+		return []FamilyByteSlicer{&metricFamily{[]byte("kube_service_info 1\n")}}
+	}
+
+	header := "# HELP kube_service_info Information about service.\n# TYPE kube_service_info gauge"
+	ms := NewMetricsStore([]string{header}, genFunc)
+	ms.EnableFormat(FormatOpenMetrics)
+	ms.EnableFormat(FormatProtobuf)
+
+	s := v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "service",
+			Namespace: "default",
+			UID:       types.UID("a"),
+		},
+	}
+	if err := ms.Add(&s); err != nil {
+		t.Fatal(err)
+	}
+
+	if name := ms.FamilyStats()[0].Name; name != "kube_service_info" {
+		t.Errorf("expected family name kube_service_info but got %v", name)
+	}
+	want := header + "\nkube_service_info 1\n"
+	for _, f := range []Format{FormatText, FormatOpenMetrics} {
+		w := strings.Builder{}
+		ms.WriteAllFormat(&w, f)
+		if got := w.String(); got != want {
+			t.Errorf("format %v: expected:\n%v\nbut got:\n%v", f, want, got)
+		}
+	}
+	w := strings.Builder{}
+	ms.WriteAllFormat(&w, FormatProtobuf)
+	if w.Len() != 0 {
+		t.Errorf("expected no protobuf output but got %q", w.String())
+	}
+}
@@ -0,0 +1,212 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metricsstore
+
+import (
+	"container/heap"
+	"sort"
+)
+
+// objectIterator calls yield with the metrics of each object it iterates over
+// and the shard containing them, until yield returns false.
+type objectIterator func(yield func(sh *storeShard, e *entry) bool)
+
+// objectSelector selects either all objects or the objects in a single
+// namespace.
+type objectSelector struct {
+	all       bool
+	namespace string
+}
+
+// allNamespaces selects all objects.
+var allNamespaces = objectSelector{all: true}
+
+// inNamespace selects the objects in the given namespace, cluster-scoped
+// objects are selected by the empty string.
+func inNamespace(namespace string) objectSelector {
+	return objectSelector{namespace: namespace}
+}
+
+// EnableSortedOutput makes the MetricsStore write the metrics of its objects
+// ordered by namespace and name, instead of in random order. The order is
+// maintained on every change, which costs a binary search and a copy of the
+// order of a shard on every added or deleted object. Writing merges the order
+// of all shards, which requires all of them to be locked while writing. It has
+// to be called before any object is added to the store.
+func (s *MetricsStore) EnableSortedOutput() {
+	s.lockAll()
+	defer s.unlockAll()
+
+	s.sorted = true
+	for _, sh := range s.shards {
+		sh.order = []Object{}
+	}
+}
+
+// OmitEmptyFamilies makes the MetricsStore skip the header of metric families
+// without any metrics in the text based formats.
+func (s *MetricsStore) OmitEmptyFamilies() {
+	s.lockAll()
+	defer s.unlockAll()
+
+	s.omitEmpty = true
+}
+
+// objectLess orders objects by namespace, name and, for objects recreated
+// before the previous one was deleted, by UID.
+func objectLess(a, b Object) bool {
+	if a.Namespace != b.Namespace {
+		return a.Namespace < b.Namespace
+	}
+	if a.Name != b.Name {
+		return a.Name < b.Name
+	}
+	return a.UID < b.UID
+}
+
+// insertOrdered inserts the given new object into the order. The caller has
+// to hold the lock of the shard.
+func (sh *storeShard) insertOrdered(o Object) {
+	i := sort.Search(len(sh.order), func(i int) bool { return !objectLess(sh.order[i], o) })
+	sh.order = append(sh.order, Object{})
+	copy(sh.order[i+1:], sh.order[i:])
+	sh.order[i] = o
+}
+
+// removeOrdered removes the given object from the order. The caller has to
+// hold the lock of the shard.
+func (sh *storeShard) removeOrdered(o Object) {
+	i := sort.Search(len(sh.order), func(i int) bool { return !objectLess(sh.order[i], o) })
+	if i < len(sh.order) && sh.order[i] == o {
+		sh.order = append(sh.order[:i], sh.order[i+1:]...)
+	}
+}
+
+// rebuildOrder sorts all objects of the shard at once, which is cheaper than
+// inserting them one by one, e.g. after Replace. The caller has to hold the
+// lock of the shard.
+func (sh *storeShard) rebuildOrder() {
+	sh.order = make([]Object, 0, len(sh.metrics))
+	for _, e := range sh.metrics {
+		sh.order = append(sh.order, e.object)
+	}
+	sort.Slice(sh.order, func(i, j int) bool { return objectLess(sh.order[i], sh.order[j]) })
+}
+
+// objects returns an iterator over the selected objects of the shard, in
+// random order. The caller has to hold the read lock of the shard while
+// iterating.
+func (sh *storeShard) objects(sel objectSelector) objectIterator {
+	metrics := sh.metrics
+	if !sel.all {
+		metrics = sh.namespaces[sel.namespace]
+	}
+
+	return func(yield func(sh *storeShard, e *entry) bool) {
+		for _, e := range metrics {
+			if !yield(sh, e) {
+				return
+			}
+		}
+	}
+}
+
+// shardedObjects returns an iterator over the selected objects of all shards,
+// shard by shard. The caller has to hold the read lock of all shards while
+// iterating.
+func (s *MetricsStore) shardedObjects(sel objectSelector) objectIterator {
+	return func(yield func(sh *storeShard, e *entry) bool) {
+		for _, sh := range s.shards {
+			stopped := false
+			sh.objects(sel)(func(sh *storeShard, e *entry) bool {
+				stopped = !yield(sh, e)
+				return !stopped
+			})
+			if stopped {
+				return
+			}
+		}
+	}
+}
+
+// shardEntry is the metrics of an object and the shard containing them.
+type shardEntry struct {
+	sh *storeShard
+	e  *entry
+}
+
+// orderCursor points to the next object of the order of a shard to merge.
+type orderCursor struct {
+	sh    *storeShard
+	order []Object
+}
+
+// orderHeap is a min-heap of cursors ordered by their next object.
+type orderHeap []orderCursor
+
+func (h orderHeap) Len() int            { return len(h) }
+func (h orderHeap) Less(i, j int) bool  { return objectLess(h[i].order[0], h[j].order[0]) }
+func (h orderHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *orderHeap) Push(x interface{}) { *h = append(*h, x.(orderCursor)) }
+func (h *orderHeap) Pop() interface{} {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
+
+// sortedObjects returns an iterator over the selected objects of all shards
+// ordered by namespace and name, merging the order of the shards once. Objects
+// of a namespace are adjacent in the order of each shard. The caller has to
+// hold the read lock of all shards while iterating.
+func (s *MetricsStore) sortedObjects(sel objectSelector) objectIterator {
+	h := make(orderHeap, 0, len(s.shards))
+	count := 0
+	for _, sh := range s.shards {
+		order := sh.order
+		if !sel.all {
+			i := sort.Search(len(order), func(i int) bool { return order[i].Namespace >= sel.namespace })
+			j := sort.Search(len(order), func(i int) bool { return order[i].Namespace > sel.namespace })
+			order = order[i:j]
+		}
+		if len(order) > 0 {
+			h = append(h, orderCursor{sh: sh, order: order})
+			count += len(order)
+		}
+	}
+	heap.Init(&h)
+
+	merged := make([]shardEntry, 0, count)
+	for h.Len() > 0 {
+		c := &h[0]
+		merged = append(merged, shardEntry{sh: c.sh, e: c.sh.metrics[c.order[0].UID]})
+		c.order = c.order[1:]
+		if len(c.order) == 0 {
+			heap.Pop(&h)
+		} else {
+			heap.Fix(&h, 0)
+		}
+	}
+
+	return func(yield func(sh *storeShard, e *entry) bool) {
+		for _, m := range merged {
+			if !yield(m.sh, m.e) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,140 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metricsstore
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func newOrderTestStore(t *testing.T) *MetricsStore {
+	genFunc := func(obj interface{}) []FamilyByteSlicer {
+		o, err := meta.Accessor(obj)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return []FamilyByteSlicer{
+			&metricFamily{[]byte(fmt.Sprintf("kube_service_info{namespace=\"%s\",service=\"%s\",uid=\"%s\"} 1\n", o.GetNamespace(), o.GetName(), o.GetUID()))},
+			&metricFamily{},
+		}
+	}
+
+	headers := []FamilyHeader{
+		familyHeader{name: "kube_service_info", text: "# TYPE kube_service_info gauge"},
+		familyHeader{name: "kube_service_created", text: "# TYPE kube_service_created gauge"},
+	}
+	return NewMetricsStoreWithHeaders(headers, genFunc)
+}
+
+func newOrderTestService(namespace, name, uid string) *v1.Service {
+	return &v1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, UID: types.UID(uid)}}
+}
+
+func TestSortedOutput(t *testing.T) {
+	ms := newOrderTestStore(t)
+	ms.EnableSortedOutput()
+
+	services := []*v1.Service{
+		newOrderTestService("kube-system", "dns", "1"),
+		newOrderTestService("default", "web", "2"),
+		newOrderTestService("default", "api", "3"),
+		newOrderTestService("monitoring", "prometheus", "4"),
+		newOrderTestService("default", "db", "5"),
+	}
+	for _, s := range services {
+		if err := ms.Add(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Updates do not change the order.
+	if err := ms.Update(services[1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := ms.Delete(services[4]); err != nil {
+		t.Fatal(err)
+	}
+	// A recreated object whose predecessor is not deleted yet.
+	if err := ms.Add(newOrderTestService("default", "api", "6")); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `# TYPE kube_service_info gauge
+kube_service_info{namespace="default",service="api",uid="3"} 1
+kube_service_info{namespace="default",service="api",uid="6"} 1
+kube_service_info{namespace="default",service="web",uid="2"} 1
+kube_service_info{namespace="kube-system",service="dns",uid="1"} 1
+kube_service_info{namespace="monitoring",service="prometheus",uid="4"} 1
+# TYPE kube_service_created gauge
+`
+	w := strings.Builder{}
+	ms.WriteAll(&w)
+	if w.String() != want {
+		t.Errorf("expected:\n%s\nbut got:\n%s", want, w.String())
+	}
+
+	wantNamespace := `# TYPE kube_service_info gauge
+kube_service_info{namespace="default",service="api",uid="3"} 1
+kube_service_info{namespace="default",service="api",uid="6"} 1
+kube_service_info{namespace="default",service="web",uid="2"} 1
+# TYPE kube_service_created gauge
+`
+	w = strings.Builder{}
+	ms.WriteNamespaceFamilies(&w, FormatText, "default", nil)
+	if w.String() != wantNamespace {
+		t.Errorf("expected:\n%s\nbut got:\n%s", wantNamespace, w.String())
+	}
+
+	if err := ms.Replace([]interface{}{services[3], services[0], services[2]}, ""); err != nil {
+		t.Fatal(err)
+	}
+	wantReplaced := `# TYPE kube_service_info gauge
+kube_service_info{namespace="default",service="api",uid="3"} 1
+kube_service_info{namespace="kube-system",service="dns",uid="1"} 1
+kube_service_info{namespace="monitoring",service="prometheus",uid="4"} 1
+# TYPE kube_service_created gauge
+`
+	w = strings.Builder{}
+	ms.WriteAll(&w)
+	if w.String() != wantReplaced {
+		t.Errorf("expected:\n%s\nbut got:\n%s", wantReplaced, w.String())
+	}
+}
+
+func TestOmitEmptyFamilies(t *testing.T) {
+	ms := newOrderTestStore(t)
+	ms.OmitEmptyFamilies()
+
+	if err := ms.Add(newOrderTestService("default", "web", "1")); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `# TYPE kube_service_info gauge
+kube_service_info{namespace="default",service="web",uid="1"} 1
+`
+	w := strings.Builder{}
+	ms.WriteAll(&w)
+	if w.String() != want {
+		t.Errorf("expected:\n%s\nbut got:\n%s", want, w.String())
+	}
+}
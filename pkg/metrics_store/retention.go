@@ -0,0 +1,240 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metricsstore
+
+import (
+	"bytes"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	dto "github.com/prometheus/client_model/go"
+)
+
+var (
+	deletedLabel       = []byte(`deleted="true"`)
+	deletedLabelName   = "deleted"
+	deletedLabelValue  = "true"
+	deletedLabelSuffix = append([]byte{','}, deletedLabel...)
+)
+
+// RetainDeleted makes the MetricsStore keep the metrics of deleted objects
+// for the given duration before removing them, so that their final state is
+// scraped at least once. If mark is true, the label deleted="true" is added
+// to the retained metrics. Objects which vanished when the store is replaced
+// are retained as well. A zero duration removes the metrics of deleted objects
+// immediately. It only affects objects deleted afterwards.
+func (s *MetricsStore) RetainDeleted(d time.Duration, mark bool) {
+	s.lockAll()
+	defer s.unlockAll()
+
+	s.retention = d
+	s.markDeleted = mark
+}
+
+// tombstone replaces the given metrics of a deleted object by the retained
+// ones, which are removed once the retention expired, and returns the latter.
+// The caller has to hold the lock of the shard.
+func (s *MetricsStore) tombstone(sh *storeShard, e *entry) *entry {
+	t := &entry{object: e.object, families: e.families, packed: e.packed, tombstone: true}
+	if s.markDeleted {
+		t.families = s.markedFamilies(sh, e)
+		t.packed = nil
+		sh.release(e)
+	}
+
+	// The object is not found by its key anymore if it was recreated.
+	s.indexTombstone(sh, t)
+	delete(sh.versions, t.object.UID)
+	atomic.AddUint64(&s.generation, 1)
+
+	s.afterFunc(s.retention, func() {
+		s.expire(sh, t)
+	})
+	return t
+}
+
+// indexTombstone stores the given retained metrics of a deleted object in the
+// given shard. Its key keeps referring to a recreated object. Only the latest
+// retained metrics of a key are kept, and unless they are marked, only as
+// long as no recreated object exists, as their series would collide
+// otherwise. The caller has to hold the lock of the shard.
+func (s *MetricsStore) indexTombstone(sh *storeShard, t *entry) {
+	s.index(sh, t)
+
+	key := t.object.Key()
+	s.keysMutex.Lock()
+	defer s.keysMutex.Unlock()
+
+	uid, ok := s.keys[key]
+	previous, retained := s.retained[key]
+	recreated := ok && uid != t.object.UID && (!retained || uid != previous.object.UID)
+	if recreated && !s.markDeleted {
+		s.displaced = append(s.displaced, t)
+		return
+	}
+	if retained && previous != t {
+		s.displaced = append(s.displaced, previous)
+	}
+	if !recreated {
+		s.keys[key] = t.object.UID
+	}
+	s.retained[key] = t
+}
+
+// dropDisplaced removes the retained metrics of deleted objects which collide
+// with the ones of another object with the same key. The caller must not hold
+// the lock of any shard.
+func (s *MetricsStore) dropDisplaced() {
+	s.keysMutex.Lock()
+	displaced := s.displaced
+	s.displaced = nil
+	s.keysMutex.Unlock()
+
+	for _, t := range displaced {
+		s.expire(s.shards[s.shardIndex(t.object.UID)], t)
+	}
+}
+
+// expire removes the given retained metrics of a deleted object from the
+// given shard, unless they were replaced in the meantime, e.g. by a recreated
+// object with the same UID.
+func (s *MetricsStore) expire(sh *storeShard, t *entry) {
+	sh.mutex.Lock()
+	defer sh.mutex.Unlock()
+
+	if sh.metrics[t.object.UID] != t {
+		return
+	}
+
+	if s.watched() {
+		s.notify(t.object, s.text(sh, t), nil)
+	}
+	s.remove(sh, t.object)
+}
+
+// markedFamilies returns the metric families of the given entry in all
+// formats with the label deleted="true" added to all metrics. The caller has
+// to hold the read lock of the shard.
+func (s *MetricsStore) markedFamilies(sh *storeShard, e *entry) [][][]byte {
+	text := s.text(sh, e)
+	markedText := make([][]byte, len(text))
+	for i, family := range text {
+		markedText[i] = markTextFamily(family)
+	}
+
+	marked := make([][][]byte, formatCount)
+	marked[FormatText] = markedText
+	for _, f := range s.formats {
+		families := e.families[f]
+		if families == nil {
+			continue
+		}
+
+		marked[f] = make([][]byte, len(families))
+		for i, family := range families {
+			switch {
+			case f == FormatProtobuf:
+				marked[f][i] = markProtobufFamily(family)
+			case family == nil || bytes.Equal(family, text[i]):
+				marked[f][i] = markedText[i]
+			default:
+				marked[f][i] = markTextFamily(family)
+			}
+		}
+	}
+	return marked
+}
+
+// markTextFamily adds the label deleted="true" to all metrics of the given
+// metric family in a text based format. The labels of a metric end right
+// before the space separating its value, as label values may contain spaces
+// but kube-state-metrics does not render timestamps.
+func markTextFamily(family []byte) []byte {
+	if len(family) == 0 {
+		return family
+	}
+
+	marked := make([]byte, 0, len(family)+bytes.Count(family, []byte{'\n'})*(len(deletedLabelSuffix)+1))
+	for len(family) > 0 {
+		line := family
+		if i := bytes.IndexByte(family, '\n'); i >= 0 {
+			line, family = family[:i], family[i+1:]
+		} else {
+			family = nil
+		}
+
+		i := bytes.LastIndexByte(line, ' ')
+		switch {
+		case i < 0:
+			marked = append(marked, line...)
+		case i > 0 && line[i-1] == '}':
+			marked = append(marked, line[:i-1]...)
+			marked = append(marked, deletedLabelSuffix...)
+			marked = append(marked, line[i-1:]...)
+		default:
+			marked = append(marked, line[:i]...)
+			marked = append(marked, '{')
+			marked = append(marked, deletedLabel...)
+			marked = append(marked, '}')
+			marked = append(marked, line[i:]...)
+		}
+		marked = append(marked, '\n')
+	}
+	return marked
+}
+
+// markProtobufFamily adds the label deleted="true" to all metrics of the given
+// metric family, encoded as the repeated metric field of an
+// io.prometheus.client.MetricFamily message.
+func markProtobufFamily(family []byte) []byte {
+	if len(family) == 0 {
+		return family
+	}
+
+	out := proto.NewBuffer(nil)
+	for len(family) > 0 {
+		// Skip the tag of the metric field, followed by the length of the
+		// metric.
+		_, tagLength := proto.DecodeVarint(family)
+		length, lengthLength := proto.DecodeVarint(family[tagLength:])
+		start := tagLength + lengthLength
+		if tagLength == 0 || lengthLength == 0 || uint64(len(family)-start) < length {
+			panic("failed to decode metric of protobuf family")
+		}
+		message := family[start : start+int(length)]
+		family = family[start+int(length):]
+
+		m := &dto.Metric{}
+		if err := proto.Unmarshal(message, m); err != nil {
+			panic(fmt.Sprintf("failed to decode metric: %v", err))
+		}
+		m.Label = append(m.Label, &dto.LabelPair{
+			Name:  proto.String(deletedLabelName),
+			Value: proto.String(deletedLabelValue),
+		})
+
+		if err := out.EncodeVarint(MetricFieldTag); err != nil {
+			panic(fmt.Sprintf("failed to encode metric field tag: %v", err))
+		}
+		if err := out.EncodeMessage(m); err != nil {
+			panic(fmt.Sprintf("failed to encode metric: %v", err))
+		}
+	}
+	return out.Bytes()
+}
@@ -0,0 +1,397 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metricsstore
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	dto "github.com/prometheus/client_model/go"
+	v1 "k8s.io/api/core/v1"
+)
+
+// manualTimers records the functions of afterFunc to call them on demand.
+type manualTimers struct {
+	durations []time.Duration
+	funcs     []func()
+}
+
+func (m *manualTimers) afterFunc(d time.Duration, f func()) {
+	m.durations = append(m.durations, d)
+	m.funcs = append(m.funcs, f)
+}
+
+func (m *manualTimers) fire() {
+	funcs := m.funcs
+	m.funcs = nil
+	for _, f := range funcs {
+		f()
+	}
+}
+
+func newRetentionTestStore(t *testing.T, mark bool) (*MetricsStore, *manualTimers) {
+	ms := newOrderTestStore(t)
+	timers := &manualTimers{}
+	ms.afterFunc = timers.afterFunc
+	ms.RetainDeleted(time.Minute, mark)
+	return ms, timers
+}
+
+func writeAll(ms *MetricsStore) string {
+	w := strings.Builder{}
+	ms.WriteAll(&w)
+	return w.String()
+}
+
+func TestRetainDeleted(t *testing.T) {
+	ms, timers := newRetentionTestStore(t, false)
+	w := &recordingWatcher{}
+	ms.Watch(w)
+
+	service := newOrderTestService("default", "web", "1")
+	if err := ms.Add(service); err != nil {
+		t.Fatal(err)
+	}
+	before := writeAll(ms)
+
+	if err := ms.Delete(service); err != nil {
+		t.Fatal(err)
+	}
+	// Deleting a retained object again does not extend its retention.
+	if err := ms.Delete(service); err != nil {
+		t.Fatal(err)
+	}
+	if got := writeAll(ms); got != before {
+		t.Errorf("expected retained metrics:\n%s\nbut got:\n%s", before, got)
+	}
+	if !reflect.DeepEqual(timers.durations, []time.Duration{time.Minute}) {
+		t.Errorf("expected a single retention of a minute but got %v", timers.durations)
+	}
+	if _, exists, _ := ms.GetByKey("default/web"); !exists {
+		t.Error("expected retained object to be found by its key")
+	}
+
+	timers.fire()
+	want := "# TYPE kube_service_info gauge\n# TYPE kube_service_created gauge\n"
+	if got := writeAll(ms); got != want {
+		t.Errorf("expected:\n%s\nbut got:\n%s", want, got)
+	}
+	if keys := ms.ListKeys(); len(keys) != 0 {
+		t.Errorf("expected no keys after expiry but got %v", keys)
+	}
+
+	// Added on Add and removed on expiry only.
+	if len(w.deltas) != 2 || len(w.deltas[0].Added) != 1 || len(w.deltas[1].Removed) != 1 {
+		t.Errorf("expected an added and a removed delta but got %+v", w.deltas)
+	}
+}
+
+func TestRetainDeletedReadded(t *testing.T) {
+	ms, timers := newRetentionTestStore(t, false)
+
+	service := newOrderTestService("default", "web", "1")
+	service.ResourceVersion = "1"
+	if err := ms.Add(service); err != nil {
+		t.Fatal(err)
+	}
+	want := writeAll(ms)
+
+	// A deleted object added again with the same UID and unchanged metrics,
+	// e.g. after leaving and re-entering a selector, is not removed on
+	// expiry.
+	if err := ms.Delete(service); err != nil {
+		t.Fatal(err)
+	}
+	if err := ms.Add(service); err != nil {
+		t.Fatal(err)
+	}
+	timers.fire()
+	if got := writeAll(ms); got != want {
+		t.Errorf("expected:\n%s\nbut got:\n%s", want, got)
+	}
+
+	// The same applies to objects which vanished on replace.
+	if err := ms.Replace([]interface{}{}, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := ms.Replace([]interface{}{service}, ""); err != nil {
+		t.Fatal(err)
+	}
+	timers.fire()
+	if got := writeAll(ms); got != want {
+		t.Errorf("expected:\n%s\nbut got:\n%s", want, got)
+	}
+}
+
+func TestRetainDeletedRecreated(t *testing.T) {
+	deleted := newOrderTestService("default", "web", "1")
+	recreated := newOrderTestService("default", "web", "2")
+	want := `# TYPE kube_service_info gauge
+kube_service_info{namespace="default",service="web",uid="2"} 1
+# TYPE kube_service_created gauge
+`
+
+	// The unmarked retained metrics of a deleted object collide with the ones
+	// of an object recreated with the same key, hence they are dropped,
+	// regardless of whether the deletion is observed first.
+	for _, deleteFirst := range []bool{true, false} {
+		ms, timers := newRetentionTestStore(t, false)
+		ms.EnableSortedOutput()
+		w := &recordingWatcher{}
+		ms.Watch(w)
+
+		if err := ms.Add(deleted); err != nil {
+			t.Fatal(err)
+		}
+		if deleteFirst {
+			if err := ms.Delete(deleted); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := ms.Add(recreated); err != nil {
+			t.Fatal(err)
+		}
+		if !deleteFirst {
+			if err := ms.Delete(deleted); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if got := writeAll(ms); got != want {
+			t.Errorf("expected:\n%s\nbut got:\n%s", want, got)
+		}
+		if last := w.deltas[len(w.deltas)-1]; last.Object.UID != "1" || len(last.Removed) != 1 || len(last.Added) != 0 {
+			t.Errorf("expected the removal of the deleted object but got %+v", last)
+		}
+
+		timers.fire()
+		if got := writeAll(ms); got != want {
+			t.Errorf("expected:\n%s\nbut got:\n%s", want, got)
+		}
+		if _, exists, _ := ms.GetByKey("default/web"); !exists {
+			t.Error("expected recreated object to be found by its key")
+		}
+	}
+
+	// The same applies to objects which vanished on replace.
+	ms, timers := newRetentionTestStore(t, false)
+	if err := ms.Add(deleted); err != nil {
+		t.Fatal(err)
+	}
+	if err := ms.Replace([]interface{}{recreated}, ""); err != nil {
+		t.Fatal(err)
+	}
+	timers.fire()
+	if got := writeAll(ms); got != want {
+		t.Errorf("expected:\n%s\nbut got:\n%s", want, got)
+	}
+}
+
+func TestRetainDeletedMarkedRecreated(t *testing.T) {
+	ms, _ := newRetentionTestStore(t, true)
+	ms.EnableSortedOutput()
+
+	deleted := newOrderTestService("default", "web", "1")
+	recreated := newOrderTestService("default", "web", "2")
+	if err := ms.Add(deleted); err != nil {
+		t.Fatal(err)
+	}
+	if err := ms.Delete(deleted); err != nil {
+		t.Fatal(err)
+	}
+	if err := ms.Add(recreated); err != nil {
+		t.Fatal(err)
+	}
+
+	// Marked retained metrics do not collide with the ones of a recreated
+	// object, but with the ones retained once it is deleted as well.
+	want := `# TYPE kube_service_info gauge
+kube_service_info{namespace="default",service="web",uid="1",deleted="true"} 1
+kube_service_info{namespace="default",service="web",uid="2"} 1
+# TYPE kube_service_created gauge
+`
+	if got := writeAll(ms); got != want {
+		t.Errorf("expected:\n%s\nbut got:\n%s", want, got)
+	}
+
+	if err := ms.Delete(recreated); err != nil {
+		t.Fatal(err)
+	}
+	want = `# TYPE kube_service_info gauge
+kube_service_info{namespace="default",service="web",uid="2",deleted="true"} 1
+# TYPE kube_service_created gauge
+`
+	if got := writeAll(ms); got != want {
+		t.Errorf("expected:\n%s\nbut got:\n%s", want, got)
+	}
+}
+
+func TestRetainDeletedMarked(t *testing.T) {
+	ms, timers := newRetentionTestStore(t, true)
+	ms.EnableSortedOutput()
+	w := &recordingWatcher{}
+	ms.Watch(w)
+
+	web := newOrderTestService("default", "web", "1")
+	dns := newOrderTestService("kube-system", "dns", "2")
+	for _, s := range []*v1.Service{web, dns} {
+		if err := ms.Add(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ms.Delete(web); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `# TYPE kube_service_info gauge
+kube_service_info{namespace="default",service="web",uid="1",deleted="true"} 1
+kube_service_info{namespace="kube-system",service="dns",uid="2"} 1
+# TYPE kube_service_created gauge
+`
+	if got := writeAll(ms); got != want {
+		t.Errorf("expected:\n%s\nbut got:\n%s", want, got)
+	}
+
+	wantDelta := Delta{
+		Object:  Object{UID: "1", Namespace: "default", Name: "web"},
+		Added:   []Series{{Metric: `kube_service_info{namespace="default",service="web",uid="1",deleted="true"}`, Value: "1"}},
+		Removed: []Series{{Metric: `kube_service_info{namespace="default",service="web",uid="1"}`, Value: "1"}},
+	}
+	if got := w.deltas[len(w.deltas)-1]; !reflect.DeepEqual(got, wantDelta) {
+		t.Errorf("expected delta:\n%+v\nbut got:\n%+v", wantDelta, got)
+	}
+
+	// Objects which vanished on replace are retained, the retained ones are
+	// kept until their retention expires.
+	if err := ms.Replace([]interface{}{}, ""); err != nil {
+		t.Fatal(err)
+	}
+	want = `# TYPE kube_service_info gauge
+kube_service_info{namespace="default",service="web",uid="1",deleted="true"} 1
+kube_service_info{namespace="kube-system",service="dns",uid="2",deleted="true"} 1
+# TYPE kube_service_created gauge
+`
+	if got := writeAll(ms); got != want {
+		t.Errorf("expected:\n%s\nbut got:\n%s", want, got)
+	}
+
+	// A retained object re-added with the same UID is not removed on expiry.
+	if err := ms.Add(dns); err != nil {
+		t.Fatal(err)
+	}
+	timers.fire()
+	want = `# TYPE kube_service_info gauge
+kube_service_info{namespace="kube-system",service="dns",uid="2"} 1
+# TYPE kube_service_created gauge
+`
+	if got := writeAll(ms); got != want {
+		t.Errorf("expected:\n%s\nbut got:\n%s", want, got)
+	}
+}
+
+func TestRetainDeletedReplaceNamespace(t *testing.T) {
+	ms, timers := newRetentionTestStore(t, true)
+	ms.EnableSortedOutput()
+
+	web := newOrderTestService("default", "web", "1")
+	db := newOrderTestService("default", "db", "2")
+	dns := newOrderTestService("kube-system", "dns", "3")
+	for _, s := range []*v1.Service{web, db, dns} {
+		if err := ms.Add(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Only the objects of the relisted namespace vanish, the ones of other
+	// namespaces, listed by their own reflectors, are kept.
+	if err := ms.ReplaceNamespace([]interface{}{web}, "default"); err != nil {
+		t.Fatal(err)
+	}
+	want := `# TYPE kube_service_info gauge
+kube_service_info{namespace="default",service="db",uid="2",deleted="true"} 1
+kube_service_info{namespace="default",service="web",uid="1"} 1
+kube_service_info{namespace="kube-system",service="dns",uid="3"} 1
+# TYPE kube_service_created gauge
+`
+	if got := writeAll(ms); got != want {
+		t.Errorf("expected:\n%s\nbut got:\n%s", want, got)
+	}
+	if len(timers.durations) != 1 {
+		t.Errorf("expected a single retention but got %v", timers.durations)
+	}
+	if _, exists, _ := ms.GetByKey("kube-system/dns"); !exists {
+		t.Error("expected object of other namespace to be found by its key")
+	}
+
+	timers.fire()
+	want = `# TYPE kube_service_info gauge
+kube_service_info{namespace="default",service="web",uid="1"} 1
+kube_service_info{namespace="kube-system",service="dns",uid="3"} 1
+# TYPE kube_service_created gauge
+`
+	if got := writeAll(ms); got != want {
+		t.Errorf("expected:\n%s\nbut got:\n%s", want, got)
+	}
+}
+
+func TestMarkTextFamily(t *testing.T) {
+	family := "kube_pod_info{pod=\"a b\",note=\"} 1\"} 1\nkube_pods 3\n"
+	want := "kube_pod_info{pod=\"a b\",note=\"} 1\",deleted=\"true\"} 1\nkube_pods{deleted=\"true\"} 3\n"
+	if got := string(markTextFamily([]byte(family))); got != want {
+		t.Errorf("expected:\n%s\nbut got:\n%s", want, got)
+	}
+	if got := markTextFamily(nil); got != nil {
+		t.Errorf("expected empty family to stay empty but got %q", got)
+	}
+}
+
+func TestMarkProtobufFamily(t *testing.T) {
+	b := proto.NewBuffer(nil)
+	for _, pod := range []string{"a", "b"} {
+		if err := b.EncodeVarint(MetricFieldTag); err != nil {
+			t.Fatal(err)
+		}
+		err := b.EncodeMessage(&dto.Metric{
+			Label: []*dto.LabelPair{{Name: proto.String("pod"), Value: proto.String(pod)}},
+			Gauge: &dto.Gauge{Value: proto.Float64(1)},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	header, err := proto.Marshal(&dto.MetricFamily{Name: proto.String("kube_pod_info")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	family := &dto.MetricFamily{}
+	if err := proto.Unmarshal(append(header, markProtobufFamily(b.Bytes())...), family); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(family.Metric) != 2 {
+		t.Fatalf("expected 2 metrics but got %v", family)
+	}
+	for _, m := range family.Metric {
+		labels := m.GetLabel()
+		if len(labels) != 2 || labels[1].GetName() != "deleted" || labels[1].GetValue() != "true" {
+			t.Errorf("expected deleted label to be added but got %v", m)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metricsstore
+
+import (
+	"sync"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// defaultShardCount is the number of shards of a MetricsStore.
+const defaultShardCount = 16
+
+// storeShard contains the metrics of the objects of a MetricsStore whose UID
+// hashes to it, guarded by its own lock.
+type storeShard struct {
+	// Protects metrics
+	mutex sync.RWMutex
+	// metrics is a map indexed by Kubernetes object id, containing the metric
+	// families of the object. We need to keep metrics grouped by metric
+	// families in order to zip families with their help text in
+	// MetricsStore.WriteAll().
+	metrics map[types.UID]*entry
+	// namespaces indexes the entries of metrics by the namespace of their
+	// object, cluster-scoped objects are indexed by the empty string.
+	namespaces map[string]map[types.UID]*entry
+	// versions contains the resource version of the object of each entry of
+	// metrics, the metrics are only regenerated if it changes.
+	versions map[types.UID]string
+	// order contains all objects of the shard sorted by namespace and name if
+	// sorted output is enabled.
+	order []Object
+	// symbols interns the label names and values of packed metric families.
+	// It is nil unless compact storage is enabled.
+	symbols *symbolTable
+}
+
+func newStoreShard() *storeShard {
+	return &storeShard{
+		metrics:    map[types.UID]*entry{},
+		namespaces: map[string]map[types.UID]*entry{},
+		versions:   map[types.UID]string{},
+	}
+}
+
+// shardIndex returns the index of the shard of the object with the given UID,
+// based on its FNV-1a hash.
+func (s *MetricsStore) shardIndex(uid types.UID) int {
+	h := uint32(2166136261)
+	for i := 0; i < len(uid); i++ {
+		h ^= uint32(uid[i])
+		h *= 16777619
+	}
+	return int(h % uint32(len(s.shards)))
+}
+
+// lockAll locks all shards, always in the same order to prevent deadlocks.
+func (s *MetricsStore) lockAll() {
+	for _, sh := range s.shards {
+		sh.mutex.Lock()
+	}
+}
+
+func (s *MetricsStore) unlockAll() {
+	for _, sh := range s.shards {
+		sh.mutex.Unlock()
+	}
+}
+
+// rLockAll read locks all shards, always in the same order to prevent
+// deadlocks.
+func (s *MetricsStore) rLockAll() {
+	for _, sh := range s.shards {
+		sh.mutex.RLock()
+	}
+}
+
+func (s *MetricsStore) rUnlockAll() {
+	for _, sh := range s.shards {
+		sh.mutex.RUnlock()
+	}
+}
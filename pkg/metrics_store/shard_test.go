@@ -0,0 +1,166 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metricsstore
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestShardedStore(t *testing.T) {
+	ms := newOrderTestStore(t)
+	ms.EnableSortedOutput()
+
+	// Adding objects concurrently spreads them over all shards.
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			s := newOrderTestService(fmt.Sprintf("ns-%d", i%3), fmt.Sprintf("svc-%02d", i), fmt.Sprint(i))
+			if err := ms.Add(s); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for _, sh := range ms.shards {
+		if len(sh.metrics) == 0 {
+			t.Fatal("expected objects in every shard")
+		}
+	}
+
+	want := strings.Builder{}
+	want.WriteString("# TYPE kube_service_info gauge\n")
+	for ns := 0; ns < 3; ns++ {
+		for i := ns; i < 100; i += 3 {
+			fmt.Fprintf(&want, "kube_service_info{namespace=\"ns-%d\",service=\"svc-%02d\",uid=\"%d\"} 1\n", ns, i, i)
+		}
+	}
+	want.WriteString("# TYPE kube_service_created gauge\n")
+
+	w := strings.Builder{}
+	ms.WriteAll(&w)
+	if w.String() != want.String() {
+		t.Errorf("expected:\n%s\nbut got:\n%s", want.String(), w.String())
+	}
+
+	// The key of a recreated object refers to the new object, even if the
+	// previous one is deleted afterwards from another shard.
+	previous := newOrderTestService("ns-0", "svc-00", "0")
+	recreated := newOrderTestService("ns-0", "svc-00", "recreated")
+	if ms.shardIndex(previous.UID) == ms.shardIndex(recreated.UID) {
+		t.Fatal("expected objects in different shards")
+	}
+	if err := ms.Add(recreated); err != nil {
+		t.Fatal(err)
+	}
+	if err := ms.Delete(previous); err != nil {
+		t.Fatal(err)
+	}
+
+	item, exists, err := ms.GetByKey("ns-0/svc-00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !exists || item.(*ObjectMetrics).UID != types.UID("recreated") {
+		t.Errorf("expected recreated object but got %v", item)
+	}
+	if got := len(ms.ListKeys()); got != 100 {
+		t.Errorf("expected 100 keys but got %v", got)
+	}
+}
+
+func BenchmarkConcurrentAddAndWriteAll(b *testing.B) {
+	const objects = 1000
+
+	tests := []struct {
+		testName string
+		shards   int
+	}{
+		{
+			testName: "1-shard",
+			shards:   1,
+		},
+		{
+			testName: fmt.Sprintf("%d-shards", defaultShardCount),
+			shards:   defaultShardCount,
+		},
+	}
+
+	for _, test := range tests {
+		b.Run(test.testName, func(b *testing.B) {
+			ms := newMetricsStore(compactTestHeaders, compactTestFamilies(b), test.shards)
+			services := make([]*v1.Service, objects)
+			for i := range services {
+				services[i] = newCompactTestService(fmt.Sprintf("namespace-%d", i%10), fmt.Sprintf("service-%d", i), "0", 5)
+				if err := ms.Add(services[i]); err != nil {
+					b.Fatal(err)
+				}
+			}
+
+			// Scrapes run continuously while the objects are updated.
+			var scrapes int64
+			stop := make(chan struct{})
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				for {
+					select {
+					case <-stop:
+						return
+					default:
+						ms.WriteAll(ioutil.Discard)
+						atomic.AddInt64(&scrapes, 1)
+					}
+				}
+			}()
+
+			var version int64
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					v := atomic.AddInt64(&version, 1)
+					s := services[v%objects]
+					// Updated objects alternate their number of ports to
+					// force their metrics to be regenerated.
+					err := ms.Update(newCompactTestService(s.Namespace, s.Name, fmt.Sprint(v), int(v%2)+4))
+					if err != nil {
+						// Fatal must not be called outside of the goroutine
+						// running the benchmark.
+						b.Error(err)
+						return
+					}
+				}
+			})
+			b.StopTimer()
+
+			close(stop)
+			<-done
+			b.ReportMetric(float64(atomic.LoadInt64(&scrapes))/float64(b.N), "scrapes/op")
+		})
+	}
+}
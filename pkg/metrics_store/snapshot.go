@@ -0,0 +1,298 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metricsstore
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+)
+
+// snapshotVersion is the version of the snapshot encoding, snapshots of other
+// versions are not restored.
+const snapshotVersion = 2
+
+// snapshotHeader is the first value of a snapshot. A snapshot is only
+// restored into a store with the same scope, metric families and formats.
+type snapshotHeader struct {
+	Version int
+	// Scope describes the objects of the store, see
+	// MetricsStore.ScopeSnapshots.
+	Scope string
+	// Headers are the headers of the metric families in the Prometheus text
+	// format.
+	Headers []string
+	Formats []Format
+}
+
+// snapshotObject contains the metrics of an object in a snapshot. The end of
+// a snapshot is marked by an object without UID.
+type snapshotObject struct {
+	Object  Object
+	Version string
+	// Families are the metric families in the Prometheus text format.
+	Families [][]byte
+	// Formats contains the metric families in the other formats, unless all
+	// of them are rendered as in the Prometheus text format. Families of text
+	// based formats rendered as in the Prometheus text format are nil.
+	Formats map[Format][][]byte
+}
+
+// SnapshotFile returns the path of the snapshot of the store of the given
+// collector and shard in the given directory.
+func SnapshotFile(dir, collector string, shard int32, totalShards int) string {
+	return filepath.Join(dir, fmt.Sprintf("%s-%d-of-%d.snapshot", collector, shard, totalShards))
+}
+
+// WriteSnapshot writes the metrics and resource versions of all objects in the
+// store to the given writer, so that they can be restored by RestoreSnapshot,
+// e.g. after a restart. The retained metrics of deleted objects are skipped.
+// Shards are locked one at a time, hence the snapshot is only consistent per
+// shard.
+func (s *MetricsStore) WriteSnapshot(w io.Writer) error {
+	buf := &bytes.Buffer{}
+	enc := gob.NewEncoder(buf)
+
+	header := snapshotHeader{Version: snapshotVersion, Scope: s.snapshotScope, Headers: s.textHeaders(), Formats: s.formats}
+	if err := enc.Encode(header); err != nil {
+		return errors.Wrap(err, "encode snapshot header")
+	}
+
+	for _, sh := range s.shards {
+		sh.mutex.RLock()
+		for uid, e := range sh.metrics {
+			if e.tombstone {
+				continue
+			}
+
+			o := snapshotObject{
+				Object:   e.object,
+				Version:  sh.versions[uid],
+				Families: s.text(sh, e),
+				Formats:  snapshotFormats(e),
+			}
+			if err := enc.Encode(o); err != nil {
+				sh.mutex.RUnlock()
+				return errors.Wrapf(err, "encode snapshot of %s", e.object.Key())
+			}
+		}
+		sh.mutex.RUnlock()
+
+		if _, err := w.Write(buf.Bytes()); err != nil {
+			return errors.Wrap(err, "write snapshot")
+		}
+		buf.Reset()
+	}
+
+	if err := enc.Encode(snapshotObject{}); err != nil {
+		return errors.Wrap(err, "encode end of snapshot")
+	}
+	_, err := w.Write(buf.Bytes())
+	return errors.Wrap(err, "write snapshot")
+}
+
+// snapshotFormats returns the metric families of the given entry in the other
+// formats than the Prometheus text format, see snapshotObject.
+func snapshotFormats(e *entry) map[Format][][]byte {
+	text := e.families[FormatText]
+
+	var formats map[Format][][]byte
+	for f := FormatText + 1; f < formatCount; f++ {
+		families := e.families[f]
+		if families == nil || (f.textBased() && len(families) > 0 && &families[0] == &text[0]) {
+			continue
+		}
+
+		if f.textBased() {
+			diverging := make([][]byte, len(families))
+			for i := range families {
+				if !sameBytes(families[i], text[i]) {
+					diverging[i] = families[i]
+				}
+			}
+			families = diverging
+		}
+		if formats == nil {
+			formats = map[Format][][]byte{}
+		}
+		formats[f] = families
+	}
+	return formats
+}
+
+// RestoreSnapshot restores the metrics and resource versions of the objects
+// in the given snapshot written by WriteSnapshot, until the store is replaced,
+// e.g. by the initial list of a reflector. Objects whose resource version did
+// not change in the meantime are then taken over without regenerating their
+// metrics, unless compact storage is enabled. It fails if the snapshot was
+// written by a store with a different scope, metric families or formats, or if
+// the store is not empty.
+func (s *MetricsStore) RestoreSnapshot(r io.Reader) error {
+	dec := gob.NewDecoder(r)
+
+	var header snapshotHeader
+	if err := dec.Decode(&header); err != nil {
+		return errors.Wrap(err, "decode snapshot header")
+	}
+	if header.Version != snapshotVersion {
+		return errors.Errorf("unsupported snapshot version %d", header.Version)
+	}
+	if header.Scope != s.snapshotScope {
+		return errors.Errorf("snapshot contains objects of scope %q instead of %q", header.Scope, s.snapshotScope)
+	}
+	if !equalStrings(header.Headers, s.textHeaders()) {
+		return errors.New("snapshot contains different metric families")
+	}
+	if !sameFormats(header.Formats, s.formats) {
+		return errors.Errorf("snapshot contains metrics in formats %v instead of %v", header.Formats, s.formats)
+	}
+
+	// The snapshot is decoded completely before restoring it, so that it is
+	// not restored partially.
+	objects := []snapshotObject{}
+	for {
+		var o snapshotObject
+		if err := dec.Decode(&o); err != nil {
+			return errors.Wrap(err, "decode snapshot")
+		}
+		if o.Object.UID == "" {
+			break
+		}
+		if len(o.Families) != len(s.headers) {
+			return errors.Errorf("snapshot of %s contains %d instead of %d metric families", o.Object.Key(), len(o.Families), len(s.headers))
+		}
+		objects = append(objects, o)
+	}
+
+	s.lockAll()
+	defer s.unlockAll()
+
+	s.keysMutex.RLock()
+	empty := len(s.keys) == 0
+	s.keysMutex.RUnlock()
+	if !empty {
+		return errors.New("snapshot can only be restored into an empty store")
+	}
+
+	for _, o := range objects {
+		sh := s.shards[s.shardIndex(o.Object.UID)]
+		e := &entry{object: o.Object, families: make([][][]byte, formatCount)}
+		e.families[FormatText] = o.Families
+		for _, f := range s.formats {
+			e.families[f] = restoredFamilies(o, f)
+		}
+
+		// The restored metrics are not packed, the metrics of unchanged
+		// objects are regenerated to pack them.
+		version := o.Version
+		if sh.symbols != nil {
+			version = ""
+		}
+		s.insert(sh, version, e)
+	}
+	for _, sh := range s.shards {
+		if s.sorted {
+			sh.rebuildOrder()
+		}
+	}
+	atomic.StoreUint32(&s.restored, 1)
+	atomic.AddUint64(&s.generation, 1)
+
+	return nil
+}
+
+// restoredFamilies returns the metric families of the given object of a
+// snapshot in the given format, see snapshotObject.
+func restoredFamilies(o snapshotObject, f Format) [][]byte {
+	families, ok := o.Formats[f]
+	if !ok {
+		if f.textBased() {
+			return o.Families
+		}
+		return make([][]byte, len(o.Families))
+	}
+	if !f.textBased() {
+		return families
+	}
+
+	restored := make([][]byte, len(o.Families))
+	for i := range restored {
+		restored[i] = o.Families[i]
+		if i < len(families) && len(families[i]) > 0 {
+			restored[i] = families[i]
+		}
+	}
+	return restored
+}
+
+// Restored returns whether the store contains the metrics restored from a
+// snapshot, which might be stale, as it was not replaced since.
+func (s *MetricsStore) Restored() bool {
+	return atomic.LoadUint32(&s.restored) == 1
+}
+
+// ClearRestored marks the metrics restored from a snapshot as replaced. Stores
+// replaced by ReplaceNamespace have to be marked once all of their namespaces
+// were replaced.
+func (s *MetricsStore) ClearRestored() {
+	atomic.StoreUint32(&s.restored, 0)
+}
+
+// textHeaders returns the headers of the metric families of the store in the
+// Prometheus text format.
+func (s *MetricsStore) textHeaders() []string {
+	headers := make([]string, len(s.headers))
+	for i, h := range s.headers {
+		headers[i] = h.Header(FormatText)
+	}
+	return headers
+}
+
+// sameFormats returns whether the given formats contain the same formats.
+func sameFormats(a, b []Format) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, f := range a {
+		found := false
+		for _, g := range b {
+			found = found || f == g
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// equalStrings returns whether the given string slices are equal.
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
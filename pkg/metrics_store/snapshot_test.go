@@ -0,0 +1,139 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metricsstore
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestSnapshot(t *testing.T) {
+	for _, compact := range []bool{false, true} {
+		newStore := func() *MetricsStore {
+			ms := NewMetricsStoreWithHeaders(compactTestHeaders, compactTestFamilies(t))
+			ms.EnableSortedOutput()
+			if compact {
+				ms.EnableCompactStorage()
+			}
+			return ms
+		}
+		write := func(ms *MetricsStore, f Format) string {
+			w := strings.Builder{}
+			ms.WriteAllFormat(&w, f)
+			return w.String()
+		}
+
+		ms := newStore()
+		for _, s := range []*v1.Service{
+			newCompactTestService("default", "web", "1", 2),
+			newCompactTestService("default", "db", "1", 1),
+			newCompactTestService("kube-system", "dns", "1", 0),
+		} {
+			if err := ms.Add(s); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		snapshot := &bytes.Buffer{}
+		if err := ms.WriteSnapshot(snapshot); err != nil {
+			t.Fatalf("compact=%v: %v", compact, err)
+		}
+
+		restored := newStore()
+		updates := map[UpdateResult]int{}
+		restored.ObserveUpdates(func(r UpdateResult) {
+			updates[r]++
+		})
+		if err := restored.RestoreSnapshot(bytes.NewReader(snapshot.Bytes())); err != nil {
+			t.Fatalf("compact=%v: %v", compact, err)
+		}
+		if !restored.Restored() {
+			t.Errorf("compact=%v: expected store to be restored", compact)
+		}
+		for _, f := range []Format{FormatText, FormatOpenMetrics} {
+			if want, got := write(ms, f), write(restored, f); got != want {
+				t.Errorf("compact=%v: expected restored %v output:\n%v\nbut got:\n%v", compact, f, want, got)
+			}
+		}
+		if want, got := ms.FamilyStats(), restored.FamilyStats(); got[1].Series != want[1].Series {
+			t.Errorf("compact=%v: expected %v restored series but got %v", compact, want[1].Series, got[1].Series)
+		}
+
+		// Unchanged objects are taken over, unless their metrics have to be
+		// packed.
+		err := restored.Replace([]interface{}{
+			newCompactTestService("default", "web", "1", 2),
+			newCompactTestService("kube-system", "dns", "2", 1),
+		}, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if restored.Restored() {
+			t.Errorf("compact=%v: expected replaced store not to be restored", compact)
+		}
+		wantSkipped := 1
+		if compact {
+			wantSkipped = 0
+		}
+		if updates[UpdateSkipped] != wantSkipped {
+			t.Errorf("compact=%v: expected %v skipped updates but got %v", compact, wantSkipped, updates[UpdateSkipped])
+		}
+
+		expected := newStore()
+		for _, s := range []*v1.Service{
+			newCompactTestService("default", "web", "1", 2),
+			newCompactTestService("kube-system", "dns", "2", 1),
+		} {
+			if err := expected.Add(s); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if want, got := write(expected, FormatOpenMetrics), write(restored, FormatOpenMetrics); got != want {
+			t.Errorf("compact=%v: expected replaced output:\n%v\nbut got:\n%v", compact, want, got)
+		}
+
+		// Snapshots are only restored into empty stores with the same scope,
+		// metric families and formats.
+		if err := restored.RestoreSnapshot(bytes.NewReader(snapshot.Bytes())); err == nil {
+			t.Errorf("compact=%v: expected error restoring into non-empty store", compact)
+		}
+		protobuf := newStore()
+		protobuf.EnableFormat(FormatProtobuf)
+		if err := protobuf.RestoreSnapshot(bytes.NewReader(snapshot.Bytes())); err == nil {
+			t.Errorf("compact=%v: expected error restoring into store with other formats", compact)
+		}
+		scoped := newStore()
+		scoped.ScopeSnapshots(`namespaces="default"`)
+		if err := scoped.RestoreSnapshot(bytes.NewReader(snapshot.Bytes())); err == nil {
+			t.Errorf("compact=%v: expected error restoring into store with other scope", compact)
+		}
+		other := NewMetricsStoreWithHeaders(compactTestHeaders[1:], compactTestFamilies(t))
+		if err := other.RestoreSnapshot(bytes.NewReader(snapshot.Bytes())); err == nil {
+			t.Errorf("compact=%v: expected error restoring into store with other metric families", compact)
+		}
+		truncated := newStore()
+		if err := truncated.RestoreSnapshot(bytes.NewReader(snapshot.Bytes()[:snapshot.Len()-10])); err == nil {
+			t.Errorf("compact=%v: expected error restoring truncated snapshot", compact)
+		}
+		if got := write(truncated, FormatText); got != write(newStore(), FormatText) {
+			t.Errorf("compact=%v: expected truncated snapshot not to be restored, got:\n%v", compact, got)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metricsstore
+
+import (
+	"bytes"
+)
+
+// Series is a single series of a metric family in the Prometheus text format.
+type Series struct {
+	// Metric is the name and the labels of the series, e.g.
+	// kube_pod_info{namespace="default",pod="pod0"}.
+	Metric string
+	// Value is the value of the series.
+	Value string
+}
+
+// Delta contains the series of an object which were added, changed or removed
+// by a single change of the store. Removed series carry their last value.
+type Delta struct {
+	Object  Object
+	Added   []Series
+	Changed []Series
+	Removed []Series
+}
+
+// Watcher is notified of the changes of the metrics of a store. Its methods
+// are called with a shard or all of the store locked, hence they must not
+// block nor access the store. Changes of objects of different shards are
+// notified concurrently.
+type Watcher interface {
+	// Changed is called with the delta of every change of the metrics of an
+	// object, apart from changes by Replace.
+	Changed(d Delta)
+	// Resynced is called after the content of the store was replaced, i.e.
+	// the state of watchers has to be rebuilt from the store.
+	Resynced()
+}
+
+// Watch registers the given watcher to be notified of all future changes of
+// the store.
+func (s *MetricsStore) Watch(w Watcher) {
+	s.watchMutex.Lock()
+	defer s.watchMutex.Unlock()
+
+	s.watchers[w] = struct{}{}
+}
+
+// Unwatch unregisters the given watcher.
+func (s *MetricsStore) Unwatch(w Watcher) {
+	s.watchMutex.Lock()
+	defer s.watchMutex.Unlock()
+
+	delete(s.watchers, w)
+}
+
+// notify notifies the watchers of the delta between the rendered metric
+// families of the given object before and after a change. Either of them is
+// nil if the object was added or deleted respectively. Nothing is notified if
+// the metrics did not change. The caller has to hold the lock of the shard of
+// the object.
+func (s *MetricsStore) notify(o Object, before, after [][]byte) {
+	d := Delta{Object: o}
+	for i := range s.headers {
+		var oldFamily, newFamily []byte
+		if i < len(before) {
+			oldFamily = before[i]
+		}
+		if i < len(after) {
+			newFamily = after[i]
+		}
+		if bytes.Equal(oldFamily, newFamily) {
+			continue
+		}
+
+		diffFamily(&d, oldFamily, newFamily)
+	}
+
+	if len(d.Added) == 0 && len(d.Changed) == 0 && len(d.Removed) == 0 {
+		return
+	}
+	s.watchMutex.RLock()
+	defer s.watchMutex.RUnlock()
+	for w := range s.watchers {
+		w.Changed(d)
+	}
+}
+
+// watched returns whether any watcher is registered.
+func (s *MetricsStore) watched() bool {
+	s.watchMutex.RLock()
+	defer s.watchMutex.RUnlock()
+
+	return len(s.watchers) > 0
+}
+
+// diffFamily adds the series which differ between the given rendered metric
+// family before and after a change to the given delta, in the order of the
+// family.
+func diffFamily(d *Delta, before, after []byte) {
+	oldSeries := parseSeries(before)
+	oldValues := make(map[string]string, len(oldSeries))
+	for _, series := range oldSeries {
+		oldValues[series.Metric] = series.Value
+	}
+
+	newSeries := parseSeries(after)
+	newMetrics := make(map[string]struct{}, len(newSeries))
+	for _, series := range newSeries {
+		newMetrics[series.Metric] = struct{}{}
+
+		value, ok := oldValues[series.Metric]
+		switch {
+		case !ok:
+			d.Added = append(d.Added, series)
+		case value != series.Value:
+			d.Changed = append(d.Changed, series)
+		}
+	}
+
+	for _, series := range oldSeries {
+		if _, ok := newMetrics[series.Metric]; !ok {
+			d.Removed = append(d.Removed, series)
+		}
+	}
+}
+
+// parseSeries splits a rendered metric family into its series. The value is
+// separated by the last space of a line, as label values may contain spaces
+// but kube-state-metrics does not render timestamps.
+func parseSeries(family []byte) []Series {
+	var series []Series
+	for len(family) > 0 {
+		line := family
+		if i := bytes.IndexByte(family, '\n'); i >= 0 {
+			line, family = family[:i], family[i+1:]
+		} else {
+			family = nil
+		}
+
+		i := bytes.LastIndexByte(line, ' ')
+		if i < 0 {
+			continue
+		}
+		series = append(series, Series{Metric: string(line[:i]), Value: string(line[i+1:])})
+	}
+	return series
+}
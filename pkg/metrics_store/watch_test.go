@@ -0,0 +1,136 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metricsstore
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// recordingWatcher records the notifications of a store.
+type recordingWatcher struct {
+	deltas   []Delta
+	resynced int
+}
+
+func (w *recordingWatcher) Changed(d Delta) {
+	w.deltas = append(w.deltas, d)
+}
+
+func (w *recordingWatcher) Resynced() {
+	w.resynced++
+}
+
+func TestWatch(t *testing.T) {
+	// The labels of the service determine the series of the first family,
+	// its port the value of the second one.
+	genFunc := func(obj interface{}) []FamilyByteSlicer {
+		s := obj.(*v1.Service)
+
+		info := ""
+		for _, k := range []string{"a", "b"} {
+			if v, ok := s.Labels[k]; ok {
+				info += fmt.Sprintf("kube_service_labels{label_%s=\"%s\"} 1\n", k, v)
+			}
+		}
+
+		return []FamilyByteSlicer{
+			&metricFamily{[]byte(info)},
+			&metricFamily{[]byte(fmt.Sprintf("kube_service_port{service=\"%s\"} %d\n", s.Name, len(s.Spec.Ports)))},
+		}
+	}
+
+	headers := []FamilyHeader{
+		familyHeader{name: "kube_service_labels", text: "# TYPE kube_service_labels gauge"},
+		familyHeader{name: "kube_service_port", text: "# TYPE kube_service_port gauge"},
+	}
+	ms := NewMetricsStoreWithHeaders(headers, genFunc)
+	w := &recordingWatcher{}
+	ms.Watch(w)
+
+	service := &v1.Service{ObjectMeta: metav1.ObjectMeta{
+		Name:      "a",
+		Namespace: "default",
+		UID:       types.UID("a"),
+		Labels:    map[string]string{"a": "with space"},
+	}}
+	object := Object{UID: "a", Namespace: "default", Name: "a"}
+
+	if err := ms.Add(service); err != nil {
+		t.Fatal(err)
+	}
+	// Nothing changes.
+	if err := ms.Update(service); err != nil {
+		t.Fatal(err)
+	}
+
+	updated := service.DeepCopy()
+	updated.Labels = map[string]string{"b": "b"}
+	updated.Spec.Ports = []v1.ServicePort{{Port: 80}}
+	if err := ms.Update(updated); err != nil {
+		t.Fatal(err)
+	}
+	if err := ms.Delete(updated); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Delta{
+		{
+			Object: object,
+			Added: []Series{
+				{Metric: `kube_service_labels{label_a="with space"}`, Value: "1"},
+				{Metric: `kube_service_port{service="a"}`, Value: "0"},
+			},
+		},
+		{
+			Object:  object,
+			Added:   []Series{{Metric: `kube_service_labels{label_b="b"}`, Value: "1"}},
+			Changed: []Series{{Metric: `kube_service_port{service="a"}`, Value: "1"}},
+			Removed: []Series{{Metric: `kube_service_labels{label_a="with space"}`, Value: "1"}},
+		},
+		{
+			Object: object,
+			Removed: []Series{
+				{Metric: `kube_service_labels{label_b="b"}`, Value: "1"},
+				{Metric: `kube_service_port{service="a"}`, Value: "1"},
+			},
+		},
+	}
+	if !reflect.DeepEqual(w.deltas, want) {
+		t.Errorf("expected deltas:\n%+v\nbut got:\n%+v", want, w.deltas)
+	}
+
+	if err := ms.Replace([]interface{}{service}, ""); err != nil {
+		t.Fatal(err)
+	}
+	if len(w.deltas) != len(want) || w.resynced != 1 {
+		t.Errorf("expected a single resync and no deltas on replace, got %d resyncs and %d deltas", w.resynced, len(w.deltas)-len(want))
+	}
+
+	ms.Unwatch(w)
+	if err := ms.Delete(service); err != nil {
+		t.Fatal(err)
+	}
+	if len(w.deltas) != len(want) {
+		t.Errorf("expected no deltas after unwatching")
+	}
+}
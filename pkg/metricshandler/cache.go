@@ -0,0 +1,115 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metricshandler
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	metricsstore "k8s.io/kube-state-metrics/pkg/metrics_store"
+)
+
+// cacheKey identifies a cached response. Only unfiltered responses are
+// cached, thus there is at most one entry per exposition format and content
+// encoding.
+type cacheKey struct {
+	format metricsstore.Format
+	// encoding is the name of the content encoding of the body, or empty if
+	// it is not compressed.
+	encoding string
+}
+
+// cachedResponse is a rendered, possibly compressed, response body together
+// with the generations of the stores it was rendered from.
+type cachedResponse struct {
+	generations []uint64
+	body        []byte
+}
+
+// responseCache caches rendered responses until the generation of any store
+// changes.
+type responseCache struct {
+	mtx     sync.Mutex
+	entries map[cacheKey]*cachedResponse
+
+	requestsTotal *prometheus.CounterVec
+}
+
+func newResponseCache() *responseCache {
+	return &responseCache{
+		entries: map[cacheKey]*cachedResponse{},
+		requestsTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "kube_state_metrics_response_cache_requests_total",
+				Help: "Number of total /metrics requests looked up in the response cache in kube-state-metrics, by result (hit or miss).",
+			},
+			[]string{"result"},
+		),
+	}
+}
+
+// get returns the cached body for the given key if it was rendered from
+// stores with the given generations.
+func (c *responseCache) get(key cacheKey, generations []uint64) ([]byte, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok || !equalGenerations(entry.generations, generations) {
+		c.requestsTotal.WithLabelValues("miss").Inc()
+		return nil, false
+	}
+
+	c.requestsTotal.WithLabelValues("hit").Inc()
+	return entry.body, true
+}
+
+// set caches the given body for the given key, rendered from stores with the
+// given generations.
+func (c *responseCache) set(key cacheKey, generations []uint64, body []byte) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.entries[key] = &cachedResponse{
+		generations: generations,
+		body:        body,
+	}
+}
+
+// reset drops all cached responses, e.g. when the stores are rebuilt and
+// their generations are no longer comparable to the cached ones.
+func (c *responseCache) reset() {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.entries = map[cacheKey]*cachedResponse{}
+}
+
+func equalGenerations(a, b []uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
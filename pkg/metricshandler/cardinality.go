@@ -0,0 +1,66 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metricshandler
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	familySeriesDesc = prometheus.NewDesc(
+		"kube_state_metrics_family_series",
+		"Number of series of a metric family exposed by kube-state-metrics, by collector.",
+		[]string{"family", "collector"}, nil,
+	)
+	familyBytesDesc = prometheus.NewDesc(
+		"kube_state_metrics_family_bytes",
+		"Size in bytes of the metrics of a metric family kept in memory by kube-state-metrics, by collector.",
+		[]string{"family", "collector"}, nil,
+	)
+	familySeriesDroppedDesc = prometheus.NewDesc(
+		"kube_state_metrics_family_series_dropped_total",
+		"Number of total series of a metric family dropped by kube-state-metrics because a series limit was exceeded, by collector.",
+		[]string{"family", "collector"}, nil,
+	)
+)
+
+// cardinalityCollector is a prometheus.Collector exposing the cardinality of
+// the metric families of the stores of a MetricsHandler.
+type cardinalityCollector struct {
+	m *MetricsHandler
+}
+
+// Describe implements the prometheus.Collector interface.
+func (c cardinalityCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- familySeriesDesc
+	ch <- familyBytesDesc
+	ch <- familySeriesDroppedDesc
+}
+
+// Collect implements the prometheus.Collector interface.
+func (c cardinalityCollector) Collect(ch chan<- prometheus.Metric) {
+	c.m.mtx.RLock()
+	defer c.m.mtx.RUnlock()
+
+	for _, collector := range c.m.collectors {
+		for _, stats := range c.m.stores[collector].FamilyStats() {
+			ch <- prometheus.MustNewConstMetric(familySeriesDesc, prometheus.GaugeValue, float64(stats.Series), stats.Name, collector)
+			ch <- prometheus.MustNewConstMetric(familyBytesDesc, prometheus.GaugeValue, float64(stats.Bytes), stats.Name, collector)
+			ch <- prometheus.MustNewConstMetric(familySeriesDroppedDesc, prometheus.CounterValue, float64(stats.Dropped), stats.Name, collector)
+		}
+	}
+}
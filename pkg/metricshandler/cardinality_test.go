@@ -0,0 +1,99 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metricshandler
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	metricsstore "k8s.io/kube-state-metrics/pkg/metrics_store"
+	"k8s.io/kube-state-metrics/pkg/options"
+)
+
+func TestCardinalityCollector(t *testing.T) {
+	m := New(&options.Options{}, nil, nil, false)
+	pods := newTestStore(t, "kube_pod_info", 0)
+	pods.LimitSeries(map[string]int64{"kube_pod_info": 2}, 0)
+	m.stores = map[string]*metricsstore.MetricsStore{
+		"services": newTestStore(t, "kube_service_info", 3),
+		"pods":     pods,
+	}
+	m.collectors = []string{"pods", "services"}
+	for i := 0; i < 3; i++ {
+		err := pods.Add(&v1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("pod%d", i), Namespace: "default", UID: types.UID(fmt.Sprint(i))},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := prometheus.NewRegistry()
+	m.WithMetrics(r)
+	families, err := r.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]map[string]float64{
+		"kube_state_metrics_family_series": {
+			"kube_pod_info/pods":         2,
+			"kube_service_info/services": 3,
+		},
+		"kube_state_metrics_family_series_dropped_total": {
+			"kube_pod_info/pods":         1,
+			"kube_service_info/services": 0,
+		},
+		"kube_state_metrics_family_bytes": {
+			"kube_pod_info/pods":         float64(2 * len("kube_pod_info{uid=\"0\"} 1\n")),
+			"kube_service_info/services": float64(3 * len("kube_service_info{uid=\"0\"} 1\n")),
+		},
+	}
+	for _, f := range families {
+		values, ok := want[f.GetName()]
+		if !ok {
+			continue
+		}
+		delete(want, f.GetName())
+
+		got := map[string]float64{}
+		for _, metric := range f.GetMetric() {
+			labels := map[string]string{}
+			for _, l := range metric.GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+			value := metric.GetGauge().GetValue()
+			if metric.Counter != nil {
+				value = metric.GetCounter().GetValue()
+			}
+			got[labels["family"]+"/"+labels["collector"]] = value
+		}
+		for key, v := range values {
+			if got[key] != v {
+				t.Errorf("%s: expected %v for %v but got %v", f.GetName(), v, key, got[key])
+			}
+		}
+	}
+	for name := range want {
+		t.Errorf("expected metric family %v to be gathered", name)
+	}
+}
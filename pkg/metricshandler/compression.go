@@ -0,0 +1,150 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metricshandler
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// compressor is implemented by the streaming encoders of all supported
+// content encodings.
+type compressor interface {
+	io.Writer
+	// Reset discards the state of the compressor and makes it write to the
+	// given writer, allowing it to be reused.
+	Reset(io.Writer)
+	// Flush writes any pending compressed data to the underlying writer.
+	Flush() error
+	// Close flushes and finalizes the compressed stream.
+	Close() error
+}
+
+// contentEncoding is an HTTP content coding the metrics can be compressed
+// with. Compressors are pooled, as allocating them is expensive compared to
+// resetting them.
+type contentEncoding struct {
+	name string
+	pool *sync.Pool
+}
+
+var (
+	gzipEncoding = &contentEncoding{
+		name: "gzip",
+		pool: &sync.Pool{
+			New: func() interface{} { return gzip.NewWriter(nil) },
+		},
+	}
+
+	zstdEncoding = &contentEncoding{
+		name: "zstd",
+		pool: &sync.Pool{
+			New: func() interface{} {
+				// A single goroutine per encoder keeps memory usage
+				// predictable, scrapes are served concurrently anyway.
+				w, err := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+				if err != nil {
+					panic(err)
+				}
+				return w
+			},
+		},
+	}
+
+	// snappyEncoding uses the snappy framing format, which, in contrast to
+	// the block format, supports streaming.
+	snappyEncoding = &contentEncoding{
+		name: "snappy",
+		pool: &sync.Pool{
+			New: func() interface{} { return snappy.NewBufferedWriter(nil) },
+		},
+	}
+)
+
+// get returns a compressor of the encoding writing to the given writer.
+func (e *contentEncoding) get(w io.Writer) compressor {
+	c := e.pool.Get().(compressor)
+	c.Reset(w)
+	return c
+}
+
+// put returns the given compressor to the pool of the encoding. The
+// compressor has to be closed beforehand.
+func (e *contentEncoding) put(c compressor) {
+	// Do not keep a reference to the response writer in the pool.
+	c.Reset(nil)
+	e.pool.Put(c)
+}
+
+// flush writes pending data of the given compressor, if any, and flushes the
+// response writer, sending everything written so far to the client.
+func flush(w http.ResponseWriter, c compressor) {
+	if c != nil && c.Flush() != nil {
+		return
+	}
+
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// negotiateEncoding returns the content encoding to compress the response
+// with based on the Accept-Encoding header of the given request headers, or
+// nil if the response should not be compressed. The encoding with the highest
+// quality is chosen, on equal quality the order of the offered encodings
+// decides.
+func negotiateEncoding(h http.Header, offered []*contentEncoding) *contentEncoding {
+	if len(offered) == 0 {
+		return nil
+	}
+
+	qualities := map[string]float64{}
+	wildcardQ := -1.0
+
+	for _, accept := range h[http.CanonicalHeaderKey("Accept-Encoding")] {
+		for _, part := range strings.Split(accept, ",") {
+			coding, _, q := parseAcceptPart(part)
+			if coding == "*" {
+				wildcardQ = q
+				continue
+			}
+			qualities[coding] = q
+		}
+	}
+
+	var best *contentEncoding
+	bestQ := 0.0
+	for _, e := range offered {
+		q, ok := qualities[e.name]
+		if !ok {
+			q = wildcardQ
+		}
+
+		if q > bestQ {
+			best = e
+			bestQ = q
+		}
+	}
+
+	return best
+}
@@ -0,0 +1,211 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metricshandler
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"k8s.io/kube-state-metrics/pkg/metric"
+	metricsstore "k8s.io/kube-state-metrics/pkg/metrics_store"
+	"k8s.io/kube-state-metrics/pkg/options"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	all := []*contentEncoding{zstdEncoding, gzipEncoding, snappyEncoding}
+
+	tests := []struct {
+		acceptEncoding string
+		offered        []*contentEncoding
+		want           *contentEncoding
+	}{
+		{
+			acceptEncoding: "gzip",
+			offered:        nil,
+			want:           nil,
+		},
+		{
+			acceptEncoding: "",
+			offered:        all,
+			want:           nil,
+		},
+		{
+			acceptEncoding: "gzip",
+			offered:        all,
+			want:           gzipEncoding,
+		},
+		{
+			acceptEncoding: "gzip, zstd",
+			offered:        all,
+			want:           zstdEncoding,
+		},
+		{
+			acceptEncoding: "gzip;q=1.0, zstd;q=0.5",
+			offered:        all,
+			want:           gzipEncoding,
+		},
+		{
+			acceptEncoding: "snappy, gzip;q=0",
+			offered:        []*contentEncoding{gzipEncoding},
+			want:           nil,
+		},
+		{
+			acceptEncoding: "*",
+			offered:        []*contentEncoding{gzipEncoding, snappyEncoding},
+			want:           gzipEncoding,
+		},
+		{
+			acceptEncoding: "identity",
+			offered:        all,
+			want:           nil,
+		},
+	}
+
+	for _, test := range tests {
+		h := http.Header{}
+		h.Set("Accept-Encoding", test.acceptEncoding)
+
+		if got := negotiateEncoding(h, test.offered); got != test.want {
+			t.Errorf("accept-encoding %q: expected %v but got %v", test.acceptEncoding, test.want, got)
+		}
+	}
+}
+
+func TestServeHTTPCompression(t *testing.T) {
+	opts := &options.Options{
+		EnableZstdEncoding:   true,
+		EnableSnappyEncoding: true,
+	}
+	m := New(opts, nil, nil, true)
+	m.stores = map[string]*metricsstore.MetricsStore{
+		"services": newTestStore(t, "kube_service_info", 100),
+		"pods":     newTestStore(t, "kube_pod_info", 100),
+	}
+	m.collectors = []string{"pods", "services"}
+
+	uncompressed := serve(m, "")
+	if !strings.Contains(uncompressed, `kube_pod_info{uid="99"} 1`) {
+		t.Fatalf("expected uncompressed response to contain metrics, got:\n%v", uncompressed)
+	}
+
+	decoders := map[string]func(io.Reader) (io.Reader, error){
+		"gzip": func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+		"zstd": func(r io.Reader) (io.Reader, error) { return zstd.NewReader(r) },
+		"snappy": func(r io.Reader) (io.Reader, error) {
+			return snappy.NewReader(r), nil
+		},
+	}
+
+	for encoding, decoder := range decoders {
+		// Serve twice to cover compressors reused from the pool.
+		for i := 0; i < 2; i++ {
+			req := httptest.NewRequest("GET", "http://localhost:8080/metrics", nil)
+			req.Header.Set("Accept-Encoding", encoding)
+			w := httptest.NewRecorder()
+			m.ServeHTTP(w, req)
+
+			resp := w.Result()
+			if got := resp.Header.Get("Content-Encoding"); got != encoding {
+				t.Fatalf("expected content encoding %q but got %q", encoding, got)
+			}
+
+			r, err := decoder(resp.Body)
+			if err != nil {
+				t.Fatalf("%v: failed to create decoder: %v", encoding, err)
+			}
+			body, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatalf("%v: failed to decode response: %v", encoding, err)
+			}
+
+			// The order of objects within a store is not deterministic.
+			if !reflect.DeepEqual(sortedLines(string(body)), sortedLines(uncompressed)) {
+				t.Fatalf("%v: expected decoded response to equal uncompressed response", encoding)
+			}
+		}
+	}
+}
+
+func serve(m *MetricsHandler, acceptEncoding string) string {
+	req := httptest.NewRequest("GET", "http://localhost:8080/metrics", nil)
+	if acceptEncoding != "" {
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, req)
+
+	return w.Body.String()
+}
+
+func sortedLines(s string) []string {
+	lines := strings.Split(s, "\n")
+	sort.Strings(lines)
+	return lines
+}
+
+func newTestStore(t *testing.T, name string, objects int) *metricsstore.MetricsStore {
+	generators := []metric.FamilyGenerator{
+		{
+			Name: name,
+			Type: metric.Gauge,
+			Help: "Information about the object.",
+			GenerateFunc: func(obj interface{}) *metric.Family {
+				return &metric.Family{
+					Metrics: []*metric.Metric{{
+						LabelKeys:   []string{"uid"},
+						LabelValues: []string{string(obj.(*v1.Service).UID)},
+						Value:       1,
+					}},
+				}
+			},
+		},
+	}
+
+	s := metricsstore.NewMetricsStoreWithHeaders(
+		metric.ExtractMetricFamilyFormatHeaders(generators),
+		metric.ComposeMetricGenFuncs(generators),
+	)
+
+	for i := 0; i < objects; i++ {
+		err := s.Add(&v1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      fmt.Sprintf("service%d", i),
+				Namespace: "default",
+				UID:       types.UID(fmt.Sprintf("%d", i)),
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return s
+}
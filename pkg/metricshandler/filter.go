@@ -0,0 +1,96 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metricshandler
+
+import (
+	"net/url"
+	"strings"
+)
+
+const (
+	// nameParam is the query parameter restricting a scrape to metric
+	// families with the given names, following the convention of the
+	// Prometheus federation endpoint.
+	nameParam = "name[]"
+	// collectorParam is the query parameter restricting a scrape to the
+	// stores of the given collectors.
+	collectorParam = "collector"
+)
+
+// scrapeFilter restricts the metrics written by a single scrape to a subset
+// of collectors and metric families. An empty set does not restrict anything.
+type scrapeFilter struct {
+	names      map[string]struct{}
+	collectors map[string]struct{}
+}
+
+// newScrapeFilter parses the scrape filter from the given query parameters.
+// Each parameter can be given multiple times and contain a comma separated
+// list of values.
+func newScrapeFilter(query url.Values) scrapeFilter {
+	return scrapeFilter{
+		names:      parseSet(query[nameParam]),
+		collectors: parseSet(query[collectorParam]),
+	}
+}
+
+// empty returns whether the filter does not restrict anything.
+func (f scrapeFilter) empty() bool {
+	return len(f.names) == 0 && len(f.collectors) == 0
+}
+
+// includesCollector returns whether the store of the given collector is
+// written.
+func (f scrapeFilter) includesCollector(collector string) bool {
+	return includes(f.collectors, collector)
+}
+
+// familyFilter returns the function deciding which metric families of a store
+// are written, or nil if all are.
+func (f scrapeFilter) familyFilter() func(name string) bool {
+	if len(f.names) == 0 {
+		return nil
+	}
+
+	return func(name string) bool {
+		return includes(f.names, name)
+	}
+}
+
+func includes(set map[string]struct{}, s string) bool {
+	if len(set) == 0 {
+		return true
+	}
+
+	_, ok := set[s]
+	return ok
+}
+
+func parseSet(values []string) map[string]struct{} {
+	set := map[string]struct{}{}
+
+	for _, v := range values {
+		for _, s := range strings.Split(v, ",") {
+			s = strings.TrimSpace(s)
+			if s != "" {
+				set[s] = struct{}{}
+			}
+		}
+	}
+
+	return set
+}
@@ -0,0 +1,133 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metricshandler
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	metricsstore "k8s.io/kube-state-metrics/pkg/metrics_store"
+	"k8s.io/kube-state-metrics/pkg/options"
+)
+
+func TestScrapeFilter(t *testing.T) {
+	tests := []struct {
+		query      string
+		collectors map[string]bool
+		names      map[string]bool
+	}{
+		{
+			query:      "",
+			collectors: map[string]bool{"pods": true, "nodes": true},
+			names:      map[string]bool{"kube_pod_info": true},
+		},
+		{
+			query:      "collector=pods,nodes",
+			collectors: map[string]bool{"pods": true, "nodes": true, "services": false},
+			names:      map[string]bool{"kube_pod_info": true},
+		},
+		{
+			query:      "collector=pods&collector=nodes",
+			collectors: map[string]bool{"pods": true, "nodes": true, "services": false},
+		},
+		{
+			query:      "name[]=kube_pod_status_phase&name[]=kube_node_info",
+			collectors: map[string]bool{"pods": true},
+			names:      map[string]bool{"kube_pod_status_phase": true, "kube_node_info": true, "kube_pod_info": false},
+		},
+		{
+			query: "name%5B%5D=kube_pod_status_phase",
+			names: map[string]bool{"kube_pod_status_phase": true, "kube_pod_info": false},
+		},
+	}
+
+	for _, test := range tests {
+		query, err := url.ParseQuery(test.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f := newScrapeFilter(query)
+
+		for c, want := range test.collectors {
+			if got := f.includesCollector(c); got != want {
+				t.Errorf("query %q: expected collector %v to be included: %v, got %v", test.query, c, want, got)
+			}
+		}
+
+		include := f.familyFilter()
+		for name, want := range test.names {
+			got := include == nil || include(name)
+			if got != want {
+				t.Errorf("query %q: expected family %v to be included: %v, got %v", test.query, name, want, got)
+			}
+		}
+	}
+}
+
+func TestServeHTTPFilter(t *testing.T) {
+	m := New(&options.Options{}, nil, nil, false)
+	m.stores = map[string]*metricsstore.MetricsStore{
+		"services": newTestStore(t, "kube_service_info", 1),
+		"pods":     newTestStore(t, "kube_pod_info", 1),
+	}
+	m.collectors = []string{"pods", "services"}
+
+	tests := []struct {
+		url  string
+		want []string
+		not  []string
+	}{
+		{
+			url:  "/metrics",
+			want: []string{"kube_service_info", "kube_pod_info"},
+		},
+		{
+			url:  "/metrics?collector=pods",
+			want: []string{"kube_pod_info"},
+			not:  []string{"kube_service_info"},
+		},
+		{
+			url:  "/metrics?name[]=kube_service_info",
+			want: []string{"kube_service_info"},
+			not:  []string{"kube_pod_info"},
+		},
+		{
+			url: "/metrics?collector=pods&name[]=kube_service_info",
+			not: []string{"kube_service_info", "kube_pod_info"},
+		},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "http://localhost:8080"+test.url, nil)
+		w := httptest.NewRecorder()
+		m.ServeHTTP(w, req)
+		body := w.Body.String()
+
+		for _, name := range test.want {
+			if !strings.Contains(body, "# TYPE "+name) {
+				t.Errorf("%v: expected response to contain family %v, got:\n%v", test.url, name, body)
+			}
+		}
+		for _, name := range test.not {
+			if strings.Contains(body, name) {
+				t.Errorf("%v: expected response not to contain family %v, got:\n%v", test.url, name, body)
+			}
+		}
+	}
+}
@@ -0,0 +1,103 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metricshandler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	metricsstore "k8s.io/kube-state-metrics/pkg/metrics_store"
+)
+
+const (
+	openMetricsMediaType = "application/openmetrics-text"
+	protobufMediaType    = "application/vnd.google.protobuf"
+	protobufProto        = "io.prometheus.client.MetricFamily"
+	protobufEncoding     = "delimited"
+)
+
+// negotiateFormat returns the exposition format to respond with based on the
+// Accept header of the given request headers. The format with the highest
+// quality is chosen, preferring protobuf (if enabled) over OpenMetrics over
+// the Prometheus text format, which is the default.
+func negotiateFormat(h http.Header, enableProtobuf bool) metricsstore.Format {
+	var protobufQ, openMetricsQ, textQ float64 = -1, -1, -1
+
+	for _, accept := range h[http.CanonicalHeaderKey("Accept")] {
+		for _, part := range strings.Split(accept, ",") {
+			mediaType, params, q := parseAcceptPart(part)
+
+			switch mediaType {
+			case protobufMediaType:
+				if params["proto"] == protobufProto && params["encoding"] == protobufEncoding && q > protobufQ {
+					protobufQ = q
+				}
+			case openMetricsMediaType:
+				if q > openMetricsQ {
+					openMetricsQ = q
+				}
+			case "text/plain", "text/*", "*/*":
+				if q > textQ {
+					textQ = q
+				}
+			}
+		}
+	}
+
+	if enableProtobuf && protobufQ > 0 && protobufQ >= openMetricsQ && protobufQ >= textQ {
+		return metricsstore.FormatProtobuf
+	}
+
+	if openMetricsQ > 0 && openMetricsQ >= textQ {
+		return metricsstore.FormatOpenMetrics
+	}
+
+	return metricsstore.FormatText
+}
+
+// parseAcceptPart parses a single media range of an Accept header, e.g.
+// "text/plain;version=0.0.4;q=0.5", and returns its media type, its parameters
+// and its quality.
+func parseAcceptPart(part string) (string, map[string]string, float64) {
+	fields := strings.Split(part, ";")
+	mediaType := strings.ToLower(strings.TrimSpace(fields[0]))
+	params := map[string]string{}
+	q := 1.0
+
+	for _, field := range fields[1:] {
+		kv := strings.SplitN(strings.TrimSpace(field), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+
+		key := strings.ToLower(strings.TrimSpace(kv[0]))
+		value := strings.TrimSpace(kv[1])
+		if key != "q" {
+			params[key] = value
+			continue
+		}
+
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			continue
+		}
+		q = parsed
+	}
+
+	return mediaType, params, q
+}
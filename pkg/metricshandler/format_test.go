@@ -0,0 +1,89 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metricshandler
+
+import (
+	"net/http"
+	"testing"
+
+	metricsstore "k8s.io/kube-state-metrics/pkg/metrics_store"
+)
+
+func TestNegotiateFormat(t *testing.T) {
+	tests := []struct {
+		accept         string
+		enableProtobuf bool
+		want           metricsstore.Format
+	}{
+		{
+			accept: "",
+			want:   metricsstore.FormatText,
+		},
+		{
+			accept: "text/plain;version=0.0.4;q=1,*/*;q=0.1",
+			want:   metricsstore.FormatText,
+		},
+		{
+			accept: "application/openmetrics-text; version=1.0.0",
+			want:   metricsstore.FormatOpenMetrics,
+		},
+		{
+			// Accept header sent by Prometheus 2.5+.
+			accept: "application/openmetrics-text;version=1.0.0,application/openmetrics-text;version=0.0.1;q=0.75,text/plain;version=0.0.4;q=0.5,*/*;q=0.1",
+			want:   metricsstore.FormatOpenMetrics,
+		},
+		{
+			accept: "application/openmetrics-text;q=0.3,text/plain;q=0.5",
+			want:   metricsstore.FormatText,
+		},
+		{
+			accept: "application/openmetrics-text;q=0",
+			want:   metricsstore.FormatText,
+		},
+		{
+			accept:         "application/vnd.google.protobuf;proto=io.prometheus.client.MetricFamily;encoding=delimited;q=0.7,text/plain;version=0.0.4;q=0.3,*/*;q=0.1",
+			enableProtobuf: true,
+			want:           metricsstore.FormatProtobuf,
+		},
+		{
+			accept:         "application/vnd.google.protobuf;proto=io.prometheus.client.MetricFamily;encoding=delimited;q=0.7,text/plain;version=0.0.4;q=0.3,*/*;q=0.1",
+			enableProtobuf: false,
+			want:           metricsstore.FormatText,
+		},
+		{
+			accept:         "application/vnd.google.protobuf;proto=io.prometheus.client.MetricFamily;encoding=text",
+			enableProtobuf: true,
+			want:           metricsstore.FormatText,
+		},
+		{
+			accept:         "application/vnd.google.protobuf;proto=io.prometheus.client.MetricFamily;encoding=delimited;q=0.5,application/openmetrics-text;version=1.0.0",
+			enableProtobuf: true,
+			want:           metricsstore.FormatOpenMetrics,
+		},
+	}
+
+	for _, test := range tests {
+		h := http.Header{}
+		if test.accept != "" {
+			h.Set("Accept", test.accept)
+		}
+
+		if got := negotiateFormat(h, test.enableProtobuf); got != test.want {
+			t.Errorf("accept %q: expected format %v but got %v", test.accept, test.want, got)
+		}
+	}
+}
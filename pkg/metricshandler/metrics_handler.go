@@ -17,15 +17,17 @@ limitations under the License.
 package metricshandler
 
 import (
-	"compress/gzip"
+	"bytes"
 	"context"
 	"io"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
 
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
 	appsv1 "k8s.io/api/apps/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/fields"
@@ -41,28 +43,81 @@ import (
 // MetricsHandler is a http.Handler that exposes the main kube-state-metrics
 // /metrics endpoint. It allows concurrent reconfiguration at runtime.
 type MetricsHandler struct {
-	opts               *options.Options
-	kubeClient         kubernetes.Interface
-	storeBuilder       *store.Builder
-	enableGZIPEncoding bool
+	opts         *options.Options
+	kubeClient   kubernetes.Interface
+	storeBuilder *store.Builder
+	// encodings contains the content encodings responses can be compressed
+	// with, in order of preference.
+	encodings []*contentEncoding
+	// cache caches unfiltered responses, it is nil if caching is disabled.
+	cache *responseCache
+	// watchHub distributes the changes of the stores to the clients of the
+	// watch stream.
+	watchHub *watchHub
 
 	cancel func()
 
-	// mtx protects stores, curShard, and curTotalShards
-	mtx            *sync.RWMutex
-	stores         []*metricsstore.MetricsStore
+	// mtx protects ctx, stores, storeCancels, storeWatchers, collectors,
+	// syncStatus, curShard, and curTotalShards
+	mtx *sync.RWMutex
+	// ctx is the context of the current sharding configuration, from which
+	// the contexts of the stores are derived.
+	ctx    context.Context
+	stores map[string]*metricsstore.MetricsStore
+	// storeCancels contains the functions stopping the reflectors of each
+	// store, so that stores can be rebuilt independently by Reconfigure.
+	storeCancels map[string]func()
+	// storeWatchers contains the watchers of the stores publishing their
+	// changes to watchHub, only registered while it has clients.
+	storeWatchers map[string]*storeWatcher
+	// collectors contains the names of the collectors of stores in sorted
+	// order, in which they are written.
+	collectors     []string
+	syncStatus     store.SyncStatus
 	curShard       int32
 	curTotalShards int
 }
 
 // New creates and returns a new MetricsHandler with the given options.
 func New(opts *options.Options, kubeClient kubernetes.Interface, storeBuilder *store.Builder, enableGZIPEncoding bool) *MetricsHandler {
+	encodings := []*contentEncoding{}
+	if opts.EnableZstdEncoding {
+		encodings = append(encodings, zstdEncoding)
+	}
+	if enableGZIPEncoding {
+		encodings = append(encodings, gzipEncoding)
+	}
+	if opts.EnableSnappyEncoding {
+		encodings = append(encodings, snappyEncoding)
+	}
+
+	var cache *responseCache
+	if opts.EnableResponseCache {
+		cache = newResponseCache()
+	}
+
 	return &MetricsHandler{
-		opts:               opts,
-		kubeClient:         kubeClient,
-		storeBuilder:       storeBuilder,
-		enableGZIPEncoding: enableGZIPEncoding,
-		mtx:                &sync.RWMutex{},
+		opts:          opts,
+		kubeClient:    kubeClient,
+		storeBuilder:  storeBuilder,
+		encodings:     encodings,
+		cache:         cache,
+		watchHub:      newWatchHub(opts.WatchBufferSize),
+		storeWatchers: map[string]*storeWatcher{},
+		mtx:           &sync.RWMutex{},
+	}
+}
+
+// WithMetrics registers the metrics about the MetricsHandler itself, e.g. the
+// response cache hits and the cardinality of the metric families, with the
+// given registry.
+func (m *MetricsHandler) WithMetrics(r *prometheus.Registry) {
+	if m.cache != nil {
+		r.MustRegister(m.cache.requestsTotal)
+	}
+	r.MustRegister(m.watchHub.eventsTotal, m.watchHub.clientCount, cardinalityCollector{m: m})
+	if m.opts.SnapshotDir != "" {
+		r.MustRegister(snapshotCollector{m: m})
 	}
 }
 
@@ -78,18 +133,92 @@ func (m *MetricsHandler) ConfigureSharding(ctx context.Context, shard int32, tot
 	if totalShards != 1 {
 		klog.Infof("configuring sharding of this instance to be shard index %d (zero-indexed) out of %d total shards", shard, totalShards)
 	}
-	ctx, m.cancel = context.WithCancel(ctx)
+	m.ctx, m.cancel = context.WithCancel(ctx)
 	m.storeBuilder.WithSharding(shard, totalShards)
-	m.storeBuilder.WithContext(ctx)
-	m.stores = m.storeBuilder.Build()
+	for c := range m.stores {
+		m.removeStore(c)
+	}
+	m.stores = map[string]*metricsstore.MetricsStore{}
+	m.storeCancels = map[string]func(){}
+	m.storeWatchers = map[string]*storeWatcher{}
+	m.syncStatus = store.SyncStatus{}
+	collectors := m.storeBuilder.Collectors()
+	m.buildStores(collectors)
+	// Snapshots are only restored on startup, as they are outdated or of
+	// another configuration once stores are rebuilt at runtime.
+	m.storeBuilder.WithSnapshotDir("")
+	klog.Infof("Active collectors: %s", strings.Join(collectors, ","))
+	m.storesChanged()
 	m.curShard = shard
 	m.curTotalShards = totalShards
 }
 
+// buildStores builds the stores of the given collectors, replacing their
+// current stores, if any. Each store is built with its own context derived
+// from the context of the current sharding configuration, so that its
+// reflectors can be stopped independently of the other stores. The caller has
+// to hold the write lock of mtx.
+func (m *MetricsHandler) buildStores(collectors []string) {
+	for _, c := range collectors {
+		m.removeStore(c)
+
+		ctx, cancel := context.WithCancel(m.ctx)
+		m.storeBuilder.WithContext(ctx)
+		s, ok := m.storeBuilder.BuildCollectors([]string{c})[c]
+		if !ok {
+			cancel()
+			continue
+		}
+		m.stores[c] = s
+		m.storeCancels[c] = cancel
+		if m.watchHub.subscribed() {
+			m.watchStore(c)
+		}
+		m.syncStatus[c] = m.storeBuilder.SyncStatus()[c]
+	}
+}
+
+// removeStore stops the reflectors of the store of the given collector and
+// removes it. The store is not watched anymore, as the retained metrics of
+// deleted objects still expire afterwards. The caller has to hold the write
+// lock of mtx.
+func (m *MetricsHandler) removeStore(c string) {
+	if cancel, ok := m.storeCancels[c]; ok {
+		cancel()
+	}
+	if w, ok := m.storeWatchers[c]; ok {
+		m.stores[c].Unwatch(w)
+	}
+	delete(m.stores, c)
+	delete(m.storeCancels, c)
+	delete(m.storeWatchers, c)
+	delete(m.syncStatus, c)
+}
+
+// storesChanged updates the sorted collectors after stores were built or
+// removed, resets the response cache and makes the clients of the watch
+// stream resync. The caller has to hold the write lock of mtx.
+func (m *MetricsHandler) storesChanged() {
+	m.collectors = make([]string, 0, len(m.stores))
+	for c := range m.stores {
+		m.collectors = append(m.collectors, c)
+	}
+	sort.Strings(m.collectors)
+	if m.cache != nil {
+		m.cache.reset()
+	}
+	m.watchHub.resync()
+}
+
 // Run configures the MetricsHandler's sharding and if autosharding is enabled
-// re-configures sharding on re-sharding events. Run should only be called
-// once.
+// re-configures sharding on re-sharding events. If a snapshot directory is
+// configured, it periodically writes snapshots of the stores. Run should only
+// be called once.
 func (m *MetricsHandler) Run(ctx context.Context) error {
+	if m.opts.SnapshotDir != "" {
+		go m.runSnapshots(ctx)
+	}
+
 	autoSharding := len(m.opts.Pod) > 0 && len(m.opts.Namespace) > 0
 
 	if !autoSharding {
@@ -175,36 +304,141 @@ func (m *MetricsHandler) Run(ctx context.Context) error {
 }
 
 // ServeHTTP implements the http.Handler interface. It writes the metrics in
-// its stores to the response body.
+// its stores to the response body, compressed if requested by the client.
+// The response is flushed after each store, streaming it to the client. The
+// "collector" and "name[]" query parameters restrict the response to the
+// given collectors and metric families.
 func (m *MetricsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.serve(w, r, m.cache, func(s *metricsstore.MetricsStore, w io.Writer, f metricsstore.Format, include func(string) bool) {
+		s.WriteFamilies(w, f, include)
+	})
+}
+
+// NamespaceHandler returns a http.Handler serving the metrics of the objects
+// in a single namespace like ServeHTTP. The namespace is the path of the
+// request, which is expected to have the path of the endpoint stripped, e.g.
+// by http.StripPrefix.
+func (m *MetricsHandler) NamespaceHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		namespace := r.URL.Path
+		if namespace == "" || strings.Contains(namespace, "/") {
+			http.NotFound(w, r)
+			return
+		}
+
+		m.serve(w, r, nil, func(s *metricsstore.MetricsStore, w io.Writer, f metricsstore.Format, include func(string) bool) {
+			s.WriteNamespaceFamilies(w, f, namespace, include)
+		})
+	})
+}
+
+// serve writes the response of a scrape, using the given function to write
+// the metrics of each store. Unfiltered responses are served from and added
+// to the given cache, unless it is nil.
+func (m *MetricsHandler) serve(w http.ResponseWriter, r *http.Request, cache *responseCache, write func(*metricsstore.MetricsStore, io.Writer, metricsstore.Format, func(string) bool)) {
 	m.mtx.RLock()
 	defer m.mtx.RUnlock()
 	resHeader := w.Header()
 	var writer io.Writer = w
 
-	resHeader.Set("Content-Type", `text/plain; version=`+"0.0.4")
-
-	if m.enableGZIPEncoding {
-		// Gzip response if requested. Taken from
-		// github.com/prometheus/client_golang/prometheus/promhttp.decorateWriter.
-		reqHeader := r.Header.Get("Accept-Encoding")
-		parts := strings.Split(reqHeader, ",")
-		for _, part := range parts {
-			part = strings.TrimSpace(part)
-			if part == "gzip" || strings.HasPrefix(part, "gzip;") {
-				writer = gzip.NewWriter(writer)
-				resHeader.Set("Content-Encoding", "gzip")
-			}
+	format := negotiateFormat(r.Header, m.opts.EnableProtobufEncoding)
+	resHeader.Set("Content-Type", format.ContentType())
+
+	if len(m.encodings) > 0 {
+		resHeader.Add("Vary", "Accept-Encoding")
+	}
+	encoding := negotiateEncoding(r.Header, m.encodings)
+	if encoding != nil {
+		resHeader.Set("Content-Encoding", encoding.name)
+	}
+
+	filter := newScrapeFilter(r.URL.Query())
+	if !filter.empty() {
+		cache = nil
+	}
+
+	var (
+		key         cacheKey
+		generations []uint64
+		body        *bytes.Buffer
+	)
+	if cache != nil {
+		key = cacheKey{format: format}
+		if encoding != nil {
+			key.encoding = encoding.name
 		}
+
+		// The generations have to be retrieved before writing the stores, so
+		// that changes while writing invalidate the cached response.
+		generations = make([]uint64, len(m.collectors))
+		for i, collector := range m.collectors {
+			generations[i] = m.stores[collector].Generation()
+		}
+
+		if cached, ok := cache.get(key, generations); ok {
+			w.Write(cached)
+			return
+		}
+
+		body = &bytes.Buffer{}
+		// The body is written to first, so that it is complete even if
+		// writing to the client fails.
+		writer = io.MultiWriter(body, w)
 	}
 
-	for _, s := range m.stores {
-		s.WriteAll(w)
+	var c compressor
+	if encoding != nil {
+		c = encoding.get(writer)
+		defer encoding.put(c)
+		writer = c
 	}
 
-	// In case we gzipped the response, we have to close the writer.
-	if closer, ok := writer.(io.Closer); ok {
-		closer.Close()
+	include := filter.familyFilter()
+	for _, collector := range m.collectors {
+		if !filter.includesCollector(collector) {
+			continue
+		}
+
+		write(m.stores[collector], writer, format, include)
+		flush(w, c)
+	}
+	format.WriteTrailer(writer)
+
+	// In case we compressed the response, we have to close the compressor to
+	// write the end of the stream.
+	if c != nil {
+		if err := c.Close(); err != nil {
+			klog.V(4).Infof("failed to finish compressed response: %v", err)
+			return
+		}
+	}
+
+	if cache != nil {
+		cache.set(key, generations, body.Bytes())
+	}
+}
+
+// WriteAll writes the metrics of all stores into the given writer in the
+// Prometheus text format.
+func (m *MetricsHandler) WriteAll(w io.Writer) {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+
+	for _, collector := range m.collectors {
+		m.stores[collector].WriteAll(w)
+	}
+}
+
+// WalkFamilies calls f for each object of each store with its generated metric
+// families, see metricsstore.MetricsStore.WalkFamilies.
+func (m *MetricsHandler) WalkFamilies(f func(collector string, o metricsstore.Object, families []metricsstore.FamilyByteSlicer)) {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+
+	for _, collector := range m.collectors {
+		m.stores[collector].WalkFamilies(func(o metricsstore.Object, families []metricsstore.FamilyByteSlicer) {
+			f(collector, o, families)
+		})
 	}
 }
 
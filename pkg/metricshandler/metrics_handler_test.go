@@ -0,0 +1,252 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metricshandler
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	metricsstore "k8s.io/kube-state-metrics/pkg/metrics_store"
+	"k8s.io/kube-state-metrics/pkg/options"
+)
+
+func TestNamespaceHandler(t *testing.T) {
+	m := New(&options.Options{}, nil, nil, false)
+	m.stores = map[string]*metricsstore.MetricsStore{
+		"services": newTestStore(t, "kube_service_info", 3),
+	}
+	m.collectors = []string{"services"}
+
+	h := http.StripPrefix("/metrics/namespaces/", m.NamespaceHandler())
+
+	tests := []struct {
+		url    string
+		status int
+		want   string
+	}{
+		{
+			url:    "/metrics/namespaces/default",
+			status: http.StatusOK,
+			want:   `kube_service_info{uid="1"} 1`,
+		},
+		{
+			url:    "/metrics/namespaces/kube-system",
+			status: http.StatusOK,
+		},
+		{
+			url:    "/metrics/namespaces/",
+			status: http.StatusNotFound,
+		},
+		{
+			url:    "/metrics/namespaces/default/pods",
+			status: http.StatusNotFound,
+		},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "http://localhost:8080"+test.url, nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		if w.Code != test.status {
+			t.Errorf("%v: expected status %v but got %v", test.url, test.status, w.Code)
+		}
+		if test.status != http.StatusOK {
+			continue
+		}
+
+		body := w.Body.String()
+		if test.want == "" && body != "" {
+			t.Errorf("%v: expected empty response but got:\n%v", test.url, body)
+		}
+		if !strings.Contains(body, test.want) {
+			t.Errorf("%v: expected response to contain %v, got:\n%v", test.url, test.want, body)
+		}
+	}
+}
+
+func TestServeHTTPCache(t *testing.T) {
+	m := New(&options.Options{EnableResponseCache: true}, nil, nil, true)
+	services := newTestStore(t, "kube_service_info", 3)
+	m.stores = map[string]*metricsstore.MetricsStore{
+		"services": services,
+	}
+	m.collectors = []string{"services"}
+
+	first := serve(m, "")
+	if got := serve(m, ""); got != first {
+		t.Errorf("expected cached response:\n%v\nbut got:\n%v", first, got)
+	}
+	expectCacheRequests(t, m, 1, 1)
+
+	err := services.Add(&v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "new", Namespace: "default", UID: types.UID("new")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := serve(m, ""); !strings.Contains(got, `kube_service_info{uid="new"} 1`) {
+		t.Errorf("expected response to contain added object, got:\n%v", got)
+	}
+	expectCacheRequests(t, m, 1, 2)
+
+	// Filtered responses are not cached.
+	req := httptest.NewRequest("GET", "http://localhost:8080/metrics?collector=services", nil)
+	m.ServeHTTP(httptest.NewRecorder(), req)
+	expectCacheRequests(t, m, 1, 2)
+
+	// Compressed responses are cached compressed.
+	var bodies []string
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest("GET", "http://localhost:8080/metrics", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		m.ServeHTTP(w, req)
+
+		if got := w.Header().Get("Content-Encoding"); got != "gzip" {
+			t.Fatalf("expected content encoding gzip but got %q", got)
+		}
+
+		r, err := gzip.NewReader(w.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bodies = append(bodies, string(body))
+	}
+	if bodies[0] != bodies[1] {
+		t.Errorf("expected cached compressed response:\n%v\nbut got:\n%v", bodies[0], bodies[1])
+	}
+	expectCacheRequests(t, m, 2, 3)
+}
+
+func TestServeHTTPCacheDuringReplace(t *testing.T) {
+	m := New(&options.Options{EnableResponseCache: true}, nil, nil, true)
+	services := newTestStore(t, "kube_service_info", 2)
+	m.stores = map[string]*metricsstore.MetricsStore{
+		"services": services,
+	}
+	m.collectors = []string{"services"}
+
+	// The relist is paused while adding its first object, after the store
+	// was emptied.
+	paused := make(chan struct{})
+	resume := make(chan struct{})
+	var once sync.Once
+	services.ObserveUpdates(func(metricsstore.UpdateResult) {
+		once.Do(func() {
+			close(paused)
+			<-resume
+		})
+	})
+
+	var list []interface{}
+	for i := 0; i < 2; i++ {
+		list = append(list, &v1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      fmt.Sprintf("service%d", i),
+				Namespace: "default",
+				UID:       types.UID(fmt.Sprintf("%d", i)),
+			},
+		})
+	}
+	replaced := make(chan error)
+	go func() {
+		replaced <- services.Replace(list, "")
+	}()
+	<-paused
+
+	scraped := make(chan struct{})
+	go func() {
+		serve(m, "")
+		close(scraped)
+	}()
+	for cacheRequests(t, m, "miss") == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	close(resume)
+	<-scraped
+	if err := <-replaced; err != nil {
+		t.Fatal(err)
+	}
+
+	got := serve(m, "")
+	expectCacheRequests(t, m, 0, 2)
+	for _, want := range []string{`kube_service_info{uid="0"} 1`, `kube_service_info{uid="1"} 1`} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected response to contain %v, got:\n%v", want, got)
+		}
+	}
+}
+
+func expectCacheRequests(t *testing.T, m *MetricsHandler, hits, misses float64) {
+	t.Helper()
+
+	for result, want := range map[string]float64{"hit": hits, "miss": misses} {
+		if got := cacheRequests(t, m, result); got != want {
+			t.Errorf("expected %v cache requests with result %v but got %v", want, result, got)
+		}
+	}
+}
+
+func cacheRequests(t *testing.T, m *MetricsHandler, result string) float64 {
+	t.Helper()
+
+	metric := &dto.Metric{}
+	if err := m.cache.requestsTotal.WithLabelValues(result).Write(metric); err != nil {
+		t.Fatal(err)
+	}
+	return metric.GetCounter().GetValue()
+}
+
+func TestWriteAll(t *testing.T) {
+	m := New(&options.Options{}, nil, nil, false)
+	m.stores = map[string]*metricsstore.MetricsStore{
+		"services": newTestStore(t, "kube_service_info", 1),
+		"pods":     newTestStore(t, "kube_pod_info", 1),
+	}
+	m.collectors = []string{"pods", "services"}
+
+	w := strings.Builder{}
+	m.WriteAll(&w)
+
+	want := `# HELP kube_pod_info Information about the object.
+# TYPE kube_pod_info gauge
+kube_pod_info{uid="0"} 1
+# HELP kube_service_info Information about the object.
+# TYPE kube_service_info gauge
+kube_service_info{uid="0"} 1
+`
+	if got := w.String(); got != want {
+		t.Errorf("expected:\n%v\nbut got:\n%v", want, got)
+	}
+}
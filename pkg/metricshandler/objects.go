@@ -0,0 +1,169 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metricshandler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"k8s.io/klog"
+
+	"k8s.io/kube-state-metrics/pkg/metric"
+	metricsstore "k8s.io/kube-state-metrics/pkg/metrics_store"
+)
+
+// objectsResponse is the response of the objects API.
+type objectsResponse struct {
+	Objects []objectJSON `json:"objects"`
+}
+
+// objectJSON contains the metric families of a single Kubernetes object.
+type objectJSON struct {
+	Kind      string       `json:"kind"`
+	Namespace string       `json:"namespace,omitempty"`
+	Name      string       `json:"name"`
+	UID       string       `json:"uid"`
+	Families  []familyJSON `json:"families"`
+}
+
+type familyJSON struct {
+	Name    string       `json:"name"`
+	Type    string       `json:"type"`
+	Help    string       `json:"help,omitempty"`
+	Samples []sampleJSON `json:"samples"`
+}
+
+// sampleJSON is a single sample. Like in the Prometheus HTTP API, the value is
+// a string, as JSON does not support NaN and infinite values.
+type sampleJSON struct {
+	Labels map[string]string `json:"labels"`
+	Value  string            `json:"value"`
+}
+
+type errorJSON struct {
+	Error string `json:"error"`
+}
+
+// ServeObjects serves the metric families and samples of the objects of the
+// collector given by the kind query parameter, or of all collectors, as JSON.
+// The objects can be restricted to a namespace with the namespace parameter,
+// and to a single object with the name parameter, which requires a kind.
+func (m *MetricsHandler) ServeObjects(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeJSON(w, http.StatusMethodNotAllowed, errorJSON{Error: "method not allowed"})
+		return
+	}
+
+	query := r.URL.Query()
+	kind, name, namespace := query.Get("kind"), query.Get("name"), query.Get("namespace")
+	_, namespaced := query["namespace"]
+
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+
+	collectors := m.collectors
+	if kind != "" {
+		if _, ok := m.stores[kind]; !ok {
+			writeJSON(w, http.StatusBadRequest, errorJSON{Error: fmt.Sprintf("unknown kind %q, must be one of the enabled collectors: %s", kind, strings.Join(m.collectors, ", "))})
+			return
+		}
+		collectors = []string{kind}
+	} else if name != "" {
+		writeJSON(w, http.StatusBadRequest, errorJSON{Error: "name requires a kind"})
+		return
+	}
+
+	resp := objectsResponse{Objects: []objectJSON{}}
+	for _, collector := range collectors {
+		s := m.stores[collector]
+
+		var objects []*metricsstore.ObjectMetrics
+		switch {
+		case name != "":
+			key := metricsstore.Object{Namespace: namespace, Name: name}.Key()
+			item, exists, err := s.GetByKey(key)
+			if err != nil {
+				klog.Errorf("failed to get metrics of %s %s: %v", collector, key, err)
+				writeJSON(w, http.StatusInternalServerError, errorJSON{Error: err.Error()})
+				return
+			}
+			if exists {
+				objects = append(objects, item.(*metricsstore.ObjectMetrics))
+			}
+		case namespaced:
+			objects = s.ListNamespace(namespace)
+		default:
+			for _, item := range s.List() {
+				objects = append(objects, item.(*metricsstore.ObjectMetrics))
+			}
+		}
+
+		for _, o := range objects {
+			resp.Objects = append(resp.Objects, newObjectJSON(collector, o))
+		}
+	}
+
+	if name != "" && len(resp.Objects) == 0 {
+		writeJSON(w, http.StatusNotFound, errorJSON{Error: fmt.Sprintf("%s %q not found", kind, name)})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func newObjectJSON(kind string, o *metricsstore.ObjectMetrics) objectJSON {
+	families := make([]familyJSON, 0, len(o.Families))
+	for _, f := range o.Families {
+		family := familyJSON{
+			Name:    f.GetName(),
+			Type:    strings.ToLower(f.GetType().String()),
+			Help:    f.GetHelp(),
+			Samples: make([]sampleJSON, 0, len(f.Metric)),
+		}
+		for _, pm := range f.Metric {
+			m := metric.MetricFromProto(pm)
+			labels := make(map[string]string, len(m.LabelKeys))
+			for i, key := range m.LabelKeys {
+				labels[key] = m.LabelValues[i]
+			}
+			family.Samples = append(family.Samples, sampleJSON{
+				Labels: labels,
+				Value:  strconv.FormatFloat(m.Value, 'f', -1, 64),
+			})
+		}
+		families = append(families, family)
+	}
+
+	return objectJSON{
+		Kind:      kind,
+		Namespace: o.Namespace,
+		Name:      o.Name,
+		UID:       string(o.UID),
+		Families:  families,
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		klog.Errorf("failed to write JSON response: %v", err)
+	}
+}
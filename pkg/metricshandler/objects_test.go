@@ -0,0 +1,148 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metricshandler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	metricsstore "k8s.io/kube-state-metrics/pkg/metrics_store"
+	"k8s.io/kube-state-metrics/pkg/options"
+)
+
+func TestServeObjects(t *testing.T) {
+	m := New(&options.Options{}, nil, nil, false)
+	m.stores = map[string]*metricsstore.MetricsStore{
+		"configmaps": newTestStore(t, "kube_configmap_info", 1),
+		"services":   newTestStore(t, "kube_service_info", 2),
+	}
+	m.collectors = []string{"configmaps", "services"}
+
+	tests := []struct {
+		query  string
+		status int
+		want   []string
+	}{
+		{
+			query:  "",
+			status: http.StatusOK,
+			want:   []string{"configmaps/service0", "services/service0", "services/service1"},
+		},
+		{
+			query:  "?kind=services",
+			status: http.StatusOK,
+			want:   []string{"services/service0", "services/service1"},
+		},
+		{
+			query:  "?kind=services&namespace=kube-system",
+			status: http.StatusOK,
+			want:   []string{},
+		},
+		{
+			query:  "?namespace=default",
+			status: http.StatusOK,
+			want:   []string{"configmaps/service0", "services/service0", "services/service1"},
+		},
+		{
+			query:  "?kind=services&namespace=default&name=service1",
+			status: http.StatusOK,
+			want:   []string{"services/service1"},
+		},
+		{
+			query:  "?kind=services&namespace=default&name=service2",
+			status: http.StatusNotFound,
+		},
+		{
+			query:  "?name=service1",
+			status: http.StatusBadRequest,
+		},
+		{
+			query:  "?kind=pods",
+			status: http.StatusBadRequest,
+		},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "http://localhost:8080/api/v1/objects"+test.query, nil)
+		w := httptest.NewRecorder()
+		m.ServeObjects(w, req)
+
+		if w.Code != test.status {
+			t.Errorf("%q: expected status %v but got %v", test.query, test.status, w.Code)
+			continue
+		}
+		if test.status != http.StatusOK {
+			continue
+		}
+
+		var resp objectsResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%q: %v", test.query, err)
+		}
+
+		got := []string{}
+		for _, o := range resp.Objects {
+			got = append(got, o.Kind+"/"+o.Name)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: expected objects %v but got %v", test.query, test.want, got)
+		}
+	}
+}
+
+func TestServeObjectsFamilies(t *testing.T) {
+	m := New(&options.Options{}, nil, nil, false)
+	m.stores = map[string]*metricsstore.MetricsStore{
+		"services": newTestStore(t, "kube_service_info", 1),
+	}
+	m.collectors = []string{"services"}
+
+	req := httptest.NewRequest("GET", "http://localhost:8080/api/v1/objects?kind=services&namespace=default&name=service0", nil)
+	w := httptest.NewRecorder()
+	m.ServeObjects(w, req)
+
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("expected JSON content type, got %q", ct)
+	}
+
+	var resp objectsResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+
+	want := objectsResponse{Objects: []objectJSON{{
+		Kind:      "services",
+		Namespace: "default",
+		Name:      "service0",
+		UID:       "0",
+		Families: []familyJSON{{
+			Name: "kube_service_info",
+			Type: "gauge",
+			Help: "Information about the object.",
+			Samples: []sampleJSON{{
+				Labels: map[string]string{"uid": "0"},
+				Value:  "1",
+			}},
+		}},
+	}}}
+	if !reflect.DeepEqual(resp, want) {
+		t.Errorf("expected response:\n%+v\nbut got:\n%+v", want, resp)
+	}
+}
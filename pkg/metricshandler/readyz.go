@@ -0,0 +1,60 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metricshandler
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ServeReadyz reports whether the stores are ready to be scraped, i.e. all
+// reflectors of all enabled collectors completed their initial list since
+// the stores were last (re-)built. The body contains the sync state of each
+// collector.
+func (m *MetricsHandler) ServeReadyz(w http.ResponseWriter, r *http.Request) {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+
+	body := strings.Builder{}
+	ready := m.syncStatus != nil
+	if !ready {
+		body.WriteString("[-]collectors not configured yet\n")
+	}
+
+	synced := m.syncStatus.Synced()
+	for _, collector := range m.collectors {
+		if synced[collector] {
+			fmt.Fprintf(&body, "[+]%s ok\n", collector)
+			continue
+		}
+
+		fmt.Fprintf(&body, "[-]%s not synced\n", collector)
+		ready = false
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if !ready {
+		body.WriteString("readyz check failed\n")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	} else {
+		body.WriteString("ok\n")
+	}
+
+	w.Write([]byte(body.String()))
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metricshandler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"k8s.io/client-go/tools/cache"
+
+	"k8s.io/kube-state-metrics/internal/store"
+	"k8s.io/kube-state-metrics/pkg/options"
+)
+
+func TestServeReadyz(t *testing.T) {
+	podsSynced := false
+	synced := func(s *bool) cache.InformerSynced {
+		return func() bool { return *s }
+	}
+	alwaysSynced := func() bool { return true }
+
+	tests := []struct {
+		name       string
+		syncStatus store.SyncStatus
+		collectors []string
+		status     int
+		want       string
+	}{
+		{
+			name:   "not configured",
+			status: http.StatusServiceUnavailable,
+			want:   "[-]collectors not configured yet\nreadyz check failed\n",
+		},
+		{
+			name: "not synced",
+			syncStatus: store.SyncStatus{
+				"nodes": {alwaysSynced},
+				"pods":  {alwaysSynced, synced(&podsSynced)},
+			},
+			collectors: []string{"nodes", "pods"},
+			status:     http.StatusServiceUnavailable,
+			want:       "[+]nodes ok\n[-]pods not synced\nreadyz check failed\n",
+		},
+		{
+			name: "synced",
+			syncStatus: store.SyncStatus{
+				"nodes": {alwaysSynced},
+				"pods":  {alwaysSynced, alwaysSynced},
+			},
+			collectors: []string{"nodes", "pods"},
+			status:     http.StatusOK,
+			want:       "[+]nodes ok\n[+]pods ok\nok\n",
+		},
+	}
+
+	for _, test := range tests {
+		m := New(&options.Options{}, nil, nil, false)
+		m.syncStatus = test.syncStatus
+		m.collectors = test.collectors
+
+		req := httptest.NewRequest("GET", "http://localhost:8080/readyz", nil)
+		w := httptest.NewRecorder()
+		m.ServeReadyz(w, req)
+
+		if w.Code != test.status {
+			t.Errorf("%v: expected status %v but got %v", test.name, test.status, w.Code)
+		}
+		if got := w.Body.String(); got != test.want {
+			t.Errorf("%v: expected body:\n%v\nbut got:\n%v", test.name, test.want, got)
+		}
+	}
+}
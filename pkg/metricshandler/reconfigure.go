@@ -0,0 +1,69 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metricshandler
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/klog"
+
+	"k8s.io/kube-state-metrics/pkg/options"
+	"k8s.io/kube-state-metrics/pkg/whiteblacklist"
+)
+
+// Reconfigure changes the enabled collectors, the namespaces, the metric
+// white- or blacklist and the list selectors of collectors at runtime. Only
+// the stores affected by the change are rebuilt, see store.Builder.Reconfigure,
+// the other stores keep serving their metrics. If the configuration is invalid,
+// an error is returned and the previous configuration stays in effect.
+// Reconfiguration can be done concurrently.
+func (m *MetricsHandler) Reconfigure(collectors []string, namespaces options.NamespaceList, l *whiteblacklist.WhiteBlackList, selectors map[string]options.ListSelector) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	rebuild, err := m.storeBuilder.Reconfigure(collectors, namespaces, l, selectors)
+	if err != nil {
+		return errors.Wrap(err, "invalid configuration")
+	}
+	if m.stores == nil {
+		// The stores are built with the new configuration once sharding
+		// is configured.
+		return nil
+	}
+
+	enabled := map[string]bool{}
+	for _, c := range m.storeBuilder.Collectors() {
+		enabled[c] = true
+	}
+	removed := []string{}
+	for _, c := range m.collectors {
+		if !enabled[c] {
+			m.removeStore(c)
+			removed = append(removed, c)
+		}
+	}
+	m.buildStores(rebuild)
+
+	if len(removed) == 0 && len(rebuild) == 0 {
+		klog.Info("Configuration unchanged, no collectors rebuilt")
+		return nil
+	}
+	klog.Infof("Reconfigured collectors, rebuilt: [%s], removed: [%s]", strings.Join(rebuild, ","), strings.Join(removed, ","))
+	m.storesChanged()
+	return nil
+}
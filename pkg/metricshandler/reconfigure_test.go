@@ -0,0 +1,216 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metricshandler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"k8s.io/kube-state-metrics/internal/store"
+	"k8s.io/kube-state-metrics/pkg/options"
+	"k8s.io/kube-state-metrics/pkg/whiteblacklist"
+)
+
+func TestReconfigure(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	b := store.NewBuilder()
+	b.WithKubeClient(fake.NewSimpleClientset())
+	if err := b.WithEnabledResources([]string{"configmaps", "secrets"}); err != nil {
+		t.Fatal(err)
+	}
+	b.WithNamespaces(options.DefaultNamespaces)
+	b.WithWhiteBlackList(newTestWhiteBlackList(t, nil, nil))
+
+	m := New(&options.Options{}, nil, b, false)
+	m.ConfigureSharding(ctx, 0, 1)
+	expectCollectors(t, m, "configmaps", "secrets")
+	configMaps, secrets := m.stores["configmaps"], m.stores["secrets"]
+
+	// Only the store of the added collector is built.
+	err := m.Reconfigure([]string{"configmaps", "secrets", "services"}, options.DefaultNamespaces, newTestWhiteBlackList(t, nil, nil), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectCollectors(t, m, "configmaps", "secrets", "services")
+	if m.stores["configmaps"] != configMaps || m.stores["secrets"] != secrets {
+		t.Error("expected stores of unchanged collectors not to be rebuilt")
+	}
+
+	// Only the store whose metric families change is rebuilt.
+	err = m.Reconfigure([]string{"configmaps", "secrets", "services"}, options.DefaultNamespaces, newTestWhiteBlackList(t, nil, []string{"kube_secret_labels"}), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.stores["configmaps"] != configMaps {
+		t.Error("expected store of configmaps not to be rebuilt")
+	}
+	if m.stores["secrets"] == secrets {
+		t.Error("expected store of secrets to be rebuilt")
+	}
+	secrets = m.stores["secrets"]
+
+	// The store of a removed collector is removed.
+	err = m.Reconfigure([]string{"configmaps", "secrets"}, options.DefaultNamespaces, newTestWhiteBlackList(t, nil, []string{"kube_secret_labels"}), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectCollectors(t, m, "configmaps", "secrets")
+	if m.stores["configmaps"] != configMaps || m.stores["secrets"] != secrets {
+		t.Error("expected stores of unchanged collectors not to be rebuilt")
+	}
+	if _, ok := m.storeCancels["services"]; ok {
+		t.Error("expected reflectors of removed collector to be stopped")
+	}
+
+	// All stores are rebuilt if the namespaces change.
+	err = m.Reconfigure([]string{"configmaps", "secrets"}, options.NamespaceList{"default"}, newTestWhiteBlackList(t, nil, []string{"kube_secret_labels"}), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.stores["configmaps"] == configMaps || m.stores["secrets"] == secrets {
+		t.Error("expected all stores to be rebuilt")
+	}
+	configMaps, secrets = m.stores["configmaps"], m.stores["secrets"]
+
+	// Only the store whose selector changes is rebuilt.
+	selectors := map[string]options.ListSelector{"secrets": {LabelSelector: "team=platform"}}
+	err = m.Reconfigure([]string{"configmaps", "secrets"}, options.NamespaceList{"default"}, newTestWhiteBlackList(t, nil, []string{"kube_secret_labels"}), selectors)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.stores["configmaps"] != configMaps {
+		t.Error("expected store of configmaps not to be rebuilt")
+	}
+	if m.stores["secrets"] == secrets {
+		t.Error("expected store of secrets to be rebuilt")
+	}
+	secrets = m.stores["secrets"]
+
+	// An invalid selector is rejected.
+	selectors = map[string]options.ListSelector{"secrets": {FieldSelector: "type"}}
+	err = m.Reconfigure([]string{"configmaps", "secrets"}, options.NamespaceList{"default"}, newTestWhiteBlackList(t, nil, []string{"kube_secret_labels"}), selectors)
+	if err == nil {
+		t.Fatal("expected error for invalid selector")
+	}
+	if m.stores["secrets"] != secrets {
+		t.Error("expected store of secrets not to be rebuilt")
+	}
+
+	// An invalid configuration is rejected and the previous one stays in
+	// effect.
+	err = m.Reconfigure([]string{"configmaps", "unknown"}, options.DefaultNamespaces, newTestWhiteBlackList(t, nil, nil), nil)
+	if err == nil {
+		t.Fatal("expected error for unknown collector")
+	}
+	expectCollectors(t, m, "configmaps", "secrets")
+	if m.stores["configmaps"] != configMaps || m.stores["secrets"] != secrets {
+		t.Error("expected stores not to be rebuilt")
+	}
+	if got := b.Collectors(); len(got) != 2 {
+		t.Errorf("expected builder to keep its collectors, got %v", got)
+	}
+}
+
+func TestReconfigureWithRetention(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	secret := &v1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "secret", Namespace: "default", UID: "1"}}
+	b := store.NewBuilder()
+	b.WithKubeClient(fake.NewSimpleClientset(secret))
+	b.WithMetrics(nil)
+	if err := b.WithEnabledResources([]string{"secrets"}); err != nil {
+		t.Fatal(err)
+	}
+	b.WithNamespaces(options.DefaultNamespaces)
+	b.WithWhiteBlackList(newTestWhiteBlackList(t, nil, nil))
+	retention := 10 * time.Millisecond
+	if err := b.WithDeletedObjectRetention(options.CollectorDurations{"secrets": retention}, false); err != nil {
+		t.Fatal(err)
+	}
+
+	m := New(&options.Options{WatchBufferSize: 10}, nil, b, false)
+	m.ConfigureSharding(ctx, 0, 1)
+	for !m.syncStatus.Synced()["secrets"] {
+		time.Sleep(time.Millisecond)
+	}
+	m.mtx.Lock()
+	c := m.subscribeWatch(map[string]struct{}{"secrets": {}}, "", false)
+	m.mtx.Unlock()
+	defer m.unsubscribeWatch(c)
+
+	// The retained metrics of a deleted object of a rebuilt store expire
+	// after it was discarded, which is not published.
+	if err := m.stores["secrets"].Delete(secret); err != nil {
+		t.Fatal(err)
+	}
+	err := m.Reconfigure([]string{"secrets"}, options.DefaultNamespaces, newTestWhiteBlackList(t, nil, []string{"kube_secret_labels"}), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	timeout := time.After(10 * retention)
+	for {
+		select {
+		case e := <-c.events:
+			if e.delta != nil && len(e.delta.Removed) > 0 && len(e.delta.Added) == 0 {
+				t.Fatalf("expected expiry in discarded store not to be published, got %+v", e.delta)
+			}
+		case <-timeout:
+			return
+		}
+	}
+}
+
+func newTestWhiteBlackList(t *testing.T, white, black []string) *whiteblacklist.WhiteBlackList {
+	t.Helper()
+
+	set := func(items []string) map[string]struct{} {
+		s := map[string]struct{}{}
+		for _, item := range items {
+			s[item] = struct{}{}
+		}
+		return s
+	}
+	l, err := whiteblacklist.New(set(white), set(black))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Parse(); err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+func expectCollectors(t *testing.T, m *MetricsHandler, want ...string) {
+	t.Helper()
+
+	if len(m.collectors) != len(want) {
+		t.Fatalf("expected collectors %v but got %v", want, m.collectors)
+	}
+	for i, c := range want {
+		if m.collectors[i] != c || m.stores[c] == nil {
+			t.Fatalf("expected collectors %v but got %v", want, m.collectors)
+		}
+	}
+}
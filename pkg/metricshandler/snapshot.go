@@ -0,0 +1,153 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metricshandler
+
+import (
+	"bufio"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/klog"
+
+	metricsstore "k8s.io/kube-state-metrics/pkg/metrics_store"
+)
+
+var snapshotStaleDesc = prometheus.NewDesc(
+	"kube_state_metrics_snapshot_stale",
+	"Whether kube-state-metrics serves the metrics of a collector restored from a snapshot, which might be stale, as its initial list did not complete yet.",
+	[]string{"collector"}, nil,
+)
+
+// snapshotCollector is a prometheus.Collector exposing whether the stores of
+// a MetricsHandler serve metrics restored from a snapshot.
+type snapshotCollector struct {
+	m *MetricsHandler
+}
+
+// Describe implements the prometheus.Collector interface.
+func (c snapshotCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- snapshotStaleDesc
+}
+
+// Collect implements the prometheus.Collector interface.
+func (c snapshotCollector) Collect(ch chan<- prometheus.Metric) {
+	c.m.mtx.RLock()
+	defer c.m.mtx.RUnlock()
+
+	synced := c.m.syncStatus.Synced()
+	for _, collector := range c.m.collectors {
+		stale := 0.0
+		if c.m.restored(collector, synced) {
+			stale = 1
+		}
+		ch <- prometheus.MustNewConstMetric(snapshotStaleDesc, prometheus.GaugeValue, stale, collector)
+	}
+}
+
+// runSnapshots writes the snapshots of the stores on every snapshot interval
+// and once more when the given context is canceled.
+func (m *MetricsHandler) runSnapshots(ctx context.Context) {
+	if err := os.MkdirAll(m.opts.SnapshotDir, 0755); err != nil {
+		klog.Errorf("failed to create snapshot directory: %v", err)
+		return
+	}
+
+	ticker := time.NewTicker(m.opts.SnapshotInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			m.WriteSnapshots()
+			return
+		case <-ticker.C:
+			m.WriteSnapshots()
+		}
+	}
+}
+
+// WriteSnapshots writes a snapshot of each store whose initial list completed
+// into the snapshot directory, replacing the previous one. Stores still
+// serving a restored snapshot or being filled are skipped, so that complete
+// snapshots are not replaced by partial ones.
+func (m *MetricsHandler) WriteSnapshots() {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+
+	synced := m.syncStatus.Synced()
+	for _, collector := range m.collectors {
+		if !synced[collector] || m.restored(collector, synced) {
+			continue
+		}
+
+		path := metricsstore.SnapshotFile(m.opts.SnapshotDir, collector, m.curShard, m.curTotalShards)
+		if err := writeSnapshot(path, m.stores[collector]); err != nil {
+			klog.Errorf("failed to write snapshot of collector %s: %v", collector, err)
+		}
+	}
+}
+
+// restored returns whether the store of the given collector serves metrics
+// restored from a snapshot. The store is marked as replaced once the given
+// synced collectors contain its collector, i.e. the reflectors of all of its
+// namespaces completed their initial list. The caller has to hold the read
+// lock of mtx.
+func (m *MetricsHandler) restored(collector string, synced map[string]bool) bool {
+	s := m.stores[collector]
+	if !s.Restored() {
+		return false
+	}
+	if !synced[collector] {
+		return true
+	}
+
+	s.ClearRestored()
+	return false
+}
+
+// writeSnapshot writes the snapshot of the given store to a temporary file,
+// which is renamed to the given path once complete, so that the snapshot at
+// the given path is never partial.
+func writeSnapshot(path string, s *metricsstore.MetricsStore) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return errors.Wrap(err, "create snapshot file")
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	if err := s.WriteSnapshot(w); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return errors.Wrap(err, "write snapshot file")
+	}
+	if err := f.Sync(); err != nil {
+		return errors.Wrap(err, "sync snapshot file")
+	}
+	if err := f.Close(); err != nil {
+		return errors.Wrap(err, "close snapshot file")
+	}
+
+	return errors.Wrap(os.Rename(f.Name(), path), "rename snapshot file")
+}
@@ -0,0 +1,191 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metricshandler
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+
+	"k8s.io/kube-state-metrics/internal/store"
+	metricsstore "k8s.io/kube-state-metrics/pkg/metrics_store"
+	"k8s.io/kube-state-metrics/pkg/options"
+)
+
+func TestWriteSnapshots(t *testing.T) {
+	dir, err := ioutil.TempDir("", "snapshots")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	m := New(&options.Options{SnapshotDir: dir}, nil, nil, false)
+	m.stores = map[string]*metricsstore.MetricsStore{
+		"services": newTestStore(t, "kube_service_info", 2),
+		"pods":     newTestStore(t, "kube_pod_info", 1),
+	}
+	m.collectors = []string{"pods", "services"}
+	m.curTotalShards = 1
+	synced := func() bool { return true }
+	notSynced := func() bool { return false }
+	m.syncStatus = store.SyncStatus{
+		"services": {synced},
+		"pods":     {notSynced},
+	}
+
+	m.WriteSnapshots()
+
+	// Only the snapshots of synced stores are written.
+	if _, err := os.Stat(metricsstore.SnapshotFile(dir, "pods", 0, 1)); !os.IsNotExist(err) {
+		t.Errorf("expected no snapshot of unsynced store, got %v", err)
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Errorf("expected a single snapshot file but got %v", len(files))
+	}
+
+	f, err := os.Open(metricsstore.SnapshotFile(dir, "services", 0, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	restored := newTestStore(t, "kube_service_info", 0)
+	if err := restored.RestoreSnapshot(f); err != nil {
+		t.Fatal(err)
+	}
+
+	m.stores["services"] = restored
+	m.syncStatus["services"] = []cache.InformerSynced{notSynced}
+	w := strings.Builder{}
+	m.WriteAll(&w)
+	for _, want := range []string{`kube_service_info{uid="0"} 1`, `kube_service_info{uid="1"} 1`} {
+		if !strings.Contains(w.String(), want) {
+			t.Errorf("expected restored metrics to contain %v, got:\n%v", want, w.String())
+		}
+	}
+
+	r := prometheus.NewRegistry()
+	m.WithMetrics(r)
+	gatherStale := func() map[string]float64 {
+		families, err := r.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		stale := map[string]float64{}
+		for _, f := range families {
+			if f.GetName() != "kube_state_metrics_snapshot_stale" {
+				continue
+			}
+			for _, metric := range f.GetMetric() {
+				stale[metric.GetLabel()[0].GetValue()] = metric.GetGauge().GetValue()
+			}
+		}
+		return stale
+	}
+	if stale := gatherStale(); stale["services"] != 1 || stale["pods"] != 0 || len(stale) != 2 {
+		t.Errorf("expected only services to be stale, got %v", stale)
+	}
+
+	// With a reflector per namespace, the restored store is stale until all
+	// of them completed their initial list.
+	if err := restored.ReplaceNamespace([]interface{}{}, "kube-system"); err != nil {
+		t.Fatal(err)
+	}
+	m.syncStatus["services"] = []cache.InformerSynced{synced, notSynced}
+	if stale := gatherStale(); stale["services"] != 1 {
+		t.Errorf("expected services to be stale until all namespaces are synced, got %v", stale)
+	}
+	m.syncStatus["services"] = []cache.InformerSynced{synced, synced}
+	if stale := gatherStale(); stale["services"] != 0 {
+		t.Errorf("expected services not to be stale once all namespaces are synced, got %v", stale)
+	}
+	if restored.Restored() {
+		t.Error("expected synced store not to be restored")
+	}
+}
+
+func TestRestoreSnapshotsOnStartup(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dir, err := ioutil.TempDir("", "snapshots")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	newBuilder := func(client *fake.Clientset) *store.Builder {
+		b := store.NewBuilder()
+		b.WithKubeClient(client)
+		b.WithMetrics(nil)
+		if err := b.WithEnabledResources([]string{"configmaps"}); err != nil {
+			t.Fatal(err)
+		}
+		b.WithNamespaces(options.DefaultNamespaces)
+		b.WithWhiteBlackList(newTestWhiteBlackList(t, nil, nil))
+		return b
+	}
+
+	m := New(&options.Options{SnapshotDir: dir}, nil, newBuilder(fake.NewSimpleClientset(&v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "config", Namespace: "default", UID: "1"},
+	})), false)
+	m.ConfigureSharding(ctx, 0, 1)
+	for !m.syncStatus.Synced()["configmaps"] {
+		time.Sleep(time.Millisecond)
+	}
+	m.WriteSnapshots()
+
+	// The objects are never listed, so that the restored snapshot is not
+	// replaced.
+	client := fake.NewSimpleClientset()
+	listed := make(chan struct{})
+	defer close(listed)
+	client.PrependReactor("list", "configmaps", func(k8stesting.Action) (bool, runtime.Object, error) {
+		<-listed
+		return false, nil, nil
+	})
+	b := newBuilder(client)
+	b.WithSnapshotDir(dir)
+	m = New(&options.Options{SnapshotDir: dir}, nil, b, false)
+	m.ConfigureSharding(ctx, 0, 1)
+	if !m.stores["configmaps"].Restored() {
+		t.Fatal("expected store to be restored on startup")
+	}
+
+	// Stores rebuilt at runtime are not restored.
+	for _, collectors := range [][]string{{"secrets"}, {"configmaps"}} {
+		if err := m.Reconfigure(collectors, options.DefaultNamespaces, newTestWhiteBlackList(t, nil, nil), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if m.stores["configmaps"].Restored() {
+		t.Error("expected rebuilt store not to be restored")
+	}
+}
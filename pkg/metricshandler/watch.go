@@ -0,0 +1,353 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metricshandler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+	"k8s.io/klog"
+
+	metricsstore "k8s.io/kube-state-metrics/pkg/metrics_store"
+)
+
+const (
+	// deltaEvent is the server-sent event type of the changes of the
+	// metrics of an object.
+	deltaEvent = "delta"
+	// resyncEvent is the server-sent event type telling a client to rebuild
+	// its state, e.g. from the objects API, as deltas were lost.
+	resyncEvent = "resync"
+)
+
+// watchEvent is an event of the watch stream. The delta is encoded by the
+// client it is sent to, as events are published with the store locked.
+type watchEvent struct {
+	name      string
+	collector string
+	delta     *metricsstore.Delta
+}
+
+// watchClient is a client of the watch stream, receiving the events of the
+// given collectors and namespace.
+type watchClient struct {
+	collectors map[string]struct{}
+	namespace  string
+	namespaced bool
+	events     chan watchEvent
+}
+
+func (c *watchClient) includes(e watchEvent) bool {
+	if e.collector != "" && !includes(c.collectors, e.collector) {
+		return false
+	}
+	return e.delta == nil || !c.namespaced || e.delta.Object.Namespace == c.namespace
+}
+
+// watchHub distributes the changes of all stores to the clients of the watch
+// stream. Each client has a bounded buffer of events, if it is full the
+// buffered events are dropped in favor of a single resync event.
+type watchHub struct {
+	mtx        sync.Mutex
+	clients    map[*watchClient]struct{}
+	bufferSize int
+
+	eventsTotal *prometheus.CounterVec
+	clientCount prometheus.Gauge
+}
+
+func newWatchHub(bufferSize int) *watchHub {
+	if bufferSize < 1 {
+		bufferSize = 1
+	}
+
+	return &watchHub{
+		clients:    map[*watchClient]struct{}{},
+		bufferSize: bufferSize,
+		eventsTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "kube_state_metrics_watch_events_total",
+				Help: "Number of total events of the watch stream in kube-state-metrics, by result (queued or dropped).",
+			},
+			[]string{"result"},
+		),
+		clientCount: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "kube_state_metrics_watch_clients",
+				Help: "Number of clients of the watch stream in kube-state-metrics.",
+			},
+		),
+	}
+}
+
+func (h *watchHub) subscribe(collectors map[string]struct{}, namespace string, namespaced bool) *watchClient {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	c := &watchClient{
+		collectors: collectors,
+		namespace:  namespace,
+		namespaced: namespaced,
+		events:     make(chan watchEvent, h.bufferSize),
+	}
+	h.clients[c] = struct{}{}
+	h.clientCount.Inc()
+
+	return c
+}
+
+func (h *watchHub) unsubscribe(c *watchClient) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	delete(h.clients, c)
+	h.clientCount.Dec()
+}
+
+// subscribed returns whether the hub has any clients.
+func (h *watchHub) subscribed() bool {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	return len(h.clients) > 0
+}
+
+// publish queues the given event for all clients it is relevant for without
+// blocking. If the buffer of a client is full, the buffered events are
+// replaced by a resync event.
+func (h *watchHub) publish(e watchEvent) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	for c := range h.clients {
+		if !c.includes(e) {
+			continue
+		}
+
+		select {
+		case c.events <- e:
+			h.eventsTotal.WithLabelValues("queued").Inc()
+			continue
+		default:
+		}
+
+		// Only the hub sends events, hence there is room for the resync
+		// event once the buffer is drained.
+		dropped := 1
+	drain:
+		for {
+			select {
+			case <-c.events:
+				dropped++
+			default:
+				break drain
+			}
+		}
+		h.eventsTotal.WithLabelValues("dropped").Add(float64(dropped))
+		c.events <- watchEvent{name: resyncEvent, collector: e.collector}
+	}
+}
+
+// resync tells all clients to rebuild their state, e.g. after the stores were
+// rebuilt.
+func (h *watchHub) resync() {
+	h.publish(watchEvent{name: resyncEvent})
+}
+
+// storeWatcher publishes the changes of the store of a collector to a hub.
+type storeWatcher struct {
+	hub       *watchHub
+	collector string
+}
+
+func (w *storeWatcher) Changed(d metricsstore.Delta) {
+	w.hub.publish(watchEvent{name: deltaEvent, collector: w.collector, delta: &d})
+}
+
+func (w *storeWatcher) Resynced() {
+	w.hub.publish(watchEvent{name: resyncEvent, collector: w.collector})
+}
+
+// deltaJSON is the data of a delta event.
+type deltaJSON struct {
+	Kind      string       `json:"kind"`
+	Namespace string       `json:"namespace,omitempty"`
+	Name      string       `json:"name"`
+	UID       string       `json:"uid"`
+	Added     []seriesJSON `json:"added"`
+	Changed   []seriesJSON `json:"changed"`
+	Removed   []seriesJSON `json:"removed"`
+}
+
+// seriesJSON is a single series of a delta event, removed series carry their
+// last value.
+type seriesJSON struct {
+	Name   string            `json:"name"`
+	Labels map[string]string `json:"labels"`
+	Value  string            `json:"value"`
+}
+
+// resyncJSON is the data of a resync event, the kind is empty if all
+// collectors are affected.
+type resyncJSON struct {
+	Kind string `json:"kind,omitempty"`
+}
+
+// ServeWatch streams the changes of the metrics as server-sent events. A delta
+// event contains the added, changed and removed series of an object. A resync
+// event tells the client that deltas were lost, e.g. as it fell behind or the
+// stores were rebuilt, and that it has to rebuild its state. The stream can be
+// restricted to collectors with the kind query parameter and to a namespace
+// with the namespace parameter.
+func (m *MetricsHandler) ServeWatch(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeJSON(w, http.StatusInternalServerError, errorJSON{Error: "streaming is not supported"})
+		return
+	}
+
+	query := r.URL.Query()
+	collectors := parseSet(query["kind"])
+	_, namespaced := query["namespace"]
+
+	m.mtx.Lock()
+	for collector := range collectors {
+		if _, ok := m.stores[collector]; !ok {
+			m.mtx.Unlock()
+			writeJSON(w, http.StatusBadRequest, errorJSON{Error: fmt.Sprintf("unknown kind %q, must be one of the enabled collectors: %s", collector, strings.Join(m.collectors, ", "))})
+			return
+		}
+	}
+	c := m.subscribeWatch(collectors, query.Get("namespace"), namespaced)
+	m.mtx.Unlock()
+	defer m.unsubscribeWatch(c)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e := <-c.events:
+			data, err := encodeWatchEvent(e)
+			if err != nil {
+				klog.Errorf("failed to encode watch event: %v", err)
+				continue
+			}
+
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.name, data); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// subscribeWatch subscribes a client to the watch stream. The stores are only
+// watched while the stream has clients, as computing the delta of every change
+// is costly. The caller has to hold the write lock of mtx.
+func (m *MetricsHandler) subscribeWatch(collectors map[string]struct{}, namespace string, namespaced bool) *watchClient {
+	if !m.watchHub.subscribed() {
+		for collector := range m.stores {
+			m.watchStore(collector)
+		}
+	}
+	return m.watchHub.subscribe(collectors, namespace, namespaced)
+}
+
+// unsubscribeWatch unsubscribes the given client from the watch stream and
+// stops watching the stores once the last client left.
+func (m *MetricsHandler) unsubscribeWatch(c *watchClient) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	m.watchHub.unsubscribe(c)
+	if m.watchHub.subscribed() {
+		return
+	}
+	for collector, w := range m.storeWatchers {
+		m.stores[collector].Unwatch(w)
+		delete(m.storeWatchers, collector)
+	}
+}
+
+// watchStore makes the hub publish the changes of the store of the given
+// collector. The caller has to hold the write lock of mtx.
+func (m *MetricsHandler) watchStore(collector string) {
+	w := &storeWatcher{hub: m.watchHub, collector: collector}
+	m.stores[collector].Watch(w)
+	m.storeWatchers[collector] = w
+}
+
+func encodeWatchEvent(e watchEvent) ([]byte, error) {
+	if e.delta == nil {
+		return json.Marshal(resyncJSON{Kind: e.collector})
+	}
+
+	d := deltaJSON{
+		Kind:      e.collector,
+		Namespace: e.delta.Object.Namespace,
+		Name:      e.delta.Object.Name,
+		UID:       string(e.delta.Object.UID),
+	}
+	var err error
+	if d.Added, err = newSeriesJSON(e.delta.Added); err != nil {
+		return nil, err
+	}
+	if d.Changed, err = newSeriesJSON(e.delta.Changed); err != nil {
+		return nil, err
+	}
+	if d.Removed, err = newSeriesJSON(e.delta.Removed); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(d)
+}
+
+// newSeriesJSON parses the name and the labels of the given series, the
+// values are taken verbatim.
+func newSeriesJSON(series []metricsstore.Series) ([]seriesJSON, error) {
+	result := make([]seriesJSON, 0, len(series))
+
+	var parser expfmt.TextParser
+	for _, s := range series {
+		families, err := parser.TextToMetricFamilies(strings.NewReader(s.Metric + " " + s.Value + "\n"))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, family := range families {
+			for _, metric := range family.Metric {
+				labels := make(map[string]string, len(metric.Label))
+				for _, l := range metric.Label {
+					labels[l.GetName()] = l.GetValue()
+				}
+				result = append(result, seriesJSON{Name: family.GetName(), Labels: labels, Value: s.Value})
+			}
+		}
+	}
+
+	return result, nil
+}
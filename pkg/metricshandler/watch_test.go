@@ -0,0 +1,147 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metricshandler
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	metricsstore "k8s.io/kube-state-metrics/pkg/metrics_store"
+	"k8s.io/kube-state-metrics/pkg/options"
+)
+
+func TestWatchHubOverflow(t *testing.T) {
+	h := newWatchHub(2)
+	c := h.subscribe(map[string]struct{}{"services": {}}, "", false)
+	defer h.unsubscribe(c)
+
+	delta := &metricsstore.Delta{Object: metricsstore.Object{Namespace: "default", Name: "a"}}
+	for i := 0; i < 3; i++ {
+		h.publish(watchEvent{name: deltaEvent, collector: "services", delta: delta})
+	}
+	// Not watched by the client.
+	h.publish(watchEvent{name: deltaEvent, collector: "pods", delta: delta})
+
+	if len(c.events) != 1 {
+		t.Fatalf("expected only the resync event to be buffered, got %d events", len(c.events))
+	}
+	if e := <-c.events; e.name != resyncEvent || e.collector != "services" {
+		t.Errorf("expected resync event of services, got %v", e)
+	}
+}
+
+func TestServeWatch(t *testing.T) {
+	m := New(&options.Options{WatchBufferSize: 10}, nil, nil, false)
+	s := newTestStore(t, "kube_service_info", 1)
+	m.stores = map[string]*metricsstore.MetricsStore{"services": s}
+	m.collectors = []string{"services"}
+
+	server := httptest.NewServer(http.HandlerFunc(m.ServeWatch))
+	defer server.Close()
+
+	if resp, err := http.Get(server.URL + "?kind=pods"); err != nil || resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected unknown kind to be rejected, got %v, %v", resp, err)
+	}
+
+	resp, err := http.Get(server.URL + "?kind=services&namespace=default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("expected event stream, got %q", ct)
+	}
+
+	// The client is subscribed once the headers were received.
+	for _, namespace := range []string{"kube-system", "default"} {
+		err := s.Add(&v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "new", Namespace: namespace, UID: types.UID("new-" + namespace)}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Replace(nil, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	r := bufio.NewReader(resp.Body)
+	readEvent := func() (string, string) {
+		var name, data string
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				t.Fatal(err)
+			}
+			line = strings.TrimSuffix(line, "\n")
+			switch {
+			case line == "":
+				return name, data
+			case strings.HasPrefix(line, "event: "):
+				name = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				data = strings.TrimPrefix(line, "data: ")
+			}
+		}
+	}
+
+	name, data := readEvent()
+	if name != deltaEvent {
+		t.Fatalf("expected delta event, got %q", name)
+	}
+	var got deltaJSON
+	if err := json.Unmarshal([]byte(data), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := deltaJSON{
+		Kind:      "services",
+		Namespace: "default",
+		Name:      "new",
+		UID:       "new-default",
+		Added: []seriesJSON{{
+			Name:   "kube_service_info",
+			Labels: map[string]string{"uid": "new-default"},
+			Value:  "1",
+		}},
+		Changed: []seriesJSON{},
+		Removed: []seriesJSON{},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected delta:\n%+v\nbut got:\n%+v", want, got)
+	}
+
+	if name, data := readEvent(); name != resyncEvent || data != `{"kind":"services"}` {
+		t.Errorf("expected resync event of services, got %q: %s", name, data)
+	}
+
+	// The stores are no longer watched once the last client left.
+	resp.Body.Close()
+	for watched := true; watched; {
+		m.mtx.RLock()
+		watched = len(m.storeWatchers) > 0
+		m.mtx.RUnlock()
+		time.Sleep(time.Millisecond)
+	}
+}
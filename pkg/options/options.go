@@ -20,6 +20,7 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"time"
 
 	"k8s.io/klog"
 
@@ -43,11 +44,49 @@ type Options struct {
 	Namespace                            string
 	MetricBlacklist                      MetricSet
 	MetricWhitelist                      MetricSet
+	LabelsAllowlist                      KeyAllowlist
+	AnnotationsAllowlist                 KeyAllowlist
 	Version                              bool
 	DisablePodNonGenericResourceMetrics  bool
 	DisableNodeNonGenericResourceMetrics bool
-
-	EnableGZIPEncoding bool
+	CustomResourceConfig                 string
+	CustomResourceDiscovery              []string
+	Config                               string
+
+	EnableGZIPEncoding     bool
+	EnableZstdEncoding     bool
+	EnableSnappyEncoding   bool
+	EnableProtobufEncoding bool
+	EnableResponseCache    bool
+	EnableSortedOutput     bool
+	OmitEmptyFamilies      bool
+	EnableCompactStorage   bool
+	DeletedObjectRetention CollectorDurations
+	MarkDeletedObjects     bool
+	FamilySeriesLimits     map[string]int
+	CollectorSeriesLimits  map[string]int
+	SnapshotDir            string
+	SnapshotInterval       time.Duration
+
+	TLSCertFile          string
+	TLSPrivateKeyFile    string
+	TLSClientCAFile      string
+	EnableKubernetesAuth bool
+
+	RemoteWriteURL               string
+	RemoteWriteInterval          time.Duration
+	RemoteWriteTimeout           time.Duration
+	RemoteWriteShards            int
+	RemoteWriteMaxSamplesPerSend int
+	RemoteWriteMaxRetries        int
+	RemoteWriteExternalLabels    map[string]string
+
+	OTLPEndpoint string
+	OTLPProtocol string
+	OTLPInterval time.Duration
+	OTLPTimeout  time.Duration
+
+	WatchBufferSize int
 
 	flags *pflag.FlagSet
 }
@@ -55,9 +94,12 @@ type Options struct {
 // NewOptions returns a new instance of `Options`.
 func NewOptions() *Options {
 	return &Options{
-		Collectors:      CollectorSet{},
-		MetricWhitelist: MetricSet{},
-		MetricBlacklist: MetricSet{},
+		Collectors:             CollectorSet{},
+		MetricWhitelist:        MetricSet{},
+		MetricBlacklist:        MetricSet{},
+		LabelsAllowlist:        KeyAllowlist{},
+		AnnotationsAllowlist:   KeyAllowlist{},
+		DeletedObjectRetention: CollectorDurations{},
 	}
 }
 
@@ -88,6 +130,8 @@ func (o *Options) AddFlags() {
 	o.flags.Var(&o.Namespaces, "namespace", fmt.Sprintf("Comma-separated list of namespaces to be enabled. Defaults to %q", &DefaultNamespaces))
 	o.flags.Var(&o.MetricWhitelist, "metric-whitelist", "Comma-separated list of metrics to be exposed. This list comprises of exact metric names and/or regex patterns. The whitelist and blacklist are mutually exclusive.")
 	o.flags.Var(&o.MetricBlacklist, "metric-blacklist", "Comma-separated list of metrics not to be enabled. This list comprises of exact metric names and/or regex patterns. The whitelist and blacklist are mutually exclusive.")
+	o.flags.Var(&o.LabelsAllowlist, "metric-labels-allowlist", "Comma-separated list of collector=[key,...] pairs, e.g. pods=[app,team],nodes=[*], restricting the Kubernetes labels exposed by the kube_<resource>_labels metrics of these collectors to the given keys. Keys may contain * matching any sequence of characters. The labels of other collectors are exposed unrestricted.")
+	o.flags.Var(&o.AnnotationsAllowlist, "metric-annotations-allowlist", "Comma-separated list of collector=[key,...] pairs, e.g. pods=[example.com/owner],namespaces=[*], enabling the kube_<resource>_annotations metrics of these collectors, which expose the Kubernetes annotations with the given keys as annotation_<key> labels. Keys may contain * matching any sequence of characters. Disabled for collectors not listed.")
 	o.flags.Int32Var(&o.Shard, "shard", int32(0), "The instances shard nominal (zero indexed) within the total number of shards. (default 0)")
 	o.flags.IntVar(&o.TotalShards, "total-shards", 1, "The total number of shards. Sharding is disabled when total shards is set to 1.")
 
@@ -98,7 +142,39 @@ func (o *Options) AddFlags() {
 	o.flags.BoolVarP(&o.Version, "version", "", false, "kube-state-metrics build version information")
 	o.flags.BoolVarP(&o.DisablePodNonGenericResourceMetrics, "disable-pod-non-generic-resource-metrics", "", false, "Disable pod non generic resource request and limit metrics")
 	o.flags.BoolVarP(&o.DisableNodeNonGenericResourceMetrics, "disable-node-non-generic-resource-metrics", "", false, "Disable node non generic resource request and limit metrics")
+	o.flags.StringVar(&o.CustomResourceConfig, "custom-resource-config", "", "Path to a YAML file declaring custom resources and the metrics to generate from their fields, see docs/customresource-metrics.md. A store is built for every declared custom resource in addition to the enabled collectors.")
+	o.flags.StringSliceVar(&o.CustomResourceDiscovery, "custom-resource-discovery", nil, "Comma-separated list of group/kind of custom resources, e.g. cert-manager.io/*,argoproj.io/Workflow, or * for all, whose status conditions and creation timestamp are exposed by the customresources collector. Custom resource definitions are watched to discover them. Disabled if empty.")
+	o.flags.StringVar(&o.Config, "config", "", "Path to a YAML file with the collectors, namespaces, metricWhitelist and metricBlacklist, overriding the corresponding flags, and the label and field selectors of collectors. The file is reloaded when it changes or on SIGHUP, rebuilding only the stores affected by the change. If the file is invalid, the previous configuration stays in effect.")
 	o.flags.BoolVar(&o.EnableGZIPEncoding, "enable-gzip-encoding", false, "Gzip responses when requested by clients via 'Accept-Encoding: gzip' header.")
+	o.flags.BoolVar(&o.EnableZstdEncoding, "enable-zstd-encoding", false, "Compress responses with zstd when requested by clients via 'Accept-Encoding: zstd' header. Preferred over gzip if a client accepts both.")
+	o.flags.BoolVar(&o.EnableSnappyEncoding, "enable-snappy-encoding", false, "Compress responses with the snappy framing format when requested by clients via 'Accept-Encoding: snappy' header.")
+	o.flags.BoolVar(&o.EnableProtobufEncoding, "enable-protobuf-encoding", false, "Serve the Prometheus protobuf exposition format when requested by clients via 'Accept' header. This increases memory usage, as metrics are kept in both the text and the protobuf format.")
+	o.flags.BoolVar(&o.EnableResponseCache, "enable-response-cache", false, "Cache the rendered, and if requested compressed, /metrics response per exposition format and content encoding until an object changes. This increases memory usage by the size of the cached responses.")
+	o.flags.BoolVar(&o.EnableSortedOutput, "enable-sorted-output", false, "Write the metrics of each family ordered by the namespace and name of their objects, making scrapes deterministic at the cost of maintaining the order on every change.")
+	o.flags.BoolVar(&o.OmitEmptyFamilies, "omit-empty-families", false, "Omit the HELP and TYPE lines of metric families without any metrics.")
+	o.flags.BoolVar(&o.EnableCompactStorage, "enable-compact-storage", false, "Keep metrics in a compact representation with interned label names and values, rendering them on every scrape. This reduces memory usage at the cost of CPU time per scrape.")
+	o.flags.Var(&o.DeletedObjectRetention, "deleted-object-retention", "Comma-separated list of collector=duration pairs, e.g. jobs=10m,pods=5m, to keep exposing the metrics of deleted objects of these collectors for the given duration, so that their final state is scraped.")
+	o.flags.BoolVar(&o.MarkDeletedObjects, "mark-deleted-objects", false, "Add the label deleted=\"true\" to the metrics of deleted objects retained via --deleted-object-retention.")
+	o.flags.StringToIntVar(&o.FamilySeriesLimits, "family-series-limit", nil, "Comma-separated list of metric family=limit pairs, e.g. kube_pod_labels=10000, limiting the number of series of these metric families per collector. Series of objects exceeding a limit are dropped.")
+	o.flags.StringToIntVar(&o.CollectorSeriesLimits, "collector-series-limit", nil, "Comma-separated list of collector=limit pairs, e.g. pods=100000, limiting the number of series of all metric families of these collectors. Series of objects exceeding a limit are dropped.")
+	o.flags.StringVar(&o.SnapshotDir, "snapshot-dir", "", "Directory, e.g. on a persistent volume, to periodically write a snapshot of the metrics and resource versions of all objects to. On start, the snapshot is served, marked stale by the kube_state_metrics_snapshot_stale metric, until the initial list of each collector completed.")
+	o.flags.DurationVar(&o.SnapshotInterval, "snapshot-interval", 5*time.Minute, "Interval between two snapshots written to --snapshot-dir.")
+	o.flags.StringVar(&o.TLSCertFile, "tls-cert-file", "", "Path to a PEM encoded certificate to serve the metrics and telemetry endpoints over TLS with. The certificate is reloaded when the file changes.")
+	o.flags.StringVar(&o.TLSPrivateKeyFile, "tls-private-key-file", "", "Path to the PEM encoded private key of the certificate given by --tls-cert-file.")
+	o.flags.StringVar(&o.TLSClientCAFile, "tls-client-ca-file", "", "Path to a PEM encoded CA bundle. If set, requests are authenticated by a client certificate signed by the CA, using its common name as user and its organizations as groups. Requires --tls-cert-file.")
+	o.flags.BoolVar(&o.EnableKubernetesAuth, "enable-kubernetes-auth", false, "Authenticate requests by their bearer token via TokenReview and authorize them via SubjectAccessReview of a non-resource request to their path. /healthz and /readyz are not protected. Requires --tls-cert-file and --tls-private-key-file.")
+	o.flags.StringVar(&o.RemoteWriteURL, "remote-write-url", "", "URL of a Prometheus remote write endpoint to periodically push all metrics to. The metrics endpoints are served regardless.")
+	o.flags.DurationVar(&o.RemoteWriteInterval, "remote-write-interval", 30*time.Second, "Interval between two pushes of all metrics via remote write.")
+	o.flags.DurationVar(&o.RemoteWriteTimeout, "remote-write-timeout", 30*time.Second, "Timeout of a single remote write request.")
+	o.flags.IntVar(&o.RemoteWriteShards, "remote-write-shards", 4, "Number of queues pushing samples concurrently via remote write.")
+	o.flags.IntVar(&o.RemoteWriteMaxSamplesPerSend, "remote-write-max-samples-per-send", 2000, "Maximum number of samples per remote write request.")
+	o.flags.IntVar(&o.RemoteWriteMaxRetries, "remote-write-max-retries", 3, "Maximum number of retries of a remote write request failing with a recoverable error, after which its samples are dropped.")
+	o.flags.StringToStringVar(&o.RemoteWriteExternalLabels, "remote-write-external-labels", map[string]string{}, "Labels added to all series pushed via remote write, e.g. cluster=edge-1.")
+	o.flags.StringVar(&o.OTLPEndpoint, "otlp-endpoint", "", "URL of an OpenTelemetry receiver to periodically export all metrics to via OTLP, e.g. http://otel-collector:4318. The https scheme enables TLS. The metrics endpoints are served regardless.")
+	o.flags.StringVar(&o.OTLPProtocol, "otlp-protocol", "http/protobuf", "Protocol of the OTLP export, either grpc or http/protobuf.")
+	o.flags.DurationVar(&o.OTLPInterval, "otlp-interval", 30*time.Second, "Interval between two exports of all metrics via OTLP.")
+	o.flags.DurationVar(&o.OTLPTimeout, "otlp-timeout", 10*time.Second, "Timeout of a single OTLP export request.")
+	o.flags.IntVar(&o.WatchBufferSize, "watch-buffer-size", 1000, "Number of events buffered per client of the /api/v1/watch stream. The events of a client falling further behind are dropped in favor of a resync event.")
 }
 
 // Parse parses the flag definitions from the argument list.
@@ -17,8 +17,10 @@ limitations under the License.
 package options
 
 import (
+	"fmt"
 	"sort"
 	"strings"
+	"time"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
@@ -126,3 +128,113 @@ func (n *NamespaceList) Set(value string) error {
 func (n *NamespaceList) Type() string {
 	return "string"
 }
+
+// CollectorDurations represents a duration per collector.
+type CollectorDurations map[string]time.Duration
+
+func (c *CollectorDurations) String() string {
+	s := *c
+	pairs := make([]string, 0, len(s))
+	for col, d := range s {
+		pairs = append(pairs, col+"="+d.String())
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// Set converts a comma-separated string of collector=duration pairs, e.g.
+// jobs=10m,pods=5m, into the CollectorDurations.
+func (c *CollectorDurations) Set(value string) error {
+	s := *c
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if len(pair) == 0 {
+			continue
+		}
+
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("invalid collector duration %q, expected collector=duration", pair)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return fmt.Errorf("invalid duration of collector %s: %v", parts[0], err)
+		}
+		if d < 0 {
+			return fmt.Errorf("invalid duration of collector %s: must not be negative", parts[0])
+		}
+		s[strings.TrimSpace(parts[0])] = d
+	}
+	return nil
+}
+
+// Type returns a descriptive string about the CollectorDurations type.
+func (c *CollectorDurations) Type() string {
+	return "string"
+}
+
+// KeyAllowlist represents the Kubernetes label or annotation keys allowed per
+// collector. Keys may contain * matching any sequence of characters.
+type KeyAllowlist map[string][]string
+
+func (l *KeyAllowlist) String() string {
+	s := *l
+	pairs := make([]string, 0, len(s))
+	for col, keys := range s {
+		pairs = append(pairs, col+"=["+strings.Join(keys, ",")+"]")
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// Set converts a comma-separated string of collector=[key,...] pairs, e.g.
+// pods=[app,team],nodes=[*], into the KeyAllowlist.
+func (l *KeyAllowlist) Set(value string) error {
+	s := *l
+	rest := strings.TrimSpace(value)
+	for len(rest) > 0 {
+		eq := strings.Index(rest, "=")
+		if eq < 0 {
+			return fmt.Errorf("invalid key allowlist %q, expected collector=[key,...]", rest)
+		}
+		col := strings.TrimSpace(rest[:eq])
+		rest = strings.TrimSpace(rest[eq+1:])
+		if col == "" || !strings.HasPrefix(rest, "[") {
+			return fmt.Errorf("invalid key allowlist of collector %q, expected collector=[key,...]", col)
+		}
+		end := strings.Index(rest, "]")
+		if end < 0 {
+			return fmt.Errorf("invalid key allowlist of collector %s, missing ]", col)
+		}
+
+		keys := append([]string{}, s[col]...)
+		for _, key := range strings.Split(rest[1:end], ",") {
+			key = strings.TrimSpace(key)
+			if len(key) != 0 {
+				keys = append(keys, key)
+			}
+		}
+		s[col] = keys
+
+		rest = strings.TrimSpace(rest[end+1:])
+		if len(rest) > 0 {
+			if rest[0] != ',' {
+				return fmt.Errorf("invalid key allowlist of collector %s, expected , after ]", col)
+			}
+			rest = strings.TrimSpace(rest[1:])
+		}
+	}
+	return nil
+}
+
+// Type returns a descriptive string about the KeyAllowlist type.
+func (l *KeyAllowlist) Type() string {
+	return "string"
+}
+
+// ListSelector restricts the objects listed and watched by a collector
+// server-side to the ones matching a label and a field selector.
+type ListSelector struct {
+	LabelSelector string `json:"labelSelector,omitempty"`
+	FieldSelector string `json:"fieldSelector,omitempty"`
+}
@@ -19,6 +19,7 @@ package options
 import (
 	"reflect"
 	"testing"
+	"time"
 )
 
 func TestCollectorSetSet(t *testing.T) {
@@ -116,3 +117,109 @@ func TestMetricSetSet(t *testing.T) {
 		}
 	}
 }
+
+func TestCollectorDurationsSet(t *testing.T) {
+	tests := []struct {
+		Desc        string
+		Value       string
+		Wanted      CollectorDurations
+		WantedError bool
+	}{
+		{
+			Desc:   "empty collector durations",
+			Value:  "",
+			Wanted: CollectorDurations{},
+		},
+		{
+			Desc:  "normal collector durations",
+			Value: "jobs=10m, pods=30s",
+			Wanted: CollectorDurations{
+				"jobs": 10 * time.Minute,
+				"pods": 30 * time.Second,
+			},
+		},
+		{
+			Desc:        "missing duration",
+			Value:       "jobs",
+			Wanted:      CollectorDurations{},
+			WantedError: true,
+		},
+		{
+			Desc:        "invalid duration",
+			Value:       "jobs=10",
+			Wanted:      CollectorDurations{},
+			WantedError: true,
+		},
+		{
+			Desc:        "negative duration",
+			Value:       "jobs=-1m",
+			Wanted:      CollectorDurations{},
+			WantedError: true,
+		},
+	}
+
+	for _, test := range tests {
+		cd := &CollectorDurations{}
+		gotError := cd.Set(test.Value)
+		if !(((gotError == nil && !test.WantedError) || (gotError != nil && test.WantedError)) && reflect.DeepEqual(*cd, test.Wanted)) {
+			t.Errorf("Test error for Desc: %s. Want: %+v. Got: %+v. Wanted Error: %v, Got Error: %v", test.Desc, test.Wanted, *cd, test.WantedError, gotError)
+		}
+	}
+}
+
+func TestKeyAllowlistSet(t *testing.T) {
+	tests := []struct {
+		Desc        string
+		Value       string
+		Wanted      KeyAllowlist
+		WantedError bool
+	}{
+		{
+			Desc:   "empty key allowlist",
+			Value:  "",
+			Wanted: KeyAllowlist{},
+		},
+		{
+			Desc:  "normal key allowlist",
+			Value: "pods=[app, team], nodes=[*],namespaces=[]",
+			Wanted: KeyAllowlist{
+				"pods":       []string{"app", "team"},
+				"nodes":      []string{"*"},
+				"namespaces": []string{},
+			},
+		},
+		{
+			Desc:  "wildcard keys",
+			Value: "deployments=[app.kubernetes.io/*]",
+			Wanted: KeyAllowlist{
+				"deployments": []string{"app.kubernetes.io/*"},
+			},
+		},
+		{
+			Desc:        "missing brackets",
+			Value:       "pods=app",
+			Wanted:      KeyAllowlist{},
+			WantedError: true,
+		},
+		{
+			Desc:        "missing closing bracket",
+			Value:       "pods=[app",
+			Wanted:      KeyAllowlist{},
+			WantedError: true,
+		},
+		{
+			Desc:        "missing collector",
+			Value:       "[app]",
+			Wanted:      KeyAllowlist{},
+			WantedError: true,
+		},
+	}
+
+	for _, test := range tests {
+		l := &KeyAllowlist{}
+		gotError := l.Set(test.Value)
+		if !(((gotError == nil && !test.WantedError) || (gotError != nil && test.WantedError)) && reflect.DeepEqual(*l, test.Wanted)) {
+			t.Errorf("Test error for Desc: %s. Want: %+v. Got: %+v. Wanted Error: %v, Got Error: %v", test.Desc, test.Wanted, *l, test.WantedError, gotError)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package otlp
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"k8s.io/kube-state-metrics/pkg/version"
+)
+
+// The OTLP/gRPC export is a single unary call, which is implemented directly on
+// top of HTTP/2 following
+// https://github.com/grpc/grpc/blob/master/doc/PROTOCOL-HTTP2.md instead of
+// depending on the whole gRPC stack.
+
+// dialFunc returns the function dialing connections of the HTTP/2 transport.
+// For the http scheme the connection is not encrypted.
+func dialFunc(scheme string) func(network, addr string, cfg *tls.Config) (net.Conn, error) {
+	if scheme == "http" {
+		return func(network, addr string, _ *tls.Config) (net.Conn, error) {
+			return net.Dial(network, addr)
+		}
+	}
+	return nil
+}
+
+// sendGRPC sends an export request via OTLP/gRPC.
+func (e *Exporter) sendGRPC(ctx context.Context, b []byte) error {
+	// Each message is prefixed with a compression flag and its length.
+	frame := make([]byte, 5+len(b))
+	binary.BigEndian.PutUint32(frame[1:5], uint32(len(b)))
+	copy(frame[5:], b)
+
+	req, err := http.NewRequest(http.MethodPost, e.url, bytes.NewReader(frame))
+	if err != nil {
+		return errors.Wrap(err, "create request")
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+	req.Header.Set("User-Agent", "kube-state-metrics/"+version.Release)
+	if e.config.Timeout > 0 {
+		req.Header.Set("Grpc-Timeout", fmt.Sprintf("%dm", e.config.Timeout.Milliseconds()))
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("server returned HTTP status %s", resp.Status)
+	}
+	if ct := resp.Header.Get("Content-Type"); !isGRPC(ct) {
+		return fmt.Errorf("server returned unexpected content type %q", ct)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return errors.Wrap(err, "read response")
+	}
+
+	// Errors are usually sent as trailers, but responses without a message
+	// may carry the status in the headers instead.
+	status, message := resp.Header.Get("Grpc-Status"), resp.Header.Get("Grpc-Message")
+	if status == "" {
+		status, message = resp.Trailer.Get("Grpc-Status"), resp.Trailer.Get("Grpc-Message")
+	}
+	if status != "0" {
+		if msg, err := url.PathUnescape(message); err == nil {
+			message = msg
+		}
+		return fmt.Errorf("server returned gRPC status %s: %s", status, message)
+	}
+
+	if len(body) < 5 {
+		return nil
+	}
+	if body[0] != 0 {
+		return errors.New("compressed gRPC responses are not supported")
+	}
+	n := binary.BigEndian.Uint32(body[1:5])
+	if int(n) > len(body)-5 {
+		return errors.New("truncated gRPC response")
+	}
+
+	return decodeResponse(io.LimitReader(bytes.NewReader(body[5:]), int64(n)))
+}
+
+// isGRPC returns whether the given content type is a gRPC one.
+func isGRPC(contentType string) bool {
+	return contentType == "application/grpc" || strings.HasPrefix(contentType, "application/grpc+")
+}
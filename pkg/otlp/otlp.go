@@ -0,0 +1,363 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package otlp
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/net/http2"
+	"k8s.io/klog"
+
+	ksmmetric "k8s.io/kube-state-metrics/pkg/metric"
+	metricsstore "k8s.io/kube-state-metrics/pkg/metrics_store"
+	"k8s.io/kube-state-metrics/pkg/version"
+)
+
+const (
+	// ProtocolGRPC exports metrics via OTLP/gRPC.
+	ProtocolGRPC = "grpc"
+	// ProtocolHTTPProtobuf exports metrics via OTLP/HTTP with protobuf
+	// encoded payloads.
+	ProtocolHTTPProtobuf = "http/protobuf"
+
+	// maxDataPointsPerRequest bounds the size of a single export request,
+	// receivers commonly limit the size of messages to 4MiB.
+	maxDataPointsPerRequest = 5000
+
+	scopeName   = "kube-state-metrics"
+	grpcService = "/opentelemetry.proto.collector.metrics.v1.MetricsService/Export"
+)
+
+// Config configures the OTLP exporter.
+type Config struct {
+	// Endpoint is the URL of the OTLP receiver, e.g.
+	// http://otel-collector:4318 for OTLP/HTTP or http://otel-collector:4317
+	// for OTLP/gRPC. The https scheme enables TLS.
+	Endpoint string
+	// Protocol is either ProtocolGRPC or ProtocolHTTPProtobuf.
+	Protocol string
+	// Interval is the interval between two exports of all metrics.
+	Interval time.Duration
+	// Timeout is the timeout of a single export request.
+	Timeout time.Duration
+}
+
+// WalkFunc calls the given function for each object with its generated metric
+// families.
+type WalkFunc func(f func(collector string, o metricsstore.Object, families []metricsstore.FamilyByteSlicer))
+
+// metrics are the self metrics of the OTLP exporter.
+type metrics struct {
+	dataPointsTotal *prometheus.CounterVec
+	exportDuration  prometheus.Histogram
+}
+
+func newMetrics(r *prometheus.Registry) *metrics {
+	m := &metrics{
+		dataPointsTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "kube_state_metrics_otlp_data_points_total",
+				Help: "Number of total data points exported via OTLP in kube-state-metrics, by result (success or failure).",
+			},
+			[]string{"result"},
+		),
+		exportDuration: prometheus.NewHistogram(
+			prometheus.HistogramOpts{
+				Name:    "kube_state_metrics_otlp_export_duration_seconds",
+				Help:    "Duration of OTLP export requests in kube-state-metrics.",
+				Buckets: prometheus.DefBuckets,
+			},
+		),
+	}
+
+	if r != nil {
+		r.MustRegister(
+			m.dataPointsTotal,
+			m.exportDuration,
+		)
+	}
+
+	return m
+}
+
+// Exporter periodically exports the metrics of all objects to an
+// OpenTelemetry receiver. Each object becomes a resource identified by its
+// namespace, name and UID, its metrics become gauges and sums.
+type Exporter struct {
+	config  Config
+	walk    WalkFunc
+	url     string
+	client  *http.Client
+	metrics *metrics
+	// start is the start time of the cumulative sums of counters whose
+	// creation time is unknown.
+	start time.Time
+}
+
+// New returns a new Exporter exporting the objects walked by walk according to
+// the given config. Its self metrics are registered with the given registry.
+func New(config Config, walk WalkFunc, r *prometheus.Registry) (*Exporter, error) {
+	u, err := url.Parse(config.Endpoint)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse OTLP endpoint")
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, errors.Errorf("OTLP endpoint %q must have an http or https scheme", config.Endpoint)
+	}
+	if config.Interval <= 0 {
+		return nil, errors.New("OTLP export interval must be positive")
+	}
+
+	e := &Exporter{
+		config:  config,
+		walk:    walk,
+		metrics: newMetrics(r),
+		start:   time.Now(),
+	}
+
+	base := strings.TrimSuffix(config.Endpoint, "/")
+	switch config.Protocol {
+	case ProtocolHTTPProtobuf:
+		e.url = base + "/v1/metrics"
+		e.client = &http.Client{Timeout: config.Timeout}
+	case ProtocolGRPC:
+		// gRPC is HTTP/2 only, without TLS the connection starts with the
+		// HTTP/2 preface right away (h2c).
+		e.url = base + grpcService
+		e.client = &http.Client{
+			Timeout: config.Timeout,
+			Transport: &http2.Transport{
+				AllowHTTP: u.Scheme == "http",
+				DialTLS:   dialFunc(u.Scheme),
+			},
+		}
+	default:
+		return nil, errors.Errorf("unknown OTLP protocol %q, must be %q or %q", config.Protocol, ProtocolGRPC, ProtocolHTTPProtobuf)
+	}
+
+	return e, nil
+}
+
+// Run exports the metrics on every interval until the given context is
+// canceled.
+func (e *Exporter) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := e.export(ctx, time.Now()); err != nil {
+				klog.Errorf("failed to export metrics via OTLP: %v", err)
+			}
+		}
+	}
+}
+
+// export converts the metrics of all objects to data points at the given time
+// and sends them in batches. Failed batches are not retried, the next export
+// sends the current state of all objects again.
+func (e *Exporter) export(ctx context.Context, now time.Time) error {
+	var (
+		resources []*resourceMetrics
+		points    []int
+	)
+
+	// Only convert while walking, sending is done afterwards so that the
+	// stores are not blocked by slow receivers.
+	e.walk(func(collector string, o metricsstore.Object, families []metricsstore.FamilyByteSlicer) {
+		rm, n := e.resourceMetrics(collector, o, ksmmetric.Families(families), now)
+		resources = append(resources, rm)
+		points = append(points, n)
+	})
+
+	var failed error
+	for start := 0; start < len(resources); {
+		end, n := start, 0
+		for end < len(resources) && (end == start || n+points[end] <= maxDataPointsPerRequest) {
+			n += points[end]
+			end++
+		}
+
+		result := "success"
+		if err := e.send(ctx, &exportMetricsServiceRequest{ResourceMetrics: resources[start:end]}); err != nil {
+			failed = err
+			result = "failure"
+		}
+		e.metrics.dataPointsTotal.WithLabelValues(result).Add(float64(n))
+
+		start = end
+	}
+
+	return failed
+}
+
+// resourceMetrics converts the metric families of the given object to a
+// resource with one metric per family with at least one metric. It also
+// returns the number of data points.
+func (e *Exporter) resourceMetrics(collector string, o metricsstore.Object, families []*ksmmetric.Family, now time.Time) (*resourceMetrics, int) {
+	kind := singular(collector)
+	attributes := make([]*keyValue, 0, 3)
+	if o.Namespace != "" {
+		attributes = append(attributes, stringKeyValue("k8s.namespace.name", o.Namespace))
+	}
+	attributes = append(attributes,
+		stringKeyValue("k8s."+kind+".name", o.Name),
+		stringKeyValue("k8s."+kind+".uid", string(o.UID)),
+	)
+
+	timestamp := uint64(now.UnixNano())
+	start := uint64(e.start.UnixNano())
+
+	n := 0
+	ms := make([]*metric, 0, len(families))
+	for _, family := range families {
+		if len(family.Metrics) == 0 {
+			continue
+		}
+		m := &metric{Name: family.Name, Description: family.Help, Unit: family.Unit}
+
+		dataPoints := make([]*numberDataPoint, 0, len(family.Metrics))
+		for _, fm := range family.Metrics {
+			dp := &numberDataPoint{
+				TimeUnixNano: timestamp,
+				AsDouble:     proto.Float64(fm.Value),
+				Attributes:   make([]*keyValue, 0, len(fm.LabelKeys)),
+			}
+			for i, key := range fm.LabelKeys {
+				dp.Attributes = append(dp.Attributes, stringKeyValue(key, fm.LabelValues[i]))
+			}
+			if family.Type == ksmmetric.Counter {
+				dp.StartTimeUnixNano = start
+				if fm.Created != 0 {
+					dp.StartTimeUnixNano = uint64(fm.Created * float64(time.Second))
+				}
+			}
+			dataPoints = append(dataPoints, dp)
+		}
+		n += len(dataPoints)
+
+		if family.Type == ksmmetric.Counter {
+			m.Sum = &sum{
+				DataPoints:             dataPoints,
+				AggregationTemporality: aggregationTemporalityCumulative,
+				IsMonotonic:            true,
+			}
+		} else {
+			m.Gauge = &gauge{DataPoints: dataPoints}
+		}
+		ms = append(ms, m)
+	}
+
+	return &resourceMetrics{
+		Resource: &resource{Attributes: attributes},
+		ScopeMetrics: []*scopeMetrics{{
+			Scope:   &instrumentationScope{Name: scopeName, Version: version.Release},
+			Metrics: ms,
+		}},
+	}, n
+}
+
+// send sends a single export request with the configured protocol.
+func (e *Exporter) send(ctx context.Context, req *exportMetricsServiceRequest) error {
+	b, err := proto.Marshal(req)
+	if err != nil {
+		return errors.Wrap(err, "marshal export request")
+	}
+
+	start := time.Now()
+	defer func() { e.metrics.exportDuration.Observe(time.Since(start).Seconds()) }()
+
+	if e.config.Protocol == ProtocolGRPC {
+		return e.sendGRPC(ctx, b)
+	}
+	return e.sendHTTP(ctx, b)
+}
+
+// sendHTTP sends an export request via OTLP/HTTP.
+func (e *Exporter) sendHTTP(ctx context.Context, b []byte) error {
+	req, err := http.NewRequest(http.MethodPost, e.url, bytes.NewReader(b))
+	if err != nil {
+		return errors.Wrap(err, "create request")
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("User-Agent", "kube-state-metrics/"+version.Release)
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("server returned HTTP status %s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+
+	return decodeResponse(resp.Body)
+}
+
+// decodeResponse reads an ExportMetricsServiceResponse and returns an error if
+// data points were rejected.
+func decodeResponse(r io.Reader) error {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return errors.Wrap(err, "read response")
+	}
+
+	resp := &exportMetricsServiceResponse{}
+	if err := proto.Unmarshal(b, resp); err != nil {
+		return errors.Wrap(err, "unmarshal response")
+	}
+
+	if ps := resp.PartialSuccess; ps != nil && ps.RejectedDataPoints > 0 {
+		return fmt.Errorf("receiver rejected %d data points: %s", ps.RejectedDataPoints, ps.ErrorMessage)
+	}
+	return nil
+}
+
+// stringKeyValue returns an attribute with a string value.
+func stringKeyValue(key, value string) *keyValue {
+	return &keyValue{Key: key, Value: &anyValue{StringValue: proto.String(value)}}
+}
+
+// singular returns the singular kind of the objects of the given collector,
+// as used in the names of the OpenTelemetry k8s resource attributes.
+func singular(collector string) string {
+	switch {
+	case collector == "endpoints":
+		return collector
+	case strings.HasSuffix(collector, "sses"):
+		// ingresses and storageclasses
+		return strings.TrimSuffix(collector, "es")
+	}
+	return strings.TrimSuffix(collector, "s")
+}
@@ -0,0 +1,365 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package otlp
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/net/http2"
+
+	ksmmetric "k8s.io/kube-state-metrics/pkg/metric"
+	metricsstore "k8s.io/kube-state-metrics/pkg/metrics_store"
+	"k8s.io/kube-state-metrics/pkg/version"
+)
+
+func testNodeFamilies(node string) []metricsstore.FamilyByteSlicer {
+	return []metricsstore.FamilyByteSlicer{
+		&ksmmetric.Family{
+			Name: "kube_node_info",
+			Help: "Information about a cluster node.",
+			Type: ksmmetric.Gauge,
+			Metrics: []*ksmmetric.Metric{
+				{LabelKeys: []string{"node"}, LabelValues: []string{node}, Value: 1},
+			},
+		},
+	}
+}
+
+func testWalk(f func(collector string, o metricsstore.Object, families []metricsstore.FamilyByteSlicer)) {
+	f("nodes", metricsstore.Object{UID: "uid-node1", Name: "node1"}, testNodeFamilies("node1"))
+	f("pods", metricsstore.Object{UID: "uid-pod0", Namespace: "default", Name: "pod0"}, []metricsstore.FamilyByteSlicer{
+		&ksmmetric.Family{
+			Name: "kube_pod_info",
+			Help: "Information about pod.",
+			Type: ksmmetric.Gauge,
+			Metrics: []*ksmmetric.Metric{
+				{LabelKeys: []string{"namespace", "pod", "node"}, LabelValues: []string{"default", "pod0", "node1"}, Value: 1},
+			},
+		},
+		&ksmmetric.Family{
+			Name: "kube_pod_container_status_restarts_total",
+			Help: "The number of container restarts per container.",
+			Type: ksmmetric.Counter,
+			Metrics: []*ksmmetric.Metric{
+				{LabelKeys: []string{"namespace", "pod", "container"}, LabelValues: []string{"default", "pod0", "c"}, Value: 3, Created: 1450000000},
+				{LabelKeys: []string{"namespace", "pod", "container"}, LabelValues: []string{"default", "pod0", "d"}, Value: 0},
+			},
+		},
+		&ksmmetric.Family{
+			Name: "kube_pod_start_time",
+			Help: "Start time in unix timestamp for a pod.",
+			Type: ksmmetric.Gauge,
+			Unit: "seconds",
+			Metrics: []*ksmmetric.Metric{
+				{LabelKeys: []string{"namespace", "pod"}, LabelValues: []string{"default", "pod0"}, Value: 1450000000},
+			},
+		},
+		&ksmmetric.Family{
+			Name: "kube_pod_labels",
+			Type: ksmmetric.Gauge,
+		},
+	})
+}
+
+// receiver is an OTLP receiver for both protocols recording the received
+// requests.
+type receiver struct {
+	mtx      sync.Mutex
+	requests []*exportMetricsServiceRequest
+	// grpcStatus is the gRPC status of the responses, 0 if empty.
+	grpcStatus string
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rc.mtx.Lock()
+	defer rc.mtx.Unlock()
+
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	grpc := isGRPC(r.Header.Get("Content-Type"))
+	switch {
+	case grpc && r.URL.Path == grpcService && r.ProtoMajor == 2:
+		if len(b) < 5 || int(binary.BigEndian.Uint32(b[1:5])) != len(b)-5 {
+			http.Error(w, "invalid gRPC frame", http.StatusBadRequest)
+			return
+		}
+		b = b[5:]
+	case !grpc && r.URL.Path == "/v1/metrics" && r.Header.Get("Content-Type") == "application/x-protobuf":
+	default:
+		http.Error(w, "unexpected request", http.StatusBadRequest)
+		return
+	}
+
+	req := &exportMetricsServiceRequest{}
+	if err := proto.Unmarshal(b, req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rc.requests = append(rc.requests, req)
+
+	if !grpc {
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		return
+	}
+
+	status := rc.grpcStatus
+	if status == "" {
+		status = "0"
+	}
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Write([]byte{0, 0, 0, 0, 0})
+	w.Header().Set(http.TrailerPrefix+"Grpc-Status", status)
+	w.Header().Set(http.TrailerPrefix+"Grpc-Message", "test%20failure")
+}
+
+func (rc *receiver) received() []*exportMetricsServiceRequest {
+	rc.mtx.Lock()
+	defer rc.mtx.Unlock()
+
+	return append([]*exportMetricsServiceRequest{}, rc.requests...)
+}
+
+func newTestExporter(t *testing.T, endpoint, protocol string, walk WalkFunc) *Exporter {
+	e, err := New(Config{
+		Endpoint: endpoint,
+		Protocol: protocol,
+		Interval: time.Hour,
+		Timeout:  5 * time.Second,
+	}, walk, prometheus.NewRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.start = time.Unix(1400000000, 0)
+
+	return e
+}
+
+// newGRPCServer returns a TLS server supporting HTTP/2 and makes the exporter
+// trust its certificate.
+func newGRPCServer(rc *receiver) *httptest.Server {
+	server := httptest.NewUnstartedServer(rc)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	return server
+}
+
+func trustServer(e *Exporter, server *httptest.Server) {
+	pool := x509.NewCertPool()
+	pool.AddCert(server.Certificate())
+	e.client.Transport.(*http2.Transport).TLSClientConfig = &tls.Config{RootCAs: pool}
+}
+
+func expectedRequest(now time.Time) *exportMetricsServiceRequest {
+	scope := &instrumentationScope{Name: "kube-state-metrics", Version: version.Release}
+	timestamp := uint64(now.UnixNano())
+
+	return &exportMetricsServiceRequest{
+		ResourceMetrics: []*resourceMetrics{
+			{
+				Resource: &resource{Attributes: []*keyValue{
+					stringKeyValue("k8s.node.name", "node1"),
+					stringKeyValue("k8s.node.uid", "uid-node1"),
+				}},
+				ScopeMetrics: []*scopeMetrics{{
+					Scope: scope,
+					Metrics: []*metric{
+						{
+							Name:        "kube_node_info",
+							Description: "Information about a cluster node.",
+							Gauge: &gauge{DataPoints: []*numberDataPoint{{
+								TimeUnixNano: timestamp,
+								AsDouble:     proto.Float64(1),
+								Attributes:   []*keyValue{stringKeyValue("node", "node1")},
+							}}},
+						},
+					},
+				}},
+			},
+			{
+				Resource: &resource{Attributes: []*keyValue{
+					stringKeyValue("k8s.namespace.name", "default"),
+					stringKeyValue("k8s.pod.name", "pod0"),
+					stringKeyValue("k8s.pod.uid", "uid-pod0"),
+				}},
+				ScopeMetrics: []*scopeMetrics{{
+					Scope: scope,
+					Metrics: []*metric{
+						{
+							Name:        "kube_pod_info",
+							Description: "Information about pod.",
+							Gauge: &gauge{DataPoints: []*numberDataPoint{{
+								TimeUnixNano: timestamp,
+								AsDouble:     proto.Float64(1),
+								Attributes: []*keyValue{
+									stringKeyValue("namespace", "default"),
+									stringKeyValue("pod", "pod0"),
+									stringKeyValue("node", "node1"),
+								},
+							}}},
+						},
+						{
+							Name:        "kube_pod_container_status_restarts_total",
+							Description: "The number of container restarts per container.",
+							Sum: &sum{
+								DataPoints: []*numberDataPoint{
+									{
+										StartTimeUnixNano: uint64(time.Unix(1450000000, 0).UnixNano()),
+										TimeUnixNano:      timestamp,
+										AsDouble:          proto.Float64(3),
+										Attributes: []*keyValue{
+											stringKeyValue("namespace", "default"),
+											stringKeyValue("pod", "pod0"),
+											stringKeyValue("container", "c"),
+										},
+									},
+									{
+										StartTimeUnixNano: uint64(time.Unix(1400000000, 0).UnixNano()),
+										TimeUnixNano:      timestamp,
+										AsDouble:          proto.Float64(0),
+										Attributes: []*keyValue{
+											stringKeyValue("namespace", "default"),
+											stringKeyValue("pod", "pod0"),
+											stringKeyValue("container", "d"),
+										},
+									},
+								},
+								AggregationTemporality: aggregationTemporalityCumulative,
+								IsMonotonic:            true,
+							},
+						},
+						{
+							Name:        "kube_pod_start_time",
+							Description: "Start time in unix timestamp for a pod.",
+							Unit:        "seconds",
+							Gauge: &gauge{DataPoints: []*numberDataPoint{{
+								TimeUnixNano: timestamp,
+								AsDouble:     proto.Float64(1450000000),
+								Attributes: []*keyValue{
+									stringKeyValue("namespace", "default"),
+									stringKeyValue("pod", "pod0"),
+								},
+							}}},
+						},
+					},
+				}},
+			},
+		},
+	}
+}
+
+func TestExporter(t *testing.T) {
+	for _, protocol := range []string{ProtocolHTTPProtobuf, ProtocolGRPC} {
+		t.Run(protocol, func(t *testing.T) {
+			rc := &receiver{}
+			var (
+				server *httptest.Server
+				e      *Exporter
+			)
+			if protocol == ProtocolGRPC {
+				server = newGRPCServer(rc)
+				e = newTestExporter(t, server.URL, protocol, testWalk)
+				trustServer(e, server)
+			} else {
+				server = httptest.NewServer(rc)
+				e = newTestExporter(t, server.URL, protocol, testWalk)
+			}
+			defer server.Close()
+
+			now := time.Unix(1500000000, 0)
+			if err := e.export(context.Background(), now); err != nil {
+				t.Fatal(err)
+			}
+
+			got := rc.received()
+			want := []*exportMetricsServiceRequest{expectedRequest(now)}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("expected requests:\n%v\nbut got:\n%v", want, got)
+			}
+		})
+	}
+}
+
+func TestExporterGRPCError(t *testing.T) {
+	rc := &receiver{grpcStatus: "14"}
+	server := newGRPCServer(rc)
+	defer server.Close()
+
+	e := newTestExporter(t, server.URL, ProtocolGRPC, testWalk)
+	trustServer(e, server)
+
+	err := e.export(context.Background(), time.Now())
+	if err == nil || err.Error() != "server returned gRPC status 14: test failure" {
+		t.Errorf("expected gRPC status error, got %v", err)
+	}
+}
+
+func TestExporterBatches(t *testing.T) {
+	rc := &receiver{}
+	server := httptest.NewServer(rc)
+	defer server.Close()
+
+	objects := maxDataPointsPerRequest + 1
+	walk := func(f func(collector string, o metricsstore.Object, families []metricsstore.FamilyByteSlicer)) {
+		for i := 0; i < objects; i++ {
+			name := fmt.Sprintf("node%d", i)
+			f("nodes", metricsstore.Object{Name: name}, testNodeFamilies(name))
+		}
+	}
+	e := newTestExporter(t, server.URL, ProtocolHTTPProtobuf, walk)
+
+	if err := e.export(context.Background(), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	got := rc.received()
+	if len(got) != 2 || len(got[0].ResourceMetrics) != maxDataPointsPerRequest || len(got[1].ResourceMetrics) != 1 {
+		t.Errorf("expected 2 requests with %d and 1 resources", maxDataPointsPerRequest)
+	}
+}
+
+func TestSingular(t *testing.T) {
+	tests := map[string]string{
+		"pods":           "pod",
+		"endpoints":      "endpoints",
+		"ingresses":      "ingress",
+		"storageclasses": "storageclass",
+		"nodes":          "node",
+	}
+
+	for collector, want := range tests {
+		if got := singular(collector); got != want {
+			t.Errorf("expected singular of %q to be %q, got %q", collector, want, got)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package otlp
+
+import (
+	"github.com/golang/protobuf/proto"
+)
+
+// The following messages are the subset of the OTLP metrics protocol
+// (opentelemetry/proto/collector/metrics/v1 and metrics/v1) needed to export
+// gauges and sums. Fields of a oneof are declared as optional fields, which
+// they are equivalent to on the wire.
+
+// exportMetricsServiceRequest is the ExportMetricsServiceRequest message.
+type exportMetricsServiceRequest struct {
+	ResourceMetrics []*resourceMetrics `protobuf:"bytes,1,rep,name=resource_metrics,proto3"`
+}
+
+func (m *exportMetricsServiceRequest) Reset()         { *m = exportMetricsServiceRequest{} }
+func (m *exportMetricsServiceRequest) String() string { return proto.CompactTextString(m) }
+func (*exportMetricsServiceRequest) ProtoMessage()    {}
+
+// exportMetricsServiceResponse is the ExportMetricsServiceResponse message.
+type exportMetricsServiceResponse struct {
+	PartialSuccess *exportMetricsPartialSuccess `protobuf:"bytes,1,opt,name=partial_success,proto3"`
+}
+
+func (m *exportMetricsServiceResponse) Reset()         { *m = exportMetricsServiceResponse{} }
+func (m *exportMetricsServiceResponse) String() string { return proto.CompactTextString(m) }
+func (*exportMetricsServiceResponse) ProtoMessage()    {}
+
+// exportMetricsPartialSuccess is the ExportMetricsPartialSuccess message.
+type exportMetricsPartialSuccess struct {
+	RejectedDataPoints int64  `protobuf:"varint,1,opt,name=rejected_data_points,proto3"`
+	ErrorMessage       string `protobuf:"bytes,2,opt,name=error_message,proto3"`
+}
+
+func (m *exportMetricsPartialSuccess) Reset()         { *m = exportMetricsPartialSuccess{} }
+func (m *exportMetricsPartialSuccess) String() string { return proto.CompactTextString(m) }
+func (*exportMetricsPartialSuccess) ProtoMessage()    {}
+
+// resourceMetrics is the ResourceMetrics message.
+type resourceMetrics struct {
+	Resource     *resource       `protobuf:"bytes,1,opt,name=resource,proto3"`
+	ScopeMetrics []*scopeMetrics `protobuf:"bytes,2,rep,name=scope_metrics,proto3"`
+}
+
+func (m *resourceMetrics) Reset()         { *m = resourceMetrics{} }
+func (m *resourceMetrics) String() string { return proto.CompactTextString(m) }
+func (*resourceMetrics) ProtoMessage()    {}
+
+// resource is the Resource message.
+type resource struct {
+	Attributes []*keyValue `protobuf:"bytes,1,rep,name=attributes,proto3"`
+}
+
+func (m *resource) Reset()         { *m = resource{} }
+func (m *resource) String() string { return proto.CompactTextString(m) }
+func (*resource) ProtoMessage()    {}
+
+// scopeMetrics is the ScopeMetrics message.
+type scopeMetrics struct {
+	Scope   *instrumentationScope `protobuf:"bytes,1,opt,name=scope,proto3"`
+	Metrics []*metric             `protobuf:"bytes,2,rep,name=metrics,proto3"`
+}
+
+func (m *scopeMetrics) Reset()         { *m = scopeMetrics{} }
+func (m *scopeMetrics) String() string { return proto.CompactTextString(m) }
+func (*scopeMetrics) ProtoMessage()    {}
+
+// instrumentationScope is the InstrumentationScope message.
+type instrumentationScope struct {
+	Name    string `protobuf:"bytes,1,opt,name=name,proto3"`
+	Version string `protobuf:"bytes,2,opt,name=version,proto3"`
+}
+
+func (m *instrumentationScope) Reset()         { *m = instrumentationScope{} }
+func (m *instrumentationScope) String() string { return proto.CompactTextString(m) }
+func (*instrumentationScope) ProtoMessage()    {}
+
+// metric is the Metric message. Exactly one of Gauge and Sum is set.
+type metric struct {
+	Name        string `protobuf:"bytes,1,opt,name=name,proto3"`
+	Description string `protobuf:"bytes,2,opt,name=description,proto3"`
+	Unit        string `protobuf:"bytes,3,opt,name=unit,proto3"`
+	Gauge       *gauge `protobuf:"bytes,5,opt,name=gauge"`
+	Sum         *sum   `protobuf:"bytes,7,opt,name=sum"`
+}
+
+func (m *metric) Reset()         { *m = metric{} }
+func (m *metric) String() string { return proto.CompactTextString(m) }
+func (*metric) ProtoMessage()    {}
+
+// gauge is the Gauge message.
+type gauge struct {
+	DataPoints []*numberDataPoint `protobuf:"bytes,1,rep,name=data_points,proto3"`
+}
+
+func (m *gauge) Reset()         { *m = gauge{} }
+func (m *gauge) String() string { return proto.CompactTextString(m) }
+func (*gauge) ProtoMessage()    {}
+
+// aggregationTemporalityCumulative is the AGGREGATION_TEMPORALITY_CUMULATIVE
+// value of the AggregationTemporality enum.
+const aggregationTemporalityCumulative = 2
+
+// sum is the Sum message.
+type sum struct {
+	DataPoints             []*numberDataPoint `protobuf:"bytes,1,rep,name=data_points,proto3"`
+	AggregationTemporality int32              `protobuf:"varint,2,opt,name=aggregation_temporality,proto3"`
+	IsMonotonic            bool               `protobuf:"varint,3,opt,name=is_monotonic,proto3"`
+}
+
+func (m *sum) Reset()         { *m = sum{} }
+func (m *sum) String() string { return proto.CompactTextString(m) }
+func (*sum) ProtoMessage()    {}
+
+// numberDataPoint is the NumberDataPoint message, with the value always set
+// as double.
+type numberDataPoint struct {
+	StartTimeUnixNano uint64      `protobuf:"fixed64,2,opt,name=start_time_unix_nano,proto3"`
+	TimeUnixNano      uint64      `protobuf:"fixed64,3,opt,name=time_unix_nano,proto3"`
+	AsDouble          *float64    `protobuf:"fixed64,4,opt,name=as_double"`
+	Attributes        []*keyValue `protobuf:"bytes,7,rep,name=attributes,proto3"`
+}
+
+func (m *numberDataPoint) Reset()         { *m = numberDataPoint{} }
+func (m *numberDataPoint) String() string { return proto.CompactTextString(m) }
+func (*numberDataPoint) ProtoMessage()    {}
+
+// keyValue is the KeyValue message.
+type keyValue struct {
+	Key   string    `protobuf:"bytes,1,opt,name=key,proto3"`
+	Value *anyValue `protobuf:"bytes,2,opt,name=value,proto3"`
+}
+
+func (m *keyValue) Reset()         { *m = keyValue{} }
+func (m *keyValue) String() string { return proto.CompactTextString(m) }
+func (*keyValue) ProtoMessage()    {}
+
+// anyValue is the AnyValue message, of which only string values are used.
+type anyValue struct {
+	StringValue *string `protobuf:"bytes,1,opt,name=string_value"`
+}
+
+func (m *anyValue) Reset()         { *m = anyValue{} }
+func (m *anyValue) String() string { return proto.CompactTextString(m) }
+func (*anyValue) ProtoMessage()    {}
@@ -0,0 +1,67 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package remotewrite
+
+import (
+	"github.com/golang/protobuf/proto"
+)
+
+// The following messages are the subset of the Prometheus remote write
+// protocol (prometheus/prompb/remote.proto and types.proto) needed to push
+// samples. They are defined here instead of importing the Prometheus server
+// module, which would pull in a large dependency tree.
+
+// writeRequest is the prometheus.WriteRequest message.
+type writeRequest struct {
+	Timeseries []*timeSeries `protobuf:"bytes,1,rep,name=timeseries,proto3"`
+}
+
+func (m *writeRequest) Reset()         { *m = writeRequest{} }
+func (m *writeRequest) String() string { return proto.CompactTextString(m) }
+func (*writeRequest) ProtoMessage()    {}
+
+// timeSeries is the prometheus.TimeSeries message. Labels have to be sorted by
+// name.
+type timeSeries struct {
+	Labels  []*label  `protobuf:"bytes,1,rep,name=labels,proto3"`
+	Samples []*sample `protobuf:"bytes,2,rep,name=samples,proto3"`
+}
+
+func (m *timeSeries) Reset()         { *m = timeSeries{} }
+func (m *timeSeries) String() string { return proto.CompactTextString(m) }
+func (*timeSeries) ProtoMessage()    {}
+
+// label is the prometheus.Label message.
+type label struct {
+	Name  string `protobuf:"bytes,1,opt,name=name,proto3"`
+	Value string `protobuf:"bytes,2,opt,name=value,proto3"`
+}
+
+func (m *label) Reset()         { *m = label{} }
+func (m *label) String() string { return proto.CompactTextString(m) }
+func (*label) ProtoMessage()    {}
+
+// sample is the prometheus.Sample message. The timestamp is in milliseconds
+// since the epoch.
+type sample struct {
+	Value     float64 `protobuf:"fixed64,1,opt,name=value,proto3"`
+	Timestamp int64   `protobuf:"varint,2,opt,name=timestamp,proto3"`
+}
+
+func (m *sample) Reset()         { *m = sample{} }
+func (m *sample) String() string { return proto.CompactTextString(m) }
+func (*sample) ProtoMessage()    {}
@@ -0,0 +1,352 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package remotewrite
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/klog"
+
+	"k8s.io/kube-state-metrics/pkg/metric"
+	metricsstore "k8s.io/kube-state-metrics/pkg/metrics_store"
+	"k8s.io/kube-state-metrics/pkg/version"
+)
+
+const (
+	minBackoff = 100 * time.Millisecond
+	maxBackoff = 5 * time.Second
+	// queueCapacity is the number of batches each shard queues before
+	// dropping samples.
+	queueCapacity = 100
+)
+
+// Config configures the remote write client.
+type Config struct {
+	// URL is the remote write endpoint samples are pushed to.
+	URL string
+	// Interval is the interval between two snapshots of the metrics.
+	Interval time.Duration
+	// Timeout is the timeout of a single remote write request.
+	Timeout time.Duration
+	// Shards is the number of queues sending concurrently. Series are
+	// assigned to shards by their labels.
+	Shards int
+	// MaxSamplesPerSend is the maximum number of samples per request.
+	MaxSamplesPerSend int
+	// MaxRetries is the maximum number of retries of a failed request, after
+	// which its samples are dropped.
+	MaxRetries int
+	// ExternalLabels are added to every series, e.g. to identify the cluster.
+	ExternalLabels map[string]string
+}
+
+// WalkFunc calls the given function for each object with its generated metric
+// families.
+type WalkFunc func(f func(collector string, o metricsstore.Object, families []metricsstore.FamilyByteSlicer))
+
+// metrics are the self metrics of the remote write client.
+type metrics struct {
+	samplesTotal    *prometheus.CounterVec
+	retriesTotal    prometheus.Counter
+	requestDuration prometheus.Histogram
+	lastSnapshot    prometheus.Gauge
+}
+
+func newMetrics(r *prometheus.Registry) *metrics {
+	m := &metrics{
+		samplesTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "kube_state_metrics_remote_write_samples_total",
+				Help: "Number of total samples pushed via remote write in kube-state-metrics, by result (success, failure or dropped).",
+			},
+			[]string{"result"},
+		),
+		retriesTotal: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name: "kube_state_metrics_remote_write_retries_total",
+				Help: "Number of total retried remote write requests in kube-state-metrics.",
+			},
+		),
+		requestDuration: prometheus.NewHistogram(
+			prometheus.HistogramOpts{
+				Name:    "kube_state_metrics_remote_write_request_duration_seconds",
+				Help:    "Duration of remote write requests in kube-state-metrics.",
+				Buckets: prometheus.DefBuckets,
+			},
+		),
+		lastSnapshot: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "kube_state_metrics_remote_write_last_snapshot_timestamp_seconds",
+				Help: "Unix timestamp of the last snapshot of the metrics enqueued for remote write in kube-state-metrics.",
+			},
+		),
+	}
+
+	if r != nil {
+		r.MustRegister(
+			m.samplesTotal,
+			m.retriesTotal,
+			m.requestDuration,
+			m.lastSnapshot,
+		)
+	}
+
+	return m
+}
+
+// Writer periodically snapshots the metrics and pushes them via the
+// Prometheus remote write protocol.
+type Writer struct {
+	config  Config
+	walk    WalkFunc
+	client  *http.Client
+	metrics *metrics
+	shards  []chan []*timeSeries
+}
+
+// New returns a new Writer pushing the metrics of the objects walked by walk
+// according to the given config. Its self metrics are registered with the
+// given registry.
+func New(config Config, walk WalkFunc, r *prometheus.Registry) (*Writer, error) {
+	if config.URL == "" {
+		return nil, errors.New("remote write URL must not be empty")
+	}
+	if config.Interval <= 0 {
+		return nil, errors.New("remote write interval must be positive")
+	}
+	if config.Shards < 1 {
+		return nil, errors.New("number of remote write shards must be at least 1")
+	}
+	if config.MaxSamplesPerSend < 1 {
+		return nil, errors.New("maximum number of samples per remote write request must be at least 1")
+	}
+
+	shards := make([]chan []*timeSeries, config.Shards)
+	for i := range shards {
+		shards[i] = make(chan []*timeSeries, queueCapacity)
+	}
+
+	return &Writer{
+		config:  config,
+		walk:    walk,
+		client:  &http.Client{Timeout: config.Timeout},
+		metrics: newMetrics(r),
+		shards:  shards,
+	}, nil
+}
+
+// Run snapshots the metrics on every interval and pushes them until the given
+// context is canceled.
+func (w *Writer) Run(ctx context.Context) {
+	for _, shard := range w.shards {
+		go w.runShard(ctx, shard)
+	}
+
+	ticker := time.NewTicker(w.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.snapshot(time.Now())
+		}
+	}
+}
+
+// snapshot walks the metrics, converts them to time series with samples at
+// the given time and enqueues them in batches to their shards. Batches are
+// dropped if the queue of their shard is full.
+func (w *Writer) snapshot(now time.Time) {
+	timestamp := now.UnixNano() / int64(time.Millisecond)
+	batches := make([][]*timeSeries, len(w.shards))
+
+	w.walk(func(_ string, _ metricsstore.Object, families []metricsstore.FamilyByteSlicer) {
+		for _, family := range metric.Families(families) {
+			for _, m := range family.Metrics {
+				ts := w.timeSeries(family.Name, m, timestamp)
+				i := shardOf(ts, len(w.shards))
+
+				batches[i] = append(batches[i], ts)
+				if len(batches[i]) == w.config.MaxSamplesPerSend {
+					w.enqueue(i, batches[i])
+					batches[i] = nil
+				}
+			}
+		}
+	})
+
+	for i, batch := range batches {
+		if len(batch) > 0 {
+			w.enqueue(i, batch)
+		}
+	}
+
+	w.metrics.lastSnapshot.Set(float64(now.Unix()))
+}
+
+func (w *Writer) enqueue(shard int, batch []*timeSeries) {
+	select {
+	case w.shards[shard] <- batch:
+	default:
+		klog.V(4).Infof("remote write queue of shard %d is full, dropping %d samples", shard, len(batch))
+		w.metrics.samplesTotal.WithLabelValues("dropped").Add(float64(len(batch)))
+	}
+}
+
+// timeSeries converts the given metric of the family with the given name to a
+// time series with a single sample.
+func (w *Writer) timeSeries(name string, m *metric.Metric, timestamp int64) *timeSeries {
+	labels := make([]*label, 0, len(m.LabelKeys)+len(w.config.ExternalLabels)+1)
+	labels = append(labels, &label{Name: "__name__", Value: name})
+
+	seen := map[string]struct{}{}
+	for i, key := range m.LabelKeys {
+		labels = append(labels, &label{Name: key, Value: m.LabelValues[i]})
+		seen[key] = struct{}{}
+	}
+	// Labels of the metric take precedence over external labels, like in
+	// Prometheus.
+	for name, value := range w.config.ExternalLabels {
+		if _, ok := seen[name]; !ok {
+			labels = append(labels, &label{Name: name, Value: value})
+		}
+	}
+	sort.Slice(labels, func(i, j int) bool { return labels[i].Name < labels[j].Name })
+
+	return &timeSeries{
+		Labels:  labels,
+		Samples: []*sample{{Value: m.Value, Timestamp: timestamp}},
+	}
+}
+
+// shardOf returns the shard of the given time series, based on a hash of its
+// sorted labels.
+func shardOf(ts *timeSeries, shards int) int {
+	h := fnv.New64a()
+	for _, l := range ts.Labels {
+		h.Write([]byte(l.Name))
+		h.Write([]byte{0})
+		h.Write([]byte(l.Value))
+		h.Write([]byte{0})
+	}
+
+	return int(h.Sum64() % uint64(shards))
+}
+
+func (w *Writer) runShard(ctx context.Context, queue chan []*timeSeries) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case batch := <-queue:
+			result := "success"
+			if err := w.sendWithRetries(ctx, batch); err != nil {
+				klog.Errorf("failed to push %d samples via remote write: %v", len(batch), err)
+				result = "failure"
+			}
+			w.metrics.samplesTotal.WithLabelValues(result).Add(float64(len(batch)))
+		}
+	}
+}
+
+// sendWithRetries sends the given batch, retrying recoverable errors with an
+// exponential backoff.
+func (w *Writer) sendWithRetries(ctx context.Context, batch []*timeSeries) error {
+	req, err := proto.Marshal(&writeRequest{Timeseries: batch})
+	if err != nil {
+		return errors.Wrap(err, "marshal write request")
+	}
+	compressed := snappy.Encode(nil, req)
+
+	backoff := minBackoff
+	for try := 0; ; try++ {
+		err := w.send(ctx, compressed)
+		if err == nil {
+			return nil
+		}
+
+		if _, ok := err.(recoverableError); !ok || try >= w.config.MaxRetries {
+			return err
+		}
+		klog.V(4).Infof("retrying remote write request after %v: %v", backoff, err)
+		w.metrics.retriesTotal.Inc()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// recoverableError is an error of a request which might succeed when retried.
+type recoverableError struct {
+	error
+}
+
+// send sends a single snappy compressed write request.
+func (w *Writer) send(ctx context.Context, compressed []byte) error {
+	req, err := http.NewRequest(http.MethodPost, w.config.URL, bytes.NewReader(compressed))
+	if err != nil {
+		return errors.Wrap(err, "create request")
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("User-Agent", "kube-state-metrics/"+version.Release)
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+
+	start := time.Now()
+	resp, err := w.client.Do(req)
+	w.metrics.requestDuration.Observe(time.Since(start).Seconds())
+	if err != nil {
+		return recoverableError{err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 == 2 {
+		io.Copy(ioutil.Discard, resp.Body)
+		return nil
+	}
+
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("server returned HTTP status %s: %s", resp.Status, bytes.TrimSpace(body))
+	// Like Prometheus, retry on server errors and rate limiting only.
+	if resp.StatusCode/100 == 5 || resp.StatusCode == http.StatusTooManyRequests {
+		return recoverableError{err}
+	}
+	return err
+}
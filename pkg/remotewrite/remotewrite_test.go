@@ -0,0 +1,314 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package remotewrite
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"k8s.io/apimachinery/pkg/types"
+
+	"k8s.io/kube-state-metrics/pkg/metric"
+	metricsstore "k8s.io/kube-state-metrics/pkg/metrics_store"
+)
+
+func testWalk(f func(collector string, o metricsstore.Object, families []metricsstore.FamilyByteSlicer)) {
+	for _, pod := range []string{"pod0", "pod1"} {
+		families := []metricsstore.FamilyByteSlicer{
+			&metric.Family{
+				Name: "kube_pod_info",
+				Type: metric.Gauge,
+				Metrics: []*metric.Metric{{
+					LabelKeys:   []string{"namespace", "pod", "node"},
+					LabelValues: []string{"default", pod, "node1"},
+					Value:       1,
+				}},
+			},
+			&metric.Family{
+				Name: "kube_pod_container_status_restarts_total",
+				Type: metric.Counter,
+			},
+		}
+		if pod == "pod0" {
+			families[1].(*metric.Family).Metrics = []*metric.Metric{{
+				LabelKeys:   []string{"namespace", "pod", "container", "cluster"},
+				LabelValues: []string{"default", pod, "c", "inner"},
+				Value:       3,
+			}}
+		}
+		f("pods", metricsstore.Object{UID: types.UID("uid-" + pod), Namespace: "default", Name: pod}, families)
+	}
+}
+
+// receiver is a remote write receiver recording the received series.
+type receiver struct {
+	mtx    sync.Mutex
+	series []*timeSeries
+	// statuses are the status codes of the next responses, 200 if empty.
+	statuses []int
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rc.mtx.Lock()
+	defer rc.mtx.Unlock()
+
+	if len(rc.statuses) > 0 {
+		status := rc.statuses[0]
+		rc.statuses = rc.statuses[1:]
+		if status != http.StatusOK {
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+	}
+
+	if r.Header.Get("Content-Encoding") != "snappy" || r.Header.Get("Content-Type") != "application/x-protobuf" {
+		http.Error(w, "unexpected headers", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	compressed, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	b, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	req := &writeRequest{}
+	if err := proto.Unmarshal(b, req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rc.series = append(rc.series, req.Timeseries...)
+}
+
+func (rc *receiver) received() []*timeSeries {
+	rc.mtx.Lock()
+	defer rc.mtx.Unlock()
+
+	return append([]*timeSeries{}, rc.series...)
+}
+
+func newTestWriter(t *testing.T, url string, shards int) (*Writer, context.CancelFunc) {
+	w, err := New(Config{
+		URL:               url,
+		Interval:          time.Hour,
+		Timeout:           time.Second,
+		Shards:            shards,
+		MaxSamplesPerSend: 2,
+		MaxRetries:        2,
+		ExternalLabels:    map[string]string{"cluster": "edge"},
+	}, testWalk, prometheus.NewRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	for _, shard := range w.shards {
+		go w.runShard(ctx, shard)
+	}
+
+	return w, cancel
+}
+
+func TestWriter(t *testing.T) {
+	rc := &receiver{}
+	server := httptest.NewServer(rc)
+	defer server.Close()
+
+	w, cancel := newTestWriter(t, server.URL, 3)
+	defer cancel()
+
+	now := time.Unix(1500000000, 0)
+	w.snapshot(now)
+	waitForSamples(t, w, "success", 3)
+
+	got := rc.received()
+	sort.Slice(got, func(i, j int) bool { return got[i].String() < got[j].String() })
+
+	timestamp := now.UnixNano() / int64(time.Millisecond)
+	want := []*timeSeries{
+		{
+			Labels: []*label{
+				{Name: "__name__", Value: "kube_pod_container_status_restarts_total"},
+				{Name: "cluster", Value: "inner"},
+				{Name: "container", Value: "c"},
+				{Name: "namespace", Value: "default"},
+				{Name: "pod", Value: "pod0"},
+			},
+			Samples: []*sample{{Value: 3, Timestamp: timestamp}},
+		},
+		{
+			Labels: []*label{
+				{Name: "__name__", Value: "kube_pod_info"},
+				{Name: "cluster", Value: "edge"},
+				{Name: "namespace", Value: "default"},
+				{Name: "node", Value: "node1"},
+				{Name: "pod", Value: "pod0"},
+			},
+			Samples: []*sample{{Value: 1, Timestamp: timestamp}},
+		},
+		{
+			Labels: []*label{
+				{Name: "__name__", Value: "kube_pod_info"},
+				{Name: "cluster", Value: "edge"},
+				{Name: "namespace", Value: "default"},
+				{Name: "node", Value: "node1"},
+				{Name: "pod", Value: "pod1"},
+			},
+			Samples: []*sample{{Value: 1, Timestamp: timestamp}},
+		},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected series:\n%v\nbut got:\n%v", want, got)
+	}
+}
+
+func TestWriterRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		result   string
+		retries  float64
+	}{
+		{
+			name:     "recoverable errors",
+			statuses: []int{http.StatusInternalServerError, http.StatusTooManyRequests},
+			result:   "success",
+			retries:  2,
+		},
+		{
+			name:     "too many recoverable errors",
+			statuses: []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable},
+			result:   "failure",
+			retries:  2,
+		},
+		{
+			name:     "unrecoverable error",
+			statuses: []int{http.StatusBadRequest},
+			result:   "failure",
+			retries:  0,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rc := &receiver{statuses: test.statuses}
+			server := httptest.NewServer(rc)
+			defer server.Close()
+
+			// A single shard and batch keeps the number of requests
+			// deterministic.
+			w, cancel := newTestWriter(t, server.URL, 1)
+			defer cancel()
+			w.config.MaxSamplesPerSend = 10
+
+			w.snapshot(time.Now())
+			waitForSamples(t, w, test.result, 3)
+
+			if got := counterValue(t, w.metrics.retriesTotal); got != test.retries {
+				t.Errorf("expected %v retries but got %v", test.retries, got)
+			}
+		})
+	}
+}
+
+func TestWriterDropsSamplesOfFullQueue(t *testing.T) {
+	w, err := New(Config{
+		URL:               "http://localhost",
+		Interval:          time.Hour,
+		Shards:            1,
+		MaxSamplesPerSend: 1,
+	}, testWalk, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Without running shards, the queue fills up.
+	for i := 0; i < queueCapacity; i++ {
+		w.snapshot(time.Now())
+	}
+
+	want := float64(3*queueCapacity - queueCapacity)
+	if got := counterValue(t, w.metrics.samplesTotal.WithLabelValues("dropped")); got != want {
+		t.Errorf("expected %v dropped samples but got %v", want, got)
+	}
+}
+
+func TestNewValidatesConfig(t *testing.T) {
+	valid := Config{URL: "http://localhost", Interval: time.Second, Shards: 1, MaxSamplesPerSend: 1}
+
+	invalid := []func(c *Config){
+		func(c *Config) { c.URL = "" },
+		func(c *Config) { c.Interval = 0 },
+		func(c *Config) { c.Shards = 0 },
+		func(c *Config) { c.MaxSamplesPerSend = 0 },
+	}
+
+	if _, err := New(valid, nil, nil); err != nil {
+		t.Errorf("expected valid config, got %v", err)
+	}
+	for i, modify := range invalid {
+		c := valid
+		modify(&c)
+		if _, err := New(c, nil, nil); err == nil {
+			t.Errorf("config %d: expected error", i)
+		}
+	}
+}
+
+func waitForSamples(t *testing.T, w *Writer, result string, want float64) {
+	t.Helper()
+
+	var got float64
+	for i := 0; i < 100; i++ {
+		if got = counterValue(t, w.metrics.samplesTotal.WithLabelValues(result)); got >= want {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	if got != want {
+		t.Fatalf("expected %v samples with result %v but got %v", want, result, got)
+	}
+}
+
+func counterValue(t *testing.T, c prometheus.Counter) float64 {
+	t.Helper()
+
+	m := &dto.Metric{}
+	if err := c.Write(m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetCounter().GetValue()
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package runtimeconfig loads the part of the configuration of
+// kube-state-metrics that can be changed at runtime from a YAML file and
+// watches the file for changes.
+package runtimeconfig
+
+import (
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+	"sigs.k8s.io/yaml"
+
+	"k8s.io/kube-state-metrics/pkg/options"
+)
+
+// Config is the configuration of kube-state-metrics that can be changed at
+// runtime. Fields which are set override the corresponding command line
+// flags, the flags apply to the fields which are not set.
+type Config struct {
+	// Collectors are the enabled collectors, see --collectors.
+	Collectors []string `json:"collectors,omitempty"`
+	// Namespaces are the namespaces to watch, see --namespace.
+	Namespaces []string `json:"namespaces,omitempty"`
+	// MetricWhitelist are the metrics to expose, see --metric-whitelist.
+	MetricWhitelist []string `json:"metricWhitelist,omitempty"`
+	// MetricBlacklist are the metrics not to expose, see
+	// --metric-blacklist.
+	MetricBlacklist []string `json:"metricBlacklist,omitempty"`
+	// Selectors restrict the objects listed and watched by the given
+	// collectors server-side, e.g. pods: {labelSelector: team=platform}.
+	// They can only be set by the configuration file.
+	Selectors map[string]options.ListSelector `json:"selectors,omitempty"`
+}
+
+// Load reads the configuration from the YAML file at the given path.
+func Load(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "read config")
+	}
+
+	return Parse(data)
+}
+
+// Parse parses the given YAML configuration.
+func Parse(data []byte) (*Config, error) {
+	c := &Config{}
+	if err := yaml.UnmarshalStrict(data, c); err != nil {
+		return nil, errors.Wrap(err, "parse config")
+	}
+	return c, nil
+}
+
+// Apply returns a copy of the given options with the fields set in the
+// configuration overriding the corresponding options. As the metric
+// whitelist and blacklist are mutually exclusive, setting either of them
+// overrides both.
+func (c *Config) Apply(o *options.Options) *options.Options {
+	applied := *o
+	if c.Collectors != nil {
+		applied.Collectors = options.CollectorSet{}
+		for _, col := range c.Collectors {
+			applied.Collectors[col] = struct{}{}
+		}
+	}
+	if c.Namespaces != nil {
+		applied.Namespaces = append(options.NamespaceList{}, c.Namespaces...)
+	}
+	if c.MetricWhitelist != nil || c.MetricBlacklist != nil {
+		applied.MetricWhitelist = metricSet(c.MetricWhitelist)
+		applied.MetricBlacklist = metricSet(c.MetricBlacklist)
+	}
+	return &applied
+}
+
+func metricSet(metrics []string) options.MetricSet {
+	s := options.MetricSet{}
+	for _, m := range metrics {
+		s[m] = struct{}{}
+	}
+	return s
+}
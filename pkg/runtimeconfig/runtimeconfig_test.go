@@ -0,0 +1,120 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtimeconfig
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/kube-state-metrics/pkg/options"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		desc    string
+		data    string
+		want    *Config
+		wantErr bool
+	}{
+		{
+			desc: "all fields",
+			data: `
+collectors: [pods, nodes]
+namespaces: [default]
+metricBlacklist: [kube_pod_labels]
+selectors:
+  pods:
+    labelSelector: team=platform
+    fieldSelector: status.phase!=Succeeded
+`,
+			want: &Config{
+				Collectors:      []string{"pods", "nodes"},
+				Namespaces:      []string{"default"},
+				MetricBlacklist: []string{"kube_pod_labels"},
+				Selectors: map[string]options.ListSelector{
+					"pods": {
+						LabelSelector: "team=platform",
+						FieldSelector: "status.phase!=Succeeded",
+					},
+				},
+			},
+		},
+		{
+			desc: "empty",
+			data: "",
+			want: &Config{},
+		},
+		{
+			desc:    "unknown field",
+			data:    "collector: [pods]",
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		got, err := Parse([]byte(test.data))
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected error", test.desc)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.desc, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: expected %+v but got %+v", test.desc, test.want, got)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	opts := &options.Options{
+		Collectors:      options.CollectorSet{"pods": struct{}{}},
+		Namespaces:      options.NamespaceList{"default"},
+		MetricWhitelist: options.MetricSet{},
+		MetricBlacklist: options.MetricSet{"kube_pod_labels": struct{}{}},
+		Port:            8080,
+	}
+
+	c := &Config{
+		Collectors:      []string{"nodes", "services"},
+		MetricWhitelist: []string{"kube_node_info"},
+	}
+	got := c.Apply(opts)
+
+	want := &options.Options{
+		Collectors:      options.CollectorSet{"nodes": struct{}{}, "services": struct{}{}},
+		Namespaces:      options.NamespaceList{"default"},
+		MetricWhitelist: options.MetricSet{"kube_node_info": struct{}{}},
+		MetricBlacklist: options.MetricSet{},
+		Port:            8080,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %+v but got %+v", want, got)
+	}
+
+	// The given options are not modified.
+	if _, ok := opts.Collectors["pods"]; !ok || len(opts.Collectors) != 1 {
+		t.Errorf("expected given options to be unchanged, got collectors %v", opts.Collectors.String())
+	}
+
+	if got := (&Config{}).Apply(opts); !reflect.DeepEqual(got, opts) {
+		t.Errorf("expected empty config not to override options, got %+v", got)
+	}
+}
@@ -0,0 +1,160 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtimeconfig
+
+import (
+	"context"
+	"crypto/sha256"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/klog"
+)
+
+// Watcher reloads the configuration from a file whenever the file changes or
+// the process receives SIGHUP.
+type Watcher struct {
+	path string
+	// sum is the checksum of the content of the file last loaded, changes
+	// of the file not changing its content are ignored.
+	sum [sha256.Size]byte
+
+	lastReloadSuccess     prometheus.Gauge
+	lastReloadSuccessTime prometheus.Gauge
+}
+
+// NewWatcher creates a Watcher of the configuration file at the given path and
+// registers its metrics with the given registry.
+func NewWatcher(path string, r *prometheus.Registry) *Watcher {
+	w := &Watcher{
+		path: path,
+		lastReloadSuccess: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "kube_state_metrics_config_last_reload_success",
+				Help: "Whether the last reload of the configuration file of kube-state-metrics succeeded.",
+			},
+		),
+		lastReloadSuccessTime: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "kube_state_metrics_config_last_reload_success_timestamp_seconds",
+				Help: "Unix timestamp of the last successful reload of the configuration file of kube-state-metrics.",
+			},
+		),
+	}
+	if r != nil {
+		r.MustRegister(w.lastReloadSuccess, w.lastReloadSuccessTime)
+	}
+	return w
+}
+
+// Load loads the configuration from the file, e.g. on start, counting as a
+// reload.
+func (w *Watcher) Load() (*Config, error) {
+	c, _, err := w.load(true)
+	w.observe(err)
+	return c, err
+}
+
+// Run watches the directory of the configuration file, so that the file can be
+// replaced, e.g. by updating a mounted ConfigMap, and for SIGHUP until the
+// given context is done. The configuration is loaded and passed to apply
+// whenever the content of the file changes or on SIGHUP. If loading or
+// applying it fails, the previous configuration is expected to stay in
+// effect.
+func (w *Watcher) Run(ctx context.Context, apply func(*Config) error) error {
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return errors.Wrap(err, "create file watcher")
+	}
+	defer fsw.Close()
+	if err := fsw.Add(filepath.Dir(w.path)); err != nil {
+		return errors.Wrapf(err, "watch directory of %s", w.path)
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-hup:
+			klog.Infof("Received SIGHUP, reloading config from %s", w.path)
+			w.reload(apply, true)
+		case <-fsw.Events:
+			w.reload(apply, false)
+		case err := <-fsw.Errors:
+			klog.Warningf("Failed to watch config %s: %v", w.path, err)
+		}
+	}
+}
+
+// reload loads the configuration and applies it. Unless forced, it is only
+// applied if the content of the file changed and the file not missing, as it
+// is missing while being replaced.
+func (w *Watcher) reload(apply func(*Config) error, force bool) {
+	c, changed, err := w.load(force)
+	if err == nil && !changed {
+		return
+	}
+	if os.IsNotExist(errors.Cause(err)) && !force {
+		return
+	}
+	if err == nil {
+		err = apply(c)
+	}
+	if err == nil {
+		klog.Infof("Reloaded config from %s", w.path)
+	}
+	w.observe(err)
+}
+
+// load reads and parses the configuration file. Unless forced, it only parses
+// the file if its content changed since it was last loaded.
+func (w *Watcher) load(force bool) (*Config, bool, error) {
+	data, err := ioutil.ReadFile(w.path)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "read config")
+	}
+
+	sum := sha256.Sum256(data)
+	if sum == w.sum && !force {
+		return nil, false, nil
+	}
+	w.sum = sum
+
+	c, err := Parse(data)
+	return c, true, err
+}
+
+// observe updates the metrics of the Watcher with the result of a reload.
+func (w *Watcher) observe(err error) {
+	if err != nil {
+		klog.Errorf("Failed to load config from %s: %v", w.path, err)
+		w.lastReloadSuccess.Set(0)
+		return
+	}
+	w.lastReloadSuccess.Set(1)
+	w.lastReloadSuccessTime.SetToCurrentTime()
+}
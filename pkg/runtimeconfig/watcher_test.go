@@ -0,0 +1,134 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package runtimeconfig
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestWatcher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "runtimeconfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.yaml")
+	writeConfig(t, path, "collectors: [pods]")
+
+	w := NewWatcher(path, nil)
+	c, err := w.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(c.Collectors, []string{"pods"}) {
+		t.Fatalf("expected collectors [pods] but got %v", c.Collectors)
+	}
+	expectReloadSuccess(t, w, 1)
+
+	applied := make(chan *Config)
+	errs := make(chan error, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error)
+	go func() {
+		done <- w.Run(ctx, func(c *Config) error {
+			applied <- c
+			return <-errs
+		})
+	}()
+
+	// Give the watcher time to start watching the directory.
+	time.Sleep(100 * time.Millisecond)
+
+	// The config is applied when the file changes.
+	errs <- nil
+	writeConfig(t, path, "collectors: [nodes]")
+	c = expectApplied(t, applied)
+	if !reflect.DeepEqual(c.Collectors, []string{"nodes"}) {
+		t.Errorf("expected collectors [nodes] but got %v", c.Collectors)
+	}
+	expectReloadSuccess(t, w, 1)
+
+	// An invalid config is not applied.
+	writeConfig(t, path, "collector: [nodes]")
+	time.Sleep(100 * time.Millisecond)
+	select {
+	case c := <-applied:
+		t.Errorf("expected invalid config not to be applied, got %+v", c)
+	default:
+	}
+	expectReloadSuccess(t, w, 0)
+
+	// A config failing to be applied is reported.
+	errs <- context.DeadlineExceeded
+	writeConfig(t, path, "collectors: [services]")
+	expectApplied(t, applied)
+	time.Sleep(100 * time.Millisecond)
+	expectReloadSuccess(t, w, 0)
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("expected context.Canceled but got %v", err)
+	}
+}
+
+func writeConfig(t *testing.T, path, data string) {
+	t.Helper()
+
+	// The file is replaced like an updated ConfigMap, so that the watcher
+	// never reads a partially written file.
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func expectApplied(t *testing.T, applied chan *Config) *Config {
+	t.Helper()
+
+	select {
+	case c := <-applied:
+		return c
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the config to be applied")
+		return nil
+	}
+}
+
+func expectReloadSuccess(t *testing.T, w *Watcher, want float64) {
+	t.Helper()
+
+	metric := &dto.Metric{}
+	if err := w.lastReloadSuccess.Write(metric); err != nil {
+		t.Fatal(err)
+	}
+	if got := metric.GetGauge().GetValue(); got != want {
+		t.Errorf("expected last reload success %v but got %v", want, got)
+	}
+}
@@ -0,0 +1,146 @@
+/*
+Copyright 2019 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/klog"
+)
+
+// New returns a TLS config for a server presenting the certificate in the
+// given files. The certificate is reloaded on the first handshake after
+// either file changed, allowing certificates to be rotated without a restart.
+// If clientCAFile is not empty, client certificates are requested and, if
+// given, verified against the CA bundle in the file. Requests without a
+// client certificate are not rejected by the TLS config.
+func New(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	if certFile == "" || keyFile == "" {
+		return nil, errors.New("both a certificate and a private key file are required")
+	}
+
+	r := &certReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+
+	config := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: r.getCertificate,
+	}
+
+	if clientCAFile != "" {
+		pem, err := ioutil.ReadFile(clientCAFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "read client CA file")
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.Errorf("no certificates found in client CA file %s", clientCAFile)
+		}
+
+		config.ClientCAs = pool
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	return config, nil
+}
+
+// certReloader loads a certificate and private key from files and reloads
+// them whenever the modification time of either file changes.
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	// mtx protects cert and modTime
+	mtx     sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+func (r *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	modTime, err := r.latestModTime()
+	if err != nil {
+		klog.Errorf("failed to check TLS certificate for changes: %v", err)
+	}
+
+	r.mtx.Lock()
+	changed := err == nil && !modTime.Equal(r.modTime)
+	r.mtx.Unlock()
+
+	if changed {
+		// Keep serving the previous certificate, e.g. if only one of the
+		// files was updated yet.
+		if err := r.reload(); err != nil {
+			klog.Errorf("failed to reload TLS certificate: %v", err)
+		}
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return r.cert, nil
+}
+
+// reload loads the certificate and private key from their files.
+func (r *certReloader) reload() error {
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return errors.Wrap(err, "load certificate and private key")
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.cert = &cert
+	r.modTime = modTime
+
+	klog.Infof("loaded TLS certificate from %s", r.certFile)
+	return nil
+}
+
+// latestModTime returns the latest modification time of the certificate and
+// private key file.
+func (r *certReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+
+	for _, file := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, errors.Wrap(err, "stat certificate file")
+		}
+
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+
+	return latest, nil
+}